@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// JSON line of the access log
+type accessEntry struct {
+	Time      string  `json:"time"`
+	Path      string  `json:"path"`
+	Peer      string  `json:"peer"`
+	Client    string  `json:"client,omitempty"` // authenticated client name
+	IP        string  `json:"ip,omitempty"`
+	Items     int     `json:"items,omitempty"` // batch requests
+	Status    int     `json:"status"`
+	IsProxy   *int8   `json:"isProxy,omitempty"`
+	ProxyType string  `json:"proxyType,omitempty"`
+	Country   string  `json:"countryCode,omitempty"`
+	Decision  string  `json:"decision,omitempty"`
+	Source    string  `json:"source,omitempty"` // bin or webservice
+	Cached    bool    `json:"cached"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// access log writing one JSON, CEF or LEEF line per request; the successful allowed requests are sampled,
+// the denied and failed requests are always logged
+type accessLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // nil for the standard output
+	sample float64
+	redact ip2proxy.Redactor
+	siem   func(e ip2proxy.SIEMEvent) string // nil for JSON
+}
+
+// open the access log at the path, - for the standard output; nil if the path is empty
+func openAccessLog(path string, format string, sample float64, redact ip2proxy.Redactor) (*accessLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	var l = &accessLog{}
+	l.sample = sample
+	l.redact = redact
+	switch format {
+	case "", "json":
+	case "cef":
+		l.siem = ip2proxy.FormatCEF
+	case "leef":
+		l.siem = ip2proxy.FormatLEEF
+	default:
+		return nil, errors.New("-access-log-format must be json, cef or leef")
+	}
+	if path == "-" {
+		l.w = os.Stdout
+		return l, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	l.w = f
+	l.closer = f
+	return l, nil
+}
+
+func (l *accessLog) log(e *accessEntry, started time.Time) {
+	if l == nil {
+		return
+	}
+	if e.Status < 300 && e.Decision != "deny" && e.Decision != "challenge" && l.sample < 1 && rand.Float64() >= l.sample {
+		return
+	}
+
+	e.IP = redactIP(l.redact, e.IP)
+	e.Peer = redactIP(l.redact, e.Peer)
+	e.Time = started.UTC().Format(time.RFC3339Nano)
+	e.LatencyMs = float64(time.Since(started).Microseconds()) / 1000
+	var b []byte
+	if l.siem != nil {
+		b = append([]byte(l.siem(e.siemEvent(started))), '\n')
+	} else {
+		var err error
+		if b, err = json.Marshal(e); err != nil {
+			return
+		}
+		b = append(b, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(b); err != nil {
+		log.Printf("access log: %v", err)
+	}
+}
+
+// close the file once the requests still using it are done
+func (l *accessLog) closeLater() {
+	if l == nil || l.closer == nil {
+		return
+	}
+	time.AfterFunc(time.Minute, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		_ = l.closer.Close()
+	})
+}
+
+type clientNameKey struct{}
+
+// attach the name of the authenticated client for the access log
+func withClientName(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientNameKey{}, name))
+}
+
+func clientName(r *http.Request) string {
+	name, _ := r.Context().Value(clientNameKey{}).(string)
+	return name
+}
+
+// entry for a request, completed by the handler
+func newAccessEntry(r *http.Request) *accessEntry {
+	return &accessEntry{Path: r.URL.Path, Peer: remoteHost(r.RemoteAddr), Client: clientName(r)}
+}
+
+// fill in the summary of a lookup response
+func (e *accessEntry) result(res lookupResponse) {
+	isProxy := res.IsProxy
+	e.IsProxy = &isProxy
+	e.ProxyType = res.ProxyType
+	e.Country = res.CountryCode
+}
+
+// the entry as a CEF or LEEF event; the lookups of the requests without decision are plain lookups
+func (e *accessEntry) siemEvent(started time.Time) ip2proxy.SIEMEvent {
+	var ev = ip2proxy.SIEMEvent{Time: started, ClientIP: e.IP, Request: e.Path}
+	if e.IsProxy != nil {
+		ev.Record.IsProxy = *e.IsProxy
+	}
+	ev.Record.ProxyType = e.ProxyType
+	ev.Record.CountryShort = e.Country
+	switch e.Decision {
+	case "allow":
+		ev.Decision = ip2proxy.DecisionAllow
+	case "deny":
+		ev.Decision = ip2proxy.DecisionDeny
+	case "challenge":
+		ev.Decision = ip2proxy.DecisionChallenge
+	}
+	return ev
+}
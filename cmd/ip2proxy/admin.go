@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// counters of the daemon reported by /admin/stats
+type serverStats struct {
+	// accessed atomically, kept first for 64-bit alignment
+	lookups     uint64
+	wsFallbacks uint64
+
+	started time.Time
+	window  *ip2proxy.StatsWindow // of the BIN file lookups
+}
+
+// minutes aggregated by the window of /admin/stats
+const statsWindowMinutes = 5
+
+type versionResponse struct {
+	DatabaseVersion string `json:"databaseVersion"`
+	PackageVersion  string `json:"packageVersion"`
+	ModuleVersion   string `json:"moduleVersion"`
+	Generation      uint64 `json:"generation"`
+}
+
+type statsResponse struct {
+	versionResponse
+	UptimeSeconds int64                 `json:"uptimeSeconds"`
+	Lookups       uint64                `json:"lookups"`
+	WSFallbacks   uint64                `json:"webServiceFallbacks"`
+	DecisionCache decisionCacheResponse `json:"decisionCache"`
+	Window        windowResponse        `json:"window"`
+}
+
+type windowResponse struct {
+	Seconds           float64 `json:"seconds"`
+	Lookups           uint64  `json:"lookups"`
+	Errors            uint64  `json:"errors"`
+	PerMinute         float64 `json:"perMinute"`
+	ProxyRatio        float64 `json:"proxyRatio"`
+	LatencyP50Seconds float64 `json:"latencyP50Seconds"`
+	LatencyP99Seconds float64 `json:"latencyP99Seconds"`
+}
+
+type decisionCacheResponse struct {
+	Enabled   bool   `json:"enabled"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+type selfTestResponse struct {
+	OK         bool     `json:"ok"`
+	Checked    int      `json:"checked"`
+	Mismatches []string `json:"mismatches"`
+}
+
+type shadowResponse struct {
+	Filter         string          `json:"filter"`
+	Lookups        uint64          `json:"lookups"`
+	WouldDeny      uint64          `json:"wouldDeny"`
+	WouldBlockRate float64         `json:"wouldBlockRate"`
+	NewlyDenied    uint64          `json:"newlyDenied"`
+	NewlyAllowed   uint64          `json:"newlyAllowed"`
+	Examples       []shadowExample `json:"examples"`
+}
+
+type shadowExample struct {
+	IP        string `json:"ip"`
+	ProxyType string `json:"proxyType"`
+	UsageType string `json:"usageType"`
+	Country   string `json:"countryCode"`
+	Decision  string `json:"decision"`
+	Enforced  string `json:"enforced"`
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// admin endpoints for orchestration tooling, only served with an admin token
+func (s *server) adminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/version", s.admin(http.MethodGet, s.handleAdminVersion))
+	mux.HandleFunc("/admin/stats", s.admin(http.MethodGet, s.handleAdminStats))
+	mux.HandleFunc("/admin/reload", s.admin(http.MethodPost, s.handleAdminReload))
+	mux.HandleFunc("/admin/reload-config", s.admin(http.MethodPost, s.handleAdminReloadConfig))
+	mux.HandleFunc("/admin/cache/flush", s.admin(http.MethodPost, s.handleAdminFlush))
+	mux.HandleFunc("/admin/selftest", s.admin(http.MethodPost, s.handleAdminSelfTest))
+	mux.HandleFunc("/admin/shadow", s.admin(http.MethodGet, s.handleAdminShadow))
+}
+
+// check the method and the bearer token of the current configuration; without token the endpoints do not exist
+func (s *server) admin(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.current().settings.adminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ip2proxy admin"`)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid admin token"})
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) version() versionResponse {
+	return versionResponse{
+		DatabaseVersion: s.db.DatabaseVersion(),
+		PackageVersion:  s.db.PackageVersion(),
+		ModuleVersion:   ip2proxy.ModuleVersion(),
+		Generation:      s.db.Generation(),
+	}
+}
+
+func (s *server) handleAdminVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.version())
+}
+
+func (s *server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	cs := st.mw.DecisionCacheStats()
+	ws := s.stats.window.Stats()
+	writeJSON(w, http.StatusOK, statsResponse{
+		versionResponse: s.version(),
+		UptimeSeconds:   int64(time.Since(s.stats.started).Seconds()),
+		Lookups:         atomic.LoadUint64(&s.stats.lookups),
+		WSFallbacks:     atomic.LoadUint64(&s.stats.wsFallbacks),
+		DecisionCache: decisionCacheResponse{
+			Enabled:   st.settings.cacheTTL > 0,
+			Hits:      cs.Hits,
+			Misses:    cs.Misses,
+			Evictions: cs.Evictions,
+			Entries:   cs.Entries,
+		},
+		Window: windowResponse{
+			Seconds:           ws.Window.Seconds(),
+			Lookups:           ws.Lookups,
+			Errors:            ws.Errors,
+			PerMinute:         ws.PerMinute,
+			ProxyRatio:        ws.ProxyRatio,
+			LatencyP50Seconds: ws.P50.Seconds(),
+			LatencyP99Seconds: ws.P99.Seconds(),
+		},
+	})
+}
+
+// reopen the BIN file
+func (s *server) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.reloadDB(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.version())
+}
+
+func (s *server) handleAdminReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if err := s.reloadConfig(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, statusResponse{Status: "reloaded"})
+}
+
+// drop the cached decisions by switching to a fresh state with the same settings
+func (s *server) handleAdminFlush(w http.ResponseWriter, r *http.Request) {
+	st, err := s.newState(s.current().settings)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	s.setState(st)
+	writeJSON(w, http.StatusOK, statusResponse{Status: "flushed"})
+}
+
+// check the loaded BIN file against the known answers of the verify command; 503 on mismatch
+func (s *server) handleAdminSelfTest(w http.ResponseWriter, r *http.Request) {
+	answers, err := ip2proxy.ParseKnownAnswers(bytes.NewReader(knownAnswers))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	mismatches, checked, err := s.db.VerifyKnownAnswers(answers)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+		return
+	}
+
+	res := selfTestResponse{OK: len(mismatches) == 0, Checked: checked, Mismatches: []string{}}
+	for _, m := range mismatches {
+		res.Mismatches = append(res.Mismatches, m.String())
+	}
+	code := http.StatusOK
+	if !res.OK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, res)
+}
+
+// counters and sample disagreements of -shadow-filter since the last configuration reload; 404 without it
+func (s *server) handleAdminShadow(w http.ResponseWriter, r *http.Request) {
+	shadow := s.current().shadow
+	if shadow == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no shadow filter"})
+		return
+	}
+
+	st := shadow.Stats()
+	resp := shadowResponse{
+		Filter:         st.Name,
+		Lookups:        st.Lookups,
+		WouldDeny:      st.WouldDeny,
+		WouldBlockRate: st.WouldBlockRate(),
+		NewlyDenied:    st.NewlyDenied,
+		NewlyAllowed:   st.NewlyAllowed,
+		Examples:       []shadowExample{},
+	}
+	for _, e := range st.Examples {
+		resp.Examples = append(resp.Examples, shadowExample{
+			IP:        e.ClientIP,
+			ProxyType: e.Record.ProxyType,
+			UsageType: e.Record.UsageType,
+			Country:   e.Record.CountryShort,
+			Decision:  e.Shadow.String(),
+			Enforced:  e.Enforced.String(),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
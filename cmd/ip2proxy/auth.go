@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The clients file of -auth-clients lists the clients allowed on the lookup endpoints, one per line:
+//
+//	# name   secret                            requests/s  burst
+//	team-a   4f1c2a9e0b7d48e6a1f3c5d7e9b0a2c4  100         200
+//	team-b   0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a  0
+//
+// A rate of 0 means no limit; the burst defaults to the rate. Clients authenticate either with
+// "Authorization: Bearer <secret>" or, without sending the secret, with
+//
+//	Authorization: IP2Proxy-HMAC <name>:<unix time>:<hex HMAC-SHA256 of "<method>\n<request URI>\n<unix time>">
+//
+// signed less than hmacMaxSkew ago.
+
+// maximum difference between the time of an HMAC signature and the server time
+const hmacMaxSkew = 5 * time.Minute
+
+// a client of the clients file
+type authClient struct {
+	name   string
+	secret string
+	bucket *tokenBucket // nil without limit
+}
+
+// the clients of the lookup endpoints, by name
+type authClients map[string]*authClient
+
+func loadAuthClients(path string) (authClients, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	clients := make(authClients)
+	in := bufio.NewScanner(f)
+	for n := 1; in.Scan(); n++ {
+		fields := strings.Fields(stripComment(in.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("%s:%d: expected name, secret, rate and burst", path, n)
+		}
+
+		c := &authClient{name: fields[0], secret: fields[1]}
+		if _, ok := clients[c.name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate client %s", path, n, c.name)
+		}
+		if len(c.secret) < 16 {
+			return nil, fmt.Errorf("%s:%d: secret of %s shorter than 16 characters", path, n, c.name)
+		}
+
+		rate, burst := 0.0, 0.0
+		if len(fields) > 2 {
+			if rate, err = strconv.ParseFloat(fields[2], 64); err != nil || rate < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid rate %s", path, n, fields[2])
+			}
+			burst = rate
+		}
+		if len(fields) > 3 {
+			if burst, err = strconv.ParseFloat(fields[3], 64); err != nil || burst < 1 {
+				return nil, fmt.Errorf("%s:%d: invalid burst %s", path, n, fields[3])
+			}
+		}
+		if rate > 0 {
+			c.bucket = newTokenBucket(rate, math.Max(burst, 1))
+		}
+		clients[c.name] = c
+	}
+	return clients, in.Err()
+}
+
+// take over the buckets of the clients with unchanged limits, so that a reload does not reset them
+func (cs authClients) keepBuckets(old authClients) {
+	for name, c := range cs {
+		o, ok := old[name]
+		if ok && c.bucket != nil && o.bucket != nil && c.bucket.rate == o.bucket.rate && c.bucket.burst == o.bucket.burst {
+			c.bucket = o.bucket
+		}
+	}
+}
+
+// the client authenticated by the request, nil if none; a bearer secret is compared with every client
+func (cs authClients) authenticate(r *http.Request, now time.Time) *authClient {
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, "Bearer "):
+		secret := []byte(strings.TrimPrefix(auth, "Bearer "))
+		var found *authClient
+		for _, c := range cs {
+			if subtle.ConstantTimeCompare(secret, []byte(c.secret)) == 1 {
+				found = c
+			}
+		}
+		return found
+
+	case strings.HasPrefix(auth, "IP2Proxy-HMAC "):
+		parts := strings.Split(strings.TrimPrefix(auth, "IP2Proxy-HMAC "), ":")
+		if len(parts) != 3 {
+			return nil
+		}
+		c, ok := cs[parts[0]]
+		if !ok {
+			return nil
+		}
+		ts, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		if skew := now.Sub(time.Unix(ts, 0)); skew > hmacMaxSkew || skew < -hmacMaxSkew {
+			return nil
+		}
+		sig, err := hex.DecodeString(parts[2])
+		if err != nil {
+			return nil
+		}
+		mac := hmac.New(sha256.New, []byte(c.secret))
+		mac.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + parts[1]))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil
+		}
+		return c
+	}
+	return nil
+}
+
+// require an authenticated client within its rate limit; every request passes without clients file
+func (s *server) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := s.current()
+		if st.authClients == nil {
+			h(w, r)
+			return
+		}
+
+		started := time.Now()
+		c := st.authClients.authenticate(r, started)
+		if c == nil {
+			e := newAccessEntry(r)
+			e.Status, e.Error = http.StatusUnauthorized, "authentication required"
+			st.accessLog.log(e, started)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ip2proxy"`)
+			writeJSON(w, e.Status, errorResponse{Error: e.Error})
+			return
+		}
+		r = withClientName(r, c.name)
+		if c.bucket != nil {
+			if wait := c.bucket.take(started); wait > 0 {
+				e := newAccessEntry(r)
+				e.Status, e.Error = http.StatusTooManyRequests, "rate limit exceeded"
+				st.accessLog.log(e, started)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeJSON(w, e.Status, errorResponse{Error: e.Error})
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// token bucket rate limiter
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst}
+}
+
+// take a token, or return how long until one is available
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// limits of a batch request
+const batchMaxItems = 100000
+const batchMaxBytes = 32 << 20
+
+// concurrent lookups of a batch request
+const batchWorkers = 8
+
+// a line of the batch response: the lookup response, or the IP address with the error
+type batchResult struct {
+	Index  int         `json:"index"`
+	IP     string      `json:"ip,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// POST /v1/lookup/batch?fields=<names> with a JSON array of IP addresses or NDJSON, one IP address
+// or {"ip": "..."} object per line. The results are streamed back as NDJSON in completion order,
+// each with the index of its IP address in the request.
+func (s *server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	st := s.current()
+	e := newAccessEntry(r)
+	defer st.accessLog.log(e, started)
+
+	if r.Method != http.MethodPost {
+		e.Status, e.Error = http.StatusMethodNotAllowed, "method not allowed"
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, e.Status, errorResponse{Error: e.Error})
+		return
+	}
+	fields, err := parseLookupFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		e.Status, e.Error = http.StatusBadRequest, err.Error()
+		writeJSON(w, e.Status, errorResponse{Error: e.Error})
+		return
+	}
+
+	// the whole request is read first, HTTP/1.x not allowing to read it once the response started
+	ips, err := readBatch(http.MaxBytesReader(w, r.Body, batchMaxBytes))
+	if err != nil {
+		e.Status, e.Error = http.StatusBadRequest, err.Error()
+		writeJSON(w, e.Status, errorResponse{Error: e.Error})
+		return
+	}
+	e.Status, e.Items = http.StatusOK, len(ips)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	jobs := make(chan int)
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < batchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- s.batchLookup(st, i, ips[i], fields)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range ips {
+			select {
+			case jobs <- i:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	failed := false
+	for res := range results {
+		if failed {
+			// drain the workers
+			continue
+		}
+		if err := enc.Encode(res); err != nil {
+			failed = true
+			continue
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *server) batchLookup(st *serverState, index int, ip string, fields []string) batchResult {
+	if net.ParseIP(ip) == nil {
+		return batchResult{Index: index, IP: ip, Error: "invalid IP address"}
+	}
+	res, _, err := s.lookup(st, ip)
+	if err != nil {
+		return batchResult{Index: index, IP: ip, Error: err.Error()}
+	}
+	return batchResult{Index: index, Result: res.shape(fields)}
+}
+
+// the IP addresses of a JSON array or of NDJSON lines
+func readBatch(body io.Reader) ([]string, error) {
+	in := bufio.NewReader(body)
+	first, err := peekNonSpace(in)
+	if err == io.EOF {
+		return nil, errors.New("empty batch")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []string
+	if first == '[' {
+		if err = json.NewDecoder(in).Decode(&ips); err != nil {
+			return nil, fmt.Errorf("JSON array of IP addresses expected: %v", err)
+		}
+	} else {
+		lines := bufio.NewScanner(in)
+		for n := 1; lines.Scan(); n++ {
+			line := bytes.TrimSpace(lines.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			ip, err := batchLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			ips = append(ips, ip)
+			if len(ips) > batchMaxItems {
+				break
+			}
+		}
+		if err = lines.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ips) > batchMaxItems {
+		return nil, fmt.Errorf("more than %d IP addresses", batchMaxItems)
+	}
+	return ips, nil
+}
+
+// an NDJSON line: a JSON string, an object with an ip member or the bare IP address
+func batchLine(line []byte) (string, error) {
+	switch line[0] {
+	case '"':
+		var ip string
+		err := json.Unmarshal(line, &ip)
+		return ip, err
+	case '{':
+		var item struct {
+			IP string `json:"ip"`
+		}
+		err := json.Unmarshal(line, &item)
+		return item.IP, err
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+func peekNonSpace(in *bufio.Reader) (byte, error) {
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, in.UnreadByte()
+		}
+	}
+}
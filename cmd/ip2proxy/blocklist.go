@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+func runBlocklist(args []string) error {
+	fs := flag.NewFlagSet("blocklist", flag.ExitOnError)
+	dbPath := fs.String("db", "", "path to the IP2Proxy BIN file")
+	format := fs.String("format", "ipset", "output format: ipset, nft, nginx or apache")
+	setName := fs.String("set", "ip2proxy", "name of the IPv4 set; the IPv6 set name has a 6 appended")
+	table := fs.String("table", "inet filter", "nftables family and table holding the sets")
+	variable := fs.String("var", "$ip2proxy_blocked", "nginx variable set to 1 for blocked clients")
+	filterExpr := fs.String("filter", "", "filter expression selecting the ranges to block, e.g. \"proxy_type in (TOR, VPN) && threat != -\"; every proxy if empty")
+	maxEntries := fs.Int("max", 0, "maximum number of prefixes per IP version, zero for no limit")
+	statePath := fs.String("state", "", "file keeping the prefixes of the previous run; only the changes are written when it exists (ipset and nft)")
+	outPath := fs.String("o", "", "output file instead of the standard output")
+	if err := parseWithConfig(fs, args, databaseConfigKeys); err != nil {
+		return err
+	}
+
+	if *dbPath == "" {
+		return errors.New("missing -db")
+	}
+	switch *format {
+	case "ipset", "nft", "nginx", "apache":
+	default:
+		return errors.New("unknown format " + *format)
+	}
+
+	db, err := ip2proxy.OpenDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	filter, err := parseFilter(*filterExpr)
+	if err != nil {
+		return err
+	}
+
+	b, err := db.Blocklist(filter, *maxEntries)
+	if err != nil {
+		return err
+	}
+
+	var previous *ip2proxy.Blocklist
+	if *statePath != "" && (*format == "ipset" || *format == "nft") {
+		f, err := os.Open(*statePath)
+		if err == nil {
+			previous, err = ip2proxy.ReadBlocklist(f)
+			f.Close()
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case *format == "nginx":
+		err = b.WriteNginxGeo(&buf, *variable)
+	case *format == "apache":
+		err = b.WriteApacheRequire(&buf)
+	case *format == "ipset" && previous == nil:
+		err = b.WriteIPSet(&buf, *setName)
+	case *format == "ipset":
+		err = b.WriteIPSetChanges(&buf, *setName, previous)
+	case previous == nil:
+		err = b.WriteNFTables(&buf, *table, *setName)
+	default:
+		err = b.WriteNFTablesChanges(&buf, *table, *setName, previous)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *outPath == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = writeFileAtomic(*outPath, func(w io.Writer) error {
+			_, err := w.Write(buf.Bytes())
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// the state only advances once the output is written
+	if *statePath != "" && (*format == "ipset" || *format == "nft") {
+		return writeFileAtomic(*statePath, func(w io.Writer) error {
+			_, err := b.WriteTo(w)
+			return err
+		})
+	}
+	return nil
+}
+
+// write the file through a temporary file renamed over it
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
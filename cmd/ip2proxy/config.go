@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A configuration file holds the settings of a command as sections of keys, in TOML:
+//
+//	[database]
+//	path = "/var/lib/ip2proxy/IP2PROXY-LITE-PX11.BIN"
+//
+//	[policy]
+//	block = ["TOR", "VPN"]
+//
+// or in YAML, for files named *.yaml or *.yml:
+//
+//	database:
+//	  path: /var/lib/ip2proxy/IP2PROXY-LITE-PX11.BIN
+//	policy:
+//	  block: [TOR, VPN]
+//
+// Only this subset of both formats is supported: one level of sections, strings, numbers,
+// booleans and single-line lists. Every key can be overridden by an environment variable named
+// IP2PROXY_<SECTION>_<KEY>, e.g. IP2PROXY_DATABASE_PATH, and the command line flags override both.
+
+// environment variable naming the configuration file when -config is absent
+const configEnv = "IP2PROXY_CONFIG"
+
+// configuration keys, as section.key, and the flags they set
+type configKeys map[string]string
+
+// keys shared by the commands opening a BIN file
+var databaseConfigKeys = configKeys{
+	"database.path": "db",
+}
+
+// parse the flags, filling the ones not given from the configuration file named by -config or
+// IP2PROXY_CONFIG and from the environment; the -config flag is added to the flag set
+func parseWithConfig(fs *flag.FlagSet, args []string, keys configKeys) error {
+	configPath := fs.String("config", os.Getenv(configEnv), "configuration file, TOML or YAML, whose settings the flags override")
+	_ = fs.Parse(args)
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	config := make(map[string]string)
+	if *configPath != "" {
+		var err error
+		if config, err = loadConfig(*configPath); err != nil {
+			return err
+		}
+		for key := range config {
+			// the file may be shared by the commands, each using some of the keys
+			if _, ok := serveConfigKeys[key]; !ok {
+				return fmt.Errorf("%s: unknown setting %s", *configPath, key)
+			}
+		}
+	}
+
+	for key, name := range keys {
+		if set[name] {
+			continue
+		}
+		value, ok := os.LookupEnv(configEnvName(key))
+		if !ok {
+			value, ok = config[key]
+		}
+		if !ok {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("setting %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// environment variable overriding the key, e.g. IP2PROXY_CACHE_MAX_ENTRIES for cache.max_entries
+func configEnvName(key string) string {
+	return "IP2PROXY_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// read the configuration file into section.key entries, lists joined by commas like the flags
+func loadConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	parse := parseTOMLLine
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		parse = parseYAMLLine
+	}
+
+	config := make(map[string]string)
+	section := ""
+	in := bufio.NewScanner(f)
+	for n := 1; in.Scan(); n++ {
+		line := strings.TrimRight(stripComment(in.Text()), " \t")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		key, value, isSection, err := parse(line, section != "")
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if isSection {
+			section = key
+			continue
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, ok := config[key]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate setting %s", path, n, key)
+		}
+		if config[key], err = configValue(value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %v", path, n, key, err)
+		}
+	}
+	return config, in.Err()
+}
+
+// [section] or key = value
+func parseTOMLLine(line string, inSection bool) (key, value string, isSection bool, err error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") {
+		if !strings.HasSuffix(line, "]") {
+			return "", "", false, fmt.Errorf("invalid section %s", line)
+		}
+		return strings.TrimSpace(line[1 : len(line)-1]), "", true, nil
+	}
+	i := strings.IndexByte(line, '=')
+	if i <= 0 {
+		return "", "", false, fmt.Errorf("expected key = value")
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), false, nil
+}
+
+// section: at the start of the line, or key: value, indented below a section
+func parseYAMLLine(line string, inSection bool) (key, value string, isSection bool, err error) {
+	indented := line[0] == ' ' || line[0] == '\t'
+	line = strings.TrimSpace(line)
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return "", "", false, fmt.Errorf("expected key: value")
+	}
+	key, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+	if !indented {
+		if value != "" {
+			return "", "", false, fmt.Errorf("expected section %s:", key)
+		}
+		return key, "", true, nil
+	}
+	if !inSection {
+		return "", "", false, fmt.Errorf("unexpected indentation")
+	}
+	return key, value, false, nil
+}
+
+// remove a # comment outside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote a scalar, or join the items of a [a, b] list with commas
+func configValue(value string) (string, error) {
+	if !strings.HasPrefix(value, "[") {
+		return configScalar(value)
+	}
+	if !strings.HasSuffix(value, "]") {
+		return "", fmt.Errorf("unterminated list")
+	}
+
+	var items []string
+	for _, item := range splitConfigList(value[1 : len(value)-1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		v, err := configScalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, v)
+	}
+	return strings.Join(items, ","), nil
+}
+
+func configScalar(value string) (string, error) {
+	if len(value) >= 2 {
+		switch value[0] {
+		case '"':
+			if value[len(value)-1] == '"' {
+				return strconv.Unquote(value)
+			}
+		case '\'':
+			if value[len(value)-1] == '\'' {
+				return value[1 : len(value)-1], nil
+			}
+		}
+	}
+	if strings.ContainsAny(value[:1], "\"'") {
+		return "", fmt.Errorf("unterminated string %s", value)
+	}
+	return value, nil
+}
+
+// split list items on the commas outside quotes
+func splitConfigList(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
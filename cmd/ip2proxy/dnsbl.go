@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// DNSBL frontend answering <reversed IP>.<zone> queries over UDP as described in RFC 5782.
+// Proxies are listed with an A record 127.0.0.<code> encoding the proxy type and a TXT record
+// with the details; other addresses get NXDOMAIN.
+
+const (
+	dnsTypeA   = 1
+	dnsTypeTXT = 16
+	dnsTypeANY = 255
+	dnsClassIN = 1
+
+	dnsRcodeOK       = 0
+	dnsRcodeFormErr  = 1
+	dnsRcodeNXDomain = 3
+	dnsRcodeNotImpl  = 4
+	dnsRcodeRefused  = 5
+)
+
+// last octet of the A record per proxy type
+var dnsblCodes = map[string]byte{
+	"VPN": 2,
+	"TOR": 3,
+	"DCH": 4,
+	"PUB": 5,
+	"WEB": 6,
+	"SES": 7,
+	"RES": 8,
+	"CPN": 9,
+	"EPN": 10,
+}
+
+// any other proxy type
+const dnsblCodeOther = 127
+
+type dnsbl struct {
+	db   *ip2proxy.ReloadableDB
+	zone string
+	ttl  uint32
+}
+
+func newDNSBL(db *ip2proxy.ReloadableDB, zone string, ttl uint32) *dnsbl {
+	return &dnsbl{db: db, zone: strings.ToLower(strings.Trim(zone, ".")), ttl: ttl}
+}
+
+// serve queries until the connection is closed
+func (b *dnsbl) serve(pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if resp := b.handle(buf[:n]); resp != nil {
+			if _, err = pc.WriteTo(resp, addr); err != nil {
+				log.Printf("dnsbl: %v", err)
+			}
+		}
+	}
+}
+
+// build the response to a query message; nil if the message must be dropped
+func (b *dnsbl) handle(msg []byte) []byte {
+	if len(msg) < 12 || msg[2]&0x80 != 0 {
+		return nil
+	}
+
+	resp := make([]byte, 12, 512)
+	copy(resp, msg[:2])
+	resp[2] = 0x84 | msg[2]&0x01 // QR, AA and RD copied from the query
+
+	qdcount := binary.BigEndian.Uint16(msg[4:])
+	if msg[2]&0x78 != 0 {
+		return dnsRcode(resp, dnsRcodeNotImpl)
+	}
+	if qdcount != 1 {
+		return dnsRcode(resp, dnsRcodeFormErr)
+	}
+
+	name, end, ok := dnsName(msg, 12)
+	if !ok || end+4 > len(msg) {
+		return dnsRcode(resp, dnsRcodeFormErr)
+	}
+	qtype := binary.BigEndian.Uint16(msg[end:])
+	qclass := binary.BigEndian.Uint16(msg[end+2:])
+
+	// echo the question
+	resp = append(resp, msg[12:end+4]...)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+
+	if qclass != dnsClassIN {
+		return dnsRcode(resp, dnsRcodeRefused)
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == b.zone {
+		return resp
+	}
+	if !strings.HasSuffix(name, "."+b.zone) {
+		return dnsRcode(resp, dnsRcodeRefused)
+	}
+
+	ip := reversedIP(strings.TrimSuffix(name, "."+b.zone))
+	if ip == "" {
+		return dnsRcode(resp, dnsRcodeNXDomain)
+	}
+
+	code, txt, listed := b.lookup(ip)
+	if !listed {
+		return dnsRcode(resp, dnsRcodeNXDomain)
+	}
+
+	var answers uint16
+	if qtype == dnsTypeA || qtype == dnsTypeANY {
+		resp = b.appendRR(resp, dnsTypeA, []byte{127, 0, 0, code})
+		answers++
+	}
+	if qtype == dnsTypeTXT || qtype == dnsTypeANY {
+		resp = b.appendRR(resp, dnsTypeTXT, append([]byte{byte(len(txt))}, txt...))
+		answers++
+	}
+	binary.BigEndian.PutUint16(resp[6:], answers)
+	return resp
+}
+
+// listing of the IP address; 127.0.0.2 is always listed as required by RFC 5782
+func (b *dnsbl) lookup(ip string) (byte, string, bool) {
+	if ip == "127.0.0.2" {
+		return 2, "test", true
+	}
+
+	rec, err := b.db.GetAll(ip)
+	if err != nil || rec.IsProxy <= 0 {
+		return 0, "", false
+	}
+
+	code, ok := dnsblCodes[rec.ProxyType]
+	if !ok {
+		code = dnsblCodeOther
+	}
+	txt := "proxyType=" + rec.ProxyType
+	if known(rec.Threat) {
+		txt += " threat=" + rec.Threat
+	}
+	if known(rec.CountryShort) {
+		txt += " countryCode=" + rec.CountryShort
+	}
+	if len(txt) > 255 {
+		txt = txt[:255]
+	}
+	return code, txt, true
+}
+
+// append an answer pointing to the question name
+func (b *dnsbl) appendRR(resp []byte, rrtype uint16, rdata []byte) []byte {
+	var rr [12]byte
+	binary.BigEndian.PutUint16(rr[0:], 0xc00c)
+	binary.BigEndian.PutUint16(rr[2:], rrtype)
+	binary.BigEndian.PutUint16(rr[4:], dnsClassIN)
+	binary.BigEndian.PutUint32(rr[6:], b.ttl)
+	binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+	resp = append(resp, rr[:]...)
+	return append(resp, rdata...)
+}
+
+// whether the field has a value in the BIN file
+func known(v string) bool {
+	return v != "" && v != "-" && v != "NOT SUPPORTED"
+}
+
+func dnsRcode(resp []byte, rcode byte) []byte {
+	resp[3] = resp[3]&0xf0 | rcode
+	return resp
+}
+
+// read an uncompressed name at the offset; returns the offset after it
+func dnsName(msg []byte, off int) (string, int, bool) {
+	var labels []string
+	for {
+		if off >= len(msg) {
+			return "", 0, false
+		}
+		n := int(msg[off])
+		off++
+		if n == 0 {
+			break
+		}
+		if n > 63 || off+n > len(msg) {
+			return "", 0, false
+		}
+		labels = append(labels, string(msg[off:off+n]))
+		off += n
+	}
+	return strings.Join(labels, "."), off, true
+}
+
+// IP address from the reversed octets of an IPv4 address or the reversed nibbles of an IPv6 address
+func reversedIP(s string) string {
+	labels := strings.Split(s, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	switch len(labels) {
+	case 4:
+		for _, l := range labels {
+			if _, err := strconv.ParseUint(l, 10, 8); err != nil {
+				return ""
+			}
+		}
+		if ip := net.ParseIP(strings.Join(labels, ".")); ip != nil {
+			return ip.String()
+		}
+	case 32:
+		var sb strings.Builder
+		for i, l := range labels {
+			if len(l) != 1 || !strings.Contains("0123456789abcdef", l) {
+				return ""
+			}
+			if i > 0 && i%4 == 0 {
+				sb.WriteByte(':')
+			}
+			sb.WriteString(l)
+		}
+		if ip := net.ParseIP(sb.String()); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
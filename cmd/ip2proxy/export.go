@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "", "path to the IP2Proxy BIN file")
+	format := fs.String("format", "", "output format: parquet, clickhouse or mmdb")
+	filterExpr := fs.String("filter", "", "filter expression selecting the ranges, e.g. \"is_proxy > 0\"; every range if empty")
+	outPath := fs.String("o", "", "output file instead of the standard output")
+	if err := parseWithConfig(fs, args, databaseConfigKeys); err != nil {
+		return err
+	}
+
+	if *dbPath == "" {
+		return errors.New("missing -db")
+	}
+
+	var export func(db *ip2proxy.DB, w io.Writer, filter func(r ip2proxy.IPRange) bool) error
+	switch *format {
+	case "parquet":
+		export = (*ip2proxy.DB).ExportParquet
+	case "clickhouse":
+		export = (*ip2proxy.DB).ExportClickHouse
+	case "mmdb":
+		export = (*ip2proxy.DB).ExportMMDB
+	default:
+		return errors.New("unknown format " + *format)
+	}
+
+	filter, err := parseFilter(*filterExpr)
+	if err != nil {
+		return err
+	}
+
+	db, err := ip2proxy.OpenDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *outPath == "" {
+		return export(db, os.Stdout, filter)
+	}
+	return writeFileAtomic(*outPath, func(w io.Writer) error {
+		return export(db, w, filter)
+	})
+}
+
+// compile the filter expression of a flag; nil if empty
+func parseFilter(expr string) (func(r ip2proxy.IPRange) bool, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	f, err := ip2proxy.ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	return f.Ranges(), nil
+}
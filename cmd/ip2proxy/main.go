@@ -0,0 +1,71 @@
+// Command ip2proxy provides tools and a lookup daemon for IP2Proxy BIN files.
+//
+// Usage:
+//
+//	ip2proxy <command> [flags]
+//
+// The commands are:
+//
+//	serve      run the lookup daemon, with Traefik ForwardAuth on /v1/forwardauth and the HTTP flavour
+//	           of Envoy ext_authz below /v1/envoy-http; the gRPC flavour is served by contrib/envoy
+//	blocklist  generate ipset, nftables, nginx or Apache blocklists
+//	export     convert to Parquet, ClickHouse or MaxMind DB files
+//	verify     validate a BIN file against known answers
+//	summarize  print the metadata, statistics and integrity of a BIN file
+//	watch      alert on proxies among the IP addresses read from stdin
+//	soak       compare a BIN file with the web service on sampled IP addresses
+//
+// The settings can also come from a TOML or YAML configuration file given with -config or the
+// IP2PROXY_CONFIG environment variable, see contrib/ip2proxy.toml, and from environment variables
+// named after its keys, e.g. IP2PROXY_DATABASE_PATH. The flags take precedence over both.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "run the lookup daemon", runServe},
+	{"blocklist", "generate ipset, nftables, nginx or Apache blocklists", runBlocklist},
+	{"export", "convert to Parquet, ClickHouse or MaxMind DB files", runExport},
+	{"verify", "validate a BIN file against known answers", runVerify},
+	{"summarize", "print the metadata, statistics and integrity of a BIN file", runSummarize},
+	{"watch", "alert on proxies among the IP addresses read from stdin", runWatch},
+	{"soak", "compare a BIN file with the web service on sampled IP addresses", runSoak},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: ip2proxy <command> [flags]\n\nThe commands are:\n\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nUse \"ip2proxy <command> -h\" for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "ip2proxy %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "ip2proxy: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
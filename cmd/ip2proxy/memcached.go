@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// Memcached text protocol frontend, so that existing memcached clients can look up addresses:
+// "get <ip> [<ip> ...]" returns the JSON lookup response of /v1/lookup as the value of each key
+// which is a valid IP address. The protocol has no authentication, the listener is meant for the
+// local host or a private network.
+
+// longest command line accepted, a get of many IPv6 addresses included
+const memcachedMaxLine = 8192
+
+// idle connections are closed after this delay
+const memcachedIdleTimeout = 5 * time.Minute
+
+type memcached struct {
+	db      *ip2proxy.ReloadableDB
+	current func() *serverState // for the redaction of the logged keys
+	started time.Time
+
+	// accessed atomically
+	gets uint64
+	hits uint64
+}
+
+func newMemcached(db *ip2proxy.ReloadableDB, current func() *serverState) *memcached {
+	return &memcached{db: db, current: current, started: time.Now()}
+}
+
+// accept connections until the listener is closed
+func (m *memcached) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go m.serveConn(conn)
+	}
+}
+
+func (m *memcached) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	in := bufio.NewScanner(conn)
+	in.Buffer(make([]byte, 1024), memcachedMaxLine)
+	out := bufio.NewWriter(conn)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(memcachedIdleTimeout))
+		if !in.Scan() {
+			if errors.Is(in.Err(), bufio.ErrTooLong) {
+				_, _ = out.WriteString("CLIENT_ERROR line too long\r\n")
+				_ = out.Flush()
+			}
+			return
+		}
+
+		if !m.handle(out, strings.Fields(in.Text())) {
+			_ = out.Flush()
+			return
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// write the response to a command; false to close the connection
+func (m *memcached) handle(out *bufio.Writer, args []string) bool {
+	if len(args) == 0 {
+		_, _ = out.WriteString("ERROR\r\n")
+		return true
+	}
+
+	switch args[0] {
+	case "get", "gets":
+		if len(args) < 2 {
+			_, _ = out.WriteString("ERROR\r\n")
+			return true
+		}
+		for _, key := range args[1:] {
+			m.get(out, key, args[0] == "gets")
+		}
+		_, _ = out.WriteString("END\r\n")
+	case "version":
+		_, _ = out.WriteString("VERSION ip2proxy-" + ip2proxy.ModuleVersion() + "\r\n")
+	case "stats":
+		for _, s := range [][2]string{
+			{"uptime", strconv.FormatInt(int64(time.Since(m.started).Seconds()), 10)},
+			{"version", "ip2proxy-" + ip2proxy.ModuleVersion()},
+			{"cmd_get", strconv.FormatUint(atomic.LoadUint64(&m.gets), 10)},
+			{"get_hits", strconv.FormatUint(atomic.LoadUint64(&m.hits), 10)},
+			{"get_misses", strconv.FormatUint(atomic.LoadUint64(&m.gets)-atomic.LoadUint64(&m.hits), 10)},
+			{"database_version", m.db.DatabaseVersion()},
+		} {
+			_, _ = out.WriteString("STAT " + s[0] + " " + s[1] + "\r\n")
+		}
+		_, _ = out.WriteString("END\r\n")
+	case "quit":
+		return false
+	default:
+		// the data block of storage commands is not read, the connection is closed instead
+		_, _ = out.WriteString("SERVER_ERROR read only\r\n")
+		return args[0] != "set" && args[0] != "add" && args[0] != "replace" &&
+			args[0] != "append" && args[0] != "prepend" && args[0] != "cas"
+	}
+	return true
+}
+
+// write the VALUE of a key; nothing for keys which are not IP addresses, as for missing keys
+func (m *memcached) get(out *bufio.Writer, key string, cas bool) {
+	atomic.AddUint64(&m.gets, 1)
+	if net.ParseIP(key) == nil {
+		return
+	}
+
+	rec, err := m.db.GetAll(key)
+	if err != nil {
+		log.Printf("memcached: %s: %v", redactIP(m.current().redact, key), err)
+		return
+	}
+	value, err := json.Marshal(newLookupResponse(key, rec))
+	if err != nil {
+		return
+	}
+	atomic.AddUint64(&m.hits, 1)
+
+	_, _ = out.WriteString("VALUE " + key + " 0 " + strconv.Itoa(len(value)))
+	if cas {
+		_, _ = out.WriteString(" 0")
+	}
+	_, _ = out.WriteString("\r\n")
+	_, _ = out.Write(value)
+	_, _ = out.WriteString("\r\n")
+}
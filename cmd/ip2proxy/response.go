@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// JSON representation of a lookup, named like the fields of the IP2Proxy web service
+type lookupResponse struct {
+	IP          string `json:"ip"`
+	IsProxy     int8   `json:"isProxy"`
+	ProxyType   string `json:"proxyType"`
+	CountryCode string `json:"countryCode"`
+	CountryName string `json:"countryName"`
+	RegionName  string `json:"regionName"`
+	CityName    string `json:"cityName"`
+	ISP         string `json:"isp"`
+	Domain      string `json:"domain"`
+	UsageType   string `json:"usageType"`
+	ASN         string `json:"asn"`
+	AS          string `json:"as"`
+	LastSeen    string `json:"lastSeen"`
+	Threat      string `json:"threat"`
+	Provider    string `json:"provider"`
+}
+
+func newLookupResponse(ip string, rec ip2proxy.IP2ProxyRecord) lookupResponse {
+	return lookupResponse{
+		IP:          ip,
+		IsProxy:     rec.IsProxy,
+		ProxyType:   rec.ProxyType,
+		CountryCode: rec.CountryShort,
+		CountryName: rec.CountryLong,
+		RegionName:  rec.Region,
+		CityName:    rec.City,
+		ISP:         rec.Isp,
+		Domain:      rec.Domain,
+		UsageType:   rec.UsageType,
+		ASN:         rec.Asn,
+		AS:          rec.As,
+		LastSeen:    rec.LastSeen,
+		Threat:      rec.Threat,
+		Provider:    rec.Provider,
+	}
+}
+
+// the web service answers isProxy with YES or NO
+func newWSLookupResponse(ip string, res ip2proxy.IP2ProxyResult) lookupResponse {
+	isProxy := int8(-1)
+	switch res.IsProxy {
+	case "NO":
+		isProxy = 0
+	case "YES":
+		isProxy = 1
+		if res.ProxyType == "DCH" || res.ProxyType == "SES" {
+			isProxy = 2
+		}
+	}
+	return lookupResponse{
+		IP:          ip,
+		IsProxy:     isProxy,
+		ProxyType:   res.ProxyType,
+		CountryCode: res.CountryCode,
+		CountryName: res.CountryName,
+		RegionName:  res.RegionName,
+		CityName:    res.CityName,
+		ISP:         res.ISP,
+		Domain:      res.Domain,
+		UsageType:   res.UsageType,
+		ASN:         res.ASN,
+		AS:          res.AS,
+		LastSeen:    res.LastSeen,
+		Threat:      res.Threat,
+		Provider:    res.Provider,
+	}
+}
+
+// shorter names accepted by ?fields=, besides the JSON names
+var lookupFieldAliases = map[string][]string{
+	"country": {"countryCode", "countryName"},
+	"region":  {"regionName"},
+	"city":    {"cityName"},
+}
+
+// JSON names of the comma separated fields, case insensitive; nil for every field
+func parseLookupFields(list string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, name := range splitList(list) {
+		names, ok := lookupFieldAliases[strings.ToLower(name)]
+		if !ok {
+			names = []string{name}
+		}
+		for _, n := range names {
+			canonical := ""
+			for _, f := range lookupFieldNames {
+				if strings.EqualFold(f, n) {
+					canonical = f
+				}
+			}
+			if canonical == "" {
+				return nil, fmt.Errorf("unknown field %s", name)
+			}
+			if !seen[canonical] {
+				seen[canonical] = true
+				fields = append(fields, canonical)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// JSON names of the lookup response fields, ip excluded as always returned
+var lookupFieldNames = []string{
+	"isProxy", "proxyType", "countryCode", "countryName", "regionName", "cityName", "isp",
+	"domain", "usageType", "asn", "as", "lastSeen", "threat", "provider",
+}
+
+func (l lookupResponse) field(name string) interface{} {
+	switch name {
+	case "isProxy":
+		return l.IsProxy
+	case "proxyType":
+		return l.ProxyType
+	case "countryCode":
+		return l.CountryCode
+	case "countryName":
+		return l.CountryName
+	case "regionName":
+		return l.RegionName
+	case "cityName":
+		return l.CityName
+	case "isp":
+		return l.ISP
+	case "domain":
+		return l.Domain
+	case "usageType":
+		return l.UsageType
+	case "asn":
+		return l.ASN
+	case "as":
+		return l.AS
+	case "lastSeen":
+		return l.LastSeen
+	case "threat":
+		return l.Threat
+	case "provider":
+		return l.Provider
+	}
+	return nil
+}
+
+// the response with the IP address and the given fields only, the full response if none
+func (l lookupResponse) shape(fields []string) interface{} {
+	if fields == nil {
+		return l
+	}
+	shaped := map[string]interface{}{"ip": l.IP}
+	for _, f := range fields {
+		shaped[f] = l.field(f)
+	}
+	return shaped
+}
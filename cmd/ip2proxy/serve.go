@@ -0,0 +1,825 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// the daemon state shared by the handlers
+type server struct {
+	stats serverStats // first for the alignment of its atomic counters
+	db    *ip2proxy.ReloadableDB
+	args  []string     // command line, parsed again with the configuration file on reload
+	salt  []byte       // key of -redact hash without -redact-key, random so that pseudonyms change on restart
+	state atomic.Value // *serverState, replaced on configuration reload
+}
+
+// the part of the daemon state built from the configuration; the requests in progress keep
+// the state they started with
+type serverState struct {
+	settings  *serveSettings
+	mw        *ip2proxy.Middleware
+	extractor *ip2proxy.ClientIPExtractor
+	ws        *ip2proxy.WS // web service answering the lookups the BIN file cannot, nil if not configured
+	tlsConfig *tls.Config  // nil without TLS
+
+	authClients authClients                 // nil without clients file
+	accessLog   *accessLog                  // nil without access log
+	redact      ip2proxy.Redactor           // applied to the IP addresses of the logs, nil to log them as is
+	shadow      *ip2proxy.ShadowPolicy      // nil without shadow filter
+	syslog      *ip2proxy.SyslogForwarder   // nil without syslog server
+	webhook     *ip2proxy.WebhookDispatcher // nil without webhook
+}
+
+// the settings of the daemon, from the flags, the configuration file and the environment
+type serveSettings struct {
+	dbPath       string
+	listen       string
+	block        string
+	allow        string
+	blockProxies bool
+	presets      string
+	dnsblListen  string
+	mcListen     string
+	dnsblZone    string
+	dnsblTTL     uint
+	trusted      string
+	cacheTTL     time.Duration
+	cacheMax     int
+	cacheNegTTL  time.Duration
+	wsKey        string
+	wsPackage    string
+	wsSSL        bool
+	wsDowngrade  bool
+	adminToken   string
+	tlsCert      string
+	tlsKey       string
+	tlsClientCA  string
+	authClients  string
+	accessLog    string
+	accessFormat string
+	accessSample float64
+	redact       string
+	redactKey    string
+	churnRatio   float64
+	churnMin     int
+	canary       time.Duration
+	fadvise      string
+	directIO     bool
+	p99Budget    time.Duration
+	shadowFilter string
+	syslog       string
+	syslogFormat string
+	syslogRate   float64
+	webhook      string
+	webhookKey   string
+	webhookRule  string
+	webhookPath  string
+}
+
+// configuration keys of the daemon, a superset of the keys of the other commands
+var serveConfigKeys = configKeys{
+	"database.path":          "db",
+	"database.churn_alert":   "churn-alert",
+	"database.churn_min":     "churn-alert-min-ranges",
+	"database.canary":        "canary",
+	"database.fadvise":       "fadvise",
+	"database.direct_io":     "direct-io",
+	"database.p99_budget":    "p99-budget",
+	"listen.http":            "listen",
+	"listen.dnsbl":           "dnsbl-listen",
+	"listen.memcached":       "memcached-listen",
+	"dnsbl.zone":             "dnsbl-zone",
+	"dnsbl.ttl":              "dnsbl-ttl",
+	"policy.block":           "block",
+	"policy.allow":           "allow",
+	"policy.block_proxies":   "block-proxies",
+	"policy.presets":         "presets",
+	"policy.trusted_proxies": "trusted-proxies",
+	"policy.shadow_filter":   "shadow-filter",
+	"cache.ttl":              "cache-ttl",
+	"cache.max_entries":      "cache-max",
+	"cache.negative_ttl":     "cache-negative-ttl",
+	"webservice.key":         "ws-key",
+	"webservice.package":     "ws-package",
+	"webservice.ssl":         "ws-ssl",
+	"webservice.downgrade":   "ws-downgrade",
+	"admin.token":            "admin-token",
+	"tls.cert":               "tls-cert",
+	"tls.key":                "tls-key",
+	"tls.client_ca":          "tls-client-ca",
+	"auth.clients":           "auth-clients",
+	"log.access":             "access-log",
+	"log.access_sample":      "access-log-sample",
+	"log.access_format":      "access-log-format",
+	"log.redact":             "redact",
+	"log.redact_key":         "redact-key",
+	"syslog.server":          "syslog",
+	"syslog.format":          "syslog-format",
+	"syslog.rate":            "syslog-rate",
+	"webhook.url":            "webhook",
+	"webhook.secret":         "webhook-secret",
+	"webhook.filter":         "webhook-filter",
+	"webhook.path_prefix":    "webhook-path",
+}
+
+func parseServeSettings(args []string) (*serveSettings, error) {
+	var c = &serveSettings{}
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&c.dbPath, "db", "", "path to the IP2Proxy BIN file")
+	fs.StringVar(&c.listen, "listen", ":8080", "comma separated addresses to listen on, host:port, unix:/path/to/socket or unix:@name for an abstract socket, unless started by systemd socket activation")
+	fs.StringVar(&c.block, "block", "", "comma separated proxy types to deny, e.g. TOR,VPN")
+	fs.StringVar(&c.allow, "allow", "", "comma separated proxy types to allow before the deny rules apply, e.g. RES")
+	fs.BoolVar(&c.blockProxies, "block-proxies", false, "deny every proxy not explicitly allowed")
+	fs.StringVar(&c.presets, "presets", "", "comma separated policy presets applied after -block: block-anonymizers, block-anonymizers-except-res or challenge-dch, each optionally restricted to countries, e.g. challenge-dch:US|CA, or excluding them, e.g. block-anonymizers:!US")
+	fs.StringVar(&c.shadowFilter, "shadow-filter", "", "filter expression of a candidate policy denying the selected records, evaluated on the lookups without enforcing it and reported by /admin/shadow, e.g. \"usage_type == DCH\"")
+	fs.StringVar(&c.dnsblListen, "dnsbl-listen", "", "UDP address to answer DNSBL queries on, e.g. :5353")
+	fs.StringVar(&c.mcListen, "memcached-listen", "", "address to answer memcached get commands on, host:port or unix:/path, e.g. 127.0.0.1:11211")
+	fs.StringVar(&c.dnsblZone, "dnsbl-zone", "proxy.dnsbl.local", "DNSBL zone name")
+	fs.UintVar(&c.dnsblTTL, "dnsbl-ttl", 300, "TTL in seconds of the DNSBL answers")
+	fs.StringVar(&c.trusted, "trusted-proxies", "127.0.0.0/8,::1", "comma separated CIDRs of the proxies forwarding the client IP address")
+	fs.DurationVar(&c.cacheTTL, "cache-ttl", 0, "how long the decisions per IP range are cached, zero to disable the cache")
+	fs.IntVar(&c.cacheMax, "cache-max", 100000, "maximum number of cached decisions")
+	fs.DurationVar(&c.cacheNegTTL, "cache-negative-ttl", 0, "how long the decisions for the ranges not flagged as proxies are cached, -cache-ttl if zero")
+	fs.StringVar(&c.wsKey, "ws-key", "", "IP2Proxy web service API key, for the lookups the BIN file cannot answer, e.g. IPv6 addresses with an IPv4 BIN file")
+	fs.StringVar(&c.wsPackage, "ws-package", "PX11", "IP2Proxy web service package")
+	fs.BoolVar(&c.wsSSL, "ws-ssl", true, "query the web service over HTTPS")
+	fs.BoolVar(&c.wsDowngrade, "ws-downgrade", false, "retry the lookups with the lower web service packages when the package is rejected")
+	fs.StringVar(&c.adminToken, "admin-token", "", "bearer token of the /admin endpoints, disabled if empty; preferably set in the configuration file or IP2PROXY_ADMIN_TOKEN")
+	fs.StringVar(&c.tlsCert, "tls-cert", "", "PEM certificate chain file, to serve HTTPS on the TCP listeners")
+	fs.StringVar(&c.tlsKey, "tls-key", "", "PEM private key file of the certificate")
+	fs.StringVar(&c.tlsClientCA, "tls-client-ca", "", "PEM file of the CAs the client certificates must be signed by, to require mutual TLS")
+	fs.StringVar(&c.authClients, "auth-clients", "", "file of the clients allowed on /v1/lookup, with their secrets and rate limits; every client is allowed if empty")
+	fs.StringVar(&c.accessLog, "access-log", "", "access log file, - for the standard output; reopened on reload for log rotation")
+	fs.StringVar(&c.accessFormat, "access-log-format", "json", "format of the access log lines: json, or cef or leef for SIEM ingestion")
+	fs.Float64Var(&c.accessSample, "access-log-sample", 1, "share of the allowed successful requests logged, the denied and failed ones are always logged")
+	fs.StringVar(&c.redact, "redact", "", "redaction of the IP addresses in the logs: truncate to /24 and /48, or hash with HMAC-SHA256; logged as is if empty")
+	fs.StringVar(&c.redactKey, "redact-key", "", "key of -redact hash, random on every start if empty; preferably set in the configuration file or IP2PROXY_LOG_REDACT_KEY")
+	fs.Float64Var(&c.churnRatio, "churn-alert", 0, "log a warning when the share of the ranges of a proxy type changed by a database reload exceeds it, e.g. 0.2; disabled if 0")
+	fs.IntVar(&c.churnMin, "churn-alert-min-ranges", 100, "proxy types with fewer ranges before and after the reload are not warned about")
+	fs.DurationVar(&c.canary, "canary", 0, "how long a reloaded database runs side by side with the current one, which answers while the different classifications are logged, before switching; disabled if 0")
+	fs.StringVar(&c.fadvise, "fadvise", "", "how the kernel reads the database file ahead on Linux: random not to fill the page cache with huge files, or willneed to load it at start; default read-ahead if empty")
+	fs.BoolVar(&c.directIO, "direct-io", false, "read the database file with O_DIRECT on Linux, bypassing the page cache, every lookup reading the disk")
+	fs.DurationVar(&c.p99Budget, "p99-budget", 0, "log a warning for every minute the 99th percentile of the lookup latency exceeds it, e.g. 1ms, for the storage regressions; disabled if 0")
+	fs.StringVar(&c.syslog, "syslog", "", "syslog server the decisions for the proxies are forwarded to as RFC 5424 messages, udp://, tcp:// or tls://host:port")
+	fs.StringVar(&c.syslogFormat, "syslog-format", "cef", "format of the syslog messages, cef or leef")
+	fs.Float64Var(&c.syslogRate, "syslog-rate", 100, "maximum syslog messages per second, the others are dropped; zero for no limit")
+	fs.StringVar(&c.webhook, "webhook", "", "URL the lookups selected by -webhook-filter and -webhook-path are posted to as JSON events")
+	fs.StringVar(&c.webhookKey, "webhook-secret", "", "key of the HMAC-SHA256 signatures of the webhook events, unsigned if empty; preferably set in the configuration file or IP2PROXY_WEBHOOK_SECRET")
+	fs.StringVar(&c.webhookRule, "webhook-filter", "", "filter expression selecting the records posted to -webhook, e.g. \"threat contains BOTNET\"; every proxy if empty")
+	fs.StringVar(&c.webhookPath, "webhook-path", "", "path prefix of the requests posted to -webhook, e.g. /login, taken from X-Forwarded-Uri or X-Original-URI for the forward authentication")
+	if err := parseWithConfig(fs, args, serveConfigKeys); err != nil {
+		return nil, err
+	}
+
+	if c.dbPath == "" {
+		return nil, errors.New("missing -db")
+	}
+	if _, err := c.openOptions(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// the options the database files are opened with
+func (c *serveSettings) openOptions() (ip2proxy.OpenOptions, error) {
+	opts := ip2proxy.OpenOptions{Direct: c.directIO}
+	switch c.fadvise {
+	case "":
+	case "random":
+		opts.Advice = ip2proxy.AdviseRandom
+	case "willneed":
+		opts.Advice = ip2proxy.AdviseWillNeed
+	default:
+		return opts, errors.New("invalid -fadvise, must be random or willneed")
+	}
+	return opts, nil
+}
+
+func runServe(args []string) error {
+	c, err := parseServeSettings(args)
+	if err != nil {
+		return err
+	}
+
+	opts, _ := c.openOptions()
+	first, err := ip2proxy.OpenDBWithOptions(c.dbPath, opts)
+	if err != nil {
+		return err
+	}
+	db := ip2proxy.NewReloadableDB(first).SetOpenOptions(opts)
+	defer db.Close()
+	if c.churnRatio > 0 {
+		db.SetChurnAlert(ip2proxy.ChurnThresholds{MaxRatio: c.churnRatio, MinRanges: c.churnMin}, logChurn)
+	}
+
+	s := &server{db: db, args: args}
+	s.stats.started = time.Now()
+	s.stats.window = ip2proxy.NewStatsWindow(statsWindowMinutes)
+	db.AddHooks(s.stats.window.Hooks())
+	if c.p99Budget > 0 {
+		db.AddHooks(ip2proxy.NewLatencyGuard(c.p99Budget, time.Minute, logLatencyBreach).Hooks())
+	}
+	s.salt = make([]byte, 32)
+	if _, err = rand.Read(s.salt); err != nil {
+		return err
+	}
+	st, err := s.newState(c)
+	if err != nil {
+		return err
+	}
+	s.state.Store(st)
+	defer func() {
+		s.current().close()
+	}()
+	if c.canary > 0 {
+		db.SetCanary(c.canary, s.logCanary)
+	}
+
+	listeners, conns, err := systemdSockets()
+	if err != nil {
+		return err
+	}
+
+	// a datagram socket passed by systemd serves DNSBL queries
+	if len(conns) == 0 && c.dnsblListen != "" {
+		pc, err := net.ListenPacket("udp", c.dnsblListen)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, pc)
+	}
+	for _, pc := range conns {
+		defer pc.Close()
+		go newDNSBL(db, c.dnsblZone, uint32(c.dnsblTTL)).serve(pc)
+	}
+
+	if c.mcListen != "" {
+		ln, err := listen(c.mcListen)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		go newMemcached(db, s.current).serve(ln)
+	}
+
+	if len(listeners) == 0 {
+		for _, addr := range splitList(c.listen) {
+			ln, err := listen(addr)
+			if err != nil {
+				return err
+			}
+			listeners = append(listeners, ln)
+		}
+	}
+
+	if st.tlsConfig != nil {
+		for i, ln := range listeners {
+			listeners[i] = s.tlsListener(ln)
+		}
+	}
+
+	srv := &http.Server{Handler: s.routes()}
+	return serveUntilSignal(srv, listeners, s)
+}
+
+// warn about the proxy types changed the most by a database reload
+func logChurn(s ip2proxy.ChurnSummary) {
+	for _, pt := range s.Exceeded {
+		c := s.ProxyTypes[pt]
+		log.Printf("database %s to %s: %.0f%% of the %s ranges changed, %d added and %d removed of %d",
+			s.OldVersion, s.NewVersion, c.Ratio()*100, pt, c.Added, c.Removed, c.Before)
+	}
+}
+
+// warn about a minute of slow lookups
+func logLatencyBreach(b ip2proxy.LatencyBreach) {
+	log.Printf("lookup latency p99 %s over the budget of %s, %d lookups from %s", b.P99, b.Budget, b.Lookups,
+		b.Start.Format(time.RFC3339))
+}
+
+// log an address classified differently by the database under canary evaluation
+func (s *server) logCanary(d ip2proxy.CanaryDisagreement) {
+	log.Printf("canary %s: %s is %d %s instead of %d %s in %s", d.CandidateVersion, redactIP(s.current().redact, d.IP),
+		d.Candidate.IsProxy, d.Candidate.ProxyType, d.Current.IsProxy, d.Current.ProxyType, d.CurrentVersion)
+}
+
+// listen on a TCP address or, for sidecars on the same host, on a unix:/path or unix:@name socket
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix:") {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, "unix:")
+	if !strings.HasPrefix(path, "@") {
+		// left behind by a previous run, the listener removes it on close
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// the policies, client IP extractor, decision cache and web service of the settings
+func (s *server) newState(c *serveSettings) (*serverState, error) {
+	var st = &serverState{}
+	st.settings = c
+
+	var err error
+	if st.extractor, err = ip2proxy.NewClientIPExtractor(splitList(c.trusted)); err != nil {
+		return nil, err
+	}
+	if st.tlsConfig, err = loadTLSConfig(c); err != nil {
+		return nil, err
+	}
+	if c.accessSample < 0 || c.accessSample > 1 {
+		return nil, errors.New("-access-log-sample must be between 0 and 1")
+	}
+	if st.redact, err = s.redactor(c); err != nil {
+		return nil, err
+	}
+	if c.authClients != "" {
+		if st.authClients, err = loadAuthClients(c.authClients); err != nil {
+			return nil, err
+		}
+		if old, ok := s.state.Load().(*serverState); ok && old.authClients != nil {
+			st.authClients.keepBuckets(old.authClients)
+		}
+	}
+
+	var policies []ip2proxy.Policy
+	if c.allow != "" {
+		policies = append(policies, ip2proxy.AllowProxyTypes(splitList(c.allow)...))
+	}
+	if c.block != "" {
+		policies = append(policies, ip2proxy.BlockProxyTypes(splitList(c.block)...))
+	}
+	for _, preset := range splitList(c.presets) {
+		p, err := parsePreset(preset)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if c.blockProxies {
+		policies = append(policies, ip2proxy.BlockProxies())
+	}
+
+	st.mw = ip2proxy.NewMiddleware(s.db, ip2proxy.Chain(policies...)).SetClientIPExtractor(st.extractor).SetRedactor(st.redact)
+	if c.shadowFilter != "" {
+		f, err := ip2proxy.ParseFilter(c.shadowFilter)
+		if err != nil {
+			return nil, fmt.Errorf("-shadow-filter: %v", err)
+		}
+		st.shadow = ip2proxy.NewShadowPolicy(c.shadowFilter, ip2proxy.FilterPolicy(f, ip2proxy.DecisionDeny), shadowExamples)
+		st.mw.AddShadowPolicy(st.shadow)
+	}
+	if c.cacheTTL > 0 {
+		st.mw.EnableDecisionCache(c.cacheTTL, c.cacheMax)
+		if c.cacheNegTTL > 0 {
+			st.mw.SetDecisionCacheNegativeTTL(c.cacheNegTTL)
+		}
+	}
+	if c.wsKey != "" {
+		if st.ws, err = ip2proxy.OpenWS(c.wsKey, c.wsPackage, c.wsSSL); err != nil {
+			return nil, err
+		}
+		st.ws.SetPackageDowngrade(c.wsDowngrade).SetRedactor(st.redact)
+	}
+	if c.syslog != "" {
+		if st.syslog, err = newSyslogForwarder(c); err != nil {
+			return nil, err
+		}
+		st.mw.AddHooks(st.syslog.Hooks())
+	}
+	if c.webhook != "" {
+		if st.webhook, err = st.newWebhookDispatcher(c); err != nil {
+			st.close()
+			return nil, err
+		}
+		st.mw.AddHooks(st.webhook.Hooks())
+	}
+	// last, so that no file is left open on error
+	if st.accessLog, err = openAccessLog(c.accessLog, c.accessFormat, c.accessSample, st.redact); err != nil {
+		st.close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// close the access log and the sinks of a state at once, sending the queued syslog messages and webhook events,
+// for the states rejected and at exit
+func (st *serverState) close() {
+	if st.accessLog != nil && st.accessLog.closer != nil {
+		st.accessLog.closer.Close()
+	}
+	if st.syslog != nil {
+		st.syslog.Close()
+	}
+	if st.webhook != nil {
+		st.webhook.Close()
+	}
+}
+
+// a policy of -presets, name[:countries] with the countries separated by | and prefixed with ! to exclude them
+func parsePreset(preset string) (ip2proxy.Policy, error) {
+	name, countries := preset, ""
+	if i := strings.IndexByte(preset, ':'); i >= 0 {
+		name, countries = preset[:i], preset[i+1:]
+	}
+
+	var p ip2proxy.Policy
+	switch name {
+	case "block-anonymizers":
+		p = ip2proxy.BlockAnonymizers()
+	case "block-anonymizers-except-res":
+		p = ip2proxy.BlockAnonymizersExceptRES()
+	case "challenge-dch":
+		p = ip2proxy.ChallengeDCH()
+	default:
+		return nil, fmt.Errorf("unknown policy preset %q", name)
+	}
+	if countries == "" {
+		return p, nil
+	}
+
+	except := strings.HasPrefix(countries, "!")
+	codes := strings.Split(strings.TrimPrefix(countries, "!"), "|")
+	for _, code := range codes {
+		if _, ok := ip2proxy.NormalizeCountryCode(code); !ok {
+			return nil, fmt.Errorf("policy preset %q: unknown country code %q", preset, code)
+		}
+	}
+	if except {
+		return ip2proxy.ExceptCountries(p, codes...), nil
+	}
+	return ip2proxy.InCountries(p, codes...), nil
+}
+
+// disagreements of the shadow filter reported by /admin/shadow
+const shadowExamples = 20
+
+// the redactor of -redact
+func (s *server) redactor(c *serveSettings) (ip2proxy.Redactor, error) {
+	switch c.redact {
+	case "":
+		return nil, nil
+	case "truncate":
+		return ip2proxy.RedactTruncate(24, 48), nil
+	case "hash":
+		if c.redactKey != "" {
+			return ip2proxy.RedactHash([]byte(c.redactKey)), nil
+		}
+		return ip2proxy.RedactHash(s.salt), nil
+	}
+	return nil, errors.New("-redact must be truncate or hash")
+}
+
+// the IP address as logged
+func redactIP(redact ip2proxy.Redactor, ip string) string {
+	if redact == nil || ip == "" {
+		return ip
+	}
+	return redact(ip)
+}
+
+// switch to the state, the previous one is kept by the requests in progress
+func (s *server) setState(st *serverState) {
+	old, _ := s.state.Load().(*serverState)
+	s.state.Store(st)
+	if old != nil {
+		old.accessLog.closeLater()
+		if old.syslog != nil {
+			time.AfterFunc(time.Minute, func() { old.syslog.Close() })
+		}
+		if old.webhook != nil {
+			time.AfterFunc(time.Minute, func() { old.webhook.Close() })
+		}
+	}
+}
+
+// the dispatcher of -webhook with the rule of -webhook-filter and -webhook-path
+func (st *serverState) newWebhookDispatcher(c *serveSettings) (*ip2proxy.WebhookDispatcher, error) {
+	rule := ip2proxy.WebhookRule{Name: "webhook", PathPrefix: c.webhookPath}
+	if c.webhookRule != "" {
+		f, err := ip2proxy.ParseFilter(c.webhookRule)
+		if err != nil {
+			return nil, fmt.Errorf("-webhook-filter: %v", err)
+		}
+		rule.Filter = f
+	}
+	var secret []byte
+	if c.webhookKey != "" {
+		secret = []byte(c.webhookKey)
+	}
+	d, err := ip2proxy.NewWebhookDispatcher(c.webhook, secret)
+	if err != nil {
+		return nil, fmt.Errorf("-webhook: %v", err)
+	}
+	return d.AddRule(rule).SetRequestPath(st.originalPath), nil
+}
+
+// the path of the request checked by the forward authentication or Envoy, from a trusted proxy
+func (st *serverState) originalPath(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, envoyHTTPPrefix+"/") {
+		return strings.TrimPrefix(r.URL.Path, envoyHTTPPrefix)
+	}
+	if r.URL.Path != "/v1/forwardauth" || !st.extractor.IsTrusted(remoteHost(r.RemoteAddr)) {
+		return r.URL.Path
+	}
+	for _, h := range []string{"X-Forwarded-Uri", "X-Original-URI"} {
+		if uri := r.Header.Get(h); uri != "" {
+			if u, err := url.ParseRequestURI(uri); err == nil {
+				return u.Path
+			}
+		}
+	}
+	return r.URL.Path
+}
+
+// the forwarder of -syslog, connecting with the first message
+func newSyslogForwarder(c *serveSettings) (*ip2proxy.SyslogForwarder, error) {
+	u, err := url.Parse(c.syslog)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("-syslog must be udp://, tcp:// or tls://host:port")
+	}
+	f, err := ip2proxy.NewSyslogForwarder(u.Scheme, u.Host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("-syslog: %v", err)
+	}
+	if _, err = f.SetFormat(c.syslogFormat); err != nil {
+		f.Close()
+		return nil, errors.New("-syslog-format must be cef or leef")
+	}
+	return f.SetRateLimit(c.syslogRate, int(c.syslogRate)), nil
+}
+
+func (s *server) current() *serverState {
+	return s.state.Load().(*serverState)
+}
+
+// read the configuration again and switch to the new policies, trusted proxies, decision cache,
+// web service settings, TLS certificates and clients; the previous state is kept on error
+func (s *server) reloadConfig() error {
+	c, err := parseServeSettings(s.args)
+	if err != nil {
+		return err
+	}
+	// checked before the state opens the access log and connects the sinks
+	old := s.current().settings
+	if (c.tlsCert == "") != (old.tlsCert == "") {
+		return errors.New("enabling or disabling TLS requires a restart")
+	}
+	st, err := s.newState(c)
+	if err != nil {
+		return err
+	}
+
+	if c.listen != old.listen || c.dnsblListen != old.dnsblListen || c.mcListen != old.mcListen || c.dnsblZone != old.dnsblZone || c.dnsblTTL != old.dnsblTTL {
+		log.Printf("the listen addresses and DNSBL settings only change on restart")
+	}
+	s.setState(st)
+	return nil
+}
+
+// reopen the BIN file, from its path in the current configuration
+func (s *server) reloadDB() error {
+	return s.db.Reload(s.current().settings.dbPath)
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/v1/lookup", s.authenticated(s.handleLookup))
+	mux.HandleFunc("/v1/lookup/batch", s.authenticated(s.handleBatch))
+	mux.HandleFunc("/v1/forwardauth", s.handleForwardAuth)
+	mux.HandleFunc(envoyHTTPPrefix+"/", s.handleEnvoyHTTPAuthz)
+	s.adminRoutes(mux)
+	return unixPeers(mux)
+}
+
+// requests over unix sockets come from the same host, they are given the loopback address
+// so that the trusted proxies and the client IP extraction apply as for TCP
+func unixPeers(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if net.ParseIP(remoteHost(r.RemoteAddr)) == nil {
+			r.RemoteAddr = "127.0.0.1:0"
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// run the server until SIGINT or SIGTERM, then drain the connections; SIGHUP reloads the configuration
+// and the BIN file, SIGUSR1 only the configuration, except on Windows
+func serveUntilSignal(srv *http.Server, listeners []net.Listener, s *server) error {
+	errc := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			errc <- srv.Serve(ln)
+		}(ln)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, serveSignals()...)
+	defer signal.Stop(sig)
+
+	sdNotify("READY=1")
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case sg := <-sig:
+			config, database := reloadSignal(sg)
+			if !config {
+				sdNotify("STOPPING=1")
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				return srv.Shutdown(ctx)
+			}
+
+			sdNotify("RELOADING=1")
+			// each keeps serving with its previous state on error
+			if err := s.reloadConfig(); err != nil {
+				log.Printf("reload configuration: %v", err)
+			} else {
+				log.Printf("configuration reloaded")
+			}
+			if database {
+				if err := s.reloadDB(); err != nil {
+					log.Printf("reload database: %v", err)
+				} else {
+					log.Printf("database reloaded")
+				}
+			}
+			sdNotify("READY=1")
+		}
+	}
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "databaseVersion": s.db.DatabaseVersion()})
+}
+
+// GET /v1/lookup?ip=<address>&fields=<names>; the client IP address of the request is used if ip is
+// absent, and every field is returned if fields is absent
+func (s *server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	st := s.current()
+	e := newAccessEntry(r)
+	defer st.accessLog.log(e, started)
+
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		ip = st.mw.ClientIP(r)
+	}
+	e.IP = ip
+	if net.ParseIP(ip) == nil {
+		e.Status, e.Error = http.StatusBadRequest, "invalid IP address"
+		writeJSON(w, e.Status, errorResponse{Error: e.Error})
+		return
+	}
+	fields, err := parseLookupFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		e.Status, e.Error = http.StatusBadRequest, err.Error()
+		writeJSON(w, e.Status, errorResponse{Error: e.Error})
+		return
+	}
+
+	res, source, err := s.lookup(st, ip)
+	e.Source = source
+	if err != nil {
+		e.Status, e.Error = http.StatusInternalServerError, err.Error()
+		writeJSON(w, e.Status, errorResponse{Error: e.Error})
+		return
+	}
+	e.Status = http.StatusOK
+	e.result(res)
+	writeJSON(w, http.StatusOK, res.shape(fields))
+}
+
+// look up the IP address in the BIN file, or in the web service if configured and the BIN file cannot
+// answer; the source is bin or webservice
+func (s *server) lookup(st *serverState, ip string) (lookupResponse, string, error) {
+	atomic.AddUint64(&s.stats.lookups, 1)
+	rec, err := s.db.GetAll(ip)
+	if (err != nil || rec.IsProxy < 0) && st.ws != nil {
+		atomic.AddUint64(&s.stats.wsFallbacks, 1)
+		res, wsErr := st.ws.LookUp(ip)
+		if wsErr == nil {
+			return newWSLookupResponse(ip, res), "webservice", nil
+		}
+		log.Printf("web service lookup of %s: %v", redactIP(st.redact, ip), wsErr)
+	}
+	if err != nil {
+		return lookupResponse{}, "bin", err
+	}
+	return newLookupResponse(ip, rec), "bin", nil
+}
+
+// Traefik ForwardAuth: the client IP address comes from the X-Forwarded-For header set by Traefik
+func (s *server) handleForwardAuth(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	st.authorize(w, r, st.mw.ClientIP(r))
+}
+
+// path prefix of the Envoy ext_authz HTTP service, set as path_prefix of its http_service
+const envoyHTTPPrefix = "/v1/envoy-http"
+
+// Envoy ext_authz HTTP service, the gRPC Authorization service being in contrib/envoy: Envoy forwards the
+// original request below the configured path prefix and sets X-Envoy-External-Address, which is only honoured
+// from a trusted proxy
+func (s *server) handleEnvoyHTTPAuthz(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	ip := r.Header.Get("X-Envoy-External-Address")
+	if net.ParseIP(ip) == nil || !st.extractor.IsTrusted(remoteHost(r.RemoteAddr)) {
+		ip = st.mw.ClientIP(r)
+	}
+	st.authorize(w, r, ip)
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// answer 200 to allow and 403 to deny, with the lookup result in headers the proxy can pass upstream; challenged
+// requests are answered 200 with X-IP2Proxy-Decision: challenge, for the proxy or the upstream to challenge
+func (st *serverState) authorize(w http.ResponseWriter, r *http.Request, ip string) {
+	started := time.Now()
+	e := newAccessEntry(r)
+	e.IP = ip
+	e.Cached = st.mw.IsCached(ip)
+	if !e.Cached {
+		e.Source = "bin"
+	}
+	defer st.accessLog.log(e, started)
+
+	rec, d, block, err := st.mw.Evaluate(ip, r)
+	if err != nil {
+		// fail open like the middleware
+		e.Status, e.Error = http.StatusOK, err.Error()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	e.result(newLookupResponse(ip, rec))
+	e.Decision = d.String()
+
+	h := w.Header()
+	h.Set("X-IP2Proxy-Client-IP", ip)
+	h.Set("X-IP2Proxy-Is-Proxy", strconv.Itoa(int(rec.IsProxy)))
+	h.Set("X-IP2Proxy-Proxy-Type", rec.ProxyType)
+	h.Set("X-IP2Proxy-Country", rec.CountryShort)
+	h.Set("X-IP2Proxy-Threat", rec.Threat)
+	h.Set("X-IP2Proxy-Decision", d.String())
+
+	if block {
+		e.Status = http.StatusForbidden
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "access denied"})
+		return
+	}
+	e.Status = http.StatusOK
+	w.WriteHeader(http.StatusOK)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+// split a comma separated flag value
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/internal/sampledb"
+)
+
+// a server of the sample BIN file with the state of the command line, as started by runServe
+func newTestServer(t *testing.T, args ...string) *server {
+	t.Helper()
+	db, err := sampledb.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{db: ip2proxy.NewReloadableDB(db), args: args}
+	t.Cleanup(func() { s.db.Close() })
+	s.salt = make([]byte, 32)
+
+	c, err := parseServeSettings(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.newState(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.state.Store(st)
+	return s
+}
+
+// a self-signed certificate of localhost and its key, in PEM files of the directory
+func writeTestCertificate(t *testing.T, dir string) (certFile string, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// a reload enabling TLS is rejected before the access log of the new configuration is opened
+func TestReloadConfigTLSToggle(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, "-db", "sample.bin")
+	certFile, keyFile := writeTestCertificate(t, dir)
+	accessLog := filepath.Join(dir, "access.log")
+
+	s.args = []string{"-db", "sample.bin", "-tls-cert", certFile, "-tls-key", keyFile, "-access-log", accessLog}
+	if err := s.reloadConfig(); err == nil {
+		t.Fatal("TLS enabled by a reload")
+	}
+	if _, err := os.Stat(accessLog); !os.IsNotExist(err) {
+		t.Errorf("access log of the rejected configuration opened (%v)", err)
+	}
+	if s.current().settings.tlsCert != "" {
+		t.Error("state of the rejected configuration in use")
+	}
+}
+
+// the syslog forwarder and the webhook dispatcher of a rejected configuration are closed, their goroutines
+// exiting, whether it is rejected before or while its state is built
+func TestReloadConfigClosesSinks(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+	sinks := []string{"-syslog", "udp://127.0.0.1:9", "-webhook", "http://127.0.0.1:9/events"}
+	s := newTestServer(t, "-db", "sample.bin")
+	before := runtime.NumGoroutine()
+
+	for name, args := range map[string][]string{
+		"TLS enabled":        {"-tls-cert", certFile, "-tls-key", keyFile},
+		"access log invalid": {"-access-log", filepath.Join(dir, "access.log"), "-access-log-format", "xml"},
+	} {
+		s.args = append(append([]string{"-db", "sample.bin"}, sinks...), args...)
+		if err := s.reloadConfig(); err == nil {
+			t.Fatalf("%s: reload not rejected", name)
+		}
+		if n := runtime.NumGoroutine(); n != before {
+			t.Errorf("%s: %d goroutines instead of %d", name, n, before)
+		}
+	}
+
+	// the goroutines of the sinks are counted
+	s.args = append([]string{"-db", "sample.bin"}, sinks...)
+	if err := s.reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if n := runtime.NumGoroutine(); n == before {
+		t.Error("no goroutine for the sinks")
+	}
+	s.current().close()
+}
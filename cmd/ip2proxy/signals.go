@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// the signals handled by the daemon
+func serveSignals() []os.Signal {
+	return []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1}
+}
+
+// whether the signal reloads the configuration, and the BIN file too
+func reloadSignal(sg os.Signal) (config bool, database bool) {
+	return sg == syscall.SIGHUP || sg == syscall.SIGUSR1, sg == syscall.SIGHUP
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// the signals handled by the daemon, Windows having no reload signals
+func serveSignals() []os.Signal {
+	return []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+}
+
+// the signals never reload on Windows
+func reloadSignal(sg os.Signal) (config bool, database bool) {
+	return false, false
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// fields compared by soak, named like the lookup responses
+var soakFields = []struct {
+	name  string
+	field ip2proxy.FieldMask
+}{
+	{"isProxy", ip2proxy.FieldIsProxy},
+	{"proxyType", ip2proxy.FieldProxyType},
+	{"countryCode", ip2proxy.FieldCountryShort},
+	{"countryName", ip2proxy.FieldCountryLong},
+	{"regionName", ip2proxy.FieldRegion},
+	{"cityName", ip2proxy.FieldCity},
+	{"isp", ip2proxy.FieldIsp},
+	{"domain", ip2proxy.FieldDomain},
+	{"usageType", ip2proxy.FieldUsageType},
+	{"asn", ip2proxy.FieldAsn},
+	{"as", ip2proxy.FieldAs},
+	{"lastSeen", ip2proxy.FieldLastSeen},
+	{"threat", ip2proxy.FieldThreat},
+	{"provider", ip2proxy.FieldProvider},
+}
+
+// disagreements of a field
+type soakField struct {
+	compared, disagreements int
+	examples                []string
+}
+
+func runSoak(args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	dbPath := fs.String("db", "", "path to the IP2Proxy BIN file")
+	wsKey := fs.String("ws-key", "", "IP2Proxy web service API key; every lookup uses a credit")
+	wsPackage := fs.String("ws-package", "PX11", "IP2Proxy web service package")
+	wsSSL := fs.Bool("ws-ssl", true, "query the web service over HTTPS")
+	wsURL := fs.String("ws-url", "", "base URL of the web service, e.g. of a stub; api.ip2proxy.com if empty")
+	n := fs.Int("n", 100, "number of IP addresses sampled")
+	proxyShare := fs.Float64("proxy-share", 0.5, "share of the addresses drawn from the proxy ranges of the BIN file, the others being random public IPv4 addresses")
+	seed := fs.Int64("seed", 0, "seed of the sampling, random if 0")
+	examples := fs.Int("examples", 3, "number of disagreements listed per field")
+	maxRate := fs.Float64("max-rate", 1, "maximum disagreement rate of a field, between 0 and 1, above which the command fails")
+	if err := parseWithConfig(fs, args, configKeys{
+		"database.path":      "db",
+		"webservice.key":     "ws-key",
+		"webservice.package": "ws-package",
+		"webservice.ssl":     "ws-ssl",
+	}); err != nil {
+		return err
+	}
+
+	if *dbPath == "" {
+		return errors.New("missing -db")
+	}
+	if *wsKey == "" {
+		return errors.New("missing -ws-key")
+	}
+	if *n <= 0 || *proxyShare < 0 || *proxyShare > 1 {
+		return errors.New("-n must be positive and -proxy-share between 0 and 1")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	db, err := ip2proxy.OpenDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ws, err := ip2proxy.OpenWS(*wsKey, *wsPackage, *wsSSL)
+	if err != nil {
+		return err
+	}
+	if *wsURL != "" {
+		ws.SetBaseURL(*wsURL)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	ips, fromProxies, err := soakSample(db, rng, *n, int(float64(*n)**proxyShare))
+	if err != nil {
+		return err
+	}
+
+	// the fields returned by both
+	compared := db.Fields() & ws.Fields()
+	stats := make(map[string]*soakField)
+	var wsErrors int
+	for _, ip := range ips {
+		rec, err := db.GetAll(ip)
+		if err != nil {
+			return err
+		}
+		res, err := ws.LookUp(ip)
+		if err != nil {
+			wsErrors++
+			continue
+		}
+
+		bin, remote := newLookupResponse(ip, rec), newWSLookupResponse(ip, res)
+		for _, f := range soakFields {
+			if f.field != ip2proxy.FieldIsProxy && !compared.Has(f.field) {
+				continue
+			}
+			s := stats[f.name]
+			if s == nil {
+				s = &soakField{}
+				stats[f.name] = s
+			}
+			s.compared++
+			b, r := bin.field(f.name), remote.field(f.name)
+			if b != r {
+				s.disagreements++
+				if len(s.examples) < *examples {
+					s.examples = append(s.examples, fmt.Sprintf("%s: bin=%v webservice=%v", ip, b, r))
+				}
+			}
+		}
+	}
+
+	fmt.Printf("sampled:     %d addresses, %d from the proxy ranges of the BIN file, seed %d\n", len(ips), fromProxies, *seed)
+	fmt.Printf("BIN file:    PX%s %s\n", db.PackageVersion(), db.DatabaseVersion())
+	fmt.Printf("web service: %s, %d failed lookups\n", ws.Package(), wsErrors)
+	fmt.Printf("\n%-12s %9s %9s %8s\n", "field", "compared", "disagree", "rate")
+
+	var failed []string
+	for _, f := range soakFields {
+		s := stats[f.name]
+		if s == nil {
+			continue
+		}
+		rate := float64(s.disagreements) / float64(s.compared)
+		fmt.Printf("%-12s %9d %9d %7.2f%%\n", f.name, s.compared, s.disagreements, rate*100)
+		for _, e := range s.examples {
+			fmt.Printf("    %s\n", e)
+		}
+		if rate > *maxRate {
+			failed = append(failed, f.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("disagreement rate above %g for %v", *maxRate, failed)
+	}
+	return nil
+}
+
+// sample n IP addresses, up to fromProxies of them in proxy ranges of the BIN file picked by reservoir
+// sampling and the others random public IPv4 addresses, returning the addresses and how many are in proxy ranges
+func soakSample(db *ip2proxy.DB, rng *rand.Rand, n int, fromProxies int) ([]string, int, error) {
+	var reservoir []ip2proxy.IPRange
+	if fromProxies > 0 {
+		seen := 0
+		err := db.Scan(func(r ip2proxy.IPRange) error {
+			if r.Record.IsProxy <= 0 {
+				return nil
+			}
+			seen++
+			if len(reservoir) < fromProxies {
+				reservoir = append(reservoir, r)
+			} else if i := rng.Intn(seen); i < fromProxies {
+				reservoir[i] = r
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ips := make([]string, 0, n)
+	for _, r := range reservoir {
+		ips = append(ips, randomIn(rng, r.IPFrom, r.IPTo).String())
+	}
+	for len(ips) < n {
+		var b [4]byte
+		rng.Read(b[:])
+		addr := netip.AddrFrom4(b)
+		if addr.IsGlobalUnicast() && !addr.IsPrivate() {
+			ips = append(ips, addr.String())
+		}
+	}
+	rng.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+	return ips, len(reservoir), nil
+}
+
+// a random IP address between from and to, inclusive
+func randomIn(rng *rand.Rand, from net.IP, to net.IP) net.IP {
+	size := 16
+	if v4 := from.To4(); v4 != nil {
+		from, to, size = v4, to.To4(), 4
+	}
+	lo, hi := new(big.Int).SetBytes(from), new(big.Int).SetBytes(to)
+	span := new(big.Int).Sub(hi, lo)
+	span.Add(span, big.NewInt(1))
+	v := new(big.Int).Rand(rng, span)
+	v.Add(v, lo)
+
+	ip := make(net.IP, size)
+	v.FillBytes(ip)
+	return ip
+}
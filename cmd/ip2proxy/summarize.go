@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+func runSummarize(args []string) error {
+	fs := flag.NewFlagSet("summarize", flag.ExitOnError)
+	dbPath := fs.String("db", "", "path to the IP2Proxy BIN file, or as the argument which takes precedence")
+	if err := parseWithConfig(fs, args, databaseConfigKeys); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		*dbPath = fs.Arg(0)
+	}
+	if *dbPath == "" {
+		return errors.New("missing BIN file")
+	}
+
+	st, err := os.Stat(*dbPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := ip2proxy.OpenDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	layout, err := db.Layout()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("file:          %s\n", *dbPath)
+	fmt.Printf("product:       PX%s\n", db.PackageVersion())
+	fmt.Printf("published:     %s\n", db.DatabaseVersion())
+	fmt.Printf("columns:       %d\n", layout.Columns)
+	fmt.Printf("size:          %d bytes, also the memory taken by OpenDBFromBytes\n", st.Size())
+	v4Indexed, v6Indexed := db.Indexed()
+	fmt.Printf("indexes:       IPv4 %s, IPv6 %s\n", yesNo(v4Indexed), yesNo(v6Indexed))
+
+	fields := db.Fields()
+	var supported, missing []string
+	for _, f := range []struct {
+		name  string
+		field ip2proxy.FieldMask
+	}{
+		{"country", ip2proxy.FieldCountryShort},
+		{"region", ip2proxy.FieldRegion},
+		{"city", ip2proxy.FieldCity},
+		{"isp", ip2proxy.FieldIsp},
+		{"proxy_type", ip2proxy.FieldProxyType},
+		{"domain", ip2proxy.FieldDomain},
+		{"usage_type", ip2proxy.FieldUsageType},
+		{"asn", ip2proxy.FieldAsn},
+		{"as_name", ip2proxy.FieldAs},
+		{"last_seen", ip2proxy.FieldLastSeen},
+		{"threat", ip2proxy.FieldThreat},
+		{"provider", ip2proxy.FieldProvider},
+	} {
+		if fields.Has(f.field) {
+			supported = append(supported, f.name)
+		} else {
+			missing = append(missing, f.name)
+		}
+	}
+	fmt.Printf("fields:        %s\n", strings.Join(supported, " "))
+	if len(missing) > 0 {
+		fmt.Printf("not supported: %s\n", strings.Join(missing, " "))
+	}
+
+	var s summary
+	s.types = make(map[string]int)
+	if err = db.Scan(func(r ip2proxy.IPRange) error {
+		s.add(r, layout)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("scan: %v", err)
+	}
+
+	fmt.Printf("IPv4 ranges:   %d, %d proxy ranges covering %s addresses\n", s.v4, s.v4Proxies, &s.v4Addresses)
+	fmt.Printf("IPv6 ranges:   %d, %d proxy ranges covering %s addresses\n", s.v6, s.v6Proxies, &s.v6Addresses)
+	if len(s.types) > 0 {
+		names := make([]string, 0, len(s.types))
+		for t := range s.types {
+			names = append(names, t)
+		}
+		sort.Strings(names)
+		var counts []string
+		for _, t := range names {
+			counts = append(counts, fmt.Sprintf("%s=%d", t, s.types[t]))
+		}
+		fmt.Printf("proxy types:   %s\n", strings.Join(counts, " "))
+	}
+
+	for _, p := range s.problems {
+		fmt.Println("problem:", p)
+	}
+	if s.problemCount > len(s.problems) {
+		fmt.Printf("problem: %d more\n", s.problemCount-len(s.problems))
+	}
+	if s.problemCount > 0 {
+		return fmt.Errorf("integrity check: %d problems", s.problemCount)
+	}
+	fmt.Println("integrity:     ok")
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// counters of the summary
+type summary struct {
+	v4, v6                   int
+	v4Proxies, v6Proxies     int
+	v4Addresses, v6Addresses big.Int
+	types                    map[string]int
+
+	last         net.IP // end of the previous range of the same IP version
+	problems     []string
+	problemCount int
+}
+
+// number of problems listed in full
+const summaryMaxProblems = 20
+
+func (s *summary) add(r ip2proxy.IPRange, layout ip2proxy.Layout) {
+	if r.IsIPv6() {
+		if s.v6 == 0 {
+			s.last = nil
+		}
+		s.v6++
+	} else {
+		s.v4++
+	}
+
+	// the ranges must be contiguous from the first address
+	if s.last == nil {
+		if new(big.Int).SetBytes(r.IPFrom).Sign() != 0 {
+			s.problem(fmt.Sprintf("%s: not starting from the first address", r.IPFrom))
+		}
+	} else {
+		next := new(big.Int).Add(new(big.Int).SetBytes(s.last), big.NewInt(1))
+		if next.Cmp(new(big.Int).SetBytes(r.IPFrom)) != 0 {
+			s.problem(fmt.Sprintf("%s: not following %s", r.IPFrom, s.last))
+		}
+	}
+	s.last = r.IPTo
+
+	if err := r.Record.ValidateLayout(layout); err != nil {
+		s.problem(fmt.Sprintf("%s-%s: %v", r.IPFrom, r.IPTo, err))
+	}
+
+	if r.Record.IsProxy > 0 {
+		size := new(big.Int).Sub(new(big.Int).SetBytes(r.IPTo), new(big.Int).SetBytes(r.IPFrom))
+		size.Add(size, big.NewInt(1))
+		if r.IsIPv6() {
+			s.v6Proxies++
+			s.v6Addresses.Add(&s.v6Addresses, size)
+		} else {
+			s.v4Proxies++
+			s.v4Addresses.Add(&s.v4Addresses, size)
+		}
+		if layout.ProxyType != 0 {
+			s.types[r.Record.ProxyType]++
+		}
+	}
+}
+
+func (s *summary) problem(p string) {
+	s.problemCount++
+	if len(s.problems) < summaryMaxProblems {
+		s.problems = append(s.problems, p)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// first file descriptor passed by systemd
+const sdListenFDsStart = 3
+
+// listening sockets passed by systemd socket activation (see sd_listen_fds(3)), stream sockets as
+// listeners and datagram sockets as packet connections; none without socket activation
+func systemdSockets() ([]net.Listener, []net.PacketConn, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+
+	var listeners []net.Listener
+	var conns []net.PacketConn
+	for fd := sdListenFDsStart; fd < sdListenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		if ln, err := net.FileListener(f); err == nil {
+			listeners = append(listeners, ln)
+		} else if pc, err := net.FilePacketConn(f); err == nil {
+			conns = append(conns, pc)
+		} else {
+			return nil, nil, fmt.Errorf("socket activation: file descriptor %d: %v", fd, err)
+		}
+		// the net package holds duplicates
+		f.Close()
+	}
+	return listeners, conns, nil
+}
+
+// notify systemd of a state change (see sd_notify(3)); no-op unless started by systemd with NOTIFY_SOCKET
+func sdNotify(state string) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return
+	}
+	if name[0] == '@' {
+		// abstract namespace
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(state))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/internal/sampledb"
+)
+
+//go:embed knownanswers.txt
+var knownAnswers []byte
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dbPath := fs.String("db", "", "path to the IP2Proxy BIN file")
+	answersPath := fs.String("answers", "", "additional known answers file")
+	scan := fs.Bool("scan", true, "decode every row of the BIN file")
+	writeAnswers := fs.String("write-answers", "", "write the results of a spread of addresses to this known answers file, then exit")
+	answerRanges := fs.Int("answer-ranges", 100, "number of ranges of each IP version looked up by -write-answers")
+	sample := fs.Bool("sample", false, "validate the decoding of this build against the sample BIN file embedded in the command instead of -db, e.g. on big-endian platforms")
+	if err := parseWithConfig(fs, args, databaseConfigKeys); err != nil {
+		return err
+	}
+
+	if *sample {
+		return verifySample()
+	}
+	if *dbPath == "" {
+		return errors.New("missing -db")
+	}
+
+	answers, err := ip2proxy.ParseKnownAnswers(bytes.NewReader(knownAnswers))
+	if err != nil {
+		return err
+	}
+	if *answersPath != "" {
+		f, err := os.Open(*answersPath)
+		if err != nil {
+			return err
+		}
+		more, err := ip2proxy.ParseKnownAnswers(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		answers = append(answers, more...)
+	}
+
+	db, err := ip2proxy.OpenDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	fmt.Printf("PX%s %s\n", db.PackageVersion(), db.DatabaseVersion())
+
+	if *writeAnswers != "" {
+		return writeGoldenAnswers(db, *writeAnswers, *answerRanges)
+	}
+
+	if *scan {
+		var v4, v6 int
+		err = db.Scan(func(r ip2proxy.IPRange) error {
+			if r.IsIPv6() {
+				v6++
+			} else {
+				v4++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scan: %v", err)
+		}
+		if v4 == 0 {
+			return errors.New("scan: no IPv4 ranges")
+		}
+		fmt.Printf("scan: %d IPv4 and %d IPv6 ranges decoded\n", v4, v6)
+	}
+
+	mismatches, checked, err := db.VerifyKnownAnswers(answers)
+	if err != nil {
+		return err
+	}
+	for _, m := range mismatches {
+		fmt.Println("mismatch:", m)
+	}
+	fmt.Printf("known answers: %d checked, %d mismatches\n", checked, len(mismatches))
+
+	if len(mismatches) > 0 {
+		return errors.New(strconv.Itoa(len(mismatches)) + " known answers do not match")
+	}
+	return nil
+}
+
+// check the sample BIN file against its known answers, read from memory and through a file, then written again
+// by Writer and read back, so that the byte order handling of the platform is exercised both ways
+func verifySample() error {
+	answers, err := sampledb.KnownAnswers()
+	if err != nil {
+		return err
+	}
+	bin, err := sampledb.Bytes()
+	if err != nil {
+		return err
+	}
+	mem, err := sampledb.Open()
+	if err != nil {
+		return err
+	}
+	defer mem.Close()
+
+	dir, err := os.MkdirTemp("", "ip2proxy-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sample.bin")
+	if err = os.WriteFile(path, bin, 0o600); err != nil {
+		return err
+	}
+	file, err := ip2proxy.OpenDB(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rewritten, err := rewriteSample(mem, filepath.Join(dir, "rewritten.bin"))
+	if err != nil {
+		return err
+	}
+	defer rewritten.Close()
+
+	fmt.Printf("PX%s %s, %s/%s\n", mem.PackageVersion(), mem.DatabaseVersion(), runtime.GOOS, runtime.GOARCH)
+	failed := 0
+	for _, c := range []struct {
+		name string
+		db   *ip2proxy.DB
+	}{{"memory", mem}, {"file", file}, {"rewritten", rewritten}} {
+		mismatches, checked, err := c.db.VerifyKnownAnswers(answers)
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.name, err)
+		}
+		for _, m := range mismatches {
+			fmt.Printf("%s: mismatch: %s\n", c.name, m)
+		}
+		fmt.Printf("%s: %d known answers checked, %d mismatches\n", c.name, checked, len(mismatches))
+		failed += len(mismatches)
+	}
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " known answers do not match")
+	}
+	return nil
+}
+
+// write the ranges of the DB to a new BIN file and open it
+func rewriteSample(db *ip2proxy.DB, path string) (*ip2proxy.DB, error) {
+	dbType, err := strconv.Atoi(db.PackageVersion())
+	if err != nil {
+		return nil, err
+	}
+	w, err := ip2proxy.NewWriter(uint8(dbType), db.PublishDate())
+	if err != nil {
+		return nil, err
+	}
+	err = db.Scan(func(r ip2proxy.IPRange) error {
+		if r.Record.IsProxy <= 0 {
+			return nil
+		}
+		return w.AddRange(r.IPFrom.String(), r.IPTo.String(), r.Record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = w.WriteFile(path); err != nil {
+		return nil, err
+	}
+	return ip2proxy.OpenDB(path)
+}
+
+// write the golden answers of the BIN file, to be checked with -answers by later builds
+func writeGoldenAnswers(db *ip2proxy.DB, path string, ranges int) error {
+	answers, err := db.GoldenAnswers(ranges)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, "# PX%s %s, generated by ip2proxy verify -write-answers\n", db.PackageVersion(), db.DatabaseVersion())
+	if err = ip2proxy.WriteKnownAnswers(f, answers); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("known answers: %d written to %s\n", len(answers), path)
+	return nil
+}
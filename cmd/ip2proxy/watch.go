@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	dbPath := fs.String("db", "", "path to the IP2Proxy BIN file")
+	filterExpr := fs.String("filter", "is_proxy > 0", "filter expression selecting the records to alert on, e.g. \"proxy_type in (TOR, VPN) || threat != -\"")
+	field := fs.Int("field", 0, "1-based whitespace separated field holding the IP address; the first field parsing as an IP address if 0")
+	format := fs.String("format", "text", "alert format: text or json")
+	ttl := fs.Duration("ttl", 10*time.Minute, "how long lookups are cached")
+	quiet := fs.Duration("quiet", 0, "minimum time between two alerts for the same IP address")
+	if err := parseWithConfig(fs, args, configKeys{
+		"database.path": "db",
+		"cache.ttl":     "ttl",
+	}); err != nil {
+		return err
+	}
+
+	if *dbPath == "" {
+		return errors.New("missing -db")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	filter, err := ip2proxy.ParseFilter(*filterExpr)
+	if err != nil {
+		return err
+	}
+
+	db, err := ip2proxy.OpenDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	resolver := ip2proxy.NewCachedDB(db, ip2proxy.NewMemoryCache(), *ttl)
+	out := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(out)
+	alerted := make(map[string]time.Time)
+
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 64*1024), 1024*1024)
+	for in.Scan() {
+		ip := lineIP(in.Text(), *field)
+		if ip == "" {
+			continue
+		}
+
+		rec, err := resolver.GetAll(ip)
+		if err != nil {
+			return err
+		}
+		if !filter.Match(rec) {
+			continue
+		}
+
+		now := time.Now()
+		if *quiet > 0 {
+			if last, ok := alerted[ip]; ok && now.Sub(last) < *quiet {
+				continue
+			}
+			alerted[ip] = now
+			if len(alerted) > watchMaxAlerted {
+				for k, t := range alerted {
+					if now.Sub(t) >= *quiet {
+						delete(alerted, k)
+					}
+				}
+			}
+		}
+
+		if *format == "json" {
+			err = enc.Encode(newLookupResponse(ip, rec))
+		} else {
+			_, err = fmt.Fprintf(out, "%s %s proxy_type=%s threat=%s country=%s provider=%q\n",
+				now.Format(time.RFC3339), ip, rec.ProxyType, rec.Threat, rec.CountryShort, rec.Provider)
+		}
+		if err != nil {
+			return err
+		}
+		// alerts are written as they happen, with tail -f in mind
+		if err = out.Flush(); err != nil {
+			return err
+		}
+	}
+	return in.Err()
+}
+
+// number of IP addresses remembered for -quiet before the expired ones are dropped
+const watchMaxAlerted = 100000
+
+// IP address of a log line; empty if none
+func lineIP(line string, field int) string {
+	fields := strings.Fields(line)
+	if field > 0 {
+		if field > len(fields) {
+			return ""
+		}
+		fields = fields[field-1 : field]
+	}
+	for _, f := range fields {
+		f = strings.Trim(f, "\",")
+		if host, _, err := net.SplitHostPort(f); err == nil && net.ParseIP(host) != nil {
+			return host
+		}
+		f = strings.Trim(f, "[]")
+		if net.ParseIP(f) != nil {
+			return f
+		}
+	}
+	return ""
+}
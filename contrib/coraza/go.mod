@@ -0,0 +1,23 @@
+module github.com/ip2location/ip2proxy-go/contrib/coraza
+
+go 1.21
+
+require (
+	github.com/corazawaf/coraza/v3 v3.1.0
+	github.com/ip2location/ip2proxy-go/v4 v4.1.0
+)
+
+require (
+	github.com/corazawaf/libinjection-go v0.1.3 // indirect
+	github.com/magefile/mage v1.15.0 // indirect
+	github.com/petar-dambovaliev/aho-corasick v0.0.0-20230725210150-fb29fc3c913e // indirect
+	github.com/tidwall/gjson v1.17.0 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sync v0.6.0 // indirect
+	lukechampine.com/uint128 v1.2.0 // indirect
+	rsc.io/binaryregexp v0.2.0 // indirect
+)
+
+replace github.com/ip2location/ip2proxy-go/v4 => ../../
@@ -0,0 +1,40 @@
+// Package ip2proxycoraza provides the @ip2proxy operator for the Coraza WAF, so SecLang rules can
+// match the client IP address against the IP2Proxy database:
+//
+//	SecRule REMOTE_ADDR "@ip2proxy proxyType=TOR,VPN" "id:1001,phase:1,deny,status:403"
+//	SecRule REMOTE_ADDR "@ip2proxy threat=SPAM,BOTNET" "id:1002,phase:1,deny,status:403"
+//
+// The operator arguments are the conditions of ip2proxy.NewMatcher; "@ip2proxy" without
+// arguments matches every proxy.
+package ip2proxycoraza
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// OperatorName is the name of the operator in SecLang rules.
+const OperatorName = "ip2proxy"
+
+type operator struct {
+	matcher *ip2proxy.Matcher
+}
+
+// Register registers the @ip2proxy operator looking up addresses with the resolver.
+// It must be called before the WAF parsing the rules is created.
+func Register(resolver ip2proxy.Resolver) {
+	plugins.RegisterOperator(OperatorName, func(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+		m, err := ip2proxy.NewMatcher(resolver, options.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return &operator{matcher: m}, nil
+	})
+}
+
+// Evaluate matches the variable value, an IP address; lookup errors never match.
+func (o *operator) Evaluate(tx plugintypes.TransactionState, value string) bool {
+	ok, err := o.matcher.Match(value)
+	return err == nil && ok
+}
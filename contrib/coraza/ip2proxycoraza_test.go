@@ -0,0 +1,49 @@
+package ip2proxycoraza
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+// a SecLang rule using the operator denies the clients matching its conditions
+func TestOperator(t *testing.T) {
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	Register(db)
+
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+SecRuleEngine On
+SecRule REMOTE_ADDR "@ip2proxy proxyType=TOR,DCH" "id:1001,phase:1,deny,status:403"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		ip      string
+		blocked bool
+	}{
+		{ip2proxytest.SampleTOR, true},
+		{ip2proxytest.SampleDCH, true},
+		{ip2proxytest.SampleVPN, false},
+		{ip2proxytest.SampleNotProxy, false},
+	} {
+		tx := waf.NewTransaction()
+		tx.ProcessConnection(c.ip, 41234, "192.0.2.10", 443)
+		tx.ProcessURI("/", "GET", "HTTP/1.1")
+		it := tx.ProcessRequestHeaders()
+		if blocked := it != nil && it.Status == 403; blocked != c.blocked {
+			t.Errorf("%s: interruption %+v, blocked %t instead of %t", c.ip, it, blocked, c.blocked)
+		}
+		tx.Close()
+	}
+
+	if _, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`SecRule REMOTE_ADDR "@ip2proxy color=blue" "id:1002,phase:1,deny"`)); err == nil {
+		t.Error("rule with an invalid condition parsed")
+	}
+}
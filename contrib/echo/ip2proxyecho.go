@@ -0,0 +1,36 @@
+// Package ip2proxyecho adapts the IP2Proxy middleware to the Echo web framework.
+package ip2proxyecho
+
+import (
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the key of the proxy record in the Echo context.
+const ContextKey = "ip2proxy"
+
+// Middleware returns an Echo middleware looking up the client of each request with the IP2Proxy middleware.
+// The proxy record is stored in the Echo context and the request context; blocked requests are answered
+// by the deny handler of the middleware. Use m.WithPolicy to enforce different policies on route groups.
+func Middleware(m *ip2proxy.Middleware) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r, ok := m.Enforce(c.Response(), c.Request())
+			if !ok {
+				return nil
+			}
+
+			if rec, found := ip2proxy.RecordFromContext(r.Context()); found {
+				c.Set(ContextKey, rec)
+			}
+			c.SetRequest(r)
+			return next(c)
+		}
+	}
+}
+
+// Record returns the proxy record stored by the middleware.
+func Record(c echo.Context) (ip2proxy.IP2ProxyRecord, bool) {
+	rec, ok := c.Get(ContextKey).(ip2proxy.IP2ProxyRecord)
+	return rec, ok
+}
@@ -0,0 +1,48 @@
+package ip2proxyecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+	"github.com/labstack/echo/v4"
+)
+
+// the blocked clients are denied and the others get their record in the Echo context
+func TestMiddleware(t *testing.T) {
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := echo.New()
+	e.Use(Middleware(ip2proxy.NewMiddleware(db, ip2proxy.BlockProxyTypes("TOR"))))
+	e.GET("/", func(c echo.Context) error {
+		rec, ok := Record(c)
+		if !ok {
+			return c.String(http.StatusInternalServerError, "no record")
+		}
+		return c.String(http.StatusOK, rec.ProxyType)
+	})
+
+	for _, c := range []struct {
+		ip   string
+		code int
+		body string
+	}{
+		{ip2proxytest.SampleVPN, http.StatusOK, "VPN"},
+		{ip2proxytest.SampleNotProxy, http.StatusOK, "-"},
+		{ip2proxytest.SampleTOR, http.StatusForbidden, "Forbidden\n"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.ip + ":1234"
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, r)
+		if w.Code != c.code || w.Body.String() != c.body {
+			t.Errorf("%s: %d %q instead of %d %q", c.ip, w.Code, w.Body.String(), c.code, c.body)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+module github.com/ip2location/ip2proxy-go/contrib/envoy
+
+go 1.21
+
+require (
+	github.com/envoyproxy/go-control-plane v0.12.0
+	github.com/ip2location/ip2proxy-go/v4 v4.1.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237
+	google.golang.org/grpc v1.64.1
+)
+
+require (
+	github.com/cncf/xds/go v0.0.0-20240318125728-8a4994d93e50 // indirect
+	github.com/envoyproxy/protoc-gen-validate v1.0.4 // indirect
+	github.com/golang/protobuf v1.5.4 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+	lukechampine.com/uint128 v1.2.0 // indirect
+)
+
+replace github.com/ip2location/ip2proxy-go/v4 => ../../
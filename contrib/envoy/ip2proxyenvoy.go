@@ -0,0 +1,87 @@
+// Package ip2proxyenvoy implements the Envoy ext_authz gRPC service, envoy.service.auth.v3.Authorization, with the
+// IP2Proxy middleware, so that Envoy enforces its policy at the edge:
+//
+//	s := grpc.NewServer()
+//	authv3.RegisterAuthorizationServer(s, ip2proxyenvoy.NewAuthorizationServer(mw))
+//
+// The HTTP flavour of ext_authz is served by the ip2proxy daemon below /v1/envoy-http.
+package ip2proxyenvoy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/ip2location/ip2proxy-go/v4"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+// The AuthorizationServer struct answers the ext_authz checks of Envoy with the decision of the middleware.
+type AuthorizationServer struct {
+	authv3.UnimplementedAuthorizationServer
+	m *ip2proxy.Middleware
+}
+
+// NewAuthorizationServer initializes with the middleware whose policy is enforced. The client IP address is the
+// source address of the checked request, resolved by the client IP extractor of the middleware from its headers
+// when the source is a trusted proxy. The shadow mode and the audit callback of the middleware are honoured.
+func NewAuthorizationServer(m *ip2proxy.Middleware) *AuthorizationServer {
+	var s = &AuthorizationServer{}
+	s.m = m
+	return s
+}
+
+// Check allows or denies the request, with the lookup result in X-IP2Proxy-* headers Envoy passes upstream as the
+// daemon does. Challenged requests are allowed with X-IP2Proxy-Decision: challenge, for the upstream to challenge
+// them, and lookup errors allow the request like the middleware.
+func (s *AuthorizationServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attrs := req.GetAttributes()
+	header := make(http.Header)
+	for k, v := range attrs.GetRequest().GetHttp().GetHeaders() {
+		header.Set(k, v)
+	}
+	ip := s.m.ClientIPFromHeader(attrs.GetSource().GetAddress().GetSocketAddress().GetAddress(), header)
+
+	rec, d, block, err := s.m.Evaluate(ip, nil)
+	if err != nil {
+		return &authv3.CheckResponse{
+			Status:       &status.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{}},
+		}, nil
+	}
+
+	headers := []*corev3.HeaderValueOption{
+		headerValue("X-IP2Proxy-Client-IP", ip),
+		headerValue("X-IP2Proxy-Is-Proxy", strconv.Itoa(int(rec.IsProxy))),
+		headerValue("X-IP2Proxy-Proxy-Type", rec.ProxyType),
+		headerValue("X-IP2Proxy-Country", rec.CountryShort),
+		headerValue("X-IP2Proxy-Threat", rec.Threat),
+		headerValue("X-IP2Proxy-Decision", d.String()),
+	}
+	if block {
+		return &authv3.CheckResponse{
+			Status: &status.Status{Code: int32(codes.PermissionDenied), Message: "access denied"},
+			HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_Forbidden},
+				Headers: append(headers, headerValue("Content-Type", "application/json")),
+				Body:    `{"error":"access denied"}`,
+			}},
+		}, nil
+	}
+	return &authv3.CheckResponse{
+		Status:       &status.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{Headers: headers}},
+	}, nil
+}
+
+// a header replacing the one of the same name
+func headerValue(key string, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: key, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
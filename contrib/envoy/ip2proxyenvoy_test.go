@@ -0,0 +1,93 @@
+package ip2proxyenvoy
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// the checks are allowed, denied or flagged for a challenge by the policy of the middleware
+func TestCheck(t *testing.T) {
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	extractor, err := ip2proxy.NewClientIPExtractor([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := ip2proxy.NewMiddleware(db, ip2proxy.Chain(ip2proxy.BlockProxyTypes("TOR"), ip2proxy.ChallengeDCH())).
+		SetClientIPExtractor(extractor)
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(s, NewAuthorizationServer(m))
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := authv3.NewAuthorizationClient(conn)
+
+	for _, c := range []struct {
+		source   string
+		xff      string
+		code     codes.Code
+		decision string
+	}{
+		{ip2proxytest.SampleVPN, "", codes.OK, "allow"},
+		{ip2proxytest.SampleTOR, "", codes.PermissionDenied, "deny"},
+		{ip2proxytest.SampleDCH, "", codes.OK, "challenge"},
+		{"10.0.0.1", ip2proxytest.SampleTOR, codes.PermissionDenied, "deny"},
+		{ip2proxytest.SampleVPN, ip2proxytest.SampleTOR, codes.OK, "allow"},
+	} {
+		req := &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+			Source: &authv3.AttributeContext_Peer{Address: &corev3.Address{Address: &corev3.Address_SocketAddress{
+				SocketAddress: &corev3.SocketAddress{Address: c.source},
+			}}},
+			Request: &authv3.AttributeContext_Request{Http: &authv3.AttributeContext_HttpRequest{
+				Headers: map[string]string{"x-forwarded-for": c.xff},
+			}},
+		}}
+		resp, err := client.Check(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: %v", c.source, err)
+		}
+
+		var headers []*corev3.HeaderValueOption
+		if c.code == codes.OK {
+			headers = resp.GetOkResponse().GetHeaders()
+		} else {
+			if code := resp.GetDeniedResponse().GetStatus().GetCode(); code != typev3.StatusCode_Forbidden {
+				t.Errorf("%s: HTTP status %s instead of Forbidden", c.source, code)
+			}
+			headers = resp.GetDeniedResponse().GetHeaders()
+		}
+		decision := ""
+		for _, h := range headers {
+			if h.GetHeader().GetKey() == "X-IP2Proxy-Decision" {
+				decision = h.GetHeader().GetValue()
+			}
+		}
+		if code := codes.Code(resp.GetStatus().GetCode()); code != c.code || decision != c.decision {
+			t.Errorf("%s (%s): %s with decision %q instead of %s with %q", c.source, c.xff, code, decision, c.code, c.decision)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Package ip2proxyfiber adapts the IP2Proxy middleware to the Fiber web framework.
+package ip2proxyfiber
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// ContextKey is the key of the proxy record in the Fiber locals.
+const ContextKey = "ip2proxy"
+
+// New returns a Fiber handler looking up the client of each request with the IP2Proxy middleware.
+// The request is converted to net/http for the middleware, so that the client IP extractor, the shadow mode,
+// the audit callback and the deny and challenge handlers are honoured as by Middleware.Handler. The proxy record
+// is stored in the locals. Use m.WithPolicy to enforce different policies on route groups.
+func New(m *ip2proxy.Middleware) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r, err := adaptor.ConvertRequest(c, true)
+		if err != nil {
+			return c.Next()
+		}
+
+		r, ok := m.Enforce(&responseWriter{c: c, header: http.Header{}}, r)
+		if !ok {
+			return nil
+		}
+
+		if rec, found := ip2proxy.RecordFromContext(r.Context()); found {
+			c.Locals(ContextKey, rec)
+		}
+		return c.Next()
+	}
+}
+
+// Record returns the proxy record stored by the middleware.
+func Record(c *fiber.Ctx) (ip2proxy.IP2ProxyRecord, bool) {
+	rec, ok := c.Locals(ContextKey).(ip2proxy.IP2ProxyRecord)
+	return rec, ok
+}
+
+// an http.ResponseWriter writing to the Fiber response, for the deny and challenge handlers
+type responseWriter struct {
+	c           *fiber.Ctx
+	header      http.Header
+	wroteHeader bool
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	for k, values := range w.header {
+		for _, v := range values {
+			w.c.Response().Header.Add(k, v)
+		}
+	}
+	w.c.Status(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.c.Write(b)
+}
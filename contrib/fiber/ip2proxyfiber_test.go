@@ -0,0 +1,71 @@
+package ip2proxyfiber
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+// the requests go through the deny and challenge handlers of the middleware, the others get their record
+// in the locals
+func TestNew(t *testing.T) {
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the client addresses are given by X-Forwarded-For, the requests of app.Test coming from the same peer
+	extractor, err := ip2proxy.NewClientIPExtractor([]string{"0.0.0.0/0", "::/0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := ip2proxy.Chain(ip2proxy.BlockProxyTypes("TOR"), ip2proxy.ChallengeDCH())
+	m := ip2proxy.NewMiddleware(db, policy).SetClientIPExtractor(extractor)
+
+	for _, c := range []struct {
+		name     string
+		m        *ip2proxy.Middleware
+		ip       string
+		code     int
+		body     string
+		location string
+	}{
+		{"allow", m, ip2proxytest.SampleVPN, http.StatusOK, "VPN", ""},
+		{"deny", m, ip2proxytest.SampleTOR, http.StatusForbidden, "Forbidden\n", ""},
+		{"custom deny", m.WithPolicy(policy).SetDenyHandler(ip2proxy.DenyWithJSON(http.StatusUnavailableForLegalReasons, map[string]string{"error": "proxy"})),
+			ip2proxytest.SampleTOR, http.StatusUnavailableForLegalReasons, `{"error":"proxy"}`, ""},
+		{"challenge", m.WithPolicy(policy).SetChallengeHandler(ip2proxy.DenyWithRedirect("/captcha", "return")),
+			ip2proxytest.SampleDCH, http.StatusSeeOther, "", "/captcha?return=%2F"},
+		{"challenge without handler", m, ip2proxytest.SampleDCH, http.StatusOK, "DCH", ""},
+		{"shadow", m.WithPolicy(policy).SetShadowMode(true), ip2proxytest.SampleTOR, http.StatusOK, "TOR", ""},
+	} {
+		app := fiber.New()
+		app.Use(New(c.m))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			rec, ok := Record(ctx)
+			if !ok {
+				return ctx.Status(http.StatusInternalServerError).SendString("no record")
+			}
+			return ctx.SendString(rec.ProxyType)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-For", c.ip)
+		resp, err := app.Test(r)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.code || (c.body != "" && string(body) != c.body) || resp.Header.Get("Location") != c.location {
+			t.Errorf("%s: %d %q (Location %q) instead of %d %q (Location %q)", c.name, resp.StatusCode, body,
+				resp.Header.Get("Location"), c.code, c.body, c.location)
+		}
+	}
+}
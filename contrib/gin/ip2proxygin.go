@@ -0,0 +1,39 @@
+// Package ip2proxygin adapts the IP2Proxy middleware to the Gin web framework.
+package ip2proxygin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// ContextKey is the key of the proxy record in the Gin context.
+const ContextKey = "ip2proxy"
+
+// Middleware returns a Gin handler looking up the client of each request with the IP2Proxy middleware.
+// The proxy record is stored in the Gin context and the request context; blocked requests are answered
+// by the deny handler of the middleware and aborted. Use m.WithPolicy to enforce different policies on route groups.
+func Middleware(m *ip2proxy.Middleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := m.Enforce(c.Writer, c.Request)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		if rec, found := ip2proxy.RecordFromContext(r.Context()); found {
+			c.Set(ContextKey, rec)
+		}
+		c.Request = r
+		c.Next()
+	}
+}
+
+// Record returns the proxy record stored by the middleware.
+func Record(c *gin.Context) (ip2proxy.IP2ProxyRecord, bool) {
+	v, ok := c.Get(ContextKey)
+	if !ok {
+		return ip2proxy.IP2ProxyRecord{}, false
+	}
+	rec, ok := v.(ip2proxy.IP2ProxyRecord)
+	return rec, ok
+}
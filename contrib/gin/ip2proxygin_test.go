@@ -0,0 +1,50 @@
+package ip2proxygin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+// the blocked clients are denied and the others get their record in the Gin context
+func TestMiddleware(t *testing.T) {
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(ip2proxy.NewMiddleware(db, ip2proxy.BlockProxyTypes("TOR"))))
+	router.GET("/", func(c *gin.Context) {
+		rec, ok := Record(c)
+		if !ok {
+			c.String(http.StatusInternalServerError, "no record")
+			return
+		}
+		c.String(http.StatusOK, rec.ProxyType)
+	})
+
+	for _, c := range []struct {
+		ip   string
+		code int
+		body string
+	}{
+		{ip2proxytest.SampleVPN, http.StatusOK, "VPN"},
+		{ip2proxytest.SampleNotProxy, http.StatusOK, "-"},
+		{ip2proxytest.SampleTOR, http.StatusForbidden, "Forbidden\n"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != c.code || w.Body.String() != c.body {
+			t.Errorf("%s: %d %q instead of %d %q", c.ip, w.Code, w.Body.String(), c.code, c.body)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/ip2location/ip2proxy-go/contrib/grpc
+
+go 1.21
+
+require (
+	github.com/ip2location/ip2proxy-go/v4 v4.1.0
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	lukechampine.com/uint128 v1.2.0 // indirect
+)
+
+replace github.com/ip2location/ip2proxy-go/v4 => ../../
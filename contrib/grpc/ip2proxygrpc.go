@@ -0,0 +1,146 @@
+// Package ip2proxygrpc serves IP2Proxy lookups over gRPC and queries them with a client implementing
+// ip2proxy.Resolver, so that services can share one BIN file loaded by a lookup server:
+//
+//	s := grpc.NewServer()
+//	lookupv1.RegisterLookupServiceServer(s, ip2proxygrpc.NewServer(db))
+//
+//	conn, err := grpc.NewClient("ip2proxy:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	mw := ip2proxy.NewMiddleware(ip2proxygrpc.NewClient(conn), ip2proxy.BlockProxyTypes("TOR"))
+//
+// The service is defined by lookupv1/lookup.proto.
+package ip2proxygrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative lookupv1/lookup.proto
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/contrib/grpc/lookupv1"
+	"github.com/ip2location/ip2proxy-go/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sentinel of the records of invalid addresses, as returned by the DB
+const msgInvalidIP string = "INVALID IP ADDRESS"
+
+// The Server struct implements the lookup service with a resolver, e.g. a DB or a ReloadableDB.
+type Server struct {
+	lookupv1.UnimplementedLookupServiceServer
+	resolver ip2proxy.Resolver
+}
+
+// NewServer initializes with the resolver used for the lookups.
+func NewServer(resolver ip2proxy.Resolver) *Server {
+	var s = &Server{}
+	s.resolver = resolver
+	return s
+}
+
+// Lookup returns the proxy record of the IP address; invalid addresses fail with InvalidArgument and lookup
+// errors with Internal.
+func (s *Server) Lookup(ctx context.Context, req *lookupv1.LookupRequest) (*lookupv1.LookupResponse, error) {
+	if net.ParseIP(req.GetIp()) == nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid IP address")
+	}
+	rec, err := s.resolver.GetAll(req.GetIp())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &lookupv1.LookupResponse{
+		IsProxy:     int32(rec.IsProxy),
+		ProxyType:   rec.ProxyType,
+		CountryCode: rec.CountryShort,
+		CountryName: rec.CountryLong,
+		RegionName:  rec.Region,
+		CityName:    rec.City,
+		Isp:         rec.Isp,
+		Domain:      rec.Domain,
+		UsageType:   rec.UsageType,
+		Asn:         rec.Asn,
+		As:          rec.As,
+		LastSeen:    rec.LastSeen,
+		Threat:      rec.Threat,
+		Provider:    rec.Provider,
+	}, nil
+}
+
+// The Client struct is a Resolver querying the lookup service, e.g. in the middleware.
+type Client struct {
+	client  lookupv1.LookupServiceClient
+	timeout time.Duration
+}
+
+// NewClient initializes with the connection to the lookup server.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	var c = &Client{}
+	c.client = lookupv1.NewLookupServiceClient(conn)
+	c.timeout = 5 * time.Second
+	return c
+}
+
+// SetTimeout sets the timeout of the lookups; 5 seconds by default.
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+	c.timeout = timeout
+	return c
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+func (c *Client) GetAll(ipAddress string) (ip2proxy.IP2ProxyRecord, error) {
+	return c.GetAllContext(context.Background(), ipAddress)
+}
+
+// GetAllContext is GetAll with a context, e.g. the one of the request being served.
+func (c *Client) GetAllContext(ctx context.Context, ipAddress string) (ip2proxy.IP2ProxyRecord, error) {
+	x := invalidRecord()
+	if net.ParseIP(ipAddress) == nil {
+		return x, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	res, err := c.client.Lookup(ctx, &lookupv1.LookupRequest{Ip: ipAddress})
+	if err != nil {
+		return x, err
+	}
+
+	return ip2proxy.IP2ProxyRecord{
+		IsProxy:      int8(res.GetIsProxy()),
+		ProxyType:    res.GetProxyType(),
+		CountryShort: res.GetCountryCode(),
+		CountryLong:  res.GetCountryName(),
+		Region:       res.GetRegionName(),
+		City:         res.GetCityName(),
+		Isp:          res.GetIsp(),
+		Domain:       res.GetDomain(),
+		UsageType:    res.GetUsageType(),
+		Asn:          res.GetAsn(),
+		As:           res.GetAs(),
+		LastSeen:     res.GetLastSeen(),
+		Threat:       res.GetThreat(),
+		Provider:     res.GetProvider(),
+	}, nil
+}
+
+// the record of invalid addresses, every field holding the sentinel
+func invalidRecord() ip2proxy.IP2ProxyRecord {
+	return ip2proxy.IP2ProxyRecord{
+		IsProxy:      -1,
+		ProxyType:    msgInvalidIP,
+		CountryShort: msgInvalidIP,
+		CountryLong:  msgInvalidIP,
+		Region:       msgInvalidIP,
+		City:         msgInvalidIP,
+		Isp:          msgInvalidIP,
+		Domain:       msgInvalidIP,
+		UsageType:    msgInvalidIP,
+		Asn:          msgInvalidIP,
+		As:           msgInvalidIP,
+		LastSeen:     msgInvalidIP,
+		Threat:       msgInvalidIP,
+		Provider:     msgInvalidIP,
+	}
+}
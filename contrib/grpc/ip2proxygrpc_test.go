@@ -0,0 +1,57 @@
+package ip2proxygrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ip2location/ip2proxy-go/contrib/grpc/lookupv1"
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// the client returns the records of the DB of the server and is usable as the resolver of the middleware
+func TestClient(t *testing.T) {
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	lookupv1.RegisterLookupServiceServer(s, NewServer(db))
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := NewClient(conn)
+
+	for _, ip := range []string{ip2proxytest.SampleVPN, ip2proxytest.SampleTOR, ip2proxytest.SampleVPN6, ip2proxytest.SampleNotProxy, "not an address"} {
+		want, _ := db.GetAll(ip)
+		if got, err := c.GetAll(ip); err != nil || got != want {
+			t.Errorf("%s: %+v (%v) instead of %+v", ip, got, err, want)
+		}
+	}
+
+	m := ip2proxy.NewMiddleware(c, ip2proxy.BlockProxyTypes("TOR"))
+	if _, d, err := m.Lookup(ip2proxytest.SampleTOR); err != nil || d != ip2proxy.DecisionDeny {
+		t.Errorf("decision %s (%v) instead of deny", d, err)
+	}
+
+	_, err = lookupv1.NewLookupServiceClient(conn).Lookup(context.Background(), &lookupv1.LookupRequest{Ip: "not an address"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("%v instead of InvalidArgument", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package ip2proxyotel exports the IP2Proxy telemetry with OpenTelemetry metrics and traces.
+package ip2proxyotel
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// name of the instrumentation scope
+const scope = "github.com/ip2location/ip2proxy-go/v4"
+
+// The Telemetry struct implements ip2proxy.Telemetry with a meter and a tracer. The instruments are
+// created on first use.
+type Telemetry struct {
+	meter  metric.Meter
+	tracer trace.Tracer
+
+	mu         sync.Mutex
+	counters   map[string]metric.Int64Counter
+	histograms map[string]metric.Float64Histogram
+}
+
+// New initializes with the meter and tracer providers, e.g. otel.GetMeterProvider() and otel.GetTracerProvider().
+func New(mp metric.MeterProvider, tp trace.TracerProvider) *Telemetry {
+	var t = &Telemetry{}
+	t.meter = mp.Meter(scope)
+	t.tracer = tp.Tracer(scope)
+	t.counters = make(map[string]metric.Int64Counter)
+	t.histograms = make(map[string]metric.Float64Histogram)
+	return t
+}
+
+// Count adds delta to the counter.
+func (t *Telemetry) Count(name string, delta int64, attrs ...ip2proxy.Attr) {
+	t.mu.Lock()
+	c, ok := t.counters[name]
+	if !ok {
+		var err error
+		if c, err = t.meter.Int64Counter(name); err != nil {
+			t.mu.Unlock()
+			return
+		}
+		t.counters[name] = c
+	}
+	t.mu.Unlock()
+	c.Add(context.Background(), delta, metric.WithAttributes(attributes(attrs)...))
+}
+
+// Observe records a value of the histogram, in seconds for the metrics named *_seconds.
+func (t *Telemetry) Observe(name string, value float64, attrs ...ip2proxy.Attr) {
+	t.mu.Lock()
+	h, ok := t.histograms[name]
+	if !ok {
+		var opts []metric.Float64HistogramOption
+		if strings.HasSuffix(name, "_seconds") {
+			opts = append(opts, metric.WithUnit("s"))
+		}
+		var err error
+		if h, err = t.meter.Float64Histogram(name, opts...); err != nil {
+			t.mu.Unlock()
+			return
+		}
+		t.histograms[name] = h
+	}
+	t.mu.Unlock()
+	h.Record(context.Background(), value, metric.WithAttributes(attributes(attrs)...))
+}
+
+// StartSpan starts a span, which records the error it ends with.
+func (t *Telemetry) StartSpan(ctx context.Context, name string, attrs ...ip2proxy.Attr) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attributes(attrs)...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func attributes(attrs []ip2proxy.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		kvs[i] = attribute.String(a.Key, a.Value)
+	}
+	return kvs
+}
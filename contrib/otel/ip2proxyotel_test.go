@@ -0,0 +1,73 @@
+package ip2proxyotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// the lookups and decisions are exported as counters and a histogram, and as spans
+func TestTelemetry(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	spans := tracetest.NewSpanRecorder()
+	telemetry := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetTelemetry(telemetry)
+	m := ip2proxy.NewMiddleware(db, ip2proxy.BlockProxyTypes("TOR")).SetTelemetry(telemetry)
+
+	ips := []string{ip2proxytest.SampleVPN, ip2proxytest.SampleTOR, ip2proxytest.SampleNotProxy}
+	for _, ip := range ips {
+		if _, _, _, err := m.Evaluate(ip, nil); err != nil {
+			t.Fatalf("%s: %v", ip, err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	totals := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			switch data := metric.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, p := range data.DataPoints {
+					totals[metric.Name] += p.Value
+				}
+			case metricdata.Histogram[float64]:
+				if metric.Unit != "s" {
+					t.Errorf("%s in %q instead of s", metric.Name, metric.Unit)
+				}
+				for _, p := range data.DataPoints {
+					totals[metric.Name] += int64(p.Count)
+				}
+			}
+		}
+	}
+	n := int64(len(ips))
+	for _, name := range []string{ip2proxy.MetricLookups, ip2proxy.MetricLookupDuration, ip2proxy.MetricDecisions} {
+		if totals[name] != n {
+			t.Errorf("%s: %d instead of %d", name, totals[name], n)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, s := range spans.Ended() {
+		counts[s.Name()]++
+	}
+	if counts[ip2proxy.SpanLookup] != len(ips) || counts[ip2proxy.SpanEvaluate] != len(ips) {
+		t.Errorf("spans %v instead of %d of each", counts, len(ips))
+	}
+}
@@ -0,0 +1,86 @@
+// Package ip2proxyprometheus exports the IP2Proxy telemetry as Prometheus metrics. Spans are not supported
+// by Prometheus and are ignored.
+package ip2proxyprometheus
+
+import (
+	"context"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The Telemetry struct implements ip2proxy.Telemetry with the metrics registered by New.
+type Telemetry struct {
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+// New registers the metrics of the package with the registerer, e.g. prometheus.DefaultRegisterer.
+func New(reg prometheus.Registerer) (*Telemetry, error) {
+	var t = &Telemetry{}
+	t.counters = map[string]*prometheus.CounterVec{
+		ip2proxy.MetricLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ip2proxy.MetricLookups,
+			Help: "IP2Proxy lookups by source and outcome.",
+		}, []string{"source", "outcome"}),
+		ip2proxy.MetricDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ip2proxy.MetricDecisions,
+			Help: "IP2Proxy policy decisions.",
+		}, []string{"decision", "shadow"}),
+		ip2proxy.MetricReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ip2proxy.MetricReloads,
+			Help: "IP2Proxy BIN files swapped in.",
+		}, nil),
+	}
+	t.histograms = map[string]*prometheus.HistogramVec{
+		ip2proxy.MetricLookupDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    ip2proxy.MetricLookupDuration,
+			Help:    "Duration of the IP2Proxy lookups.",
+			Buckets: []float64{1e-6, 5e-6, 25e-6, 1e-4, 5e-4, 0.0025, 0.01, 0.05, 0.25, 1, 5},
+		}, []string{"source"}),
+	}
+
+	for _, c := range t.counters {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range t.histograms {
+		if err := reg.Register(h); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Count adds delta to the counter; unknown metrics are ignored.
+func (t *Telemetry) Count(name string, delta int64, attrs ...ip2proxy.Attr) {
+	if c, ok := t.counters[name]; ok {
+		if m, err := c.GetMetricWithLabelValues(labelValues(attrs)...); err == nil {
+			m.Add(float64(delta))
+		}
+	}
+}
+
+// Observe records a value of the histogram; unknown metrics are ignored.
+func (t *Telemetry) Observe(name string, value float64, attrs ...ip2proxy.Attr) {
+	if h, ok := t.histograms[name]; ok {
+		if m, err := h.GetMetricWithLabelValues(labelValues(attrs)...); err == nil {
+			m.Observe(value)
+		}
+	}
+}
+
+// StartSpan does nothing.
+func (t *Telemetry) StartSpan(ctx context.Context, name string, attrs ...ip2proxy.Attr) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+// the attributes are given in the order of the label names
+func labelValues(attrs []ip2proxy.Attr) []string {
+	values := make([]string, len(attrs))
+	for i, a := range attrs {
+		values[i] = a.Value
+	}
+	return values
+}
@@ -0,0 +1,54 @@
+package ip2proxyprometheus
+
+import (
+	"testing"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// the lookups and decisions are counted by their labels and the lookups are timed
+func TestTelemetry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	telemetry, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(reg); err == nil {
+		t.Error("metrics registered twice")
+	}
+
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetTelemetry(telemetry)
+	m := ip2proxy.NewMiddleware(db, ip2proxy.BlockProxyTypes("TOR")).SetTelemetry(telemetry)
+
+	for _, ip := range []string{ip2proxytest.SampleVPN, ip2proxytest.SampleTOR, ip2proxytest.SampleNotProxy} {
+		if _, _, _, err := m.Evaluate(ip, nil); err != nil {
+			t.Fatalf("%s: %v", ip, err)
+		}
+	}
+
+	lookups := telemetry.counters[ip2proxy.MetricLookups]
+	decisions := telemetry.counters[ip2proxy.MetricDecisions]
+	for _, c := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"proxy lookups", testutil.ToFloat64(lookups.WithLabelValues("bin", "proxy")), 2},
+		{"not_proxy lookups", testutil.ToFloat64(lookups.WithLabelValues("bin", "not_proxy")), 1},
+		{"deny decisions", testutil.ToFloat64(decisions.WithLabelValues("deny", "false")), 1},
+		{"allow decisions", testutil.ToFloat64(decisions.WithLabelValues("allow", "false")), 2},
+		{"timed lookups", float64(testutil.CollectAndCount(telemetry.histograms[ip2proxy.MetricLookupDuration])), 1},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s: %v instead of %v", c.name, c.got, c.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Command basic looks up the IP addresses given as arguments and prints their proxy fields.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+func main() {
+	dbPath := flag.String("db", "", "path to the IP2Proxy BIN file, the embedded sample if empty")
+	flag.Parse()
+
+	var db *ip2proxy.DB
+	var err error
+	if *dbPath != "" {
+		db, err = ip2proxy.OpenDB(*dbPath)
+	} else {
+		db, err = ip2proxytest.OpenSampleDB()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	fmt.Printf("PX%s database of %s\n", db.PackageVersion(), db.DatabaseVersion())
+	for _, ip := range flag.Args() {
+		// all the fields at once
+		rec, err := db.GetAll(ip)
+		if err != nil {
+			log.Printf("%s: %v", ip, err)
+			continue
+		}
+		fmt.Printf("%s: isProxy=%d proxyType=%s country=%s (%s) usageType=%s asn=%s threat=%s provider=%s\n",
+			ip, rec.IsProxy, rec.ProxyType, rec.CountryShort, rec.CountryLong, rec.UsageType, rec.Asn, rec.Threat,
+			rec.Provider)
+
+		// a single field, reading only its string
+		if proxyType, err := db.GetProxyType(ip); err == nil {
+			fmt.Printf("%s: GetProxyType=%s\n", ip, proxyType)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Command daemonclient looks up the IP addresses given as arguments through the ip2proxy daemon, which holds the
+// BIN file for all the processes of the host:
+//
+//	ip2proxy serve -db IP2PROXY.BIN -listen unix:/run/ip2proxy.sock &
+//	go run ./daemonclient -addr unix:/run/ip2proxy.sock 192.0.2.65
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address of the daemon: host:port, an http(s):// URL, unix:/path or unix:@name")
+	token := flag.String("token", "", "bearer token of the daemon, if its clients must authenticate")
+	flag.Parse()
+
+	client, err := ip2proxy.NewDaemonClient(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	client.SetTimeout(time.Second)
+	if *token != "" {
+		client.SetToken(*token)
+	}
+
+	// DaemonClient is a Resolver, so it can back a Middleware or a Matcher like a DB
+	var resolver ip2proxy.Resolver = client
+	for _, ip := range flag.Args() {
+		rec, err := resolver.GetAll(ip)
+		if err != nil {
+			log.Printf("%s: %v", ip, err)
+			continue
+		}
+		fmt.Printf("%s: isProxy=%d proxyType=%s country=%s\n", ip, rec.IsProxy, rec.ProxyType, rec.CountryShort)
+	}
+}
@@ -0,0 +1,74 @@
+// Command enrich reads a CSV stream whose first column is an IP address, e.g. extracted from access logs, and
+// writes it back with the proxy type, country, usage type and threat appended:
+//
+//	printf 'ip,user\n192.0.2.65,alice\n198.51.100.1,bob\n' | go run ./enrich -header
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+func main() {
+	dbPath := flag.String("db", "", "path to the IP2Proxy BIN file, the embedded sample if empty")
+	header := flag.Bool("header", false, "the first line is a header")
+	flag.Parse()
+
+	var db *ip2proxy.DB
+	var err error
+	if *dbPath != "" {
+		db, err = ip2proxy.OpenDB(*dbPath)
+	} else {
+		db, err = ip2proxytest.OpenSampleDB()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	in := csv.NewReader(os.Stdin)
+	in.FieldsPerRecord = -1
+	in.ReuseRecord = true
+	out := csv.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if *header {
+		row, err := in.Read()
+		if err != nil {
+			log.Fatal(err)
+		}
+		out.Write(append(row, "proxy_type", "country_code", "usage_type", "threat"))
+	}
+
+	for {
+		row, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(row) == 0 {
+			continue
+		}
+
+		// a record from the pool, its strings held in a buffer of the record: no allocation per field, but the
+		// strings are only valid until the record is released, so they are written out first
+		rec, err := db.GetAllPooled(row[0])
+		if err != nil {
+			out.Write(append(row, "", "", "", ""))
+		} else {
+			out.Write(append(row, rec.ProxyType, rec.CountryShort, rec.UsageType, rec.Threat))
+		}
+		ip2proxy.ReleaseRecord(rec)
+	}
+	if err := out.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+// Command memory opens the BIN file from memory rather than from its path, as done for files embedded with
+// go:embed or fetched from object storage, and looks up the IP addresses given as arguments.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+// a bytes.Reader with the Close method OpenDBWithReader requires
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+func main() {
+	dbPath := flag.String("db", "", "path to the IP2Proxy BIN file, the embedded sample if empty")
+	flag.Parse()
+
+	var bin []byte
+	var err error
+	if *dbPath != "" {
+		bin, err = os.ReadFile(*dbPath)
+	} else {
+		bin, err = ip2proxytest.SampleBytes()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the simplest: the slice is read in place, the strings of the records are copied
+	db, err := ip2proxy.OpenDBFromBytes(bin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// any io.ReaderAt with Read and Close works too, e.g. a memory-mapped file or a cached object
+	db2, err := ip2proxy.OpenDBWithReader(memoryFile{bytes.NewReader(bin)})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db2.Close()
+
+	for _, ip := range flag.Args() {
+		rec, err := db.GetAll(ip)
+		if err != nil {
+			log.Printf("%s: %v", ip, err)
+			continue
+		}
+		isProxy, _ := db2.IsProxy(ip)
+		fmt.Printf("%s: proxyType=%s country=%s, IsProxy from the reader=%d\n", ip, rec.ProxyType, rec.CountryShort, isProxy)
+	}
+}
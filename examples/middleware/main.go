@@ -0,0 +1,64 @@
+// Command middleware serves HTTP behind a reverse proxy, denying the clients coming from Tor exits and VPNs and
+// greeting the others with their proxy record:
+//
+//	go run ./middleware -listen :8080
+//	curl -H "X-Forwarded-For: 192.0.2.65" localhost:8080
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+func main() {
+	dbPath := flag.String("db", "", "path to the IP2Proxy BIN file, the embedded sample if empty")
+	listen := flag.String("listen", "127.0.0.1:8080", "address to listen on")
+	trusted := flag.String("trusted-proxies", "127.0.0.0/8,::1", "comma separated CIDRs of the reverse proxies setting X-Forwarded-For")
+	flag.Parse()
+
+	var db *ip2proxy.DB
+	var err error
+	if *dbPath != "" {
+		db, err = ip2proxy.OpenDB(*dbPath)
+	} else {
+		db, err = ip2proxytest.OpenSampleDB()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// the client address is only taken from X-Forwarded-For when the peer is a trusted proxy
+	extractor, err := ip2proxy.NewClientIPExtractor(strings.Split(*trusted, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mw := ip2proxy.NewMiddleware(db, ip2proxy.BlockProxyTypes("TOR", "VPN")).
+		SetClientIPExtractor(extractor).
+		SetDenyHandler(ip2proxy.DenyWithJSON(http.StatusForbidden, map[string]string{"error": "proxies are not allowed"})).
+		SetAuditFunc(func(e ip2proxy.AuditEvent) {
+			log.Printf("%s %s: %s", e.Decision, e.ClientIP, e.Record.ProxyType)
+		}).
+		EnableDecisionCache(10*time.Minute, 10000)
+
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the record of the allowed clients is in the request context
+		rec, ok := ip2proxy.RecordFromContext(r.Context())
+		if !ok || rec.IsProxy <= 0 {
+			fmt.Fprintln(w, "hello")
+			return
+		}
+		fmt.Fprintf(w, "hello, %s user from %s\n", rec.ProxyType, rec.CountryLong)
+	})
+
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, mw.Handler(hello)))
+}
@@ -0,0 +1,66 @@
+// Command updater keeps looking up an IP address while the BIN file is replaced, e.g. by a cron job downloading
+// the monthly release, to show how ReloadableDB swaps the new file in without stopping the lookups:
+//
+//	go run ./updater -db /var/lib/ip2proxy/IP2PROXY.BIN -ip 1.2.3.4
+//	cp IP2PROXY-NEW.BIN /var/lib/ip2proxy/IP2PROXY.BIN.tmp && mv /var/lib/ip2proxy/IP2PROXY.BIN.tmp /var/lib/ip2proxy/IP2PROXY.BIN
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+func main() {
+	dbPath := flag.String("db", "", "path to the IP2Proxy BIN file to watch")
+	ip := flag.String("ip", "192.0.2.65", "IP address looked up every second")
+	interval := flag.Duration("interval", 10*time.Second, "how often the file is checked for changes")
+	flag.Parse()
+	if *dbPath == "" {
+		log.Fatal("missing -db")
+	}
+
+	db, err := ip2proxy.OpenReloadableDB(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// warn when a release changes more than a fifth of the ranges of a proxy type, e.g. a truncated download
+	db.SetChurnAlert(ip2proxy.ChurnThresholds{MaxRatio: 0.2, MinRanges: 100}, func(s ip2proxy.ChurnSummary) {
+		log.Printf("database %s to %s: unusual changes of %v", s.OldVersion, s.NewVersion, s.Exceeded)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// the file is only swapped in once it stopped changing and opened successfully; an invalid file is skipped
+	go db.WatchFile(ctx, *dbPath, *interval, func(e ip2proxy.ReloadEvent) {
+		if e.Err != nil {
+			log.Printf("reload %s: %v, still using %s", e.Path, e.Err, db.DatabaseVersion())
+			return
+		}
+		log.Printf("reloaded %s: version %s, generation %d", e.Path, e.Version, e.Generation)
+	})
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		rec, err := db.GetAll(*ip)
+		if err != nil {
+			log.Printf("%s: %v", *ip, err)
+			continue
+		}
+		log.Printf("%s: proxyType=%s (database %s)", *ip, rec.ProxyType, db.DatabaseVersion())
+	}
+}
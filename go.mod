@@ -1,5 +1,5 @@
 module github.com/ip2location/ip2proxy-go/v4
 
-go 1.14
+go 1.18
 
 require lukechampine.com/uint128 v1.2.0
@@ -0,0 +1,86 @@
+//go:build ignore
+
+// Builds the sample BIN file and its known answers: go generate ./internal/sampledb
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// the sample ranges, in the documentation address blocks so that no real address is listed
+var ranges = []struct {
+	from, to string
+	rec      ip2proxy.IP2ProxyRecord
+}{
+	{"192.0.2.0", "192.0.2.63", record("VPN", "US", "United States of America", "California", "Los Angeles", "DCH", "64500", "EXAMPLE-VPN", "-", "ExampleVPN")},
+	{"192.0.2.64", "192.0.2.127", record("TOR", "DE", "Germany", "Berlin", "Berlin", "DCH", "64501", "EXAMPLE-HOSTING", "SPAM/BOTNET", "-")},
+	{"192.0.2.128", "192.0.2.191", record("DCH", "NL", "Netherlands (Kingdom of the)", "Noord-Holland", "Amsterdam", "DCH", "64502", "EXAMPLE-CLOUD", "SCANNER", "-")},
+	{"198.51.100.0", "198.51.100.127", record("PUB", "BR", "Brazil", "Sao Paulo", "Sao Paulo", "ISP", "64503", "EXAMPLE-TELECOM", "-", "-")},
+	{"198.51.100.128", "198.51.100.255", record("WEB", "FR", "France", "Ile-de-France", "Paris", "DCH", "64504", "EXAMPLE-PROXY", "-", "-")},
+	{"203.0.113.0", "203.0.113.31", record("SES", "US", "United States of America", "California", "Mountain View", "SES", "64505", "EXAMPLE-SEARCH", "-", "-")},
+	{"203.0.113.32", "203.0.113.63", record("RES", "GB", "United Kingdom of Great Britain and Northern Ireland", "England", "London", "ISP/MOB", "64506", "EXAMPLE-MOBILE", "-", "ExampleResidential")},
+	{"203.0.113.64", "203.0.113.95", record("CPN", "JP", "Japan", "Tokyo", "Tokyo", "CDN", "64507", "EXAMPLE-PRIVACY", "-", "ExampleRelay")},
+	{"203.0.113.96", "203.0.113.127", record("EPN", "CA", "Canada", "Ontario", "Toronto", "COM", "64508", "EXAMPLE-ENTERPRISE", "-", "ExampleZeroTrust")},
+	{"2001:db8::", "2001:db8::ffff", record("VPN", "SE", "Sweden", "Stockholms lan", "Stockholm", "DCH", "64509", "EXAMPLE-VPN6", "-", "ExampleVPN")},
+	{"2001:db8:1::", "2001:db8:1::ffff", record("TOR", "CH", "Switzerland", "Zurich", "Zurich", "DCH", "64510", "EXAMPLE-TOR6", "BOTNET", "-")},
+}
+
+func record(proxyType, code, country, region, city, usageType, asn, as, threat, provider string) ip2proxy.IP2ProxyRecord {
+	return ip2proxy.IP2ProxyRecord{
+		ProxyType: proxyType, CountryShort: code, CountryLong: country, Region: region, City: city,
+		Isp: "Example Networks", Domain: "example.net", UsageType: usageType, Asn: asn, As: as,
+		LastSeen: "1", Threat: threat, Provider: provider,
+	}
+}
+
+func main() {
+	w, err := ip2proxy.NewWriter(11, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, r := range ranges {
+		if err := w.AddRange(r.from, r.to, r.rec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var bin bytes.Buffer
+	if _, err := w.WriteTo(&bin); err != nil {
+		log.Fatal(err)
+	}
+
+	// compressed, the index of the empty slots being mostly zeros
+	var gz bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	zw.Write(bin.Bytes())
+	if err := zw.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("IP2PROXY-SAMPLE.BIN.gz", gz.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := ip2proxy.OpenDBFromBytes(bin.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	answers, err := db.GoldenAnswers(len(ranges) * 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.Create("answers.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("# Known answers of IP2PROXY-SAMPLE.BIN, written by gen.go.\n\n")
+	if err := ip2proxy.WriteKnownAnswers(f, answers); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,55 @@
+// Package sampledb embeds a small PX11 sample BIN file and its known answers, for the examples and the tests of
+// the module to run without downloading a database. The ranges are in the documentation address blocks,
+// 192.0.2.0/24, 198.51.100.0/24, 203.0.113.0/24 and 2001:db8::/32, one per proxy type.
+package sampledb
+
+//go:generate go run gen.go
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"io"
+	"sync"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+//go:embed IP2PROXY-SAMPLE.BIN.gz
+var compressed []byte
+
+//go:embed answers.txt
+var answers []byte
+
+var sample struct {
+	once sync.Once
+	bin  []byte
+	err  error
+}
+
+// Bytes returns the sample BIN file. The slice is shared and must not be modified.
+func Bytes() ([]byte, error) {
+	sample.once.Do(func() {
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			sample.err = err
+			return
+		}
+		sample.bin, sample.err = io.ReadAll(zr)
+	})
+	return sample.bin, sample.err
+}
+
+// Open opens the sample BIN file from memory.
+func Open() (*ip2proxy.DB, error) {
+	bin, err := Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return ip2proxy.OpenDBFromBytes(bin)
+}
+
+// KnownAnswers returns the known answers of the sample BIN file, for DB.VerifyKnownAnswers.
+func KnownAnswers() ([]ip2proxy.KnownAnswer, error) {
+	return ip2proxy.ParseKnownAnswers(bytes.NewReader(answers))
+}
@@ -0,0 +1,98 @@
+package sampledb
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// the addresses the known answers must cover: the first and last addresses of each IP version
+var requiredAnswers = []string{"0.0.0.0", "255.255.255.255", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}
+
+func knownAnswers(t *testing.T) []ip2proxy.KnownAnswer {
+	t.Helper()
+	answers, err := KnownAnswers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool, len(answers))
+	for _, a := range answers {
+		listed[a.IP] = true
+	}
+	for _, ip := range requiredAnswers {
+		if !listed[ip] {
+			t.Errorf("no known answer for %s", ip)
+		}
+	}
+	return answers
+}
+
+func verify(t *testing.T, db *ip2proxy.DB, answers []ip2proxy.KnownAnswer) {
+	t.Helper()
+	mismatches, checked, err := db.VerifyKnownAnswers(answers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != len(answers) {
+		t.Errorf("%d known answers checked out of %d", checked, len(answers))
+	}
+	for _, m := range mismatches {
+		t.Errorf("line %d, %s: %s %q instead of %q", m.Answer.Line, m.Answer.IP, m.Field, m.Actual, m.Expected)
+	}
+}
+
+// every known answer, at the first and last addresses of the ranges and of their gaps, read from memory and
+// from a file
+func TestKnownAnswers(t *testing.T) {
+	answers := knownAnswers(t)
+
+	db, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	verify(t, db, answers)
+
+	bin, err := Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "IP2PROXY-SAMPLE.BIN")
+	if err := os.WriteFile(path, bin, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fdb, err := ip2proxy.OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdb.Close()
+	verify(t, fdb, answers)
+}
+
+// the IPv4 answers hold for the IPv4-mapped IPv6 addresses
+func TestKnownAnswersIPv4Mapped(t *testing.T) {
+	var mapped []ip2proxy.KnownAnswer
+	for _, a := range knownAnswers(t) {
+		addr, err := netip.ParseAddr(a.IP)
+		if err != nil {
+			t.Fatalf("line %d: %v", a.Line, err)
+		}
+		if addr.Is4() {
+			a.IP = netip.AddrFrom16(addr.As16()).String()
+			mapped = append(mapped, a)
+		}
+	}
+	if len(mapped) == 0 {
+		t.Fatal("no IPv4 known answer")
+	}
+
+	db, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	verify(t, db, mapped)
+}
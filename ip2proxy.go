@@ -5,16 +5,16 @@
 package ip2proxy
 
 import (
-	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"lukechampine.com/uint128"
-	"math/big"
-	"net"
+	"net/netip"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -66,8 +66,11 @@ type IP2ProxyRecord struct {
 
 // The DB struct is the main object used to query the IP2Proxy BIN file.
 type DB struct {
-	f    dbReader
-	meta ip2proxyMeta
+	f        dbReader
+	data     []byte // the whole BIN file when opened from memory
+	zeroCopy bool   // strings point into data instead of being copied
+	closed   uint32 // set by Close, accessed atomically
+	meta     ip2proxyMeta
 
 	countryPositionOffset   uint32
 	regionPositionOffset    uint32
@@ -95,11 +98,23 @@ type DB struct {
 	threatEnabled    bool
 	providerEnabled  bool
 
+	plan         []decodeStep  // the columns present, in the order of the record
+	extra        []extraColumn // the registered columns present
+	unsupported  UnsupportedFields
+	bloom        *bloomFilter
+	v6Index      []byte // built by BuildIPv6Index
+	readAhead    uint32 // bytes of rows read at once by the binary search, see SetReadAhead
+	batch        BatchReaderAt
+	ipv6Mode     IPv6Handling // lookups of IPv6 addresses without IPv6 data
+	invalidIPErr bool         // lookups of invalid IP addresses return ErrInvalidIP
+	ipv6Lookup   Resolver     // with IPv6AsFallback
+	redact       Redactor     // applied to the IP addresses of the traces
+	telemetry    Telemetry
+	hooks        []Hooks
+
 	metaOK bool
 }
 
-var defaultDB = &DB{}
-
 var countryPosition = [12]uint8{0, 2, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
 var regionPosition = [12]uint8{0, 0, 0, 4, 4, 4, 4, 4, 4, 4, 4, 4}
 var cityPosition = [12]uint8{0, 0, 0, 5, 5, 5, 5, 5, 5, 5, 5, 5}
@@ -113,16 +128,15 @@ var lastSeenPosition = [12]uint8{0, 0, 0, 0, 0, 0, 0, 0, 11, 11, 11, 11}
 var threatPosition = [12]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 12, 12, 12}
 var providerPosition = [12]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 13}
 
-const moduleVersion string = "4.0.1"
+const moduleVersion string = "4.1.0"
 
+// IP number ranges, never modified so that any number of DBs can be used concurrently
 var maxIPV4Range = uint128.From64(4294967295)
-var maxIPV6Range = uint128.From64(0)
-var fromV4Mapped = uint128.From64(281470681743360)
-var toV4Mapped = uint128.From64(281474976710655)
-var from6To4 = uint128.From64(0)
-var to6To4 = uint128.From64(0)
-var fromTeredo = uint128.From64(0)
-var toTeredo = uint128.From64(0)
+var maxIPV6Range = uint128.Max
+var from6To4 = uint128.New(0, 0x2002000000000000)                  // 2002::
+var to6To4 = uint128.New(0xffffffffffffffff, 0x2002ffffffffffff)   // 2002:ffff:ffff:ffff:ffff:ffff:ffff:ffff
+var fromTeredo = uint128.New(0, 0x2001000000000000)                // 2001::
+var toTeredo = uint128.New(0xffffffffffffffff, 0x20010000ffffffff) // 2001:0:ffff:ffff:ffff:ffff:ffff:ffff
 var last32Bits = uint128.From64(4294967295)
 
 const countryShort uint32 = 0x00001
@@ -148,83 +162,86 @@ const msgMissingFile string = "MISSING FILE"
 const msgIPV6Unsupported string = "IPV6 ADDRESS MISSING IN IPV4 BIN"
 const msgInvalidBin string = "Incorrect IP2Proxy BIN file format. Please make sure that you are using the latest IP2Proxy BIN file."
 
-func reverseBytes(s []byte) {
-	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
-		s[i], s[j] = s[j], s[i]
+// get IP type and IP number of the address as written, shared by the lookups and Writer; IPv4-mapped IPv6
+// addresses are IPv4 and the addresses with a zone invalid. netip parses without allocating and gives the
+// big-endian bytes the IP number is read from directly
+func parseIP(ip string) (ipType uint32, ipNum uint128.Uint128) {
+	ipAddress, err := netip.ParseAddr(ip)
+	if err != nil || ipAddress.Zone() != "" {
+		return 0, uint128.Zero
+	}
+
+	b := ipAddress.As16()
+	if ipAddress.Is4() || ipAddress.Is4In6() {
+		// ipv4-mapped ipv6 should treat as ipv4 and read ipv4 data section
+		return 4, uint128.From64(uint64(binary.BigEndian.Uint32(b[12:])))
+	}
+	return 6, uint128.New(binary.BigEndian.Uint64(b[8:]), binary.BigEndian.Uint64(b[:8]))
+}
+
+// get IP type and calculate IP number to look up, the 6to4 and Teredo addresses being looked up as IPv4
+func ipToNum(ip string) (ipType uint32, ipNum uint128.Uint128) {
+	ipType, ipNum = parseIP(ip)
+	if ipType != 6 {
+		return
+	}
+
+	if ipNum.Cmp(from6To4) >= 0 && ipNum.Cmp(to6To4) <= 0 {
+		// 6to4 so need to remap to ipv4
+		ipType = 4
+		ipNum = ipNum.Rsh(80)
+		ipNum = ipNum.And(last32Bits)
+	} else if ipNum.Cmp(fromTeredo) >= 0 && ipNum.Cmp(toTeredo) <= 0 {
+		// Teredo so need to remap to ipv4
+		ipType = 4
+		ipNum = uint128.Uint128{Lo: ^ipNum.Lo, Hi: ^ipNum.Hi}
+		ipNum = ipNum.And(last32Bits)
 	}
+	return
 }
 
 // get IP type and calculate IP number; calculates index too if exists
 func (d *DB) checkIP(ip string) (ipType uint32, ipNum uint128.Uint128, ipIndex uint32) {
-	ipType = 0
-	ipNum = uint128.From64(0)
-	ipNumTmp := uint128.From64(0)
-	ipIndex = 0
-	ipAddress := net.ParseIP(ip)
-
-	if ipAddress != nil {
-		v4 := ipAddress.To4()
-
-		if v4 != nil {
-			ipType = 4
-			ipNum = uint128.From64(uint64(binary.BigEndian.Uint32(v4)))
-		} else {
-			v6 := ipAddress.To16()
-			// fmt.Printf("v6: %v\n", v6)
-
-			if v6 != nil {
-				ipType = 6
-				reverseBytes(v6)
-				// fmt.Printf("v6 REVERSE: %v\n", v6)
-				// ipNum.PutBytes(v6)
-				// ipNum.ReverseBytes()
-				ipNum = uint128.FromBytes(v6)
-				// ipNum.ReverseBytes()
-
-				// fmt.Printf("ipNum RAW: %v\n", ipNum)
-				// fmt.Printf("ipNum: %s\n", ipNum.String())
-
-				if ipNum.Cmp(fromV4Mapped) >= 0 && ipNum.Cmp(toV4Mapped) <= 0 {
-					// ipv4-mapped ipv6 should treat as ipv4 and read ipv4 data section
-					ipType = 4
-					ipNum = ipNum.Sub(fromV4Mapped)
-				} else if ipNum.Cmp(from6To4) >= 0 && ipNum.Cmp(to6To4) <= 0 {
-					// 6to4 so need to remap to ipv4
-					ipType = 4
-					ipNum = ipNum.Rsh(80)
-					ipNum = ipNum.And(last32Bits)
-				} else if ipNum.Cmp(fromTeredo) >= 0 && ipNum.Cmp(toTeredo) <= 0 {
-					// Teredo so need to remap to ipv4
-					ipType = 4
-					ipNum = uint128.Uint128{^ipNum.Lo, ^ipNum.Hi}
-					ipNum = ipNum.And(last32Bits)
-				}
-			}
-		}
+	ipType, ipNum = ipToNum(ip)
+	return ipType, ipNum, d.indexOf(ipType, ipNum)
+}
+
+// offset of the index entry of the IP number, 0 without index
+func (d *DB) indexOf(ipType uint32, ipNum uint128.Uint128) uint32 {
+	if ipType == 4 && d.meta.ipV4Indexed {
+		return uint32(ipNum.Rsh(16).Lsh(3).Add64(uint64(d.meta.ipV4IndexBaseAddr)).Lo)
+	} else if ipType == 6 && d.meta.ipV6Indexed {
+		return uint32(ipNum.Rsh(112).Lsh(3).Add64(uint64(d.meta.ipV6IndexBaseAddr)).Lo)
 	}
-	if ipType == 4 {
-		if d.meta.ipV4Indexed {
-			ipNumTmp = ipNum.Rsh(16)
-			ipNumTmp = ipNumTmp.Lsh(3)
-			ipIndex = uint32(ipNumTmp.Add(uint128.From64(uint64(d.meta.ipV4IndexBaseAddr))).Lo)
-		}
-	} else if ipType == 6 {
-		if d.meta.ipV6Indexed {
-			ipNumTmp = ipNum.Rsh(112)
-			ipNumTmp = ipNumTmp.Lsh(3)
-			ipIndex = uint32(ipNumTmp.Add(uint128.From64(uint64(d.meta.ipV6IndexBaseAddr))).Lo)
-		}
+	return 0
+}
+
+// bounds-checked slice of the BIN file in memory
+func (d *DB) slice(off int64, size int64) ([]byte, error) {
+	if d.isClosed() {
+		return nil, ErrClosed
 	}
-	return
+	if off < 0 || size < 0 || off+size > int64(len(d.data)) {
+		return nil, wrapError(ErrCorruptDatabase, io.ErrUnexpectedEOF)
+	}
+	return d.data[off : off+size : off+size], nil
 }
 
 // read byte
 func (d *DB) readUint8(pos int64) (uint8, error) {
+	if d.data != nil {
+		data, err := d.slice(pos-1, 1)
+		if err != nil {
+			return 0, err
+		}
+		return data[0], nil
+	}
+
 	var retVal uint8
 	data := make([]byte, 1)
 	_, err := d.f.ReadAt(data, pos-1)
 	if err != nil {
-		return 0, err
+		return 0, d.readError(err)
 	}
 	retVal = data[0]
 	return retVal, nil
@@ -233,10 +250,14 @@ func (d *DB) readUint8(pos int64) (uint8, error) {
 // read row
 func (d *DB) readRow(pos uint32, size uint32) ([]byte, error) {
 	pos2 := int64(pos)
+	if d.data != nil {
+		return d.slice(pos2-1, int64(size))
+	}
+
 	data := make([]byte, size)
 	_, err := d.f.ReadAt(data, pos2-1)
 	if err != nil {
-		return nil, err
+		return nil, d.readError(err)
 	}
 	return data, nil
 }
@@ -252,18 +273,20 @@ func (d *DB) readUint32Row(row []byte, pos uint32) uint32 {
 // read unsigned 32-bit integer
 func (d *DB) readUint32(pos uint32) (uint32, error) {
 	pos2 := int64(pos)
-	var retVal uint32
+	if d.data != nil {
+		data, err := d.slice(pos2-1, 4)
+		if err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint32(data), nil
+	}
+
 	data := make([]byte, 4)
 	_, err := d.f.ReadAt(data, pos2-1)
 	if err != nil {
-		return 0, err
-	}
-	buf := bytes.NewReader(data)
-	err = binary.Read(buf, binary.LittleEndian, &retVal)
-	if err != nil {
-		fmt.Printf("binary read failed: %v", err)
+		return 0, d.readError(err)
 	}
-	return retVal, nil
+	return binary.LittleEndian.Uint32(data), nil
 }
 
 // read unsigned 128-bit integer from slices
@@ -271,11 +294,7 @@ func (d *DB) readUint128Row(row []byte, pos uint32) uint128.Uint128 {
 	retVal := uint128.From64(0)
 	data := row[pos : pos+16]
 
-	// little endian to big endian
-	// for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
-	// data[i], data[j] = data[j], data[i]
-	// }
-	// retVal.PutBytes(data)
+	// the IPv6 numbers are stored little-endian, decoded as such whatever the byte order of the platform
 	retVal = uint128.FromBytes(data)
 	return retVal
 }
@@ -283,35 +302,68 @@ func (d *DB) readUint128Row(row []byte, pos uint32) uint128.Uint128 {
 // read unsigned 128-bit integer
 func (d *DB) readUint128(pos uint32) (uint128.Uint128, error) {
 	pos2 := int64(pos)
+	if d.data != nil {
+		data, err := d.slice(pos2-1, 16)
+		if err != nil {
+			return uint128.From64(0), err
+		}
+		return uint128.FromBytes(data), nil
+	}
+
 	retVal := uint128.From64(0)
 	data := make([]byte, 16)
 	_, err := d.f.ReadAt(data, pos2-1)
 	if err != nil {
-		return uint128.From64(0), err
+		return uint128.From64(0), d.readError(err)
 	}
 
-	// little endian to big endian
-	// for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
-	// data[i], data[j] = data[j], data[i]
-	// }
-	// retVal.PutBytes(data)
+	// little-endian, see readUint128Row
 	retVal = uint128.FromBytes(data)
 	return retVal, nil
 }
 
 // read string
 func (d *DB) readStr(pos uint32) (string, error) {
+	return d.readStrInto(pos, nil)
+}
+
+// read string, copied into the arena unless nil
+func (d *DB) readStrInto(pos uint32, arena *[]byte) (string, error) {
 	pos2 := int64(pos)
-	readLen := 256 // max size of string field + 1 byte for the length
-	var retVal string
-	data := make([]byte, readLen)
-	_, err := d.f.ReadAt(data, pos2)
-	if err != nil && err.Error() != "EOF" { // bypass EOF error coz we are reading 256 which may hit EOF
-		return "", err
-	}
-	strLen := data[0]
-	retVal = convertBytesToString(data[1:(strLen + 1)])
-	return retVal, nil
+	if d.data != nil {
+		data, err := d.slice(pos2, 1)
+		if err != nil {
+			return "", err
+		}
+		if data, err = d.slice(pos2+1, int64(data[0])); err != nil {
+			return "", err
+		}
+		if d.zeroCopy {
+			return convertBytesToString(data), nil
+		}
+		return arenaString(arena, data), nil
+	}
+
+	buf := strBufPool.Get().(*[]byte)
+	defer strBufPool.Put(buf)
+
+	data := (*buf)[:1]
+	if _, err := d.f.ReadAt(data, pos2); err != nil {
+		return "", d.readError(err)
+	}
+	data = (*buf)[:data[0]]
+	if n, err := d.f.ReadAt(data, pos2+1); err != nil && !(err == io.EOF && n == len(data)) {
+		return "", d.readError(err)
+	}
+	return arenaString(arena, data), nil
+}
+
+// buffers for reading strings, up to 255 bytes long
+var strBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 256)
+		return &b
+	},
 }
 
 func fatal(db *DB, err error) (*DB, error) {
@@ -330,32 +382,62 @@ func OpenDB(dbPath string) (*DB, error) {
 	return OpenDBWithReader(f)
 }
 
-// OpenDBWithReader takes a dbReader to the IP2Proxy BIN database file. It will read all the metadata required to
-// be able to extract the embedded proxy data, and return the underlining DB object.
-func OpenDBWithReader(reader dbReader) (*DB, error) {
-	var db = &DB{}
+// OpenDBFromBytes takes the content of an IP2Proxy BIN database file already in memory, e.g. fetched from
+// a configuration service. The slice is used without copying and must not be modified while the DB is in use.
+// The strings of the returned records are copies and remain valid afterwards.
+func OpenDBFromBytes(b []byte) (*DB, error) {
+	return openDB(bytesReader(b), b)
+}
 
-	_maxIPV6Range := big.NewInt(0)
-	_maxIPV6Range.SetString("340282366920938463463374607431768211455", 10)
-	maxIPV6Range = uint128.FromBig(_maxIPV6Range)
+// OpenDBFromBytesZeroCopy is like OpenDBFromBytes, except that the strings of the returned records point into
+// the slice instead of being copied, saving an allocation per field. The slice must then never be modified or
+// reused, also after the DB is closed, for as long as any record read from it is in use.
+func OpenDBFromBytesZeroCopy(b []byte) (*DB, error) {
+	db, err := openDB(bytesReader(b), b)
+	if err != nil {
+		return nil, err
+	}
+	db.zeroCopy = true
+	return db, nil
+}
+
+// in-memory dbReader
+type bytesReader []byte
 
-	_from6To4 := big.NewInt(0)
-	_from6To4.SetString("42545680458834377588178886921629466624", 10)
-	from6To4 = uint128.FromBig(_from6To4)
+func (b bytesReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
 
-	_to6To4 := big.NewInt(0)
-	_to6To4.SetString("42550872755692912415807417417958686719", 10)
-	to6To4 = uint128.FromBig(_to6To4)
+func (b bytesReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (b bytesReader) Close() error {
+	return nil
+}
 
-	_fromTeredo := big.NewInt(0)
-	_fromTeredo.SetString("42540488161975842760550356425300246528", 10)
-	fromTeredo = uint128.FromBig(_fromTeredo)
+// OpenDBWithReader takes a dbReader to the IP2Proxy BIN database file. It will read all the metadata required to
+// be able to extract the embedded proxy data, and return the underlining DB object.
+func OpenDBWithReader(reader dbReader) (*DB, error) {
+	return openDB(reader, nil)
+}
 
-	_toTeredo := big.NewInt(0)
-	_toTeredo.SetString("42540488241204005274814694018844196863", 10)
-	toTeredo = uint128.FromBig(_toTeredo)
+// open with the reader, reading from data directly if not nil
+func openDB(reader dbReader, data []byte) (*DB, error) {
+	var db = &DB{}
 
 	db.f = reader
+	db.data = data
+	if b, ok := reader.(BatchReaderAt); ok && data == nil {
+		db.batch = b
+	}
 
 	var row []byte
 	var err error
@@ -363,7 +445,7 @@ func OpenDBWithReader(reader dbReader) (*DB, error) {
 
 	row, err = db.readRow(1, readLen)
 	if err != nil {
-		return fatal(db, err)
+		return fatal(db, wrapError(ErrInvalidBIN, err))
 	}
 	db.meta.databaseType = row[0]
 	db.meta.databaseColumn = row[1]
@@ -382,7 +464,7 @@ func OpenDBWithReader(reader dbReader) (*DB, error) {
 
 	// check if is correct BIN (should be 2 for IP2Proxy BIN file), also checking for zipped file (PK being the first 2 chars)
 	if (db.meta.productCode != 2 && db.meta.databaseYear >= 21) || (db.meta.databaseType == 80 && db.meta.databaseColumn == 75) { // only BINs from Jan 2021 onwards have this byte set
-		return fatal(db, errors.New(msgInvalidBin))
+		return fatal(db, ErrInvalidBIN)
 	}
 
 	if db.meta.ipV4IndexBaseAddr > 0 {
@@ -396,7 +478,12 @@ func OpenDBWithReader(reader dbReader) (*DB, error) {
 	db.meta.ipV4ColumnSize = uint32(db.meta.databaseColumn << 2)              // 4 bytes each column
 	db.meta.ipV6ColumnSize = uint32(16 + ((db.meta.databaseColumn - 1) << 2)) // 4 bytes each column, except IPFrom column which is 16 bytes
 
+	// the database types newer than the package are read as the latest known one, their new columns
+	// being available through RegisterColumn
 	dbt := db.meta.databaseType
+	if int(dbt) >= len(countryPosition) {
+		dbt = uint8(len(countryPosition) - 1)
+	}
 
 	if countryPosition[dbt] != 0 {
 		db.countryPositionOffset = uint32(countryPosition[dbt]-2) << 2
@@ -447,6 +534,12 @@ func OpenDBWithReader(reader dbReader) (*DB, error) {
 		db.providerEnabled = true
 	}
 
+	if err = db.validateIndexes(); err != nil {
+		return fatal(db, err)
+	}
+
+	db.plan = db.decodePlan()
+	db.extra = registeredColumns(db.meta.databaseType, db.meta.databaseColumn)
 	db.metaOK = true
 
 	return db, nil
@@ -467,6 +560,11 @@ func (d *DB) DatabaseVersion() string {
 	return "20" + strconv.Itoa(int(d.meta.databaseYear)) + "." + strconv.Itoa(int(d.meta.databaseMonth)) + "." + strconv.Itoa(int(d.meta.databaseDay))
 }
 
+// PublishDate returns the date the database was published, at midnight UTC.
+func (d *DB) PublishDate() time.Time {
+	return time.Date(2000+int(d.meta.databaseYear), time.Month(d.meta.databaseMonth), int(d.meta.databaseDay), 0, 0, 0, 0, time.UTC)
+}
+
 // populate record with message
 func loadMessage(mesg string) IP2ProxyRecord {
 	var x IP2ProxyRecord
@@ -497,6 +595,7 @@ func handleError(rec IP2ProxyRecord, err error) IP2ProxyRecord {
 }
 
 // convertBytesToString provides a no-copy []byte to string conversion.
+// The string shares the memory of the slice, which must not be modified or reused afterwards.
 // This implementation is adopted by official strings.Builder.
 // Reference: https://github.com/golang/go/issues/25484
 func convertBytesToString(b []byte) string {
@@ -508,6 +607,11 @@ func (d *DB) GetAll(ipAddress string) (IP2ProxyRecord, error) {
 	return d.query(ipAddress, all)
 }
 
+// lookup returning the matched range too
+func (d *DB) getAllRange(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	return d.queryRange(ipAddress, all)
+}
+
 // GetCountryShort will return the ISO-3166 country code based on the queried IP address.
 func (d *DB) GetCountryShort(ipAddress string) (string, error) {
 	data, err := d.query(ipAddress, countryShort)
@@ -594,38 +698,139 @@ func (d *DB) IsProxy(ipAddress string) (int8, error) {
 
 // main query
 func (d *DB) query(ipAddress string, mode uint32) (IP2ProxyRecord, error) {
+	x, _, err := d.queryRange(ipAddress, mode)
+	return x, err
+}
+
+// an IP range matched by a query; ipTo is exclusive and ipType is 0 if nothing was matched
+type ipRange struct {
+	ipType uint32
+	ipFrom uint128.Uint128
+	ipTo   uint128.Uint128
+}
+
+// check whether the range contains the IP number, the maximum IP number included in the last range
+func (r ipRange) contains(ipType uint32, ipNum uint128.Uint128) bool {
+	return r.ipType == ipType && ipNum.Cmp(r.ipFrom) >= 0 && ipNum.Cmp(r.last()) <= 0
+}
+
+// last IP number of the range; the last row of the BIN file also holds the maximum IP number
+func (r ipRange) last() uint128.Uint128 {
+	maxIP := maxIPV4Range
+	if r.ipType == 6 {
+		maxIP = maxIPV6Range
+	}
+	if r.ipTo.Cmp(maxIP) < 0 {
+		return r.ipTo.Sub64(1)
+	}
+	return r.ipTo
+}
+
+// query returning the matched range too
+func (d *DB) queryRange(ipAddress string, mode uint32) (IP2ProxyRecord, ipRange, error) {
+	return d.queryRangeInto(ipAddress, mode, nil)
+}
+
+// query with the strings copied into the arena unless nil
+func (d *DB) queryRangeInto(ipAddress string, mode uint32, arena *[]byte) (IP2ProxyRecord, ipRange, error) {
+	if d.telemetry == nil && d.hooks == nil {
+		return d.search(ipAddress, mode, arena)
+	}
+	if d.hooks != nil {
+		started := queryStart(d.hooks, ipAddress)
+		x, r, err := d.measuredSearch(ipAddress, mode, arena)
+		queryEnd(d.hooks, ipAddress, x, err, started)
+		return x, r, err
+	}
+	return d.measuredSearch(ipAddress, mode, arena)
+}
+
+// query with telemetry if set
+func (d *DB) measuredSearch(ipAddress string, mode uint32, arena *[]byte) (IP2ProxyRecord, ipRange, error) {
+	if d.telemetry == nil {
+		return d.search(ipAddress, mode, arena)
+	}
+	started, end := startLookup(d.telemetry, "bin")
+	x, r, err := d.search(ipAddress, mode, arena)
+	recordLookup(d.telemetry, "bin", started, x.IsProxy, err)
+	end(err)
+	return x, r, err
+}
+
+// query without telemetry nor hooks
+func (d *DB) search(ipAddress string, mode uint32, arena *[]byte) (IP2ProxyRecord, ipRange, error) {
+	row, x, r, err := d.lookupRow(ipAddress)
+	if err != nil || row == nil {
+		return x, r, err
+	}
+
+	x, err = d.readRecordInto(row, mode, arena)
+	if err != nil {
+		r = ipRange{}
+	}
+	return x, r, err
+}
+
+// the row data of the IP address and its range; without row, the record holds the message to return
+func (d *DB) lookupRow(ipAddress string) ([]byte, IP2ProxyRecord, ipRange, error) {
 	x := loadMessage(msgNotSupported) // default message
+	var r ipRange
+
+	if d.isClosed() {
+		return nil, x, r, ErrClosed
+	}
 
 	// read metadata
 	if !d.metaOK {
 		x = loadMessage(msgMissingFile)
-		return x, nil
+		return nil, x, r, nil
 	}
 
 	// check IP type and return IP number & index (if exists)
 	ipType, ipNo, ipIndex := d.checkIP(ipAddress)
 
-	// fmt.Printf("ipType: %d\n", ipType);
-
 	if ipType == 0 {
 		x = loadMessage(msgInvalidIP)
-		return x, nil
+		if d.invalidIPErr {
+			return nil, x, r, ErrInvalidIP
+		}
+		return nil, x, r, nil
 	}
 
-	var err error
+	if ipType == 6 && d.meta.ipV6DatabaseCount == 0 {
+		x, err := d.missingIPv6(ipAddress)
+		return nil, x, r, err
+	}
+
+	if d.bloom != nil && !d.bloom.mayContain(ipType, ipNo) {
+		return nil, d.bloom.record, r, nil
+	}
+
+	row, ipFrom, ipTo, err := d.searchRow(ipType, ipNo, ipIndex, nil)
+	if err != nil || row == nil {
+		return nil, x, r, err
+	}
+	return row, x, ipRange{ipType: ipType, ipFrom: ipFrom, ipTo: ipTo}, nil
+}
+
+// binary search for the row containing the IP number; returns the row data without IP From and the matched range.
+// The steps are recorded in trace unless nil.
+func (d *DB) searchRow(ipType uint32, ipNo uint128.Uint128, ipIndex uint32, trace *QueryTrace) (row []byte, ipFrom uint128.Uint128, ipTo uint128.Uint128, err error) {
+	row, ipFrom, ipTo, _, err = d.searchRowNumber(ipType, ipNo, ipIndex, trace)
+	return row, ipFrom, ipTo, err
+}
+
+// binary search returning the number of the matched row too
+func (d *DB) searchRowNumber(ipType uint32, ipNo uint128.Uint128, ipIndex uint32, trace *QueryTrace) (row []byte, ipFrom uint128.Uint128, ipTo uint128.Uint128, rowNum uint32, err error) {
 	var colSize uint32
 	var baseAddr uint32
 	var low uint32
 	var high uint32
 	var mid uint32
 	var rowOffset uint32
-	var countryPos uint32
 	var firstCol uint32 = 4 // 4 bytes for ip from
-	var row []byte
 	var fullRow []byte
 	var readLen uint32
-	ipFrom := uint128.From64(0)
-	ipTo := uint128.From64(0)
 	maxIP := uint128.From64(0)
 
 	if ipType == 4 {
@@ -634,10 +839,6 @@ func (d *DB) query(ipAddress string, mode uint32) (IP2ProxyRecord, error) {
 		maxIP = maxIPV4Range
 		colSize = d.meta.ipV4ColumnSize
 	} else {
-		if d.meta.ipV6DatabaseCount == 0 {
-			x = loadMessage(msgIPV6Unsupported)
-			return x, nil
-		}
 		firstCol = 16 // 16 bytes for ip from
 		baseAddr = d.meta.ipV6DatabaseAddr
 		high = d.meta.ipV6DatabaseCount
@@ -647,157 +848,214 @@ func (d *DB) query(ipAddress string, mode uint32) (IP2ProxyRecord, error) {
 
 	// reading index
 	if ipIndex > 0 {
-		// fmt.Printf("ipIndex: %d\n", ipIndex);
-		row, err = d.readRow(ipIndex, 8) // 4 bytes each for IP From and IP To
+		row, err = d.readIndex(ipType, ipIndex)
 		if err != nil {
-			return x, err
+			return nil, ipFrom, ipTo, 0, err
 		}
 		low = d.readUint32Row(row, 0)
 		high = d.readUint32Row(row, 4)
 	}
+	if trace != nil {
+		trace.IndexOffset = ipIndex
+		trace.Low = low
+		trace.High = high
+	}
 
 	if ipNo.Cmp(maxIP) >= 0 {
 		ipNo = ipNo.Sub(uint128.From64(1))
 	}
 
+	// the IP numbers are compared as their 64-bit words, the IPv4 numbers having a low word only
+	noHi, noLo := ipNo.Hi, ipNo.Lo
+	var fromHi, fromLo, toHi, toLo uint64
+	var block []byte // rows from blockLow read at once with the read-ahead
+	var blockLow uint32
 	for low <= high {
 		mid = ((low + high) >> 1)
-		// fmt.Printf("LOW: %d MID: %d HIGH: %d\n", low, mid, high);
 		rowOffset = baseAddr + (mid * colSize)
 
 		// reading IP From + whole row + next IP From
 		readLen = colSize + firstCol
-		fullRow, err = d.readRow(rowOffset, readLen)
-		if err != nil {
-			return x, err
+		if block == nil && d.readAhead > 0 && uint64(high-low+1)*uint64(colSize)+uint64(firstCol) <= uint64(d.readAhead) {
+			block, err = d.readRow(baseAddr+(low*colSize), (high-low+1)*colSize+firstCol)
+			if err != nil {
+				return nil, ipFrom, ipTo, 0, err
+			}
+			blockLow = low
+		}
+		if block != nil {
+			off := (mid - blockLow) * colSize
+			fullRow = block[off : off+readLen]
+		} else if fullRow, err = d.readRow(rowOffset, readLen); err != nil {
+			return nil, ipFrom, ipTo, 0, err
 		}
 
 		if ipType == 4 {
-			ipFrom32 := d.readUint32Row(fullRow, 0)
-			ipFrom = uint128.From64(uint64(ipFrom32))
-
-			ipTo32 := d.readUint32Row(fullRow, colSize)
-			ipTo = uint128.From64(uint64(ipTo32))
+			fromLo = uint64(d.readUint32Row(fullRow, 0))
+			toLo = uint64(d.readUint32Row(fullRow, colSize))
 		} else {
-			ipFrom = d.readUint128Row(fullRow, 0)
-
-			ipTo = d.readUint128Row(fullRow, colSize)
+			// the IPv6 numbers are stored little-endian, the low word first
+			fromLo, fromHi = binary.LittleEndian.Uint64(fullRow[0:8]), binary.LittleEndian.Uint64(fullRow[8:16])
+			toLo, toHi = binary.LittleEndian.Uint64(fullRow[colSize:colSize+8]), binary.LittleEndian.Uint64(fullRow[colSize+8:colSize+16])
 		}
 
-		// fmt.Printf("ipFrom: %v ipTo: %v\n", ipFrom, ipTo)
+		if trace != nil {
+			trace.Steps = append(trace.Steps, TraceStep{Low: low, Mid: mid, High: high, RowOffset: rowOffset,
+				IPFrom: uint128.New(fromLo, fromHi).String(), IPTo: uint128.New(toLo, toHi).String()})
+		}
 
-		if ipNo.Cmp(ipFrom) >= 0 && ipNo.Cmp(ipTo) < 0 {
+		belowFrom := noHi < fromHi || (noHi == fromHi && noLo < fromLo)
+		if !belowFrom && (noHi < toHi || (noHi == toHi && noLo < toLo)) {
 			rowLen := colSize - firstCol
 			row = fullRow[firstCol:(firstCol + rowLen)] // extract the actual row data
+			return row, uint128.New(fromLo, fromHi), uint128.New(toLo, toHi), mid, nil
+		}
 
-			if d.proxyTypeEnabled {
-				if mode&proxyType != 0 || mode&isProxy != 0 {
-					if x.ProxyType, err = d.readStr(d.readUint32Row(row, d.proxyTypePositionOffset)); err != nil {
-						return x, err
-					}
-				}
-			}
-
-			if d.countryEnabled {
-				if mode&countryShort != 0 || mode&countryLong != 0 || mode&isProxy != 0 {
-					countryPos = d.readUint32Row(row, d.countryPositionOffset)
-				}
-				if mode&countryShort != 0 || mode&isProxy != 0 {
-					if x.CountryShort, err = d.readStr(countryPos); err != nil {
-						return x, err
-					}
-				}
-				if mode&countryLong != 0 {
-					if x.CountryLong, err = d.readStr(countryPos + 3); err != nil {
-						return x, err
-					}
-				}
-			}
-
-			if mode&region != 0 && d.regionEnabled {
-				if x.Region, err = d.readStr(d.readUint32Row(row, d.regionPositionOffset)); err != nil {
-					return x, err
-				}
-			}
-
-			if mode&city != 0 && d.cityEnabled {
-				if x.City, err = d.readStr(d.readUint32Row(row, d.cityPositionOffset)); err != nil {
-					return x, err
-				}
-			}
-
-			if mode&isp != 0 && d.ispEnabled {
-				if x.Isp, err = d.readStr(d.readUint32Row(row, d.ispPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+		if belowFrom {
+			high = mid - 1
+		} else {
+			low = mid + 1
+		}
+	}
+	return nil, uint128.New(fromLo, fromHi), uint128.New(toLo, toHi), 0, nil
+}
 
-			if mode&domain != 0 && d.domainEnabled {
-				if x.Domain, err = d.readStr(d.readUint32Row(row, d.domainPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// typed view of the row data after IP From: 32-bit little-endian string offsets, one per column
+type rowView []byte
 
-			if mode&usageType != 0 && d.usageTypeEnabled {
-				if x.UsageType, err = d.readStr(d.readUint32Row(row, d.usageTypePositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// the column at the position offset; a row too short for it is a corrupt database
+func (v rowView) at(offset uint32) (uint32, error) {
+	if uint64(offset)+4 > uint64(len(v)) {
+		return 0, wrapError(ErrCorruptDatabase, io.ErrUnexpectedEOF)
+	}
+	return binary.LittleEndian.Uint32(v[offset : offset+4]), nil
+}
 
-			if mode&asn != 0 && d.asnEnabled {
-				if x.Asn, err = d.readStr(d.readUint32Row(row, d.asnPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// a step of the decode plan: the string of a column, read when mode selects it
+type decodeStep struct {
+	mode      uint32 // fields requiring the string
+	offset    uint32 // position offset of the column
+	strOffset uint32 // added to the string offset, 3 for the country name following the country code
+	field     uint32 // the field set, a single mode bit
+}
 
-			if mode&as != 0 && d.asEnabled {
-				if x.As, err = d.readStr(d.readUint32Row(row, d.asPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// the steps of the columns of the database type; IsProxy requires the country code and the proxy type
+func (d *DB) decodePlan() []decodeStep {
+	var plan []decodeStep
+	add := func(enabled bool, mode uint32, offset uint32, strOffset uint32, field uint32) {
+		if enabled {
+			plan = append(plan, decodeStep{mode: mode, offset: offset, strOffset: strOffset, field: field})
+		}
+	}
+	add(d.countryEnabled, countryShort|isProxy, d.countryPositionOffset, 0, countryShort)
+	add(d.countryEnabled, countryLong, d.countryPositionOffset, 3, countryLong)
+	add(d.regionEnabled, region, d.regionPositionOffset, 0, region)
+	add(d.cityEnabled, city, d.cityPositionOffset, 0, city)
+	add(d.ispEnabled, isp, d.ispPositionOffset, 0, isp)
+	add(d.proxyTypeEnabled, proxyType|isProxy, d.proxyTypePositionOffset, 0, proxyType)
+	add(d.domainEnabled, domain, d.domainPositionOffset, 0, domain)
+	add(d.usageTypeEnabled, usageType, d.usageTypePositionOffset, 0, usageType)
+	add(d.asnEnabled, asn, d.asnPositionOffset, 0, asn)
+	add(d.asEnabled, as, d.asPositionOffset, 0, as)
+	add(d.lastSeenEnabled, lastSeen, d.lastSeenPositionOffset, 0, lastSeen)
+	add(d.threatEnabled, threat, d.threatPositionOffset, 0, threat)
+	add(d.providerEnabled, provider, d.providerPositionOffset, 0, provider)
+	return plan
+}
 
-			if mode&lastSeen != 0 && d.lastSeenEnabled {
-				if x.LastSeen, err = d.readStr(d.readUint32Row(row, d.lastSeenPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// set the string field of the mode bit; a switch rather than a function per step, so that the record
+// does not escape to the heap
+func (x *IP2ProxyRecord) setField(field uint32, str string) {
+	switch field {
+	case countryShort:
+		x.CountryShort = str
+	case countryLong:
+		x.CountryLong = str
+	case region:
+		x.Region = str
+	case city:
+		x.City = str
+	case isp:
+		x.Isp = str
+	case proxyType:
+		x.ProxyType = str
+	case domain:
+		x.Domain = str
+	case usageType:
+		x.UsageType = str
+	case asn:
+		x.Asn = str
+	case as:
+		x.As = str
+	case lastSeen:
+		x.LastSeen = str
+	case threat:
+		x.Threat = str
+	case provider:
+		x.Provider = str
+	}
+}
 
-			if mode&threat != 0 && d.threatEnabled {
-				if x.Threat, err = d.readStr(d.readUint32Row(row, d.threatPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// decode the fields selected by mode from the row data
+func (d *DB) readRecord(row []byte, mode uint32) (IP2ProxyRecord, error) {
+	return d.readRecordInto(row, mode, nil)
+}
 
-			if mode&provider != 0 && d.providerEnabled {
-				if x.Provider, err = d.readStr(d.readUint32Row(row, d.providerPositionOffset)); err != nil {
-					return x, err
-				}
-			}
+// decode with the strings copied into the arena unless nil
+func (d *DB) readRecordInto(row []byte, mode uint32, arena *[]byte) (IP2ProxyRecord, error) {
+	if d.batch != nil {
+		return d.readRecordBatch(row, mode, arena)
+	}
 
-			if x.CountryShort == "-" || x.ProxyType == "-" {
-				x.IsProxy = 0
-			} else {
-				if x.ProxyType == "DCH" || x.ProxyType == "SES" {
-					x.IsProxy = 2
-				} else {
-					x.IsProxy = 1
-				}
-			}
+	x := loadMessage(msgNotSupported) // default message
+	if d.unsupported == UnsupportedAsEmpty {
+		x = loadMessage("")
+	}
 
-			return x, nil
+	cols := rowView(row)
+	for i := range d.plan {
+		step := &d.plan[i]
+		if mode&step.mode == 0 {
+			continue
+		}
+		pos, err := cols.at(step.offset)
+		if err != nil {
+			return x, err
+		}
+		str, err := d.readStrInto(pos+step.strOffset, arena)
+		if err != nil {
+			return x, err
 		}
+		x.setField(step.field, str)
+	}
 
-		if ipNo.Cmp(ipFrom) < 0 {
-			high = mid - 1
+	x.setIsProxy()
+	return x, nil
+}
+
+// derive IsProxy from the country and the proxy type
+func (x *IP2ProxyRecord) setIsProxy() {
+	if x.CountryShort == "-" || x.ProxyType == "-" {
+		x.IsProxy = 0
+	} else {
+		if x.ProxyType == "DCH" || x.ProxyType == "SES" {
+			x.IsProxy = 2
 		} else {
-			low = mid + 1
+			x.IsProxy = 1
 		}
 	}
-	return x, nil
 }
 
-// Close is used to close file descriptor.
+// Close is used to close file descriptor. The queries afterwards return ErrClosed, and closing again does nothing.
 func (d *DB) Close() error {
+	if !atomic.CompareAndSwapUint32(&d.closed, 0, 1) {
+		return nil
+	}
 	err := d.f.Close()
 	return err
 }
+
+// check whether the DB was closed
+func (d *DB) isClosed() bool {
+	return atomic.LoadUint32(&d.closed) != 0
+}
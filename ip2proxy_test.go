@@ -0,0 +1,232 @@
+package ip2proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lukechampine.com/uint128"
+)
+
+// A PX2 BIN file written byte by byte, every integer little-endian with bytes of distinct values, so that
+// decoding in the byte order of a big-endian platform, or reversing a field, gives other numbers: the ranges
+// 1.2.3.0/24 and 2001:db8::/112 are VPN, the rest not a proxy.
+var littleEndianBIN = concatBytes(
+	// header: type 2, 3 columns, 2024-01-15, 3 IPv4 rows at 65, 3 IPv6 rows at 113, no index, IP2Proxy,
+	// 255 bytes
+	[]byte{
+		0x02, 0x03, 0x18, 0x01, 0x0f,
+		0x03, 0x00, 0x00, 0x00, 0x41, 0x00, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x00, 0x71, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x02, 0x01, 0xff, 0x00, 0x00, 0x00,
+	},
+	make([]byte, 64-35),
+
+	// IPv4 rows at offset 64: IP From, proxy type and country, the last row holding the IP To of the one before
+	[]byte{0x00, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00},
+	[]byte{0x00, 0x03, 0x02, 0x01, 0xd5, 0x00, 0x00, 0x00, 0xd9, 0x00, 0x00, 0x00},
+	[]byte{0x00, 0x04, 0x02, 0x01, 0xd0, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00},
+	[]byte{0xff, 0xff, 0xff, 0xff, 0xd0, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00},
+
+	// IPv6 rows at offset 112, the low 64 bits of IP From first
+	[]byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xd0, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00,
+	},
+	[]byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xb8, 0x0d, 0x01, 0x20,
+		0xd5, 0x00, 0x00, 0x00, 0xf5, 0x00, 0x00, 0x00,
+	},
+	[]byte{
+		0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xb8, 0x0d, 0x01, 0x20,
+		0xd0, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00,
+	},
+	[]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xd0, 0x00, 0x00, 0x00, 0xd0, 0x00, 0x00, 0x00,
+	},
+
+	// strings at offset 208: "-" with the padded country "-", "VPN", "US" and "SE" with their names
+	[]byte{0x01, '-', 0x00, 0x01, '-'},
+	[]byte{0x03, 'V', 'P', 'N'},
+	[]byte{0x02, 'U', 'S', 0x18}, []byte("United States of America"),
+	[]byte{0x02, 'S', 'E', 0x06}, []byte("Sweden"),
+)
+
+func concatBytes(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestDecodeLittleEndianIntegers(t *testing.T) {
+	var d DB
+	if got := d.readUint32Row([]byte{0x00, 0x01, 0x02, 0x03, 0x04}, 1); got != 0x04030201 {
+		t.Errorf("readUint32Row: %#x instead of 0x04030201", got)
+	}
+
+	row := make([]byte, 17)
+	for i := range row {
+		row[i] = byte(i)
+	}
+	want := uint128.New(0x0807060504030201, 0x100f0e0d0c0b0a09)
+	if got := d.readUint128Row(row, 1); !got.Equals(want) {
+		t.Errorf("readUint128Row: %#x%016x instead of %#x%016x", got.Hi, got.Lo, want.Hi, want.Lo)
+	}
+}
+
+// the BIN file read from memory and through a file, the two reading integers by different paths
+func openLittleEndianBIN(t *testing.T) map[string]*DB {
+	t.Helper()
+	mem, err := OpenDBFromBytes(littleEndianBIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mem.Close() })
+
+	path := filepath.Join(t.TempDir(), "le.bin")
+	if err := os.WriteFile(path, littleEndianBIN, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return map[string]*DB{"bytes": mem, "file": file}
+}
+
+func TestDecodeLittleEndianHeader(t *testing.T) {
+	if len(littleEndianBIN) != 255 {
+		t.Fatalf("fixture of %d bytes instead of 255", len(littleEndianBIN))
+	}
+	for name, db := range openLittleEndianBIN(t) {
+		m := db.meta
+		for _, c := range []struct {
+			field     string
+			got, want uint32
+		}{
+			{"IPv4 count", m.ipV4DatabaseCount, 3},
+			{"IPv4 address", m.ipV4DatabaseAddr, 65},
+			{"IPv6 count", m.ipV6DatabaseCount, 3},
+			{"IPv6 address", m.ipV6DatabaseAddr, 113},
+			{"IPv4 index", m.ipV4IndexBaseAddr, 0},
+			{"IPv6 index", m.ipV6IndexBaseAddr, 0},
+			{"file size", m.fileSize, 255},
+		} {
+			if c.got != c.want {
+				t.Errorf("%s: %s %d instead of %d", name, c.field, c.got, c.want)
+			}
+		}
+		if got := db.PackageVersion(); got != "2" {
+			t.Errorf("%s: package %s instead of 2", name, got)
+		}
+		if got := db.DatabaseVersion(); got != "2024.1.15" {
+			t.Errorf("%s: version %s instead of 2024.1.15", name, got)
+		}
+	}
+}
+
+func TestDecodeLittleEndianRows(t *testing.T) {
+	tests := []struct {
+		ip        string
+		isProxy   int8
+		proxyType string
+		country   string
+		name      string
+	}{
+		{"0.0.0.0", 0, "-", "-", "-"},
+		{"1.2.2.255", 0, "-", "-", "-"},
+		{"1.2.3.0", 1, "VPN", "US", "United States of America"},
+		{"1.2.3.128", 1, "VPN", "US", "United States of America"},
+		{"1.2.3.255", 1, "VPN", "US", "United States of America"},
+		{"1.2.4.0", 0, "-", "-", "-"},
+		{"255.255.255.255", 0, "-", "-", "-"},
+		{"::", 0, "-", "-", "-"},
+		{"2001:db7:ffff:ffff:ffff:ffff:ffff:ffff", 0, "-", "-", "-"},
+		{"2001:db8::", 1, "VPN", "SE", "Sweden"},
+		{"2001:db8::ffff", 1, "VPN", "SE", "Sweden"},
+		{"2001:db8::1:0", 0, "-", "-", "-"},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 0, "-", "-", "-"},
+	}
+	for name, db := range openLittleEndianBIN(t) {
+		for _, tt := range tests {
+			rec, err := db.GetAll(tt.ip)
+			if err != nil {
+				t.Errorf("%s %s: %v", name, tt.ip, err)
+				continue
+			}
+			if rec.IsProxy != tt.isProxy || rec.ProxyType != tt.proxyType || rec.CountryShort != tt.country || rec.CountryLong != tt.name {
+				t.Errorf("%s %s: %d %q %q %q instead of %d %q %q %q", name, tt.ip, rec.IsProxy, rec.ProxyType, rec.CountryShort,
+					rec.CountryLong, tt.isProxy, tt.proxyType, tt.country, tt.name)
+			}
+		}
+	}
+}
+
+// a header with fewer columns than the database type gives rows too short for its fields, which is a corrupt
+// database rather than the first string of the file decoded as the missing fields
+func TestDecodeTruncatedRow(t *testing.T) {
+	bin := append([]byte(nil), littleEndianBIN...)
+	bin[1] = 2
+	db, err := OpenDBFromBytes(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if rec, err := db.GetAll("0.0.0.1"); !errors.Is(err, ErrCorruptDatabase) {
+		t.Errorf("%+v (%v) instead of ErrCorruptDatabase", rec, err)
+	}
+	if got, err := db.GetProxyType("0.0.0.1"); err != nil || got != "-" {
+		t.Errorf("proxy type %q (%v) instead of -, its column being in the row", got, err)
+	}
+}
+
+// a PX2 BIN file in memory with 4096 IPv4 and IPv6 proxy ranges between ranges not flagged as proxies, without
+// the indexes so that the binary search runs over every row, and IP numbers spread over the rows
+func openSearchBenchmarkBIN(b *testing.B) (db *DB, ipv4 []uint128.Uint128, ipv6 []uint128.Uint128) {
+	b.Helper()
+	w := newTestWriter(b, 2)
+	for i := 0; i < 4096; i++ {
+		from4, to4 := fmt.Sprintf("%d.%d.0.0", i>>4, (i&15)<<4), fmt.Sprintf("%d.%d.0.255", i>>4, (i&15)<<4)
+		from6, to6 := fmt.Sprintf("2001:db8:%x::", i), fmt.Sprintf("2001:db8:%x::ffff", i)
+		if err := w.AddRange(from4, to4, testRecord("VPN")); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.AddRange(from6, to6, testRecord("VPN")); err != nil {
+			b.Fatal(err)
+		}
+		_, n4 := ipToNum(fmt.Sprintf("%d.%d.0.%d", i>>4, (i&15)<<4, i&255))
+		_, n6 := ipToNum(fmt.Sprintf("2001:db8:%x::%x", i, i))
+		ipv4, ipv6 = append(ipv4, n4), append(ipv6, n6)
+	}
+	return openTestBIN(b, w.SetIndexes(false, false)), ipv4, ipv6
+}
+
+func benchmarkSearchRow(b *testing.B, ipType uint32) {
+	db, ipv4, ipv6 := openSearchBenchmarkBIN(b)
+	ipNums := ipv4
+	if ipType == 6 {
+		ipNums = ipv6
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if row, _, _, err := db.searchRow(ipType, ipNums[i%len(ipNums)], 0, nil); row == nil || err != nil {
+			b.Fatalf("no row (%v)", err)
+		}
+	}
+}
+
+func BenchmarkSearchRowIPv4(b *testing.B) {
+	benchmarkSearchRow(b, 4)
+}
+
+func BenchmarkSearchRowIPv6(b *testing.B) {
+	benchmarkSearchRow(b, 6)
+}
@@ -0,0 +1,60 @@
+package ip2proxy
+
+import (
+	"errors"
+	"strconv"
+)
+
+const msgFieldUnsupported string = "Field not supported by the IP2Proxy BIN file."
+
+// The ASInfo struct holds the autonomous system of an IP address.
+type ASInfo struct {
+	ASN  uint32 // 0 if not applicable
+	Name string
+}
+
+// GetASInfo will return the autonomous system number and name based on the queried IP address, for the BIN
+// files with both fields (PX7 and above).
+func (d *DB) GetASInfo(ipAddress string) (ASInfo, error) {
+	if !d.Fields().Has(FieldAsn | FieldAs) {
+		return ASInfo{}, errors.New(msgFieldUnsupported)
+	}
+	x, err := d.query(ipAddress, asn|as)
+	if err != nil {
+		return ASInfo{}, err
+	}
+
+	var info ASInfo
+	if n, err := strconv.ParseUint(x.Asn, 10, 32); err == nil {
+		info.ASN = uint32(n)
+	}
+	if x.As != "-" && x.As != msgInvalidIP && x.As != msgIPV6Unsupported && x.As != msgMissingFile {
+		info.Name = x.As
+	}
+	return info, nil
+}
+
+// scan for the ranges matching, the field being required
+func (d *DB) findRanges(field FieldMask, match func(rec *IP2ProxyRecord) bool) ([]IPRange, error) {
+	if !d.Fields().Has(field) {
+		return nil, errors.New(msgFieldUnsupported)
+	}
+	var ranges []IPRange
+	err := d.Scan(func(r IPRange) error {
+		if match(&r.Record) {
+			ranges = append(ranges, r)
+		}
+		return nil
+	})
+	return ranges, err
+}
+
+// FindRangesByASN scans the BIN file for the ranges of the autonomous system number, in ascending order, the
+// IPv4 ranges first, e.g. to investigate the footprint of a hosting provider. It requires the ASN field (PX7
+// and above) and reads the whole file.
+func (d *DB) FindRangesByASN(asNumber uint32) ([]IPRange, error) {
+	want := strconv.FormatUint(uint64(asNumber), 10)
+	return d.findRanges(FieldAsn, func(rec *IP2ProxyRecord) bool {
+		return rec.Asn == want
+	})
+}
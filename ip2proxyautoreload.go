@@ -0,0 +1,103 @@
+package ip2proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The ReloadEvent struct describes an automatic reload of the BIN file, successful or not.
+type ReloadEvent struct {
+	Path       string
+	Generation uint64 // after the reload, unchanged if it failed
+	Version    string // database version of the new file
+	Err        error  // the file failed to open or to be validated, the previous DB is kept
+}
+
+// state of the watched file: the file the path resolves to and its size and modification time
+type fileState struct {
+	target  string
+	modTime time.Time
+	size    int64
+}
+
+func statFile(dbPath string) (fileState, error) {
+	var s fileState
+	target, err := filepath.EvalSymlinks(dbPath)
+	if err != nil {
+		return s, err
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return s, err
+	}
+	s.target = target
+	s.modTime = fi.ModTime()
+	s.size = fi.Size()
+	return s, nil
+}
+
+// open the BIN file as Reload does and look up the last addresses, reading the last rows, so that a truncated
+// file is rejected
+func (r *ReloadableDB) openValidated(dbPath string) (*DB, error) {
+	db, err := r.openFile(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	probes := []string{"255.255.255.254"}
+	if db.meta.ipV6DatabaseCount > 0 {
+		probes = append(probes, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe")
+	}
+	for _, ip := range probes {
+		if _, err := db.GetAll(ip); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// WatchFile checks the BIN file at every interval and swaps it in once it changed, including when the path is a
+// symbolic link pointed to another file. A changed file is only opened once unchanged for an interval, so that
+// it is not read while being copied, with the options of SetOpenOptions, and is validated before the swap; the
+// previous DB is kept if it is invalid and the file is not tried again until it changes. onReload, if not nil,
+// is called after every attempt.
+// It blocks until the context is done, returning its error, and is usually run in its own goroutine.
+func (r *ReloadableDB) WatchFile(ctx context.Context, dbPath string, interval time.Duration, onReload func(ReloadEvent)) error {
+	loaded, _ := statFile(dbPath) // the file currently opened
+	pending := loaded
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		s, err := statFile(dbPath)
+		if err != nil || s == loaded {
+			continue // missing while being replaced, or unchanged
+		}
+		if s != pending {
+			pending = s // changed since the previous check, wait for the copy to complete
+			continue
+		}
+		loaded = s
+
+		var ev = ReloadEvent{Path: dbPath}
+		db, err := r.openValidated(dbPath)
+		if err == nil {
+			ev.Version = db.DatabaseVersion()
+			err = r.Swap(db)
+		}
+		ev.Err = err
+		ev.Generation = r.Generation()
+		if onReload != nil {
+			onReload(ev)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ip2proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the files swapped in by WatchFile are opened with the options of SetOpenOptions, as the first one
+func TestWatchFileOpenOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.bin")
+	if err := os.WriteFile(path, writeTestBIN(t, newTestWriter(t, 2, testVPNRange)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := OpenOptions{Advice: AdviseRandom}
+	first, err := OpenDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReloadableDB(first).SetOpenOptions(opts)
+	defer r.Close()
+	generation := r.Generation()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan ReloadEvent, 1)
+	go r.WatchFile(ctx, path, 10*time.Millisecond, func(ev ReloadEvent) { events <- ev })
+	time.Sleep(50 * time.Millisecond) // the file opened is checked first
+
+	if err := os.WriteFile(path, writeTestBIN(t, newTestWriter(t, 2, [3]string{"192.0.2.0", "192.0.2.255", "TOR"})), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Err != nil || ev.Generation != generation+1 {
+			t.Fatalf("reload %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file not reloaded")
+	}
+
+	if rec, err := r.GetAll("192.0.2.1"); err != nil || rec.ProxyType != "TOR" {
+		t.Errorf("%q (%v) instead of the TOR range of the new file", rec.ProxyType, err)
+	}
+	db, _, release := r.acquire()
+	f, ok := db.f.(*optionFile)
+	release()
+	if !ok || f.opts != opts {
+		t.Errorf("new file read by %T without the options", db.f)
+	}
+}
@@ -0,0 +1,65 @@
+package ip2proxy
+
+import (
+	"io"
+	"sync"
+)
+
+// The BatchReaderAt interface is implemented by the readers able to read several parts of the file in a
+// single call, such as the io_uring reader of OpenDBIOUring. The DBs opened with such a reader read the
+// strings of a record at once. ReadBatchAt reads into each buffer from its offset and returns the number
+// of bytes read into each, short only at the end of the file.
+type BatchReaderAt interface {
+	ReadBatchAt(bufs [][]byte, offsets []int64) ([]int, error)
+}
+
+// buffers of the strings of a record
+var batchBufPool = sync.Pool{
+	New: func() interface{} {
+		return new([16 * 256]byte)
+	},
+}
+
+// read the strings of the record with a single batch
+func (d *DB) readRecordBatch(row []byte, mode uint32, arena *[]byte) (IP2ProxyRecord, error) {
+	x := loadMessage(msgNotSupported) // default message
+	if d.unsupported == UnsupportedAsEmpty {
+		x = loadMessage("")
+	}
+
+	cols := rowView(row)
+	var fields [16]uint32
+	var offsets [16]int64
+	var bufs [16][]byte
+	space := batchBufPool.Get().(*[16 * 256]byte) // length byte and up to 255 bytes of each string
+	defer batchBufPool.Put(space)
+	n := 0
+	for i := range d.plan {
+		step := &d.plan[i]
+		if mode&step.mode == 0 || n == len(fields) {
+			continue
+		}
+		pos, err := cols.at(step.offset)
+		if err != nil {
+			return x, err
+		}
+		fields[n] = step.field
+		offsets[n] = int64(pos + step.strOffset)
+		bufs[n] = space[n*256 : (n+1)*256]
+		n++
+	}
+
+	read, err := d.batch.ReadBatchAt(bufs[:n], offsets[:n])
+	if err != nil {
+		return x, d.readError(err)
+	}
+	for i := 0; i < n; i++ {
+		if read[i] < 1 || read[i] < 1+int(bufs[i][0]) {
+			return x, wrapError(ErrCorruptDatabase, io.ErrUnexpectedEOF)
+		}
+		x.setField(fields[i], arenaString(arena, bufs[i][1:1+int(bufs[i][0])]))
+	}
+
+	x.setIsProxy()
+	return x, nil
+}
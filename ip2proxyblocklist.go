@@ -0,0 +1,279 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/netip"
+	"strconv"
+)
+
+// The Blocklist struct holds the CIDR prefixes of the IP ranges selected for blocking,
+// for generating firewall sets.
+type Blocklist struct {
+	IPv4 []netip.Prefix
+	IPv6 []netip.Prefix
+}
+
+const msgBlocklistTooLarge string = "Blocklist exceeds the maximum number of entries."
+
+// Blocklist collects the IP ranges accepted by the filter, or the proxy ranges if filter is nil, merging
+// adjacent ranges, and splits them into CIDR prefixes. It fails if there are more than maxEntries prefixes
+// per IP version; zero means no limit.
+func (d *DB) Blocklist(filter func(r IPRange) bool, maxEntries int) (*Blocklist, error) {
+	var b = &Blocklist{}
+	if filter == nil {
+		filter = func(r IPRange) bool { return r.Record.IsProxy > 0 }
+	}
+
+	for _, ipType := range []uint32{4, 6} {
+		var prefixes []netip.Prefix
+		var pending IPRange
+		var hasPending bool
+
+		flush := func() error {
+			if !hasPending {
+				return nil
+			}
+			hasPending = false
+			prefixes = append(prefixes, pending.Prefixes()...)
+			if maxEntries > 0 && len(prefixes) > maxEntries {
+				return errors.New(msgBlocklistTooLarge)
+			}
+			return nil
+		}
+
+		err := d.scanRows(ipType, 0, func(index uint32, r IPRange) error {
+			if !filter(r) {
+				return flush()
+			}
+			if hasPending && pending.ipTo.Add64(1) == r.ipFrom {
+				pending.ipTo = r.ipTo
+				return nil
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			pending = r
+			hasPending = true
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if ipType == 4 {
+			b.IPv4 = prefixes
+		} else {
+			b.IPv6 = prefixes
+		}
+	}
+	return b, nil
+}
+
+// Diff returns the prefixes added since the previous blocklist and the ones removed from it.
+func (b *Blocklist) Diff(previous *Blocklist) (added *Blocklist, removed *Blocklist) {
+	added = &Blocklist{IPv4: prefixesNotIn(b.IPv4, previous.IPv4), IPv6: prefixesNotIn(b.IPv6, previous.IPv6)}
+	removed = &Blocklist{IPv4: prefixesNotIn(previous.IPv4, b.IPv4), IPv6: prefixesNotIn(previous.IPv6, b.IPv6)}
+	return
+}
+
+func prefixesNotIn(prefixes []netip.Prefix, other []netip.Prefix) []netip.Prefix {
+	set := make(map[netip.Prefix]bool, len(other))
+	for _, p := range other {
+		set[p] = true
+	}
+
+	var diff []netip.Prefix
+	for _, p := range prefixes {
+		if !set[p] {
+			diff = append(diff, p)
+		}
+	}
+	return diff
+}
+
+// WriteIPSet writes the blocklist as an "ipset restore" file filling the hash:net sets named setName
+// and setName6 (IPv6). The sets are filled under temporary names and swapped in atomically.
+func (b *Blocklist) WriteIPSet(out io.Writer, setName string) error {
+	w := bufio.NewWriter(out)
+	for _, s := range b.ipsetSets(setName) {
+		tmp := s.name + "-tmp"
+		maxElem := strconv.Itoa(ipsetMaxElem(len(s.prefixes)))
+		w.WriteString("create " + s.name + " hash:net family " + s.family + " maxelem " + maxElem + " -exist\n")
+		w.WriteString("create " + tmp + " hash:net family " + s.family + " maxelem " + maxElem + " -exist\n")
+		w.WriteString("flush " + tmp + "\n")
+		for _, p := range s.prefixes {
+			w.WriteString("add " + tmp + " " + p.String() + "\n")
+		}
+		w.WriteString("swap " + tmp + " " + s.name + "\n")
+		w.WriteString("destroy " + tmp + "\n")
+	}
+	return w.Flush()
+}
+
+// WriteIPSetChanges writes an "ipset restore" file applying the changes since the previous blocklist
+// to the sets written by WriteIPSet.
+func (b *Blocklist) WriteIPSetChanges(out io.Writer, setName string, previous *Blocklist) error {
+	added, removed := b.Diff(previous)
+	w := bufio.NewWriter(out)
+	for _, s := range removed.ipsetSets(setName) {
+		for _, p := range s.prefixes {
+			w.WriteString("del " + s.name + " " + p.String() + " -exist\n")
+		}
+	}
+	for _, s := range added.ipsetSets(setName) {
+		for _, p := range s.prefixes {
+			w.WriteString("add " + s.name + " " + p.String() + " -exist\n")
+		}
+	}
+	return w.Flush()
+}
+
+type ipsetSet struct {
+	name     string
+	family   string
+	prefixes []netip.Prefix
+}
+
+func (b *Blocklist) ipsetSets(setName string) []ipsetSet {
+	return []ipsetSet{
+		{name: setName, family: "inet", prefixes: b.IPv4},
+		{name: setName + "6", family: "inet6", prefixes: b.IPv6},
+	}
+}
+
+// ipset defaults to 65536 elements
+func ipsetMaxElem(n int) int {
+	m := 65536
+	for m < n {
+		m <<= 1
+	}
+	return m
+}
+
+// WriteNFTables writes the blocklist as an "nft -f" file replacing the elements of the interval sets
+// named setName and setName6 (IPv6) in the table, e.g. "inet filter". The sets are created if needed
+// and the file is applied as a single transaction.
+func (b *Blocklist) WriteNFTables(out io.Writer, table string, setName string) error {
+	w := bufio.NewWriter(out)
+	w.WriteString("add table " + table + "\n")
+	w.WriteString("add set " + table + " " + setName + " { type ipv4_addr; flags interval; }\n")
+	w.WriteString("add set " + table + " " + setName + "6 { type ipv6_addr; flags interval; }\n")
+	w.WriteString("flush set " + table + " " + setName + "\n")
+	w.WriteString("flush set " + table + " " + setName + "6\n")
+	writeNFTElements(w, "add", table, setName, b.IPv4)
+	writeNFTElements(w, "add", table, setName+"6", b.IPv6)
+	return w.Flush()
+}
+
+// WriteNFTablesChanges writes an "nft -f" file applying the changes since the previous blocklist
+// to the sets written by WriteNFTables.
+func (b *Blocklist) WriteNFTablesChanges(out io.Writer, table string, setName string, previous *Blocklist) error {
+	added, removed := b.Diff(previous)
+	w := bufio.NewWriter(out)
+	writeNFTElements(w, "delete", table, setName, removed.IPv4)
+	writeNFTElements(w, "delete", table, setName+"6", removed.IPv6)
+	writeNFTElements(w, "add", table, setName, added.IPv4)
+	writeNFTElements(w, "add", table, setName+"6", added.IPv6)
+	return w.Flush()
+}
+
+// number of elements per nft statement
+const nftBatchSize = 1024
+
+func writeNFTElements(w *bufio.Writer, verb string, table string, setName string, prefixes []netip.Prefix) {
+	for i := 0; i < len(prefixes); i += nftBatchSize {
+		batch := prefixes[i:]
+		if len(batch) > nftBatchSize {
+			batch = batch[:nftBatchSize]
+		}
+		w.WriteString(verb + " element " + table + " " + setName + " { ")
+		for j, p := range batch {
+			if j > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(p.String())
+		}
+		w.WriteString(" }\n")
+	}
+}
+
+// WriteNginxGeo writes the blocklist as a map for the nginx geo module setting the variable to 1 for
+// blocked clients and 0 otherwise, e.g. for "if ($ip2proxy_blocked) { return 403; }".
+// The variable name includes the leading $.
+func (b *Blocklist) WriteNginxGeo(out io.Writer, variable string) error {
+	w := bufio.NewWriter(out)
+	w.WriteString("geo " + variable + " {\n")
+	w.WriteString("    default 0;\n")
+	for _, prefixes := range [][]netip.Prefix{b.IPv4, b.IPv6} {
+		for _, p := range prefixes {
+			w.WriteString("    " + p.String() + " 1;\n")
+		}
+	}
+	w.WriteString("}\n")
+	return w.Flush()
+}
+
+// number of prefixes per Apache Require directive
+const apacheBatchSize = 64
+
+// WriteApacheRequire writes the blocklist as an Apache 2.4 RequireAll block granting access to
+// everyone except the blocked clients, to be included in a Directory or Location section.
+func (b *Blocklist) WriteApacheRequire(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	w.WriteString("<RequireAll>\n")
+	w.WriteString("    Require all granted\n")
+	for _, prefixes := range [][]netip.Prefix{b.IPv4, b.IPv6} {
+		for i := 0; i < len(prefixes); i += apacheBatchSize {
+			batch := prefixes[i:]
+			if len(batch) > apacheBatchSize {
+				batch = batch[:apacheBatchSize]
+			}
+			w.WriteString("    Require not ip")
+			for _, p := range batch {
+				w.WriteString(" " + p.String())
+			}
+			w.WriteString("\n")
+		}
+	}
+	w.WriteString("</RequireAll>\n")
+	return w.Flush()
+}
+
+// WriteTo writes the prefixes one per line, e.g. to keep the state for the next incremental run.
+func (b *Blocklist) WriteTo(out io.Writer) (int64, error) {
+	w := &countingWriter{w: bufio.NewWriter(out)}
+	for _, prefixes := range [][]netip.Prefix{b.IPv4, b.IPv6} {
+		for _, p := range prefixes {
+			if _, err := w.Write([]byte(p.String() + "\n")); err != nil {
+				return w.n, err
+			}
+		}
+	}
+	return w.n, w.w.(*bufio.Writer).Flush()
+}
+
+// ReadBlocklist reads prefixes written one per line by Blocklist.WriteTo.
+func ReadBlocklist(in io.Reader) (*Blocklist, error) {
+	var b = &Blocklist{}
+	s := bufio.NewScanner(in)
+	for s.Scan() {
+		if s.Text() == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(s.Text())
+		if err != nil {
+			return nil, err
+		}
+		if p.Addr().Is4() {
+			b.IPv4 = append(b.IPv4, p)
+		} else {
+			b.IPv6 = append(b.IPv6, p)
+		}
+	}
+	return b, s.Err()
+}
@@ -0,0 +1,186 @@
+package ip2proxy
+
+import (
+	"errors"
+	"lukechampine.com/uint128"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// The BloomStats struct holds the counters of the bloom filter.
+// Skipped lookups were answered by the filter, Searched lookups needed the binary search.
+type BloomStats struct {
+	Skipped  uint64
+	Searched uint64
+	Bits     uint64
+	Hashes   uint32
+}
+
+// set of the /24 IPv4 and /48 IPv6 blocks holding data, for the fast non-proxy answer
+type bloomFilter struct {
+	// accessed atomically, kept first for 64-bit alignment
+	skipped  uint64
+	searched uint64
+
+	bits   []uint64
+	hashes uint32
+	wide   []ipRange // ranges spanning too many blocks, sorted, with inclusive ipTo unlike lookups
+	record IP2ProxyRecord
+}
+
+// the ranges spanning more blocks are kept out of the filter
+const bloomMaxBlocks uint64 = 4096
+
+const msgInvalidFalsePositiveRate string = "False positive rate must be between 0 and 1."
+
+// EnableBloomFilter scans the BIN file to build a bloom filter over the address blocks holding proxy data,
+// so that lookups of most addresses without data skip the binary search. Such addresses share one record
+// in the BIN files, which is returned directly. The false positive rate, e.g. 0.01, is the share of the
+// addresses without data still needing the binary search; lower rates take more memory.
+// It must be called before any lookup, after SetUnsupportedFields.
+func (d *DB) EnableBloomFilter(falsePositiveRate float64) error {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return errors.New(msgInvalidFalsePositiveRate)
+	}
+
+	// the record shared by most non-proxy ranges, the other ranges go into the filter
+	var base *IP2ProxyRecord
+	var narrow []ipRange
+	var wide []ipRange
+	err := d.Scan(func(r IPRange) error {
+		if base == nil && r.Record.IsProxy == 0 {
+			base = &IP2ProxyRecord{}
+			*base = r.Record
+		}
+		if base != nil && r.Record == *base {
+			return nil
+		}
+
+		ir := ipRange{ipType: r.ipType, ipFrom: r.ipFrom, ipTo: r.ipTo}
+		from, to := bloomBlock(ir.ipType, ir.ipFrom), bloomBlock(ir.ipType, ir.ipTo)
+		if to.Sub(from).Cmp64(bloomMaxBlocks) >= 0 {
+			wide = append(wide, ir)
+		} else {
+			narrow = append(narrow, ir)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if base == nil {
+		// no address without data
+		return nil
+	}
+
+	n := uint64(0)
+	for _, r := range narrow {
+		n += bloomBlock(r.ipType, r.ipTo).Sub(bloomBlock(r.ipType, r.ipFrom)).Lo + 1
+	}
+	if n == 0 {
+		n = 1
+	}
+
+	// optimal number of bits and hashes for the rate
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := uint32(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	var b = &bloomFilter{}
+	b.bits = make([]uint64, (uint64(m)+63)/64)
+	b.hashes = k
+	b.wide = wide
+	b.record = *base
+	sort.Slice(b.wide, func(i, j int) bool {
+		if b.wide[i].ipType != b.wide[j].ipType {
+			return b.wide[i].ipType < b.wide[j].ipType
+		}
+		return b.wide[i].ipFrom.Cmp(b.wide[j].ipFrom) < 0
+	})
+	for _, r := range narrow {
+		to := bloomBlock(r.ipType, r.ipTo)
+		for block := bloomBlock(r.ipType, r.ipFrom); block.Cmp(to) <= 0; block = block.Add64(1) {
+			b.add(r.ipType, block)
+		}
+	}
+
+	d.bloom = b
+	return nil
+}
+
+// BloomStats returns the counters of the bloom filter.
+func (d *DB) BloomStats() BloomStats {
+	if d.bloom == nil {
+		return BloomStats{}
+	}
+	return BloomStats{
+		Skipped:  atomic.LoadUint64(&d.bloom.skipped),
+		Searched: atomic.LoadUint64(&d.bloom.searched),
+		Bits:     uint64(len(d.bloom.bits)) * 64,
+		Hashes:   d.bloom.hashes,
+	}
+}
+
+// the /24 block of IPv4 numbers, the /48 block of IPv6 numbers
+func bloomBlock(ipType uint32, ipNum uint128.Uint128) uint128.Uint128 {
+	if ipType == 4 {
+		return ipNum.Rsh(8)
+	}
+	return ipNum.Rsh(80)
+}
+
+// splitmix64 finalizer
+func bloomMix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// double hashing of the block
+func (b *bloomFilter) positions(ipType uint32, block uint128.Uint128) (uint64, uint64) {
+	h1 := bloomMix(block.Lo ^ bloomMix(block.Hi^uint64(ipType)))
+	h2 := bloomMix(h1) | 1
+	return h1, h2
+}
+
+func (b *bloomFilter) add(ipType uint32, block uint128.Uint128) {
+	h1, h2 := b.positions(ipType, block)
+	m := uint64(len(b.bits)) * 64
+	for i := uint32(0); i < b.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// checks whether the IP number may have data; false means it certainly has the base record
+func (b *bloomFilter) mayContain(ipType uint32, ipNum uint128.Uint128) bool {
+	i := sort.Search(len(b.wide), func(i int) bool {
+		r := b.wide[i]
+		if r.ipType != ipType {
+			return r.ipType > ipType
+		}
+		return r.ipTo.Cmp(ipNum) >= 0
+	})
+	if i < len(b.wide) && b.wide[i].ipType == ipType && b.wide[i].ipFrom.Cmp(ipNum) <= 0 {
+		atomic.AddUint64(&b.searched, 1)
+		return true
+	}
+
+	h1, h2 := b.positions(ipType, bloomBlock(ipType, ipNum))
+	m := uint64(len(b.bits)) * 64
+	for i := uint32(0); i < b.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			atomic.AddUint64(&b.skipped, 1)
+			return false
+		}
+	}
+	atomic.AddUint64(&b.searched, 1)
+	return true
+}
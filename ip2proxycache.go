@@ -0,0 +1,278 @@
+package ip2proxy
+
+import (
+	"container/list"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The Cache interface is implemented by lookup result caches. Values are opaque
+// serialized results so that the cache can be shared across processes.
+// A TTL of zero means the entry does not expire.
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// The MemoryCache struct is an in-process Cache. It holds at most 100000 entries by default, see SetMaxEntries,
+// the least recently used entries being evicted first.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        list.List // of *memoryCacheEntry, the most recently used first
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// default number of entries of a MemoryCache
+const memoryCacheMaxEntries = 100000
+
+// NewMemoryCache initializes an empty in-process cache.
+func NewMemoryCache() *MemoryCache {
+	var c = &MemoryCache{}
+	c.maxEntries = memoryCacheMaxEntries
+	c.entries = make(map[string]*list.Element)
+	return c
+}
+
+// SetMaxEntries sets the number of entries kept, zero for no limit. It must be called before any lookup.
+func (c *MemoryCache) SetMaxEntries(n int) *MemoryCache {
+	c.maxEntries = n
+	return c
+}
+
+// Get returns the cached value for the key.
+func (c *MemoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*memoryCacheEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true, nil
+}
+
+// Flush removes all entries.
+func (c *MemoryCache) Flush() error {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+	return nil
+}
+
+// Set stores the value for the key.
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	e := &memoryCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries, the expired ones not yet evicted included.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*memoryCacheEntry).key)
+}
+
+// The CachedDB struct caches the records of a DB keyed by the matched IP range and the database version,
+// so every IP address in the same range is served from a single cache entry. The hooks and telemetry of the DB
+// are invoked for every lookup, those served from the cache included.
+type CachedDB struct {
+	db     *DB
+	reload *ReloadableDB
+	cache  Cache
+	ttl    time.Duration
+	negTTL time.Duration // of the records not flagged as proxies
+}
+
+// NewCachedDB initializes with the DB, the cache to use and the TTL of the cache entries.
+func NewCachedDB(db *DB, cache Cache, ttl time.Duration) *CachedDB {
+	var c = &CachedDB{}
+	c.db = db
+	c.cache = cache
+	c.ttl = ttl
+	c.negTTL = ttl
+	return c
+}
+
+// SetNegativeTTL sets the TTL of the records not flagged as proxies, the TTL of NewCachedDB by default.
+// Negative results can be cached longer while the TTL of the proxies keeps the reaction to updates short.
+func (c *CachedDB) SetNegativeTTL(ttl time.Duration) *CachedDB {
+	c.negTTL = ttl
+	return c
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+// The binary search is always performed; the cache saves decoding the row and its strings.
+func (c *CachedDB) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	x, _, err := c.getAllRange(ipAddress)
+	return x, err
+}
+
+// Generation returns the generation of the ReloadableDB of Cached, see ReloadableDB.Generation, and 0 for the
+// CachedDB of a DB.
+func (c *CachedDB) Generation() uint64 {
+	if c.reload == nil {
+		return 0
+	}
+	return c.reload.Generation()
+}
+
+// cached lookup returning the matched range too
+func (c *CachedDB) getAllRange(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	d := c.db
+	prefix := "ip2proxy:"
+	if c.reload != nil {
+		var generation uint64
+		var release func()
+		d, generation, release = c.reload.acquire()
+		defer release()
+		prefix += "g" + strconv.FormatUint(generation, 10) + ":"
+	}
+
+	// the hooks and telemetry of the DB, for the lookups answered by the cache too
+	if d.telemetry == nil && d.hooks == nil {
+		return c.search(d, prefix, ipAddress)
+	}
+	if d.hooks != nil {
+		started := queryStart(d.hooks, ipAddress)
+		x, r, err := c.measuredSearch(d, prefix, ipAddress)
+		queryEnd(d.hooks, ipAddress, x, err, started)
+		return x, r, err
+	}
+	return c.measuredSearch(d, prefix, ipAddress)
+}
+
+// cached lookup with the telemetry of the DB if set
+func (c *CachedDB) measuredSearch(d *DB, prefix string, ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	if d.telemetry == nil {
+		return c.search(d, prefix, ipAddress)
+	}
+	started, end := startLookup(d.telemetry, "bin")
+	x, r, err := c.search(d, prefix, ipAddress)
+	recordLookup(d.telemetry, "bin", started, x.IsProxy, err)
+	end(err)
+	return x, r, err
+}
+
+// cached lookup without telemetry nor hooks
+func (c *CachedDB) search(d *DB, prefix string, ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	if !d.metaOK {
+		return d.search(ipAddress, all, nil)
+	}
+
+	ipType, ipNo, ipIndex := d.checkIP(ipAddress)
+	if ipType == 0 || (ipType == 6 && d.meta.ipV6DatabaseCount == 0) {
+		return d.search(ipAddress, all, nil)
+	}
+
+	row, ipFrom, ipTo, err := d.searchRow(ipType, ipNo, ipIndex, nil)
+	if err != nil || row == nil {
+		return d.search(ipAddress, all, nil)
+	}
+	r := ipRange{ipType: ipType, ipFrom: ipFrom, ipTo: ipTo}
+
+	key := prefix + "PX" + d.PackageVersion() + ":" + d.DatabaseVersion() + ":" + strconv.Itoa(int(ipType)) + ":" + ipFrom.String() + "-" + ipTo.String()
+
+	var x IP2ProxyRecord
+	if data, ok, err := c.cache.Get(key); err == nil && ok && json.Unmarshal(data, &x) == nil {
+		return x, r, nil
+	}
+
+	x, err = d.readRecord(row, all)
+	if err != nil {
+		return x, ipRange{}, err
+	}
+
+	ttl := c.ttl
+	if x.IsProxy == 0 {
+		ttl = c.negTTL
+	}
+	if data, err := json.Marshal(x); err == nil {
+		_ = c.cache.Set(key, data, ttl)
+	}
+	return x, r, nil
+}
+
+// The CachedWS struct caches the web service results keyed by the queried IP address and
+// the API package, so repeated lookups don't spend web service credits.
+type CachedWS struct {
+	ws     *WS
+	cache  Cache
+	ttl    time.Duration
+	negTTL time.Duration // of the results not flagged as proxies
+}
+
+// NewCachedWS initializes with the WS, the cache to use and the TTL of the cache entries.
+func NewCachedWS(ws *WS, cache Cache, ttl time.Duration) *CachedWS {
+	var c = &CachedWS{}
+	c.ws = ws
+	c.cache = cache
+	c.ttl = ttl
+	c.negTTL = ttl
+	return c
+}
+
+// SetNegativeTTL sets the TTL of the results not flagged as proxies, the TTL of NewCachedWS by default.
+func (c *CachedWS) SetNegativeTTL(ttl time.Duration) *CachedWS {
+	c.negTTL = ttl
+	return c
+}
+
+// LookUp will return all proxy fields based on the queried IP address.
+func (c *CachedWS) LookUp(ipAddress string) (IP2ProxyResult, error) {
+	key := "ip2proxyws:" + c.ws.Package() + ":" + ipAddress
+
+	var res IP2ProxyResult
+	if data, ok, err := c.cache.Get(key); err == nil && ok && json.Unmarshal(data, &res) == nil {
+		return res, nil
+	}
+
+	res, err := c.ws.LookUp(ipAddress)
+	if err != nil {
+		return res, err
+	}
+
+	ttl := c.ttl
+	if res.IsProxy == "NO" {
+		ttl = c.negTTL
+	}
+	if data, err := json.Marshal(res); err == nil {
+		_ = c.cache.Set(key, data, ttl)
+	}
+	return res, nil
+}
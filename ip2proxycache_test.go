@@ -0,0 +1,168 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheLRU(t *testing.T) {
+	c := NewMemoryCache().SetMaxEntries(2)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Get("a") // b is now the least recently used
+	c.Set("c", []byte("3"), 0)
+
+	if _, ok, _ := c.Get("b"); ok {
+		t.Error("least recently used entry kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	c.Set("a", []byte("4"), 0)
+	if v, _, _ := c.Get("a"); string(v) != "4" || c.Len() != 2 {
+		t.Errorf("%q and %d entries after replacing a", v, c.Len())
+	}
+
+	if err := c.Flush(); err != nil || c.Len() != 0 {
+		t.Errorf("%d entries after Flush (%v)", c.Len(), err)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	c := NewMemoryCache()
+	c.Set("a", []byte("1"), time.Nanosecond)
+	c.Set("b", []byte("2"), time.Hour)
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := c.Get("a"); ok || c.Len() != 1 {
+		t.Errorf("expired entry returned or kept, %d entries", c.Len())
+	}
+	if _, ok, _ := c.Get("b"); !ok {
+		t.Error("unexpired entry missing")
+	}
+}
+
+func TestMemoryCacheDefaultLimit(t *testing.T) {
+	c := NewMemoryCache()
+	for i := 0; i <= memoryCacheMaxEntries; i++ {
+		c.Set(strconv.Itoa(i), nil, 0)
+	}
+	if c.Len() != memoryCacheMaxEntries {
+		t.Errorf("%d entries instead of %d", c.Len(), memoryCacheMaxEntries)
+	}
+
+	c.SetMaxEntries(0)
+	c.Set("unlimited", nil, 0)
+	if c.Len() != memoryCacheMaxEntries+1 {
+		t.Errorf("%d entries without limit", c.Len())
+	}
+}
+
+// a Redis server recording the commands received and replying OK
+func fakeRedis(t *testing.T) (addr string, commands func() [][]string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var mu sync.Mutex
+	var received [][]string
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var args []string
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					for i := 0; i < n; i++ {
+						r.ReadString('\n') // length
+						arg, _ := r.ReadString('\n')
+						args = append(args, strings.TrimSuffix(arg, "\r\n"))
+					}
+					mu.Lock()
+					received = append(received, args)
+					mu.Unlock()
+					conn.Write([]byte("+OK\r\n"))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+// the TTLs are rounded up to the millisecond, PX 0 being rejected by Redis
+func TestRedisCacheTTL(t *testing.T) {
+	addr, commands := fakeRedis(t)
+	c := NewRedisCache(addr, "", 0)
+	defer c.Close()
+
+	for _, ttl := range []time.Duration{time.Nanosecond, 999 * time.Microsecond, time.Millisecond, 1500 * time.Microsecond, 0, -time.Second} {
+		if err := c.Set("k", []byte("v"), ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"SET k v PX 1", "SET k v PX 1", "SET k v PX 1", "SET k v PX 2", "SET k v", "SET k v"}
+	got := commands()
+	if len(got) != len(want) {
+		t.Fatalf("%d commands instead of %d", len(got), len(want))
+	}
+	for i := range want {
+		if cmd := strings.Join(got[i], " "); cmd != want[i] {
+			t.Errorf("%q instead of %q", cmd, want[i])
+		}
+	}
+}
+
+// a Cache recording the TTLs of the entries set
+type ttlCache struct {
+	*MemoryCache
+	ttls []time.Duration
+}
+
+func (c *ttlCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.ttls = append(c.ttls, ttl)
+	return c.MemoryCache.Set(key, value, ttl)
+}
+
+// the records not flagged as proxies expire after the TTL, for the CachedDB of a ReloadableDB too
+func TestCachedDBNegativeTTL(t *testing.T) {
+	for name, newCached := range map[string]func(db *DB, cache Cache) *CachedDB{
+		"NewCachedDB": func(db *DB, cache Cache) *CachedDB { return NewCachedDB(db, cache, time.Millisecond) },
+		"Cached":      func(db *DB, cache Cache) *CachedDB { return NewReloadableDB(db).Cached(cache, time.Millisecond) },
+	} {
+		db := openTestBIN(t, newTestWriter(t, 2, testVPNRange))
+		cache := &ttlCache{MemoryCache: NewMemoryCache()}
+		c := newCached(db, cache)
+		for i := 0; i < 2; i++ {
+			if rec, err := c.GetAll("198.51.100.1"); err != nil || rec.IsProxy != 0 {
+				t.Fatalf("%s: %+v (%v) instead of a negative result", name, rec, err)
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+		if len(cache.ttls) != 2 || cache.ttls[0] != time.Millisecond || cache.ttls[1] != time.Millisecond {
+			t.Errorf("%s: negative result cached with the TTLs %v instead of expiring after 1ms", name, cache.ttls)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,137 @@
+package ip2proxy
+
+import "time"
+
+// The CanaryDisagreement struct is an address classified differently by the DB under canary evaluation.
+// The records hold the fields read for the lookup, only IsProxy for the IsProxy lookups.
+type CanaryDisagreement struct {
+	IP               string
+	Current          IP2ProxyRecord
+	Candidate        IP2ProxyRecord
+	CurrentVersion   string
+	CandidateVersion string
+}
+
+// the canary settings and the DB under evaluation
+type canary struct {
+	period     time.Duration
+	onDisagree func(CanaryDisagreement)
+	candidate  *DB
+	timer      *time.Timer
+}
+
+// SetCanary makes the swaps, and so the reloads, run the new DB side by side with the current one for the given
+// period before switching to it: the lookups are answered from the current DB and looked up in the new one too,
+// onDisagree being called for every address where IsProxy or ProxyType differ. It is a safety net for the
+// applications where a misclassification is costly, e.g. to log the disagreements and review them before the
+// switch, or to call AbortCanary. A swap during the period replaces the DB under evaluation and restarts the
+// period. The lookups cost twice as much during the period; onDisagree is called by the lookups and must be
+// quick. Caches attached are only flushed on the switch, so the cached lookups are not compared.
+func (r *ReloadableDB) SetCanary(period time.Duration, onDisagree func(CanaryDisagreement)) *ReloadableDB {
+	var c = &canary{}
+	c.period = period
+	c.onDisagree = onDisagree
+	r.mu.Lock()
+	r.canary = c
+	r.mu.Unlock()
+	return r
+}
+
+// start the evaluation of the DB, false to swap it in right away
+func (r *ReloadableDB) startCanary(db *DB) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.canary
+	if c == nil || c.period <= 0 {
+		return false
+	}
+
+	if c.candidate != nil {
+		c.timer.Stop()
+		c.candidate.Close()
+	}
+	c.candidate = db
+	c.timer = time.AfterFunc(c.period, func() { r.promote(db) })
+	return true
+}
+
+// swap in the DB under evaluation unless replaced or aborted meanwhile
+func (r *ReloadableDB) promote(db *DB) error {
+	r.mu.Lock()
+	c := r.canary
+	if c == nil || c.candidate != db {
+		r.mu.Unlock()
+		return nil
+	}
+	c.candidate = nil
+	c.timer.Stop()
+	r.mu.Unlock()
+	return r.swap(db)
+}
+
+// Candidate returns the database version of the DB under canary evaluation, empty if none.
+func (r *ReloadableDB) Candidate() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.canary == nil || r.canary.candidate == nil {
+		return ""
+	}
+	return r.canary.candidate.DatabaseVersion()
+}
+
+// PromoteCanary ends the canary period early and swaps in the DB under evaluation, if any.
+func (r *ReloadableDB) PromoteCanary() error {
+	r.mu.RLock()
+	var db *DB
+	if r.canary != nil {
+		db = r.canary.candidate
+	}
+	r.mu.RUnlock()
+	if db == nil {
+		return nil
+	}
+	return r.promote(db)
+}
+
+// AbortCanary closes the DB under canary evaluation, if any, and keeps the current DB.
+func (r *ReloadableDB) AbortCanary() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.canary
+	if c == nil || c.candidate == nil {
+		return nil
+	}
+	c.timer.Stop()
+	err := c.candidate.Close()
+	c.candidate = nil
+	return err
+}
+
+// look up the address in the DB under evaluation, if any, and report a different classification
+func (r *ReloadableDB) compareCandidate(ipAddress string, current IP2ProxyRecord, err error, mode uint32) {
+	if err != nil {
+		return
+	}
+	r.mu.RLock()
+	c := r.canary
+	if c == nil || c.candidate == nil {
+		r.mu.RUnlock()
+		return
+	}
+	db := c.candidate
+	candidate, err := db.query(ipAddress, mode)
+	onDisagree := c.onDisagree
+	var d CanaryDisagreement
+	if err == nil && (candidate.IsProxy != current.IsProxy || candidate.ProxyType != current.ProxyType) {
+		d.IP = ipAddress
+		d.Current = current
+		d.Candidate = candidate
+		d.CurrentVersion = r.db.DatabaseVersion()
+		d.CandidateVersion = db.DatabaseVersion()
+	}
+	r.mu.RUnlock()
+
+	if d.IP != "" && onDisagree != nil {
+		onDisagree(d)
+	}
+}
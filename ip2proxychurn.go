@@ -0,0 +1,154 @@
+package ip2proxy
+
+import (
+	"sort"
+
+	"lukechampine.com/uint128"
+)
+
+// The TypeChurn struct counts the proxy ranges of a proxy type in two databases and the ranges which differ.
+// A range is unchanged if the newer database has the same range with the same proxy type.
+type TypeChurn struct {
+	Before  int // ranges in the older database
+	After   int // ranges in the newer database
+	Added   int // ranges of the newer database not in the older one
+	Removed int // ranges of the older database not in the newer one
+}
+
+// Ratio returns the share of the ranges which changed, the added and removed ranges over the ranges before.
+// It is 1 for a proxy type new to the newer database.
+func (c TypeChurn) Ratio() float64 {
+	if c.Before == 0 {
+		if c.Added > 0 {
+			return 1
+		}
+		return 0
+	}
+	return float64(c.Added+c.Removed) / float64(c.Before)
+}
+
+// The ChurnSummary struct compares the proxy ranges of two databases per proxy type, the ranges not flagged as
+// proxies being left out.
+type ChurnSummary struct {
+	OldVersion string
+	NewVersion string
+	ProxyTypes map[string]TypeChurn
+	Exceeded   []string // the proxy types over the thresholds, set for the alerts
+}
+
+// The ChurnThresholds struct sets when the churn between two databases is alerted on.
+type ChurnThresholds struct {
+	MaxRatio  float64 // highest TypeChurn.Ratio of any proxy type not alerted on, e.g. 0.2
+	MinRanges int     // proxy types with fewer ranges in both databases are not alerted on
+}
+
+// exceeded lists the proxy types over the thresholds, in alphabetical order
+func (t ChurnThresholds) exceeded(s ChurnSummary) []string {
+	var types []string
+	for pt, c := range s.ProxyTypes {
+		if (c.Before >= t.MinRanges || c.After >= t.MinRanges) && c.Ratio() > t.MaxRatio {
+			types = append(types, pt)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// a proxy range of the older database
+type churnRange struct {
+	ipType    uint32
+	ipFrom    uint128.Uint128
+	ipTo      uint128.Uint128
+	proxyType string
+}
+
+func churnRangeOf(r IPRange) churnRange {
+	return churnRange{ipType: r.ipType, ipFrom: r.ipFrom, ipTo: r.ipTo, proxyType: r.Record.ProxyType}
+}
+
+// order of the ranges, the IPv4 ranges first as scanned
+func (c churnRange) before(o churnRange) bool {
+	if c.ipType != o.ipType {
+		return c.ipType < o.ipType
+	}
+	return c.ipFrom.Cmp(o.ipFrom) < 0
+}
+
+// CompareDBs scans both databases and counts the proxy ranges added and removed per proxy type, e.g. to check a
+// new release before using it. The ranges of the older database are held in memory.
+func CompareDBs(older *DB, newer *DB) (ChurnSummary, error) {
+	var s ChurnSummary
+	s.OldVersion = older.DatabaseVersion()
+	s.NewVersion = newer.DatabaseVersion()
+	s.ProxyTypes = make(map[string]TypeChurn)
+	count := func(pt string, f func(c *TypeChurn)) {
+		c := s.ProxyTypes[pt]
+		f(&c)
+		s.ProxyTypes[pt] = c
+	}
+
+	var old []churnRange
+	err := older.Scan(func(r IPRange) error {
+		if r.Record.IsProxy > 0 {
+			old = append(old, churnRangeOf(r))
+			count(r.Record.ProxyType, func(c *TypeChurn) { c.Before++ })
+		}
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+
+	i := 0
+	err = newer.Scan(func(r IPRange) error {
+		if r.Record.IsProxy <= 0 {
+			return nil
+		}
+		n := churnRangeOf(r)
+		for ; i < len(old) && old[i].before(n); i++ {
+			count(old[i].proxyType, func(c *TypeChurn) { c.Removed++ })
+		}
+		count(n.proxyType, func(c *TypeChurn) { c.After++ })
+		if i < len(old) && old[i] == n {
+			i++
+		} else {
+			count(n.proxyType, func(c *TypeChurn) { c.Added++ })
+		}
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+	for ; i < len(old); i++ {
+		count(old[i].proxyType, func(c *TypeChurn) { c.Removed++ })
+	}
+	return s, nil
+}
+
+// SetChurnAlert compares every DB swapped in with the previous one, see CompareDBs, and calls alert with the
+// summary when the churn of a proxy type exceeds the thresholds, e.g. to catch a truncated or bad release and
+// swap back. The comparison runs in the background after the swap, the previous DB being closed once done; it
+// is given up if the newer DB is closed first.
+func (r *ReloadableDB) SetChurnAlert(thresholds ChurnThresholds, alert func(ChurnSummary)) *ReloadableDB {
+	r.mu.Lock()
+	r.churn = &churnAlert{thresholds: thresholds, alert: alert}
+	r.mu.Unlock()
+	return r
+}
+
+type churnAlert struct {
+	thresholds ChurnThresholds
+	alert      func(ChurnSummary)
+}
+
+// compare the databases and alert, then close the older one
+func (a *churnAlert) check(older *DB, newer *DB) {
+	defer older.Close()
+	s, err := CompareDBs(older, newer)
+	if err != nil {
+		return
+	}
+	if s.Exceeded = a.thresholds.exceeded(s); len(s.Exceeded) > 0 {
+		a.alert(s)
+	}
+}
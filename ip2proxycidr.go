@@ -0,0 +1,103 @@
+package ip2proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"lukechampine.com/uint128"
+	"net/netip"
+)
+
+// RangeToPrefixes converts the IP range from ipFrom to ipTo inclusive into the minimal list of
+// CIDR prefixes covering it, e.g. for firewall rules. Both addresses must be of the same IP version.
+func RangeToPrefixes(ipFrom netip.Addr, ipTo netip.Addr) ([]netip.Prefix, error) {
+	if !ipFrom.IsValid() || !ipTo.IsValid() || ipFrom.Is4() != ipTo.Is4() || ipTo.Less(ipFrom) {
+		return nil, errors.New(msgInvalidRange)
+	}
+
+	ipType, fromNum := addrToNum(ipFrom)
+	_, toNum := addrToNum(ipTo)
+
+	var prefixes []netip.Prefix
+	for _, b := range rangeToCIDRs(ipType, fromNum, toNum) {
+		prefixes = append(prefixes, b.prefix(ipType))
+	}
+	return prefixes, nil
+}
+
+// Prefixes returns the minimal list of CIDR prefixes covering the range.
+func (r IPRange) Prefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, b := range rangeToCIDRs(r.ipType, r.ipFrom, r.ipTo) {
+		prefixes = append(prefixes, b.prefix(r.ipType))
+	}
+	return prefixes
+}
+
+// a CIDR block of IP numbers
+type cidrBlock struct {
+	ipNum uint128.Uint128
+	bits  int
+}
+
+// split the inclusive range of IP numbers into the minimal list of CIDR blocks
+func rangeToCIDRs(ipType uint32, ipFrom uint128.Uint128, ipTo uint128.Uint128) []cidrBlock {
+	width := 32
+	if ipType == 6 {
+		width = 128
+	}
+
+	var blocks []cidrBlock
+	for ipFrom.Cmp(ipTo) <= 0 {
+		k := ipFrom.TrailingZeros()
+		if k > width {
+			k = width
+		}
+		for k > 0 && ipFrom.Or(hostMask(k)).Cmp(ipTo) > 0 {
+			k--
+		}
+
+		blocks = append(blocks, cidrBlock{ipNum: ipFrom, bits: width - k})
+		end := ipFrom.Or(hostMask(k))
+		if end.Cmp(ipTo) >= 0 {
+			break
+		}
+		ipFrom = end.Add64(1)
+	}
+	return blocks
+}
+
+// the lowest k bits set
+func hostMask(k int) uint128.Uint128 {
+	if k == 0 {
+		return uint128.Zero
+	}
+	return uint128.Max.Rsh(uint(128 - k))
+}
+
+// the block as a prefix
+func (b cidrBlock) prefix(ipType uint32) netip.Prefix {
+	return netip.PrefixFrom(numToAddr(ipType, b.ipNum), b.bits)
+}
+
+// IP type and IP number of the address, without the remapping done for lookups
+func addrToNum(ip netip.Addr) (uint32, uint128.Uint128) {
+	if ip.Is4() {
+		b := ip.As4()
+		return 4, uint128.From64(uint64(binary.BigEndian.Uint32(b[:])))
+	}
+	b := ip.As16()
+	return 6, uint128.New(binary.BigEndian.Uint64(b[8:]), binary.BigEndian.Uint64(b[:8]))
+}
+
+// address of the IP number
+func numToAddr(ipType uint32, ipNum uint128.Uint128) netip.Addr {
+	if ipType == 4 {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(ipNum.Lo))
+		return netip.AddrFrom4(b)
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ipNum.Hi)
+	binary.BigEndian.PutUint64(b[8:], ipNum.Lo)
+	return netip.AddrFrom16(b)
+}
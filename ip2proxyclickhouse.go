@@ -0,0 +1,84 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExportClickHouse writes the IP ranges accepted by the filter, or all of them if filter is nil, as
+// CSV with a header row for a ClickHouse ip_trie dictionary. Every range is split into the minimal
+// set of CIDR prefixes, each a row with the prefix followed by is_proxy and the fields supported by
+// the BIN file. Use ClickHouseDictionary for the matching dictionary definition.
+func (d *DB) ExportClickHouse(out io.Writer, filter func(r IPRange) bool) error {
+	bw := bufio.NewWriter(out)
+	w := csv.NewWriter(bw)
+	fields := d.exportFields()
+
+	header := []string{"prefix", "is_proxy"}
+	for _, f := range fields {
+		header = append(header, f.name)
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(header))
+	err := d.Scan(func(r IPRange) error {
+		if filter != nil && !filter(r) {
+			return nil
+		}
+
+		record[1] = strconv.Itoa(int(r.Record.IsProxy))
+		for i, f := range fields {
+			v := f.value(&r.Record)
+			if f.numeric {
+				if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+					v = "0"
+				}
+			}
+			record[i+2] = v
+		}
+
+		for _, p := range r.Prefixes() {
+			record[0] = p.String()
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ClickHouseDictionary returns the CREATE DICTIONARY statement for the CSV file written by
+// ExportClickHouse, given the dictionary name and the path of the file on the ClickHouse server.
+// Look addresses up with dictGet('name', 'proxy_type', toIPv6(...)) or the IPv4 equivalent.
+func (d *DB) ClickHouseDictionary(name string, csvPath string) string {
+	var sb strings.Builder
+	sb.WriteString("CREATE DICTIONARY " + name + "\n(\n")
+	sb.WriteString("    prefix String,\n")
+	sb.WriteString("    is_proxy Int8 DEFAULT 0")
+	for _, f := range d.exportFields() {
+		if f.numeric {
+			sb.WriteString(",\n    " + f.name + " UInt32 DEFAULT 0")
+		} else {
+			sb.WriteString(",\n    " + f.name + " String DEFAULT '-'")
+		}
+	}
+	sb.WriteString("\n)\nPRIMARY KEY prefix\n")
+	sb.WriteString("SOURCE(FILE(path '" + strings.Replace(csvPath, "'", "\\'", -1) + "' format 'CSVWithNames'))\n")
+	sb.WriteString("LAYOUT(IP_TRIE)\n")
+	sb.WriteString("LIFETIME(3600)")
+	return sb.String()
+}
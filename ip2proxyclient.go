@@ -0,0 +1,152 @@
+package ip2proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The DaemonClient struct is a Resolver querying the lookup daemon of cmd/ip2proxy, e.g. over a
+// unix socket from a sidecar on the same host, instead of opening the BIN file in every process.
+type DaemonClient struct {
+	base      string
+	client    *http.Client
+	transport *http.Transport
+	token     string
+}
+
+// JSON lookup response of the daemon
+type daemonRecord struct {
+	IsProxy     int8   `json:"isProxy"`
+	ProxyType   string `json:"proxyType"`
+	CountryCode string `json:"countryCode"`
+	CountryName string `json:"countryName"`
+	RegionName  string `json:"regionName"`
+	CityName    string `json:"cityName"`
+	ISP         string `json:"isp"`
+	Domain      string `json:"domain"`
+	UsageType   string `json:"usageType"`
+	ASN         string `json:"asn"`
+	AS          string `json:"as"`
+	LastSeen    string `json:"lastSeen"`
+	Threat      string `json:"threat"`
+	Provider    string `json:"provider"`
+	Error       string `json:"error"`
+}
+
+const msgInvalidDaemonAddress string = "Invalid daemon address."
+
+// NewDaemonClient initializes with the address of the daemon: unix:/path/to/socket, unix:@name for
+// a Linux abstract socket, host:port or an http:// or https:// URL.
+func NewDaemonClient(addr string) (*DaemonClient, error) {
+	var c = &DaemonClient{}
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	c.client = &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	c.transport = transport
+
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		if path == "" {
+			return nil, errors.New(msgInvalidDaemonAddress)
+		}
+		// the net package maps a leading @ to the abstract namespace
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		c.base = "http://unix"
+	case strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://"):
+		c.base = strings.TrimSuffix(addr, "/")
+	default:
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, errors.New(msgInvalidDaemonAddress)
+		}
+		c.base = "http://" + addr
+	}
+	return c, nil
+}
+
+// SetTimeout sets the timeout of the requests to the daemon; 5 seconds by default.
+func (c *DaemonClient) SetTimeout(timeout time.Duration) *DaemonClient {
+	c.client.Timeout = timeout
+	return c
+}
+
+// SetTLSConfig sets the TLS settings of https:// addresses, e.g. the CA of the daemon certificate and
+// the client certificate when the daemon requires mutual TLS.
+func (c *DaemonClient) SetTLSConfig(config *tls.Config) *DaemonClient {
+	c.transport.TLSClientConfig = config
+	return c
+}
+
+// SetToken sets the secret sent as bearer token, for daemons started with -auth-clients.
+func (c *DaemonClient) SetToken(token string) *DaemonClient {
+	c.token = token
+	return c
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+func (c *DaemonClient) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	x := loadMessage(msgInvalidIP)
+	if net.ParseIP(ipAddress) == nil {
+		return x, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.base+"/v1/lookup?ip="+url.QueryEscape(ipAddress), nil)
+	if err != nil {
+		return x, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return x, err
+	}
+	defer resp.Body.Close()
+
+	var res daemonRecord
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return x, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if res.Error == "" {
+			res.Error = resp.Status
+		}
+		return x, errors.New(res.Error)
+	}
+
+	return IP2ProxyRecord{
+		IsProxy:      res.IsProxy,
+		ProxyType:    res.ProxyType,
+		CountryShort: res.CountryCode,
+		CountryLong:  res.CountryName,
+		Region:       res.RegionName,
+		City:         res.CityName,
+		Isp:          res.ISP,
+		Domain:       res.Domain,
+		UsageType:    res.UsageType,
+		Asn:          res.ASN,
+		As:           res.AS,
+		LastSeen:     res.LastSeen,
+		Threat:       res.Threat,
+		Provider:     res.Provider,
+	}, nil
+}
+
+// Close closes the idle connections to the daemon.
+func (c *DaemonClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
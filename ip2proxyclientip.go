@@ -0,0 +1,173 @@
+package ip2proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The ClientIPExtractor struct resolves the real client IP address of a request which may have
+// passed through reverse proxies. Forwarding headers are only honoured when the peer sending
+// them is one of the trusted proxies, and the forwarding chain is walked from the nearest hop
+// until the first untrusted address.
+type ClientIPExtractor struct {
+	trusted        []*net.IPNet
+	forwarded      bool
+	xForwardedFor  bool
+	cfConnectingIP bool
+	maxDepth       int
+}
+
+// NewClientIPExtractor initializes with the CIDRs (or single IP addresses) of the trusted proxies.
+// The Forwarded (RFC 7239) and X-Forwarded-For headers are honoured by default.
+func NewClientIPExtractor(trustedProxies []string) (*ClientIPExtractor, error) {
+	var e = &ClientIPExtractor{}
+	e.forwarded = true
+	e.xForwardedFor = true
+
+	for _, s := range trustedProxies {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		e.trusted = append(e.trusted, n)
+	}
+	return e, nil
+}
+
+// UseForwarded sets whether the Forwarded header is honoured. It takes precedence over X-Forwarded-For.
+func (e *ClientIPExtractor) UseForwarded(enabled bool) *ClientIPExtractor {
+	e.forwarded = enabled
+	return e
+}
+
+// UseXForwardedFor sets whether the X-Forwarded-For header is honoured.
+func (e *ClientIPExtractor) UseXForwardedFor(enabled bool) *ClientIPExtractor {
+	e.xForwardedFor = enabled
+	return e
+}
+
+// UseCFConnectingIP sets whether the CF-Connecting-IP header set by Cloudflare is honoured.
+// The Cloudflare ranges must be part of the trusted proxies.
+func (e *ClientIPExtractor) UseCFConnectingIP(enabled bool) *ClientIPExtractor {
+	e.cfConnectingIP = enabled
+	return e
+}
+
+// SetMaxDepth limits how many forwarding hops are walked; zero means no limit.
+func (e *ClientIPExtractor) SetMaxDepth(depth int) *ClientIPExtractor {
+	e.maxDepth = depth
+	return e
+}
+
+// IsTrusted checks whether the IP address belongs to a trusted proxy.
+func (e *ClientIPExtractor) IsTrusted(ipAddress string) bool {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return false
+	}
+	for _, n := range e.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP address of the request.
+func (e *ClientIPExtractor) ClientIP(r *http.Request) string {
+	return e.FromHeader(remoteIP(r.RemoteAddr), r.Header)
+}
+
+// FromHeader returns the client IP address given the IP address of the peer and the request headers,
+// for frameworks not based on net/http.
+func (e *ClientIPExtractor) FromHeader(peerIP string, header http.Header) string {
+	if !e.IsTrusted(peerIP) {
+		return peerIP
+	}
+
+	if e.cfConnectingIP {
+		if ip := parseHop(header.Get("CF-Connecting-IP")); ip != "" {
+			return ip
+		}
+	}
+
+	var chain []string
+	if e.forwarded && len(header.Values("Forwarded")) > 0 {
+		chain = forwardedFor(header.Values("Forwarded"))
+	} else if e.xForwardedFor {
+		for _, v := range header.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(v, ",")...)
+		}
+	}
+
+	ip := peerIP
+	depth := 0
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := parseHop(chain[i])
+		if hop == "" {
+			// obfuscated or malformed hop, the last known address is the best we have
+			break
+		}
+		ip = hop
+		depth++
+		if !e.IsTrusted(ip) || (e.maxDepth > 0 && depth >= e.maxDepth) {
+			break
+		}
+	}
+	return ip
+}
+
+// extract the "for" parameters of the Forwarded header elements in order, one hop per element,
+// empty for the elements without one so that the hops stay aligned with the proxies
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					hop = strings.Trim(kv[1], `"`)
+				}
+			}
+			chain = append(chain, hop)
+		}
+	}
+	return chain
+}
+
+// parse a forwarding hop which may carry a port or brackets; empty if not an IP address
+func parseHop(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// host part of the remote address
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
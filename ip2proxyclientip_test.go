@@ -0,0 +1,32 @@
+package ip2proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+// the Forwarded elements without a "for" parameter count as unknown hops, stopping the walk
+func TestClientIPForwarded(t *testing.T) {
+	e, err := NewClientIPExtractor([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		forwarded string
+		want      string
+	}{
+		{"for=198.51.100.7", "198.51.100.7"},
+		{`for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`, "2001:db8::1"},
+		{"by=10.0.0.9;proto=https, for=198.51.100.7", "198.51.100.7"},
+		{"by=10.0.0.9;proto=https, for=10.0.0.2", "10.0.0.2"},
+		{"for=203.0.113.5, by=10.0.0.9;proto=https, for=10.0.0.2", "10.0.0.2"},
+		{"for=203.0.113.5, for=_hidden, for=10.0.0.2", "10.0.0.2"},
+		{"by=10.0.0.9;proto=https", "10.0.0.1"},
+	} {
+		header := http.Header{}
+		header.Set("Forwarded", c.forwarded)
+		if got := e.FromHeader("10.0.0.1", header); got != c.want {
+			t.Errorf("Forwarded: %s: %s instead of %s", c.forwarded, got, c.want)
+		}
+	}
+}
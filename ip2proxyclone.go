@@ -0,0 +1,86 @@
+package ip2proxy
+
+import (
+	"errors"
+	"os"
+)
+
+const msgCloneUnsupported string = "The reader of the IP2Proxy BIN file cannot be cloned."
+const msgCloneFileChanged string = "The IP2Proxy BIN file changed since it was opened."
+
+// readers duplicating themselves for Clone
+type clonableReader interface {
+	clone() (dbReader, error)
+}
+
+// Clone returns a DB reading the same BIN file through its own file handle, sharing the metadata, the
+// settings and the indexes already read or built, e.g. by BuildIPv6Index, so that the query load can be spread
+// over several handles without reading the header again per goroutine. The DB opened from memory are cloned
+// over the same bytes. The DB opened with a custom reader cannot be cloned. The clone must be closed on its own;
+// closing it leaves the original open and the other way round. The hooks added to either afterwards are not
+// shared.
+func (d *DB) Clone() (*DB, error) {
+	if d.isClosed() {
+		return nil, ErrClosed
+	}
+
+	var f dbReader
+	switch r := d.f.(type) {
+	case bytesReader:
+		f = r
+	case *os.File:
+		c, err := reopen(r)
+		if err != nil {
+			return nil, err
+		}
+		f = c
+	case clonableReader:
+		c, err := r.clone()
+		if err != nil {
+			return nil, err
+		}
+		f = c
+	default:
+		return nil, errors.New(msgCloneUnsupported)
+	}
+
+	var db = &DB{}
+	*db = *d
+	db.closed = 0
+	db.f = f
+	db.batch = nil
+	if b, ok := f.(BatchReaderAt); ok && db.data == nil {
+		db.batch = b
+	}
+	db.hooks = append([]Hooks(nil), d.hooks...)
+	return db, nil
+}
+
+// open the file again, checking that it was not replaced meanwhile, e.g. by an update
+func reopen(f *os.File) (*os.File, error) {
+	c, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err = sameFile(f, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// check that both files are the same file
+func sameFile(f *os.File, c *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	ci, err := c.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(fi, ci) {
+		return errors.New(msgCloneFileChanged)
+	}
+	return nil
+}
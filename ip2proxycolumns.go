@@ -0,0 +1,130 @@
+package ip2proxy
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// The ColumnType type is the encoding of a registered column.
+type ColumnType int
+
+const (
+	// ColumnString is the offset of a length-prefixed string, as the built-in columns.
+	ColumnString ColumnType = iota
+	// ColumnUint32 is a 32-bit value stored in the row, returned in decimal.
+	ColumnUint32
+)
+
+// The Column struct describes a column of the BIN files which this version of the package does not know,
+// e.g. one added to a new database type, so that it can be read before a release supports it.
+type Column struct {
+	Name string
+	// Positions is the position of the column by database type, 0 where absent; the position of IP From is 1.
+	// PX11 having 13 columns, the next column would be at position 14 from its database type on.
+	Positions []uint8
+	Type      ColumnType
+}
+
+// The ExtraFields type holds the values of the registered columns by name. It is not part of IP2ProxyRecord,
+// which must remain comparable.
+type ExtraFields map[string]string
+
+const msgInvalidColumn string = "Invalid column."
+
+// registered columns, read by the DBs opened afterwards
+var columnRegistry struct {
+	mu      sync.RWMutex
+	columns []Column
+}
+
+// a registered column present in the opened BIN file
+type extraColumn struct {
+	name   string
+	offset uint32 // position offset in the row data
+	typ    ColumnType
+}
+
+// RegisterColumn registers a column read by GetAllExtra from the BIN files opened afterwards. The name must not
+// be registered already and the positions must come after IP From.
+func RegisterColumn(c Column) error {
+	if c.Name == "" || (c.Type != ColumnString && c.Type != ColumnUint32) {
+		return errors.New(msgInvalidColumn)
+	}
+	for _, p := range c.Positions {
+		if p == 1 {
+			return errors.New(msgInvalidColumn)
+		}
+	}
+
+	columnRegistry.mu.Lock()
+	defer columnRegistry.mu.Unlock()
+	for _, r := range columnRegistry.columns {
+		if r.Name == c.Name {
+			return errors.New(msgInvalidColumn + " " + c.Name + " already registered.")
+		}
+	}
+	c.Positions = append([]uint8(nil), c.Positions...)
+	columnRegistry.columns = append(columnRegistry.columns, c)
+	return nil
+}
+
+// the registered columns of the database type within the columns of the BIN file
+func registeredColumns(databaseType uint8, databaseColumn uint8) []extraColumn {
+	columnRegistry.mu.RLock()
+	defer columnRegistry.mu.RUnlock()
+
+	var extra []extraColumn
+	for _, c := range columnRegistry.columns {
+		if int(databaseType) >= len(c.Positions) {
+			continue
+		}
+		p := c.Positions[databaseType]
+		if p < 2 || p > databaseColumn {
+			continue
+		}
+		extra = append(extra, extraColumn{name: c.Name, offset: uint32(p-2) << 2, typ: c.Type})
+	}
+	return extra
+}
+
+// ExtraColumns returns the names of the registered columns present in the BIN file.
+func (d *DB) ExtraColumns() []string {
+	names := make([]string, len(d.extra))
+	for i, c := range d.extra {
+		names[i] = c.name
+	}
+	return names
+}
+
+// GetAllExtra will return all proxy fields based on the queried IP address, along with the registered columns
+// present in the BIN file. The extra fields are nil if none is present or the lookup did not match a row.
+func (d *DB) GetAllExtra(ipAddress string) (IP2ProxyRecord, ExtraFields, error) {
+	row, x, _, err := d.lookupRow(ipAddress)
+	if err != nil || row == nil {
+		return x, nil, err
+	}
+	if x, err = d.readRecord(row, all); err != nil {
+		return x, nil, err
+	}
+	if len(d.extra) == 0 {
+		return x, nil, nil
+	}
+
+	cols := rowView(row)
+	extra := make(ExtraFields, len(d.extra))
+	for _, c := range d.extra {
+		v, err := cols.at(c.offset)
+		if err != nil {
+			return x, nil, err
+		}
+		if c.typ == ColumnUint32 {
+			extra[c.name] = strconv.FormatUint(uint64(v), 10)
+			continue
+		}
+		if extra[c.name], err = d.readStr(v); err != nil {
+			return x, nil, err
+		}
+	}
+	return x, extra, nil
+}
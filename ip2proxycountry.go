@@ -0,0 +1,72 @@
+package ip2proxy
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// The CountryInfo struct holds the ISO 3166 metadata of a country, joined on the country code of the records.
+type CountryInfo struct {
+	Code      string // ISO 3166-1 alpha-2 code
+	Numeric   string // ISO 3166-1 numeric code, 3 digits
+	Continent string // AF, AN, AS, EU, NA, OC or SA
+	EU        bool   // member of the European Union
+}
+
+//go:embed iso3166.txt
+var iso3166 string
+
+// members of the European Union
+var euMembers = []string{"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU", "IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK"}
+
+// codes in use besides ISO 3166-1, e.g. UK in some data sources and EL in the EU nomenclature
+var countryAliases = map[string]string{"UK": "GB", "EL": "GR"}
+
+var countries struct {
+	once   sync.Once
+	byCode map[string]CountryInfo
+}
+
+// parse the embedded table on first use
+func loadCountries() {
+	countries.byCode = make(map[string]CountryInfo, 256)
+	for _, line := range strings.Split(iso3166, "\n") {
+		f := strings.Fields(line)
+		if len(f) != 3 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		countries.byCode[f[0]] = CountryInfo{Code: f[0], Numeric: f[1], Continent: f[2]}
+	}
+	for _, code := range euMembers {
+		c := countries.byCode[code]
+		c.EU = true
+		countries.byCode[code] = c
+	}
+}
+
+// NormalizeCountryCode returns the ISO 3166-1 alpha-2 code of the country code, upper-cased and with the
+// aliases UK and EL mapped to GB and GR; false if the code is unknown, e.g. "-" or a sentinel message.
+func NormalizeCountryCode(code string) (string, bool) {
+	countries.once.Do(loadCountries)
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if alias, ok := countryAliases[code]; ok {
+		code = alias
+	}
+	_, ok := countries.byCode[code]
+	return code, ok
+}
+
+// LookupCountry returns the ISO 3166 metadata of the country code, normalized by NormalizeCountryCode.
+func LookupCountry(code string) (CountryInfo, bool) {
+	code, ok := NormalizeCountryCode(code)
+	if !ok {
+		return CountryInfo{}, false
+	}
+	return countries.byCode[code], true
+}
+
+// Country returns the ISO 3166 metadata of the country of the record; false if it has no known country code.
+func (r IP2ProxyRecord) Country() (CountryInfo, bool) {
+	return LookupCountry(r.CountryShort)
+}
@@ -0,0 +1,63 @@
+package ip2proxy
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+)
+
+// default columns of the CSV writer
+var csvDefaultFields = []string{"is_proxy", "proxy_type", "country_code", "country_name", "region_name", "city_name",
+	"isp", "domain", "usage_type", "asn", "as_name", "last_seen", "threat", "provider"}
+
+// The CSVWriter struct writes proxy records as CSV rows, quoted as per RFC 4180 by encoding/csv.
+type CSVWriter struct {
+	w      *csv.Writer
+	names  []string
+	fields []string
+}
+
+// NewCSVWriter initializes with the writer to output to and the fields to write, named as in filter
+// expressions, e.g. "country_code" or "usage_type". Without fields all fields are written.
+func NewCSVWriter(out io.Writer, fields ...string) (*CSVWriter, error) {
+	if len(fields) == 0 {
+		fields = csvDefaultFields
+	}
+
+	var c = &CSVWriter{}
+	c.w = csv.NewWriter(out)
+	for _, name := range fields {
+		field, ok := filterField(name)
+		if !ok {
+			return nil, errors.New(msgUnknownField)
+		}
+		c.names = append(c.names, name)
+		c.fields = append(c.fields, field)
+	}
+	return c, nil
+}
+
+// Writer returns the underlying csv.Writer, e.g. to change the delimiter before writing.
+func (c *CSVWriter) Writer() *csv.Writer {
+	return c.w
+}
+
+// Header writes the names of the fields.
+func (c *CSVWriter) Header() error {
+	return c.w.Write(c.names)
+}
+
+// Row writes the fields of the record.
+func (c *CSVWriter) Row(rec IP2ProxyRecord) error {
+	row := make([]string, len(c.fields))
+	for i, field := range c.fields {
+		row[i], _ = recordField(rec, field)
+	}
+	return c.w.Write(row)
+}
+
+// Flush writes any buffered rows to the underlying writer and returns the first error encountered.
+func (c *CSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
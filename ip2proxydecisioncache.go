@@ -0,0 +1,173 @@
+package ip2proxy
+
+import (
+	"lukechampine.com/uint128"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// implemented by resolvers able to report the IP range matched by a lookup
+type rangeResolver interface {
+	getAllRange(ipAddress string) (IP2ProxyRecord, ipRange, error)
+}
+
+// implemented by resolvers swapping their DB, like ReloadableDB; the generation changes on every swap
+type generationResolver interface {
+	Generation() uint64
+}
+
+// generation of the DB of the resolver, 0 if it never swaps it
+func resolverGeneration(resolver Resolver) uint64 {
+	if g, ok := resolver.(generationResolver); ok {
+		return g.Generation()
+	}
+	return 0
+}
+
+// The DecisionCacheStats struct holds the counters of the middleware decision cache.
+type DecisionCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// caches policy decisions per matched IP range; entries are kept sorted for binary search. The entries are of
+// a single generation of the resolver, those of the previous ones being dropped, since the ranges and records
+// change with the DB.
+type decisionCache struct {
+	// accessed atomically, kept first for 64-bit alignment
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	ttl         time.Duration
+	negativeTTL time.Duration // of the records not flagged as proxies
+	maxEntries  int
+
+	mu         sync.RWMutex
+	generation uint64
+	entries    []decisionCacheEntry
+}
+
+type decisionCacheEntry struct {
+	r        ipRange
+	rec      IP2ProxyRecord
+	decision Decision
+	expires  time.Time
+}
+
+func newDecisionCache(ttl time.Duration, maxEntries int) *decisionCache {
+	var c = &decisionCache{}
+	c.ttl = ttl
+	c.negativeTTL = ttl
+	c.maxEntries = maxEntries
+	return c
+}
+
+// position of the first entry not sorting before the IP number, the last range including the maximum IP number
+func (c *decisionCache) search(ipType uint32, ipNum uint128.Uint128) int {
+	return sort.Search(len(c.entries), func(i int) bool {
+		r := c.entries[i].r
+		if r.ipType != ipType {
+			return r.ipType > ipType
+		}
+		return r.last().Cmp(ipNum) >= 0
+	})
+}
+
+func (c *decisionCache) get(generation uint64, ipType uint32, ipNum uint128.Uint128) (IP2ProxyRecord, Decision, bool) {
+	c.mu.RLock()
+	i := c.search(ipType, ipNum)
+	if generation == c.generation && i < len(c.entries) && c.entries[i].r.contains(ipType, ipNum) && time.Now().Before(c.entries[i].expires) {
+		e := c.entries[i]
+		c.mu.RUnlock()
+		atomic.AddUint64(&c.hits, 1)
+		return e.rec, e.decision, true
+	}
+	c.mu.RUnlock()
+	atomic.AddUint64(&c.misses, 1)
+	return IP2ProxyRecord{}, DecisionNone, false
+}
+
+// checks for an unexpired entry without counting a hit or miss
+func (c *decisionCache) has(generation uint64, ipType uint32, ipNum uint128.Uint128) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.search(ipType, ipNum)
+	return generation == c.generation && i < len(c.entries) && c.entries[i].r.contains(ipType, ipNum) && time.Now().Before(c.entries[i].expires)
+}
+
+// cache the decision of a lookup made with the generation of the resolver read before it
+func (c *decisionCache) set(generation uint64, r ipRange, rec IP2ProxyRecord, decision Decision) {
+	now := time.Now()
+	ttl := c.ttl
+	if rec.IsProxy == 0 {
+		ttl = c.negativeTTL
+	}
+	e := decisionCacheEntry{r: r, rec: rec, decision: decision, expires: now.Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case generation < c.generation:
+		// looked up in a DB swapped since
+		return
+	case generation > c.generation:
+		atomic.AddUint64(&c.evictions, uint64(len(c.entries)))
+		c.entries = c.entries[:0]
+		c.generation = generation
+	}
+
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+
+	i := c.search(r.ipType, r.ipFrom)
+	if i < len(c.entries) && c.entries[i].r == r {
+		c.entries[i] = e
+		return
+	}
+	c.entries = append(c.entries, decisionCacheEntry{})
+	copy(c.entries[i+1:], c.entries[i:])
+	c.entries[i] = e
+}
+
+// drop the expired entries, or the entry closest to expiry if none has expired
+func (c *decisionCache) evict(now time.Time) {
+	n := len(c.entries)
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		if now.Before(e.expires) {
+			kept = append(kept, e)
+		}
+	}
+
+	if len(kept) == n {
+		oldest := 0
+		for i, e := range kept {
+			if e.expires.Before(kept[oldest].expires) {
+				oldest = i
+			}
+		}
+		kept = append(kept[:oldest], kept[oldest+1:]...)
+	}
+	atomic.AddUint64(&c.evictions, uint64(n-len(kept)))
+	c.entries = kept
+}
+
+func (c *decisionCache) stats() DecisionCacheStats {
+	c.mu.RLock()
+	n := len(c.entries)
+	c.mu.RUnlock()
+
+	return DecisionCacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Entries:   n,
+	}
+}
@@ -0,0 +1,97 @@
+package ip2proxy
+
+import (
+	"testing"
+	"time"
+)
+
+// ranges of the proxy type ending at the maximum addresses and elsewhere
+func writeDecisionTestBIN(t *testing.T, proxyType string) *DB {
+	t.Helper()
+	return openTestBIN(t, newTestWriter(t, 2,
+		[3]string{"192.0.2.0", "192.0.2.255", proxyType},
+		[3]string{"255.255.255.0", "255.255.255.255", proxyType},
+		[3]string{"2001:db8::", "2001:db8::ffff", proxyType},
+		[3]string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", proxyType},
+	))
+}
+
+func checkDecision(t *testing.T, m *Middleware, ipAddress string, want Decision, hits uint64) {
+	t.Helper()
+	_, d, err := m.Lookup(ipAddress)
+	if err != nil {
+		t.Fatalf("%s: %v", ipAddress, err)
+	}
+	if d != want {
+		t.Errorf("%s: %s instead of %s", ipAddress, d, want)
+	}
+	if got := m.DecisionCacheStats().Hits; got != hits {
+		t.Errorf("%s: %d hits instead of %d", ipAddress, got, hits)
+	}
+}
+
+// the ranges ending at the maximum addresses are answered by the cache up to those addresses
+func TestDecisionCacheMaxIP(t *testing.T) {
+	db := writeDecisionTestBIN(t, "VPN")
+	defer db.Close()
+	m := NewMiddleware(db, BlockProxyTypes("VPN")).EnableDecisionCache(time.Hour, 0)
+
+	var hits uint64
+	for _, ips := range [][]string{
+		{"255.255.255.0", "255.255.255.254", "255.255.255.255"},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00"},
+		{"192.0.2.255", "192.0.2.0"},
+	} {
+		checkDecision(t, m, ips[0], DecisionDeny, hits)
+		for _, ip := range ips[1:] {
+			hits++
+			checkDecision(t, m, ip, DecisionDeny, hits)
+		}
+	}
+	checkDecision(t, m, "255.255.255.255", DecisionDeny, hits+1)
+	if !m.IsCached("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff") {
+		t.Error("maximum IPv6 address not cached")
+	}
+}
+
+// the decisions cached before a swap are not returned after it
+func TestDecisionCacheSwap(t *testing.T) {
+	r := NewReloadableDB(writeDecisionTestBIN(t, "VPN"))
+	defer r.Close()
+	cached := r.Cached(NewMemoryCache(), time.Hour)
+
+	for name, resolver := range map[string]Resolver{"ReloadableDB": r, "CachedDB": cached, "HotRanges": NewHotRanges(r, 10)} {
+		if err := r.Swap(writeDecisionTestBIN(t, "VPN")); err != nil {
+			t.Fatal(err)
+		}
+		m := NewMiddleware(resolver, BlockProxyTypes("VPN")).EnableDecisionCache(time.Hour, 0)
+		checkDecision(t, m, "192.0.2.1", DecisionDeny, 0)
+		checkDecision(t, m, "192.0.2.2", DecisionDeny, 1)
+
+		if err := r.Swap(writeDecisionTestBIN(t, "DCH")); err != nil {
+			t.Fatal(err)
+		}
+		if m.IsCached("192.0.2.2") {
+			t.Errorf("%s: decision of the previous DB cached", name)
+		}
+		checkDecision(t, m, "192.0.2.2", DecisionAllow, 1)
+		checkDecision(t, m, "192.0.2.3", DecisionAllow, 2)
+		if s := m.DecisionCacheStats(); s.Entries != 1 || s.Evictions != 1 {
+			t.Errorf("%s: %d entries and %d evictions instead of 1 and 1", name, s.Entries, s.Evictions)
+		}
+	}
+}
+
+// a decision looked up in a DB swapped since is not cached
+func TestDecisionCacheStaleSet(t *testing.T) {
+	c := newDecisionCache(time.Hour, 0)
+	r := ipRange{ipType: 4, ipFrom: maxIPV4Range.Sub64(256), ipTo: maxIPV4Range}
+	c.set(2, r, IP2ProxyRecord{IsProxy: 1}, DecisionDeny)
+	c.set(1, r, IP2ProxyRecord{}, DecisionAllow)
+	if _, d, ok := c.get(2, 4, maxIPV4Range); !ok || d != DecisionDeny {
+		t.Errorf("%s %v instead of the decision of generation 2", d, ok)
+	}
+	if _, _, ok := c.get(1, 4, maxIPV4Range); ok {
+		t.Error("decision of generation 2 returned for generation 1")
+	}
+}
@@ -0,0 +1,143 @@
+package ip2proxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const msgNoDBInDir string = "No valid IP2Proxy BIN file in the directory."
+
+// pattern of the BIN files when none is given
+const defaultDirPattern = "*.[Bb][Ii][Nn]"
+
+// The dirScanner struct finds the newest BIN file of a directory, remembering the publish dates of the files
+// already opened as long as they are not modified.
+type dirScanner struct {
+	dir     string
+	pattern string
+	files   map[string]dirFile
+}
+
+type dirFile struct {
+	modTime time.Time
+	size    int64
+	date    time.Time
+	valid   bool
+	pending bool // not opened yet
+}
+
+func newDirScanner(dir string, pattern string) *dirScanner {
+	if pattern == "" {
+		pattern = defaultDirPattern
+	}
+	var s = &dirScanner{}
+	s.dir = dir
+	s.pattern = pattern
+	s.files = map[string]dirFile{}
+	return s
+}
+
+// newest valid BIN file, by publish date then modification time; with stable, the files modified since the
+// previous scan are skipped as they may still be written
+func (s *dirScanner) newest(stable bool) (string, time.Time, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, s.pattern))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var best string
+	var bestFile dirFile
+	seen := make(map[string]dirFile, len(paths))
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		f, ok := s.files[p]
+		if !ok || !f.modTime.Equal(fi.ModTime()) || f.size != fi.Size() {
+			f = dirFile{modTime: fi.ModTime(), size: fi.Size(), pending: true}
+			if stable {
+				seen[p] = f // not opened until unchanged for a scan
+				continue
+			}
+		}
+		if f.pending {
+			f.pending = false
+			if db, err := OpenDB(p); err == nil {
+				f.date = db.PublishDate()
+				f.valid = true
+				db.Close()
+			}
+		}
+		seen[p] = f
+		if f.valid && (best == "" || f.date.After(bestFile.date) || (f.date.Equal(bestFile.date) && f.modTime.After(bestFile.modTime))) {
+			best, bestFile = p, f
+		}
+	}
+	s.files = seen
+
+	if best == "" {
+		return "", time.Time{}, errors.New(msgNoDBInDir)
+	}
+	return best, bestFile.date, nil
+}
+
+// FindNewestDB returns the path to the newest valid IP2Proxy BIN file of the directory, by the publish date
+// embedded in the files, among the files matching the pattern, e.g. "IP2PROXY-*.BIN". An empty pattern matches
+// the files with the .BIN extension in any case. The files which fail to open are skipped.
+func FindNewestDB(dir string, pattern string) (string, error) {
+	path, _, err := newDirScanner(dir, pattern).newest(false)
+	return path, err
+}
+
+// OpenDBDir opens the newest valid IP2Proxy BIN file of the directory, see FindNewestDB.
+func OpenDBDir(dir string, pattern string) (*DB, error) {
+	path, err := FindNewestDB(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return OpenDB(path)
+}
+
+// OpenReloadableDBDir opens the newest valid IP2Proxy BIN file of the directory as the first generation,
+// to be kept up to date by WatchDir.
+func OpenReloadableDBDir(dir string, pattern string) (*ReloadableDB, error) {
+	db, err := OpenDBDir(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return NewReloadableDB(db), nil
+}
+
+// WatchDir checks the directory at every interval and swaps in the newest BIN file matching the pattern
+// once its publish date is after the one of the current DB, e.g. when the monthly file is dropped there.
+// A new file is only opened once unchanged for an interval, so that it is not read while being copied.
+// It blocks until the context is done, returning its error, and is usually run in its own goroutine.
+func (r *ReloadableDB) WatchDir(ctx context.Context, dir string, pattern string, interval time.Duration) error {
+	s := newDirScanner(dir, pattern)
+	s.newest(false) // the files present are complete
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		path, date, err := s.newest(true)
+		if err != nil {
+			continue
+		}
+		db, _, release := r.acquire()
+		current := db.PublishDate()
+		release()
+		if date.After(current) {
+			r.Reload(path) // retried at the next interval if it fails
+		}
+	}
+}
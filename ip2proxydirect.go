@@ -0,0 +1,75 @@
+package ip2proxy
+
+import (
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// alignment of the offsets, sizes and buffers of the O_DIRECT reads, the logical block size of most disks
+const directAlign = 4096
+
+// reader of a file opened with O_DIRECT, reading whole aligned blocks into aligned buffers
+type directReader struct {
+	*os.File
+	opts OpenOptions
+}
+
+func newDirectReader(f *os.File, opts OpenOptions) *directReader {
+	return &directReader{File: f, opts: opts}
+}
+
+// buffers of two blocks, enough for the rows and the strings crossing a block boundary
+var directBufPool = sync.Pool{
+	New: func() interface{} {
+		b := alignedBuffer(2 * directAlign)
+		return &b
+	},
+}
+
+// a buffer of the size, aligned on directAlign
+func alignedBuffer(size int) []byte {
+	b := make([]byte, size+directAlign)
+	off := 0
+	if r := int(uintptr(unsafe.Pointer(&b[0])) & (directAlign - 1)); r != 0 {
+		off = directAlign - r
+	}
+	return b[off : off+size : off+size]
+}
+
+func (r *directReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	start := off &^ (directAlign - 1)
+	end := (off + int64(len(p)) + directAlign - 1) &^ (directAlign - 1)
+	size := int(end - start)
+
+	var buf []byte
+	if size <= 2*directAlign {
+		pooled := directBufPool.Get().(*[]byte)
+		defer directBufPool.Put(pooled)
+		buf = (*pooled)[:size]
+	} else {
+		buf = alignedBuffer(size)
+	}
+
+	n, err := r.File.ReadAt(buf, start)
+	n -= int(off - start)
+	if n < 0 {
+		n = 0
+	}
+	n = copy(p, buf[int(off-start):int(off-start)+n])
+	if n < len(p) {
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return n, nil
+}
+
+func (r *directReader) clone() (dbReader, error) {
+	return reopenWithOptions(r.File, r.opts)
+}
@@ -0,0 +1,52 @@
+package ip2proxy
+
+import (
+	"net/http/cookiejar"
+	"strings"
+)
+
+// NormalizeDomain returns the domain name in lower case without trailing dot, or "" for values which are not
+// domain names, such as "-" and the messages of the lookups.
+func NormalizeDomain(domain string) string {
+	d := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if !strings.Contains(d, ".") {
+		return ""
+	}
+	for i := 0; i < len(d); i++ {
+		c := d[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return ""
+		}
+	}
+	if strings.HasPrefix(d, ".") || strings.Contains(d, "..") {
+		return ""
+	}
+	return d
+}
+
+// RegistrableDomain returns the registrable domain of the domain name, its public suffix with one more label
+// (eTLD+1), e.g. "example.co.uk" for "vpn.example.co.uk", for rules grouping by the registrable domain rather
+// than by the host names. The public suffixes come from the list, usually publicsuffix.List of
+// golang.org/x/net/publicsuffix; without list, the public suffix is the last label, wrong for suffixes like
+// co.uk. It returns "" for values which are not domain names or are public suffixes.
+func RegistrableDomain(domain string, list cookiejar.PublicSuffixList) string {
+	d := NormalizeDomain(domain)
+	if d == "" {
+		return ""
+	}
+
+	suffix := d[strings.LastIndexByte(d, '.')+1:]
+	if list != nil {
+		suffix = list.PublicSuffix(d)
+	}
+	rest := len(d) - len(suffix) - 1 // length before the dot preceding the suffix
+	if rest <= 0 || d[rest] != '.' {
+		return ""
+	}
+	return d[strings.LastIndexByte(d[:rest], '.')+1:]
+}
+
+// RegistrableDomain returns the registrable domain of the Domain field, see the RegistrableDomain function.
+func (r IP2ProxyRecord) RegistrableDomain(list cookiejar.PublicSuffixList) string {
+	return RegistrableDomain(r.Domain, list)
+}
@@ -0,0 +1,69 @@
+package ip2proxy
+
+import (
+	"errors"
+	"io"
+)
+
+const msgClosed string = "IP2Proxy BIN file already closed."
+const msgCorruptDatabase string = "Corrupt IP2Proxy BIN file."
+
+var (
+	// ErrInvalidBIN is returned when opening files which are not IP2Proxy BIN files, e.g. IP2Location BIN files or
+	// zipped files. The errors reading the header wrap it together with the I/O error.
+	ErrInvalidBIN = errors.New(msgInvalidBin)
+	// ErrInvalidIP is returned by the lookups of invalid IP addresses, with SetInvalidIPAsError.
+	ErrInvalidIP = errors.New(msgInvalidIP)
+	// ErrIPv6Unsupported is ErrIPv6NotSupported, named after the other errors.
+	ErrIPv6Unsupported = ErrIPv6NotSupported
+	// ErrClosed is returned by the queries of a DB after Close.
+	ErrClosed = errors.New(msgClosed)
+	// ErrCorruptDatabase is returned for BIN files truncated or with offsets or indexes out of the file. The errors
+	// wrap it together with the I/O error, if any, so that errors.Is and errors.As work for both.
+	ErrCorruptDatabase = errors.New(msgCorruptDatabase)
+)
+
+// an error of one of the kinds above, wrapping its cause
+type wrappedError struct {
+	kind error
+	err  error
+}
+
+func (e *wrappedError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+func (e *wrappedError) Is(target error) bool {
+	return target == e.kind
+}
+
+// wrap the error as an error of the kind, nil and the errors of the kind staying as they are
+func wrapError(kind error, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &wrappedError{kind: kind, err: err}
+}
+
+// the read errors after Close are ErrClosed whatever the reader returned, those past the end of the file are
+// corrupt databases and the others are returned as they are
+func (d *DB) readError(err error) error {
+	if d.isClosed() {
+		return ErrClosed
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return wrapError(ErrCorruptDatabase, err)
+	}
+	return err
+}
+
+// SetInvalidIPAsError makes the lookups of invalid IP addresses return ErrInvalidIP, the fields holding the
+// "INVALID IP ADDRESS" message as by default. It must be called before any lookup.
+func (d *DB) SetInvalidIPAsError(enabled bool) *DB {
+	d.invalidIPErr = enabled
+	return d
+}
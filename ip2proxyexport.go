@@ -0,0 +1,52 @@
+package ip2proxy
+
+// a field supported by the BIN file, named like the columns of the exports
+type exportField struct {
+	name    string
+	numeric bool // integer values, unknown values are not numbers
+	value   func(rec *IP2ProxyRecord) string
+}
+
+// fields supported by the BIN file, in BIN column order
+func (d *DB) exportFields() []exportField {
+	var fields []exportField
+	if d.countryEnabled {
+		fields = append(fields,
+			exportField{name: "country_code", value: func(rec *IP2ProxyRecord) string { return rec.CountryShort }},
+			exportField{name: "country_name", value: func(rec *IP2ProxyRecord) string { return rec.CountryLong }})
+	}
+	if d.regionEnabled {
+		fields = append(fields, exportField{name: "region_name", value: func(rec *IP2ProxyRecord) string { return rec.Region }})
+	}
+	if d.cityEnabled {
+		fields = append(fields, exportField{name: "city_name", value: func(rec *IP2ProxyRecord) string { return rec.City }})
+	}
+	if d.ispEnabled {
+		fields = append(fields, exportField{name: "isp", value: func(rec *IP2ProxyRecord) string { return rec.Isp }})
+	}
+	if d.proxyTypeEnabled {
+		fields = append(fields, exportField{name: "proxy_type", value: func(rec *IP2ProxyRecord) string { return rec.ProxyType }})
+	}
+	if d.domainEnabled {
+		fields = append(fields, exportField{name: "domain", value: func(rec *IP2ProxyRecord) string { return rec.Domain }})
+	}
+	if d.usageTypeEnabled {
+		fields = append(fields, exportField{name: "usage_type", value: func(rec *IP2ProxyRecord) string { return rec.UsageType }})
+	}
+	if d.asnEnabled {
+		fields = append(fields, exportField{name: "asn", numeric: true, value: func(rec *IP2ProxyRecord) string { return rec.Asn }})
+	}
+	if d.asEnabled {
+		fields = append(fields, exportField{name: "as_name", value: func(rec *IP2ProxyRecord) string { return rec.As }})
+	}
+	if d.lastSeenEnabled {
+		fields = append(fields, exportField{name: "last_seen", numeric: true, value: func(rec *IP2ProxyRecord) string { return rec.LastSeen }})
+	}
+	if d.threatEnabled {
+		fields = append(fields, exportField{name: "threat", value: func(rec *IP2ProxyRecord) string { return rec.Threat }})
+	}
+	if d.providerEnabled {
+		fields = append(fields, exportField{name: "provider", value: func(rec *IP2ProxyRecord) string { return rec.Provider }})
+	}
+	return fields
+}
@@ -0,0 +1,30 @@
+//go:build linux && (amd64 || arm64 || riscv64 || ppc64 || ppc64le || s390x || mips64 || mips64le)
+
+package ip2proxy
+
+import (
+	"os"
+	"syscall"
+)
+
+// posix_fadvise advices, the same on all the architectures above
+const fadvRandom = 1
+const fadvWillNeed = 3
+
+// give the advice for the whole file
+func fadvise(f *os.File, advice FileAdvice) error {
+	var adv uintptr
+	switch advice {
+	case AdviseRandom:
+		adv = fadvRandom
+	case AdviseWillNeed:
+		adv = fadvWillNeed
+	default:
+		return nil
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, adv, 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("fadvise64", errno)
+	}
+	return nil
+}
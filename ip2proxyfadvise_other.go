@@ -0,0 +1,10 @@
+//go:build !linux || !(amd64 || arm64 || riscv64 || ppc64 || ppc64le || s390x || mips64 || mips64le)
+
+package ip2proxy
+
+import "os"
+
+// the advices are only given on Linux, on the architectures passing 64-bit offsets in a single register
+func fadvise(f *os.File, advice FileAdvice) error {
+	return nil
+}
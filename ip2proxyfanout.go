@@ -0,0 +1,47 @@
+package ip2proxy
+
+import (
+	"context"
+	"sync"
+)
+
+// The LookupResult struct holds the outcome of one of the lookups of LookupAll.
+type LookupResult struct {
+	IPAddress string
+	Record    IP2ProxyRecord
+	Err       error
+}
+
+// LookupAll looks up the IP addresses with at most concurrency lookups in progress, or one per
+// address if concurrency is zero or less, and returns the results in the order of the addresses.
+// Once the context is done, the remaining lookups are skipped and fail with the context error.
+func LookupAll(ctx context.Context, resolver Resolver, ipAddresses []string, concurrency int) []LookupResult {
+	results := make([]LookupResult, len(ipAddresses))
+	if concurrency <= 0 || concurrency > len(ipAddresses) {
+		concurrency = len(ipAddresses)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].IPAddress = ipAddresses[i]
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Record, results[i].Err = resolver.GetAll(ipAddresses[i])
+			}
+		}()
+	}
+
+	for i := range ipAddresses {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
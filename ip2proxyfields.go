@@ -0,0 +1,116 @@
+package ip2proxy
+
+import "strings"
+
+// The FieldMask type is a set of record fields.
+type FieldMask uint32
+
+// The record fields, which may be combined.
+const (
+	FieldCountryShort FieldMask = FieldMask(countryShort)
+	FieldCountryLong  FieldMask = FieldMask(countryLong)
+	FieldRegion       FieldMask = FieldMask(region)
+	FieldCity         FieldMask = FieldMask(city)
+	FieldIsp          FieldMask = FieldMask(isp)
+	FieldProxyType    FieldMask = FieldMask(proxyType)
+	FieldIsProxy      FieldMask = FieldMask(isProxy)
+	FieldDomain       FieldMask = FieldMask(domain)
+	FieldUsageType    FieldMask = FieldMask(usageType)
+	FieldAsn          FieldMask = FieldMask(asn)
+	FieldAs           FieldMask = FieldMask(as)
+	FieldLastSeen     FieldMask = FieldMask(lastSeen)
+	FieldThreat       FieldMask = FieldMask(threat)
+	FieldProvider     FieldMask = FieldMask(provider)
+)
+
+// Has checks whether the mask holds all the given fields.
+func (m FieldMask) Has(fields FieldMask) bool {
+	return m&fields == fields
+}
+
+// names of the fields, in the order of the record
+var fieldMaskNames = []struct {
+	field FieldMask
+	name  string
+}{
+	{FieldIsProxy, "IsProxy"},
+	{FieldCountryShort, "CountryShort"},
+	{FieldCountryLong, "CountryLong"},
+	{FieldRegion, "Region"},
+	{FieldCity, "City"},
+	{FieldIsp, "Isp"},
+	{FieldProxyType, "ProxyType"},
+	{FieldDomain, "Domain"},
+	{FieldUsageType, "UsageType"},
+	{FieldAsn, "Asn"},
+	{FieldAs, "As"},
+	{FieldLastSeen, "LastSeen"},
+	{FieldThreat, "Threat"},
+	{FieldProvider, "Provider"},
+}
+
+// String returns the names of the fields separated by |, e.g. "CountryShort|ProxyType".
+func (m FieldMask) String() string {
+	var names []string
+	for _, f := range fieldMaskNames {
+		if m.Has(f.field) {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// The UnsupportedFields type sets what the lookups return in the fields not supported by the BIN file.
+type UnsupportedFields int
+
+const (
+	// UnsupportedAsSentinel sets the fields to "NOT SUPPORTED", the default.
+	UnsupportedAsSentinel UnsupportedFields = iota
+	// UnsupportedAsEmpty leaves the fields empty, e.g. for JSON schemas not allowing the sentinel;
+	// Fields or GetAllFields tell which fields are supported.
+	UnsupportedAsEmpty
+)
+
+// SetUnsupportedFields sets what the lookups return in the fields not supported by the BIN file.
+// It must be called before any lookup.
+func (d *DB) SetUnsupportedFields(mode UnsupportedFields) *DB {
+	d.unsupported = mode
+	return d
+}
+
+// Fields returns the fields supported by the BIN file.
+func (d *DB) Fields() FieldMask {
+	m := FieldIsProxy
+	for _, f := range []struct {
+		enabled bool
+		fields  FieldMask
+	}{
+		{d.countryEnabled, FieldCountryShort | FieldCountryLong},
+		{d.regionEnabled, FieldRegion},
+		{d.cityEnabled, FieldCity},
+		{d.ispEnabled, FieldIsp},
+		{d.proxyTypeEnabled, FieldProxyType},
+		{d.domainEnabled, FieldDomain},
+		{d.usageTypeEnabled, FieldUsageType},
+		{d.asnEnabled, FieldAsn},
+		{d.asEnabled, FieldAs},
+		{d.lastSeenEnabled, FieldLastSeen},
+		{d.threatEnabled, FieldThreat},
+		{d.providerEnabled, FieldProvider},
+	} {
+		if f.enabled {
+			m |= f.fields
+		}
+	}
+	return m
+}
+
+// GetAllFields will return all proxy fields based on the queried IP address, along with the fields holding data.
+// The mask is empty if the lookup failed, in which case the fields hold the error message.
+func (d *DB) GetAllFields(ipAddress string) (IP2ProxyRecord, FieldMask, error) {
+	rec, r, err := d.queryRange(ipAddress, all)
+	if err != nil || r.ipType == 0 {
+		return rec, 0, err
+	}
+	return rec, d.Fields(), nil
+}
@@ -0,0 +1,357 @@
+package ip2proxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The Filter struct is a compiled filter expression selecting proxy records, shared by the scans,
+// the exports and the command line tools. Expressions compare record fields with values and combine
+// the comparisons with &&, || and !, e.g.
+//
+//	proxy_type in (VPN, TOR) && country == "RU" && last_seen < 30
+//
+// The fields are named like the export columns (proxy_type, country_code, usage_type, threat, ...);
+// country, region, city and as are accepted too. The operators are ==, !=, <, <=, >, >=, in (...),
+// not in (...) and contains. Strings compare ignoring case; <, <=, > and >= compare numbers and never
+// hold for fields which are not numbers. Values without spaces or operators need no quotes.
+type Filter struct {
+	expr filterNode
+}
+
+type filterNode interface {
+	eval(rec *IP2ProxyRecord) bool
+}
+
+const msgInvalidFilter string = "Invalid filter expression"
+
+// ParseFilter compiles the filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	p := &filterParser{tokens: tokenizeFilter(expr)}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected " + p.tokens[p.pos].text)
+	}
+
+	var f = &Filter{}
+	f.expr = node
+	return f, nil
+}
+
+// FilterFunc wraps a function selecting proxy records as a filter.
+func FilterFunc(fn func(rec IP2ProxyRecord) bool) *Filter {
+	var f = &Filter{}
+	f.expr = funcNode(fn)
+	return f
+}
+
+// Match checks whether the record is selected by the filter.
+func (f *Filter) Match(rec IP2ProxyRecord) bool {
+	return f.expr.eval(&rec)
+}
+
+// Ranges returns the filter as a function selecting IP ranges, for DB.Scan based APIs such as
+// FindRanges, Blocklist and the exports.
+func (f *Filter) Ranges() func(r IPRange) bool {
+	return func(r IPRange) bool {
+		return f.expr.eval(&r.Record)
+	}
+}
+
+// FindRanges returns the IP ranges selected by the filter, or all of them if filter is nil.
+func (d *DB) FindRanges(filter func(r IPRange) bool) ([]IPRange, error) {
+	var ranges []IPRange
+	err := d.Scan(func(r IPRange) error {
+		if filter == nil || filter(r) {
+			ranges = append(ranges, r)
+		}
+		return nil
+	})
+	return ranges, err
+}
+
+type funcNode func(rec IP2ProxyRecord) bool
+
+func (n funcNode) eval(rec *IP2ProxyRecord) bool {
+	return n(*rec)
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) eval(rec *IP2ProxyRecord) bool {
+	return n.left.eval(rec) && n.right.eval(rec)
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) eval(rec *IP2ProxyRecord) bool {
+	return n.left.eval(rec) || n.right.eval(rec)
+}
+
+type notNode struct{ node filterNode }
+
+func (n notNode) eval(rec *IP2ProxyRecord) bool {
+	return !n.node.eval(rec)
+}
+
+type compareNode struct {
+	field  string
+	op     string
+	values []string
+	number float64
+}
+
+func (n compareNode) eval(rec *IP2ProxyRecord) bool {
+	v, _ := recordField(*rec, n.field)
+
+	switch n.op {
+	case "==":
+		return strings.EqualFold(v, n.values[0])
+	case "!=":
+		return !strings.EqualFold(v, n.values[0])
+	case "in", "not in":
+		found := false
+		for _, value := range n.values {
+			if strings.EqualFold(v, value) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	case "contains":
+		return strings.Contains(strings.ToUpper(v), strings.ToUpper(n.values[0]))
+	}
+
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return x < n.number
+	case "<=":
+		return x <= n.number
+	case ">":
+		return x > n.number
+	default:
+		return x >= n.number
+	}
+}
+
+// filter field names which do not map to the record fields by dropping the underscores
+var filterFieldAliases = map[string]string{
+	"country": "countrycode",
+	"region":  "regionname",
+	"city":    "cityname",
+	"asname":  "as",
+}
+
+// record field of a filter field name
+func filterField(name string) (string, bool) {
+	field := strings.ToLower(strings.Replace(name, "_", "", -1))
+	if alias, ok := filterFieldAliases[field]; ok {
+		field = alias
+	}
+	_, ok := recordField(IP2ProxyRecord{}, field)
+	return field, ok
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeFilter(expr string) []filterToken {
+	var tokens []filterToken
+	r := []rune(expr)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(r) && r[j] != c {
+				if r[j] == '\\' && j+1 < len(r) {
+					j++
+				}
+				sb.WriteRune(r[j])
+				j++
+			}
+			tokens = append(tokens, filterToken{text: sb.String(), quoted: true})
+			i = j + 1
+		case strings.ContainsRune("()!,<>=&|", c):
+			j := i + 1
+			if j < len(r) {
+				two := string(r[i : j+1])
+				if two == "==" || two == "!=" || two == "<=" || two == ">=" || two == "&&" || two == "||" {
+					j++
+				}
+			}
+			tokens = append(tokens, filterToken{text: string(r[i:j])})
+			i = j
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && !strings.ContainsRune("()!,<>=&|\"'", r[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: string(r[i:j])})
+			i = j
+		}
+	}
+	return tokens
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) errorf(detail string) error {
+	return errors.New(msgInvalidFilter + ": " + detail + ".")
+}
+
+// the next unquoted token if it is one of the given texts
+func (p *filterParser) accept(texts ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return "", false
+	}
+	for _, t := range texts {
+		if strings.EqualFold(p.tokens[p.pos].text, t) {
+			p.pos++
+			return t, true
+		}
+	}
+	return "", false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+
+	if _, ok := p.accept("("); ok {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok = p.accept(")"); !ok {
+			return nil, p.errorf("missing )")
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.errorf("missing field")
+	}
+	name := p.tokens[p.pos].text
+	p.pos++
+
+	field, ok := filterField(name)
+	if !ok {
+		return nil, p.errorf("unknown field " + name)
+	}
+
+	n := compareNode{field: field}
+	if _, ok := p.accept("not"); ok {
+		if _, ok = p.accept("in"); !ok {
+			return nil, p.errorf("missing in after not")
+		}
+		n.op = "not in"
+	} else if op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in", "contains"); ok {
+		n.op = op
+	} else {
+		return nil, p.errorf("missing operator after " + name)
+	}
+
+	if n.op == "in" || n.op == "not in" {
+		if _, ok := p.accept("("); !ok {
+			return nil, p.errorf("missing ( after in")
+		}
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+			if _, ok := p.accept(")"); ok {
+				return n, nil
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, p.errorf("missing , or )")
+			}
+		}
+	}
+
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	n.values = []string{v}
+
+	if n.op == "<" || n.op == "<=" || n.op == ">" || n.op == ">=" {
+		if n.number, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, p.errorf(v + " is not a number")
+		}
+	}
+	return n, nil
+}
+
+func (p *filterParser) parseValue() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", p.errorf("missing value")
+	}
+	t := p.tokens[p.pos]
+	if !t.quoted && strings.ContainsAny(t.text, "()!,<>=&|") {
+		return "", p.errorf("unexpected " + t.text)
+	}
+	p.pos++
+	return t.text, nil
+}
@@ -0,0 +1,70 @@
+package ip2proxy
+
+import (
+	"errors"
+
+	"lukechampine.com/uint128"
+)
+
+const msgInvalidIPType string = "IP type must be 4 or 6."
+const msgInvalidRow string = "Invalid row offset."
+
+// ParseIPNumber returns the IP version, 4 or 6, and the IP number of the IP address as searched by FindRow.
+// The IPv4-mapped, 6to4 and Teredo IPv6 addresses give their IPv4 address. The IP version is 0 for invalid addresses.
+func ParseIPNumber(ipAddress string) (ipType uint32, ipNum uint128.Uint128) {
+	return ipToNum(ipAddress)
+}
+
+// the row data and the number of rows of the IP version
+func (d *DB) rowsOf(ipType uint32) (baseAddr uint32, count uint32, colSize uint32, firstCol uint32, err error) {
+	switch ipType {
+	case 4:
+		return d.meta.ipV4DatabaseAddr, d.meta.ipV4DatabaseCount, d.meta.ipV4ColumnSize, 4, nil
+	case 6:
+		if d.meta.ipV6DatabaseCount == 0 {
+			return 0, 0, 0, 0, errors.New(msgIPV6Unsupported)
+		}
+		return d.meta.ipV6DatabaseAddr, d.meta.ipV6DatabaseCount, d.meta.ipV6ColumnSize, 16, nil
+	}
+	return 0, 0, 0, 0, errors.New(msgInvalidIPType)
+}
+
+// FindRow runs the binary search of the lookups for the IP number of the IP version, see ParseIPNumber, and
+// returns the offset of the matched row in the BIN file with its range, ipTo included as with LookupRange.
+// The row is decoded by RecordAt, so that custom caches, e.g. keyed by range or by row, and prefetching can be
+// built on top of the search. The offset is 0 if no row matches, which only happens with corrupted files.
+func (d *DB) FindRow(ipType uint32, ipNum uint128.Uint128) (rowOffset uint32, ipFrom uint128.Uint128, ipTo uint128.Uint128, err error) {
+	baseAddr, _, colSize, _, err := d.rowsOf(ipType)
+	if err != nil {
+		return 0, ipFrom, ipTo, err
+	}
+
+	row, ipFrom, ipTo, rowNum, err := d.searchRowNumber(ipType, ipNum, d.indexOf(ipType, ipNum), nil)
+	if err != nil || row == nil {
+		return 0, ipFrom, ipTo, err
+	}
+	r := ipRange{ipType: ipType, ipFrom: ipFrom, ipTo: ipTo}
+	return baseAddr + rowNum*colSize, ipFrom, r.last(), nil
+}
+
+// RecordAt decodes the fields of the row of the IP version at the offset returned by FindRow, all the fields
+// of the BIN file if fields is 0.
+func (d *DB) RecordAt(ipType uint32, rowOffset uint32, fields FieldMask) (IP2ProxyRecord, error) {
+	baseAddr, count, colSize, firstCol, err := d.rowsOf(ipType)
+	if err != nil {
+		return IP2ProxyRecord{}, err
+	}
+	if rowOffset < baseAddr || (rowOffset-baseAddr)%colSize != 0 || (rowOffset-baseAddr)/colSize >= count {
+		return IP2ProxyRecord{}, errors.New(msgInvalidRow)
+	}
+
+	row, err := d.readRow(rowOffset+firstCol, colSize-firstCol)
+	if err != nil {
+		return IP2ProxyRecord{}, err
+	}
+	mode := uint32(fields)
+	if mode == 0 {
+		mode = all
+	}
+	return d.readRecord(row, mode)
+}
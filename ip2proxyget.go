@@ -0,0 +1,58 @@
+package ip2proxy
+
+import "strconv"
+
+// The FieldValue interface is the constraint of the types of the field values returned by Get.
+type FieldValue interface {
+	~string | ~int | ~int8 | ~uint8
+}
+
+// The TypedField struct identifies a record field along with the type of its values, for Get.
+type TypedField[T FieldValue] struct {
+	mode  uint32
+	value func(x *IP2ProxyRecord) T
+}
+
+// Mask returns the field as a FieldMask.
+func (f TypedField[T]) Mask() FieldMask {
+	return FieldMask(f.mode)
+}
+
+func stringField(mode uint32, value func(x *IP2ProxyRecord) string) TypedField[string] {
+	return TypedField[string]{mode: mode, value: value}
+}
+
+// the number, zero for "-" and the messages
+func intValue(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// The fields for Get. The string fields hold the strings of the record as returned by GetAll; the numbers of
+// AsnField and LastSeenField are zero when not applicable or not supported.
+var (
+	IsProxyField      = TypedField[int8]{mode: isProxy, value: func(x *IP2ProxyRecord) int8 { return x.IsProxy }}
+	CountryShortField = stringField(countryShort, func(x *IP2ProxyRecord) string { return x.CountryShort })
+	CountryLongField  = stringField(countryLong, func(x *IP2ProxyRecord) string { return x.CountryLong })
+	RegionField       = stringField(region, func(x *IP2ProxyRecord) string { return x.Region })
+	CityField         = stringField(city, func(x *IP2ProxyRecord) string { return x.City })
+	IspField          = stringField(isp, func(x *IP2ProxyRecord) string { return x.Isp })
+	ProxyTypeField    = stringField(proxyType, func(x *IP2ProxyRecord) string { return x.ProxyType })
+	DomainField       = stringField(domain, func(x *IP2ProxyRecord) string { return x.Domain })
+	UsageTypeField    = TypedField[UsageType]{mode: usageType, value: func(x *IP2ProxyRecord) UsageType { return UsageType(x.UsageType) }}
+	AsnField          = TypedField[int]{mode: asn, value: func(x *IP2ProxyRecord) int { return intValue(x.Asn) }}
+	AsField           = stringField(as, func(x *IP2ProxyRecord) string { return x.As })
+	LastSeenField     = TypedField[int]{mode: lastSeen, value: func(x *IP2ProxyRecord) int { return intValue(x.LastSeen) }}
+	ThreatField       = TypedField[ThreatSet]{mode: threat, value: func(x *IP2ProxyRecord) ThreatSet { return x.Threats() }}
+	ProviderField     = stringField(provider, func(x *IP2ProxyRecord) string { return x.Provider })
+)
+
+// Get will return the value of a single field based on the queried IP address, typed by the field, e.g.
+// Get(db, ip, ThreatField) returns a ThreatSet. Only the string of the field is read, as with the GetX methods.
+func Get[T FieldValue](db *DB, ipAddress string, field TypedField[T]) (T, error) {
+	x, err := db.query(ipAddress, field.mode)
+	return field.value(&x), err
+}
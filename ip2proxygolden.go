@@ -0,0 +1,134 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"lukechampine.com/uint128"
+)
+
+// the fields of the golden answers, in the order written
+var goldenFields = []string{
+	"is_proxy", "proxy_type", "country_code", "country_name", "region_name", "city_name", "isp",
+	"domain", "usage_type", "asn", "as", "last_seen", "threat", "provider",
+}
+
+// GoldenAnswers looks up a spread of addresses of the BIN file and returns the results as known answers for
+// every field, to be saved with WriteKnownAnswers and checked with VerifyKnownAnswers against later builds of
+// the package. Of about maxRanges ranges of each IP version, evenly spaced, it looks up the first and last
+// addresses and the address following the range, so that off-by-one errors at the range boundaries show up.
+func (d *DB) GoldenAnswers(maxRanges int) ([]KnownAnswer, error) {
+	if maxRanges < 1 {
+		maxRanges = 1
+	}
+	tier := "PX" + d.PackageVersion()
+
+	var answers []KnownAnswer
+	add := func(ipType uint32, ipNum uint128.Uint128) error {
+		ip := numToIP(ipType, ipNum)
+		text := ip.String()
+		if ipType == 6 {
+			addr, _ := netip.AddrFromSlice(ip)
+			text = addr.String() // keeps IPv4-mapped addresses in IPv6 form
+		}
+		if n := len(answers); n > 0 && answers[n-1].IP == text {
+			return nil // the address following the previous range
+		}
+		rec, err := d.GetAll(text)
+		if err != nil {
+			return err
+		}
+
+		a := KnownAnswer{Tier: tier, IP: text, Expect: make(map[string]string, len(goldenFields))}
+		for _, name := range goldenFields {
+			field, _ := filterField(name)
+			a.Expect[name], _ = recordField(rec, field)
+		}
+		answers = append(answers, a)
+		return nil
+	}
+
+	for _, ipType := range []uint32{4, 6} {
+		count, maxIP := d.meta.ipV4DatabaseCount, maxIPV4Range
+		if ipType == 6 {
+			count, maxIP = d.meta.ipV6DatabaseCount, maxIPV6Range
+		}
+		step := count / uint32(maxRanges)
+		if step == 0 {
+			step = 1
+		}
+
+		err := d.scanRows(ipType, 0, func(index uint32, r IPRange) error {
+			if index%step != 0 && index != count-1 {
+				return nil
+			}
+			if err := add(ipType, r.ipFrom); err != nil {
+				return err
+			}
+			if !r.ipTo.Equals(r.ipFrom) {
+				if err := add(ipType, r.ipTo); err != nil {
+					return err
+				}
+			}
+			if r.ipTo.Cmp(maxIP) < 0 {
+				return add(ipType, r.ipTo.Add64(1))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return answers, nil
+}
+
+// WriteKnownAnswers writes the known answers in the format read by ParseKnownAnswers.
+func WriteKnownAnswers(out io.Writer, answers []KnownAnswer) error {
+	w := bufio.NewWriter(out)
+	for _, a := range answers {
+		w.WriteString(a.Tier)
+		w.WriteByte(' ')
+		w.WriteString(a.IP)
+
+		known := make(map[string]bool, len(goldenFields))
+		for _, name := range goldenFields {
+			if value, ok := a.Expect[name]; ok {
+				writeAnswerField(w, name, value)
+			}
+			known[name] = true
+		}
+		var others []string
+		for name := range a.Expect {
+			if !known[name] {
+				others = append(others, name)
+			}
+		}
+		sort.Strings(others)
+		for _, name := range others {
+			writeAnswerField(w, name, a.Expect[name])
+		}
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+func writeAnswerField(w *bufio.Writer, name string, value string) {
+	w.WriteByte(' ')
+	w.WriteString(name)
+	w.WriteByte('=')
+	if value != "" && !strings.ContainsAny(value, " \t()!,<>=&|\"'\\") {
+		w.WriteString(value)
+		return
+	}
+	w.WriteByte('"')
+	for _, c := range value {
+		if c == '"' || c == '\\' {
+			w.WriteByte('\\')
+		}
+		w.WriteRune(c)
+	}
+	w.WriteByte('"')
+}
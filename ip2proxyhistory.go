@@ -0,0 +1,104 @@
+package ip2proxy
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const msgNoVersion string = "No database published before the given time."
+const msgDuplicateVersion string = "Several databases published on the same date."
+
+// The MultiVersionDB struct holds BIN files published on different dates, e.g. the archives of the monthly
+// downloads, to look up IP addresses as they were at the time of past events, for retroactive investigations
+// of historical logs. A BIN file covers the time from its publish date until the publish date of the next one.
+type MultiVersionDB struct {
+	versions []*DB // by ascending publish date
+}
+
+// OpenMultiVersionDB takes the paths to the IP2Proxy BIN database files, in any order, and opens them.
+func OpenMultiVersionDB(dbPaths ...string) (*MultiVersionDB, error) {
+	var dbs []*DB
+	for _, p := range dbPaths {
+		db, err := OpenDB(p)
+		if err != nil {
+			for _, opened := range dbs {
+				opened.Close()
+			}
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+
+	m, err := NewMultiVersionDB(dbs...)
+	if err != nil {
+		for _, db := range dbs {
+			db.Close()
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewMultiVersionDB wraps already opened DBs, in any order. Their publish dates must differ.
+func NewMultiVersionDB(dbs ...*DB) (*MultiVersionDB, error) {
+	var m = &MultiVersionDB{}
+	m.versions = append([]*DB(nil), dbs...)
+	sort.SliceStable(m.versions, func(i, j int) bool {
+		return m.versions[i].PublishDate().Before(m.versions[j].PublishDate())
+	})
+	for i := 1; i < len(m.versions); i++ {
+		if m.versions[i].PublishDate().Equal(m.versions[i-1].PublishDate()) {
+			return nil, errors.New(msgDuplicateVersion)
+		}
+	}
+	return m, nil
+}
+
+// Versions returns the publish dates of the databases, in ascending order.
+func (m *MultiVersionDB) Versions() []time.Time {
+	dates := make([]time.Time, len(m.versions))
+	for i, db := range m.versions {
+		dates[i] = db.PublishDate()
+	}
+	return dates
+}
+
+// DBAsOf returns the database covering the time, the last one published on or before it.
+func (m *MultiVersionDB) DBAsOf(t time.Time) (*DB, error) {
+	i := sort.Search(len(m.versions), func(i int) bool {
+		return m.versions[i].PublishDate().After(t)
+	})
+	if i == 0 {
+		return nil, errors.New(msgNoVersion)
+	}
+	return m.versions[i-1], nil
+}
+
+// GetAllAsOf will return all proxy fields based on the queried IP address, from the database covering the time.
+func (m *MultiVersionDB) GetAllAsOf(ipAddress string, t time.Time) (IP2ProxyRecord, error) {
+	db, err := m.DBAsOf(t)
+	if err != nil {
+		return IP2ProxyRecord{}, err
+	}
+	return db.GetAll(ipAddress)
+}
+
+// GetAll will return all proxy fields based on the queried IP address, from the latest database.
+func (m *MultiVersionDB) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	if len(m.versions) == 0 {
+		return IP2ProxyRecord{}, errors.New(msgNoVersion)
+	}
+	return m.versions[len(m.versions)-1].GetAll(ipAddress)
+}
+
+// Close closes the databases.
+func (m *MultiVersionDB) Close() error {
+	var err error
+	for _, db := range m.versions {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
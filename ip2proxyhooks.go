@@ -0,0 +1,60 @@
+package ip2proxy
+
+import "time"
+
+// The Hooks struct holds the callbacks invoked around the lookups of DB, ReloadableDB and Middleware and on the
+// decisions of Middleware, e.g. for custom audit, sampling or the shadow evaluation of new policies. Nil callbacks
+// are skipped. The callbacks run on the lookup path, they must be fast and safe for concurrent use.
+type Hooks struct {
+	// OnQueryStart is invoked before a lookup.
+	OnQueryStart func(ipAddress string)
+	// OnQueryEnd is invoked after a lookup with its result and duration. The lookups of Middleware answered
+	// by the decision cache and those of CachedDB answered by its cache are included.
+	OnQueryEnd func(ipAddress string, rec IP2ProxyRecord, err error, elapsed time.Duration)
+	// OnDecision is invoked by Middleware for every policy decision, the allowed requests and the cached
+	// decisions included. The client IP address is redacted like for the audit callback.
+	OnDecision func(event AuditEvent)
+}
+
+// AddHooks registers the callbacks invoked around the lookups. It must be called before any lookup.
+func (d *DB) AddHooks(h Hooks) *DB {
+	d.hooks = append(d.hooks, h)
+	return d
+}
+
+// AddHooks registers the callbacks invoked around the lookups, the BIN files swapped in included.
+// It must be called before any lookup.
+func (r *ReloadableDB) AddHooks(h Hooks) *ReloadableDB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, h)
+	r.db.AddHooks(h)
+	return r
+}
+
+// AddHooks registers the callbacks invoked around the lookups and on the decisions. The lookups of the
+// resolver have hooks of their own. It must be called before any lookup.
+func (m *Middleware) AddHooks(h Hooks) *Middleware {
+	m.hooks = append(m.hooks, h)
+	return m
+}
+
+// invoke the OnQueryStart callbacks and return the start time of the lookup
+func queryStart(hooks []Hooks, ipAddress string) time.Time {
+	for _, h := range hooks {
+		if h.OnQueryStart != nil {
+			h.OnQueryStart(ipAddress)
+		}
+	}
+	return time.Now()
+}
+
+// invoke the OnQueryEnd callbacks
+func queryEnd(hooks []Hooks, ipAddress string, rec IP2ProxyRecord, err error, started time.Time) {
+	elapsed := time.Since(started)
+	for _, h := range hooks {
+		if h.OnQueryEnd != nil {
+			h.OnQueryEnd(ipAddress, rec, err, elapsed)
+		}
+	}
+}
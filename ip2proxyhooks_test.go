@@ -0,0 +1,93 @@
+package ip2proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a Telemetry counting the lookups and their spans
+type countingTelemetry struct {
+	mu      sync.Mutex
+	lookups int64
+	spans   int
+}
+
+func (t *countingTelemetry) Count(name string, delta int64, attrs ...Attr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if name == MetricLookups {
+		t.lookups += delta
+	}
+}
+
+func (t *countingTelemetry) Observe(name string, value float64, attrs ...Attr) {}
+
+func (t *countingTelemetry) StartSpan(ctx context.Context, name string, attrs ...Attr) (context.Context, func(err error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans++
+	return ctx, func(err error) {}
+}
+
+// the lookups of CachedDB invoke the hooks and the telemetry of the DB once each, served from the cache or not
+func TestCachedDBHooks(t *testing.T) {
+	var starts, ends int
+	var last IP2ProxyRecord
+	hooks := Hooks{
+		OnQueryStart: func(ipAddress string) { starts++ },
+		OnQueryEnd: func(ipAddress string, rec IP2ProxyRecord, err error, elapsed time.Duration) {
+			ends++
+			last = rec
+		},
+	}
+	telemetry := &countingTelemetry{}
+	db := openTestBIN(t, newTestWriter(t, 2, testVPNRange)).AddHooks(hooks).SetTelemetry(telemetry)
+	defer db.Close()
+
+	cache := NewMemoryCache()
+	c := NewCachedDB(db, cache, time.Hour)
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "198.51.100.1", "not an address"}
+	for _, ip := range ips {
+		if _, err := c.GetAll(ip); err != nil {
+			t.Fatalf("%s: %v", ip, err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("%d cache entries instead of 2", cache.Len())
+	}
+	n := len(ips)
+	if starts != n || ends != n || telemetry.lookups != int64(n) || telemetry.spans != n {
+		t.Errorf("%d starts, %d ends, %d lookups and %d spans instead of %d each", starts, ends, telemetry.lookups, telemetry.spans, n)
+	}
+	if last.CountryShort != msgInvalidIP {
+		t.Errorf("last record %+v instead of the invalid address", last)
+	}
+
+	rec, _ := c.GetAll("192.0.2.4")
+	if last != rec || rec.ProxyType != "VPN" {
+		t.Errorf("hooks given %+v for the cached %+v", last, rec)
+	}
+}
+
+// the hooks of a ReloadableDB are invoked for the lookups of its CachedDB, after a swap too
+func TestReloadableCachedDBHooks(t *testing.T) {
+	var ends int
+	r := NewReloadableDB(openTestBIN(t, newTestWriter(t, 2, testVPNRange))).AddHooks(Hooks{
+		OnQueryEnd: func(ipAddress string, rec IP2ProxyRecord, err error, elapsed time.Duration) { ends++ },
+	})
+	defer r.Close()
+	c := r.Cached(NewMemoryCache(), time.Hour)
+
+	c.GetAll("192.0.2.1")
+	c.GetAll("192.0.2.1")
+	if err := r.Swap(openTestBIN(t, newTestWriter(t, 2, testVPNRange))); err != nil {
+		t.Fatal(err)
+	}
+	c.GetAll("192.0.2.1")
+	c.GetAll("192.0.2.1")
+	if ends != 4 {
+		t.Errorf("%d lookups hooked instead of 4", ends)
+	}
+}
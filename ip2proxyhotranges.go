@@ -0,0 +1,150 @@
+package ip2proxy
+
+import (
+	"net"
+	"sort"
+	"sync"
+)
+
+// The HotRange struct is one of the most queried IP ranges. IPTo is inclusive and Count is an
+// estimate which may exceed the actual number of lookups, never fall short of it.
+type HotRange struct {
+	IPFrom net.IP
+	IPTo   net.IP
+	Record IP2ProxyRecord
+	Count  uint64
+}
+
+// The HotRanges struct wraps a resolver and tracks the most queried IP ranges with a count-min sketch,
+// using a fixed amount of memory whatever the number of distinct ranges. Only lookups through
+// resolvers reporting the matched ranges, i.e. DB, CachedDB, ReloadableDB and SequentialDB, are tracked.
+type HotRanges struct {
+	resolver Resolver
+	n        int
+
+	mu     sync.Mutex
+	sketch [hotRangesDepth][]uint32
+	top    map[ipRange]*hotRange
+}
+
+type hotRange struct {
+	rec   IP2ProxyRecord
+	count uint64
+}
+
+// rows of the sketch and default counters per row
+const hotRangesDepth = 4
+const hotRangesWidth = 8192
+
+// NewHotRanges initializes with the resolver used for the lookups and the number of ranges to report.
+func NewHotRanges(resolver Resolver, n int) *HotRanges {
+	var h = &HotRanges{}
+	h.resolver = resolver
+	h.n = n
+	h.top = make(map[ipRange]*hotRange, n+1)
+	for i := range h.sketch {
+		h.sketch[i] = make([]uint32, hotRangesWidth)
+	}
+	return h
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+func (h *HotRanges) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	rec, _, err := h.getAllRange(ipAddress)
+	return rec, err
+}
+
+// Generation returns the generation of the wrapped resolver, see ReloadableDB.Generation, and 0 unless it
+// swaps its DB.
+func (h *HotRanges) Generation() uint64 {
+	return resolverGeneration(h.resolver)
+}
+
+// lookup returning the matched range too
+func (h *HotRanges) getAllRange(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	rr, ok := h.resolver.(rangeResolver)
+	if !ok {
+		rec, err := h.resolver.GetAll(ipAddress)
+		return rec, ipRange{}, err
+	}
+
+	rec, r, err := rr.getAllRange(ipAddress)
+	if err == nil && r.ipType != 0 {
+		h.count(r, rec)
+	}
+	return rec, r, err
+}
+
+// count the range in the sketch and keep it if among the top ranges
+func (h *HotRanges) count(r ipRange, rec IP2ProxyRecord) {
+	h1 := bloomMix(r.ipFrom.Lo ^ bloomMix(r.ipFrom.Hi^uint64(r.ipType)))
+	h2 := bloomMix(h1) | 1
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	est := uint32(0)
+	for i := range h.sketch {
+		c := &h.sketch[i][(h1+uint64(i)*h2)%hotRangesWidth]
+		if *c < ^uint32(0) {
+			*c++
+		}
+		if i == 0 || *c < est {
+			est = *c
+		}
+	}
+
+	if t, ok := h.top[r]; ok {
+		t.count = uint64(est)
+		return
+	}
+	if len(h.top) < h.n {
+		h.top[r] = &hotRange{rec: rec, count: uint64(est)}
+		return
+	}
+
+	// replace the coldest range if this one is hotter
+	var coldest ipRange
+	var min *hotRange
+	for k, t := range h.top {
+		if min == nil || t.count < min.count {
+			coldest, min = k, t
+		}
+	}
+	if min != nil && uint64(est) > min.count {
+		delete(h.top, coldest)
+		h.top[r] = &hotRange{rec: rec, count: uint64(est)}
+	}
+}
+
+// Report returns the most queried ranges, the hottest first.
+func (h *HotRanges) Report() []HotRange {
+	h.mu.Lock()
+	report := make([]HotRange, 0, len(h.top))
+	for r, t := range h.top {
+		report = append(report, HotRange{
+			IPFrom: numToIP(r.ipType, r.ipFrom),
+			IPTo:   numToIP(r.ipType, r.last()),
+			Record: t.rec,
+			Count:  t.count,
+		})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Count > report[j].Count
+	})
+	return report
+}
+
+// Reset clears the counters, e.g. to report per period.
+func (h *HotRanges) Reset() {
+	h.mu.Lock()
+	for i := range h.sketch {
+		for j := range h.sketch[i] {
+			h.sketch[i][j] = 0
+		}
+	}
+	h.top = make(map[ipRange]*hotRange, h.n+1)
+	h.mu.Unlock()
+}
@@ -0,0 +1,94 @@
+package ip2proxy
+
+import (
+	"errors"
+
+	"lukechampine.com/uint128"
+)
+
+const msgInvalidIndex string = "Invalid index in the IP2Proxy BIN file."
+
+var errInvalidIndex = errors.New(msgInvalidIndex)
+
+// Indexed reports whether the lookups of each IP version start from an index, read from the BIN file or
+// built by BuildIPv6Index. Some database tiers have no IPv6 index, their IPv6 lookups searching every row.
+func (d *DB) Indexed() (ipv4 bool, ipv6 bool) {
+	return d.meta.ipV4Indexed, d.meta.ipV6Indexed
+}
+
+// check that the indexes lie inside the file and only point to existing rows, so that a truncated or
+// corrupted file fails to open instead of failing lookups
+func (d *DB) validateIndexes() error {
+	if d.meta.ipV4Indexed {
+		if err := d.validateIndex(d.meta.ipV4IndexBaseAddr, d.meta.ipV4DatabaseCount); err != nil {
+			return err
+		}
+	}
+	if d.meta.ipV6Indexed {
+		if err := d.validateIndex(d.meta.ipV6IndexBaseAddr, d.meta.ipV6DatabaseCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DB) validateIndex(baseAddr uint32, count uint32) error {
+	if uint64(baseAddr)+uint64(indexSize) > 1<<32 {
+		return wrapError(ErrCorruptDatabase, errInvalidIndex)
+	}
+	index, err := d.readRow(baseAddr, indexSize)
+	if err != nil {
+		return wrapError(ErrCorruptDatabase, err)
+	}
+	for i := uint32(0); i < indexSize; i += 8 {
+		low, high := d.readUint32Row(index, i), d.readUint32Row(index, i+4)
+		if low > high || high > count {
+			return wrapError(ErrCorruptDatabase, errInvalidIndex)
+		}
+	}
+	return nil
+}
+
+// read the low and high rows of the index entry, from the index built by BuildIPv6Index for the IPv6 lookups
+// of the BIN files without IPv6 index
+func (d *DB) readIndex(ipType uint32, ipIndex uint32) ([]byte, error) {
+	if ipType == 6 && d.v6Index != nil {
+		off := ipIndex - 1
+		if off+8 > uint32(len(d.v6Index)) {
+			return nil, wrapError(ErrCorruptDatabase, errInvalidIndex)
+		}
+		return d.v6Index[off : off+8], nil
+	}
+	return d.readRow(ipIndex, 8) // 4 bytes each for IP From and IP To
+}
+
+// BuildIPv6Index scans the IPv6 rows of a BIN file without IPv6 index to build one in memory, 512 KiB, so that
+// the IPv6 lookups take a few steps of binary search instead of searching every row. It does nothing if the
+// BIN file has an IPv6 index or no IPv6 data. It must be called before any lookup.
+func (d *DB) BuildIPv6Index() error {
+	if d.meta.ipV6Indexed || d.meta.ipV6DatabaseCount == 0 {
+		return nil
+	}
+
+	count := d.meta.ipV6DatabaseCount
+	colSize := d.meta.ipV6ColumnSize
+	ipFroms := make([]uint128.Uint128, 0, count)
+	for i := uint32(0); i < count; i += scanBatchRows {
+		n := count - i
+		if n > scanBatchRows {
+			n = scanBatchRows
+		}
+		data, err := d.readRow(d.meta.ipV6DatabaseAddr+i*colSize, n*colSize)
+		if err != nil {
+			return err
+		}
+		for j := uint32(0); j < n; j++ {
+			ipFroms = append(ipFroms, d.readUint128Row(data, j*colSize))
+		}
+	}
+
+	d.v6Index = buildIndex(len(ipFroms), func(i int) uint128.Uint128 { return ipFroms[i] }, 112, uint128.Max)
+	d.meta.ipV6IndexBaseAddr = 1 // offset in v6Index, 1-based like the file offsets
+	d.meta.ipV6Indexed = true
+	return nil
+}
@@ -0,0 +1,109 @@
+package ip2proxy
+
+import (
+	"testing"
+
+	"lukechampine.com/uint128"
+)
+
+// ranges at the first and last addresses, across the prefixes of the index entries and within a single one
+var indexTestRanges = [][3]string{
+	{"0.0.0.0", "0.0.0.255", "VPN"},
+	{"1.0.255.0", "1.1.0.255", "TOR"},
+	{"1.1.1.0", "1.1.1.0", "DCH"},
+	{"1.1.1.2", "1.1.1.9", "PUB"},
+	{"10.0.0.0", "10.255.255.255", "RES"},
+	{"255.255.255.0", "255.255.255.255", "WEB"},
+	{"::", "::ff", "VPN"},
+	{"2001:db7:ffff::", "2001:db8::ffff", "TOR"},
+	{"2001:db8:1::", "2001:db8:1::", "DCH"},
+	{"2001:db8:1::2", "2001:db8:1::9", "PUB"},
+	{"fe80::", "fe80:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "RES"},
+	{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "WEB"},
+}
+
+func writeIndexTestBIN(t *testing.T, ipv4 bool, ipv6 bool) (*Writer, *DB) {
+	t.Helper()
+	w := newTestWriter(t, 11, indexTestRanges...).SetIndexes(ipv4, ipv6)
+	return w, openTestBIN(t, w)
+}
+
+// the first and last addresses of every row, gaps included, and those around them
+func rowBoundaries(t *testing.T, w *Writer) []string {
+	t.Helper()
+	var ips []string
+	for _, v := range []struct {
+		ipType uint32
+		ranges []writerRange
+		maxIP  uint128.Uint128
+	}{{4, w.v4Ranges, maxIPV4Range}, {6, w.v6Ranges, uint128.Max}} {
+		rows, err := fillRanges(v.ranges, v.maxIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rows {
+			for _, n := range []uint128.Uint128{r.ipFrom, r.ipFrom.AddWrap64(1), r.ipTo.SubWrap64(1), r.ipTo} {
+				ips = append(ips, numToAddr(v.ipType, n).String())
+			}
+		}
+	}
+	return ips
+}
+
+func TestIndexedAndUnindexedAgree(t *testing.T) {
+	w, indexed := writeIndexTestBIN(t, true, true)
+	if v4, v6 := indexed.Indexed(); !v4 || !v6 {
+		t.Fatalf("indexes %v %v, expected both", v4, v6)
+	}
+
+	variants := []struct {
+		name   string
+		ipv4   bool
+		ipv6   bool
+		build6 bool
+	}{
+		{"no IPv6 index", true, false, false},
+		{"no IPv4 index", false, true, false},
+		{"no index", false, false, false},
+		{"built IPv6 index", true, false, true},
+	}
+	ips := rowBoundaries(t, w)
+	for _, v := range variants {
+		_, db := writeIndexTestBIN(t, v.ipv4, v.ipv6)
+		if v.build6 {
+			if err := db.BuildIPv6Index(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v4, v6 := db.Indexed(); v4 != v.ipv4 || v6 != (v.ipv6 || v.build6) {
+			t.Errorf("%s: indexes %v %v", v.name, v4, v6)
+		}
+
+		for _, ip := range ips {
+			want, err := indexed.GetAll(ip)
+			if err != nil {
+				t.Fatalf("%s: %v", ip, err)
+			}
+			got, err := db.GetAll(ip)
+			if err != nil {
+				t.Fatalf("%s, %s: %v", v.name, ip, err)
+			}
+			if got != want {
+				t.Errorf("%s, %s: %+v instead of %+v", v.name, ip, got, want)
+			}
+		}
+	}
+}
+
+// the indexed file answers the ranges written
+func TestIndexedAnswers(t *testing.T) {
+	_, db := writeIndexTestBIN(t, true, true)
+	for _, r := range indexTestRanges {
+		for _, ip := range []string{r[0], r[1]} {
+			got, err := db.GetProxyType(ip)
+			if err != nil || got != r[2] {
+				t.Errorf("%s: %q (%v) instead of %q", ip, got, err, r[2])
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+//go:build linux && ip2proxy_iouring
+
+package ip2proxy
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// system calls and constants of io_uring, see linux/io_uring.h
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringEnterGetEvents = 1
+	ioringOpRead         = 22
+
+	ioringEntries = 64
+)
+
+type ioSQRingOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type ioCQRingOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type ioUringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  ioSQRingOffsets
+	cqOff                                                                  ioCQRingOffsets
+}
+
+// the rings are shared with the kernel in the byte order of the platform, so the structures below are accessed
+// natively, unlike the BIN file which is little-endian on every platform
+type ioUringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// The ioUringReader struct reads the BIN file through an io_uring, submitting the reads of a batch at once.
+// The ring is shared by the lookups, which take turns.
+type ioUringReader struct {
+	f  *os.File
+	fd int
+
+	mu     sync.Mutex
+	sqRing []byte
+	cqRing []byte
+	sqes   []byte
+
+	sqTail, sqMask *uint32
+	sqArray        []uint32
+	cqHead, cqTail *uint32
+	cqMask         uint32
+	cqes           []ioUringCQE
+	entries        uint32
+	broken         error // set when completions could not be waited for, the ring being unusable
+}
+
+// OpenDBIOUring takes the path to the IP2Proxy BIN database file and opens it like OpenDB, except that
+// the file is read through an io_uring, the strings of a record being read with a single system call.
+// It is experimental and only available on Linux 5.6 and later, built with the ip2proxy_iouring tag.
+func OpenDBIOUring(dbPath string) (*DB, error) {
+	f, err := os.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newIOUringReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return OpenDBWithReader(r)
+}
+
+func newIOUringReader(f *os.File) (*ioUringReader, error) {
+	var p ioUringParams
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, ioringEntries, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+
+	var r = &ioUringReader{}
+	r.f = f
+	r.fd = int(fd)
+	r.entries = p.sqEntries
+
+	var err error
+	if r.sqRing, err = syscall.Mmap(r.fd, ioringOffSQRing, int(p.sqOff.array+p.sqEntries*4),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.release()
+		return nil, err
+	}
+	if r.cqRing, err = syscall.Mmap(r.fd, ioringOffCQRing, int(p.cqOff.cqes+p.cqEntries*uint32(unsafe.Sizeof(ioUringCQE{}))),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.release()
+		return nil, err
+	}
+	if r.sqes, err = syscall.Mmap(r.fd, ioringOffSQEs, int(p.sqEntries*uint32(unsafe.Sizeof(ioUringSQE{}))),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.release()
+		return nil, err
+	}
+
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.tail]))
+	r.sqMask = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.array])), p.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*ioUringCQE)(unsafe.Pointer(&r.cqRing[p.cqOff.cqes])), p.cqEntries)
+	return r, nil
+}
+
+func (r *ioUringReader) sqe(i uint32) *ioUringSQE {
+	return (*ioUringSQE)(unsafe.Pointer(&r.sqes[uintptr(i)*unsafe.Sizeof(ioUringSQE{})]))
+}
+
+// ReadAt reads through the ring like a batch of one read.
+func (r *ioUringReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ReadBatchAt([][]byte{p}, []int64{off})
+	if err != nil {
+		return 0, err
+	}
+	if n[0] < len(p) {
+		return n[0], io.EOF
+	}
+	return n[0], nil
+}
+
+// ReadBatchAt submits the reads at once, in chunks of the size of the ring.
+func (r *ioUringReader) ReadBatchAt(bufs [][]byte, offsets []int64) ([]int, error) {
+	read := make([]int, len(bufs))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for start := 0; start < len(bufs); start += int(r.entries) {
+		end := start + int(r.entries)
+		if end > len(bufs) {
+			end = len(bufs)
+		}
+		if err := r.submit(bufs, offsets, read, start, end); err != nil {
+			return nil, err
+		}
+	}
+	runtime.KeepAlive(bufs)
+	return read, nil
+}
+
+// submit the reads from start to end and wait for their completion. Every read submitted is waited for, the
+// failed ones included, so that no completion is left for the next batch and the kernel no longer writes into
+// the buffers once returned; the first error is returned then.
+func (r *ioUringReader) submit(bufs [][]byte, offsets []int64, read []int, start int, end int) error {
+	if r.broken != nil {
+		return r.broken
+	}
+
+	tail := atomic.LoadUint32(r.sqTail)
+	mask := atomic.LoadUint32(r.sqMask)
+	for i := start; i < end; i++ {
+		idx := tail & mask
+		sqe := r.sqe(idx)
+		*sqe = ioUringSQE{opcode: ioringOpRead, fd: int32(r.f.Fd()), off: uint64(offsets[i]), len: uint32(len(bufs[i])), userData: uint64(i)}
+		if len(bufs[i]) > 0 {
+			sqe.addr = uint64(uintptr(unsafe.Pointer(&bufs[i][0])))
+		}
+		r.sqArray[idx] = idx
+		tail++
+	}
+	atomic.StoreUint32(r.sqTail, tail)
+
+	var first error
+	toSubmit, pending := uint32(end-start), end-start
+	for pending > 0 {
+		n, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), uintptr(toSubmit), uintptr(pending), ioringEnterGetEvents, 0, 0)
+		switch {
+		case errno == 0:
+			toSubmit -= uint32(n)
+		case errno == syscall.EINTR:
+		case toSubmit > 0:
+			// nothing submitted by the failed call: the entries left are taken back and those submitted
+			// before are waited for
+			if first == nil {
+				first = os.NewSyscallError("io_uring_enter", errno)
+			}
+			atomic.StoreUint32(r.sqTail, tail-toSubmit)
+			pending -= int(toSubmit)
+			toSubmit = 0
+			continue
+		default:
+			// the reads in flight cannot be waited for, their completions would be taken for those of
+			// the next batches
+			r.broken = os.NewSyscallError("io_uring_enter", errno)
+			return r.broken
+		}
+
+		head := atomic.LoadUint32(r.cqHead)
+		for ; head != atomic.LoadUint32(r.cqTail); head++ {
+			cqe := r.cqes[head&r.cqMask]
+			if cqe.res < 0 {
+				if first == nil {
+					first = os.NewSyscallError("read", syscall.Errno(-cqe.res))
+				}
+			} else {
+				read[cqe.userData] = int(cqe.res)
+			}
+			pending--
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+	return first
+}
+
+// a reader of its own over the same file, for Clone
+func (r *ioUringReader) clone() (dbReader, error) {
+	f, err := reopen(r.f)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newIOUringReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read is not supported, the file is only read at offsets.
+func (r *ioUringReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// Close releases the ring and closes the file.
+func (r *ioUringReader) Close() error {
+	r.release()
+	return r.f.Close()
+}
+
+func (r *ioUringReader) release() {
+	for _, m := range [][]byte{r.sqRing, r.cqRing, r.sqes} {
+		if m != nil {
+			syscall.Munmap(m)
+		}
+	}
+	syscall.Close(r.fd)
+}
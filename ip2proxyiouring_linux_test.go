@@ -0,0 +1,78 @@
+//go:build linux && ip2proxy_iouring
+
+package ip2proxy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestRing(t *testing.T, content []byte) *ioUringReader {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "truncated.bin")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newIOUringReader(f)
+	if err != nil {
+		f.Close()
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// every read of a batch must be reaped, the failed and short ones included, so that the next batch gets its own
+// completions
+func TestIOUringFailedReadsAreReaped(t *testing.T) {
+	content := make([]byte, 4096)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	r := openTestRing(t, content)
+
+	bufs := [][]byte{make([]byte, 16), make([]byte, 16), make([]byte, 16), make([]byte, 16)}
+	offsets := []int64{0, -2, 8192, 4090} // valid, negative, past EOF, crossing EOF; -1 is the file position
+	if _, err := r.ReadBatchAt(bufs, offsets); err == nil {
+		t.Fatal("expected an error for the negative offset")
+	}
+
+	for round := 0; round < 3; round++ {
+		bufs = [][]byte{make([]byte, 32), make([]byte, 32), make([]byte, 10)}
+		offsets = []int64{100, 2000, 4090}
+		read, err := r.ReadBatchAt(bufs, offsets)
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		for i, want := range [][]byte{content[100:132], content[2000:2032], content[4090:]} {
+			if read[i] != len(want) || !bytes.Equal(bufs[i][:read[i]], want) {
+				t.Fatalf("round %d: read %d is %d bytes %v, expected %v", round, i, read[i], bufs[i][:read[i]], want)
+			}
+		}
+	}
+}
+
+func TestIOUringShortRead(t *testing.T) {
+	r := openTestRing(t, []byte("0123456789"))
+
+	p := make([]byte, 8)
+	n, err := r.ReadAt(p, 6)
+	if n != 4 || err != io.EOF || string(p[:n]) != "6789" {
+		t.Fatalf("got %d %q %v, expected 4 \"6789\" EOF", n, p[:n], err)
+	}
+	n, err = r.ReadAt(p, 100)
+	if n != 0 || err != io.EOF {
+		t.Fatalf("got %d %v past EOF, expected 0 EOF", n, err)
+	}
+	n, err = r.ReadAt(p[:4], 0)
+	if n != 4 || err != nil || string(p[:4]) != "0123" {
+		t.Fatalf("got %d %q %v, expected 4 \"0123\"", n, p[:4], err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux || !ip2proxy_iouring
+
+package ip2proxy
+
+import "errors"
+
+const msgIOUringUnavailable string = "io_uring is only available on Linux, built with the ip2proxy_iouring tag."
+
+// OpenDBIOUring opens the BIN file through an io_uring on Linux, built with the ip2proxy_iouring tag.
+// Otherwise it returns an error, OpenDB being the portable choice.
+func OpenDBIOUring(dbPath string) (*DB, error) {
+	return nil, errors.New(msgIOUringUnavailable)
+}
@@ -0,0 +1,59 @@
+package ip2proxy
+
+import "errors"
+
+// ErrIPv6NotSupported is returned by the lookups of IPv6 addresses in BIN files without IPv6 data, with IPv6AsError.
+var ErrIPv6NotSupported = errors.New(msgIPV6Unsupported)
+
+// The IPv6Handling type sets what the lookups of IPv6 addresses return with the BIN files without IPv6 data,
+// e.g. the IPv4-only tiers.
+type IPv6Handling int
+
+const (
+	// IPv6AsSentinel sets the fields to "IPV6 ADDRESS MISSING IN IPV4 BIN" and IsProxy to -1, the default.
+	IPv6AsSentinel IPv6Handling = iota
+	// IPv6AsNotProxy returns the addresses as not proxies, as the addresses outside of any proxy range.
+	IPv6AsNotProxy
+	// IPv6AsError returns ErrIPv6NotSupported, the fields holding the sentinel message.
+	IPv6AsError
+	// IPv6AsFallback looks up the addresses with the resolver of SetIPv6Fallback, e.g. another BIN file or the web service.
+	IPv6AsFallback
+)
+
+// SetIPv6Handling sets what the lookups of IPv6 addresses return with BIN files without IPv6 data.
+// It must be called before any lookup.
+func (d *DB) SetIPv6Handling(mode IPv6Handling) *DB {
+	d.ipv6Mode = mode
+	return d
+}
+
+// SetIPv6Fallback looks up the IPv6 addresses with the resolver when the BIN file has no IPv6 data, e.g. a DB
+// opened from a PX11 file or a CachedWS, setting the handling to IPv6AsFallback. It must be called before any lookup.
+func (d *DB) SetIPv6Fallback(resolver Resolver) *DB {
+	d.ipv6Lookup = resolver
+	d.ipv6Mode = IPv6AsFallback
+	return d
+}
+
+// the result of an IPv6 address without IPv6 data
+func (d *DB) missingIPv6(ipAddress string) (IP2ProxyRecord, error) {
+	switch d.ipv6Mode {
+	case IPv6AsNotProxy:
+		x := loadMessage(msgNotSupported)
+		if d.unsupported == UnsupportedAsEmpty {
+			x = loadMessage("")
+		}
+		for i := range d.plan {
+			x.setField(d.plan[i].field, "-")
+		}
+		x.IsProxy = 0
+		return x, nil
+	case IPv6AsError:
+		return loadMessage(msgIPV6Unsupported), ErrIPv6NotSupported
+	case IPv6AsFallback:
+		if d.ipv6Lookup != nil {
+			return d.ipv6Lookup.GetAll(ipAddress)
+		}
+	}
+	return loadMessage(msgIPV6Unsupported), nil
+}
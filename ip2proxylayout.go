@@ -0,0 +1,106 @@
+package ip2proxy
+
+import "errors"
+
+// The Layout struct describes the columns of the rows of a BIN database type. Columns are numbered
+// from 1, column 1 being the IP From column; a field not supported by the database type has column 0.
+// Every column holds a 4-byte little-endian value, except the 16-byte IP From column of IPv6 rows.
+// String fields hold the offset of a length-prefixed string, Country pointing to the country code
+// followed by the country name 3 bytes further.
+type Layout struct {
+	DatabaseType uint8
+	Columns      uint8
+	Country      uint8
+	Region       uint8
+	City         uint8
+	Isp          uint8
+	ProxyType    uint8
+	Domain       uint8
+	UsageType    uint8
+	Asn          uint8
+	As           uint8
+	LastSeen     uint8
+	Threat       uint8
+	Provider     uint8
+}
+
+// DatabaseLayout returns the layout of the database type (1 to 11 respectively for PX1 to PX11).
+func DatabaseLayout(databaseType uint8) (Layout, error) {
+	if databaseType < 1 || int(databaseType) >= len(countryPosition) {
+		return Layout{}, errors.New(msgInvalidDatabaseType)
+	}
+
+	dbt := databaseType
+	return Layout{
+		DatabaseType: dbt,
+		Columns:      writerColumns(dbt),
+		Country:      countryPosition[dbt],
+		Region:       regionPosition[dbt],
+		City:         cityPosition[dbt],
+		Isp:          ispPosition[dbt],
+		ProxyType:    proxyTypePosition[dbt],
+		Domain:       domainPosition[dbt],
+		UsageType:    usageTypePosition[dbt],
+		Asn:          asnPosition[dbt],
+		As:           asPosition[dbt],
+		LastSeen:     lastSeenPosition[dbt],
+		Threat:       threatPosition[dbt],
+		Provider:     providerPosition[dbt],
+	}, nil
+}
+
+// Layout returns the layout of the opened BIN file, with the number of columns as stated in its header.
+func (d *DB) Layout() (Layout, error) {
+	l, err := DatabaseLayout(d.meta.databaseType)
+	if err != nil {
+		return l, err
+	}
+	l.Columns = d.meta.databaseColumn
+	return l, nil
+}
+
+// RowSize returns the size in bytes of the IPv4 rows, or of the IPv6 rows if ipv6 is set.
+func (l Layout) RowSize(ipv6 bool) uint32 {
+	if ipv6 {
+		return 16 + (uint32(l.Columns)-1)<<2
+	}
+	return uint32(l.Columns) << 2
+}
+
+// Offset returns the byte offset of the column within the IPv4 rows, or the IPv6 rows if ipv6 is set.
+func (l Layout) Offset(column uint8, ipv6 bool) uint32 {
+	if column <= 1 {
+		return 0
+	}
+	if ipv6 {
+		return 16 + (uint32(column)-2)<<2
+	}
+	return (uint32(column) - 1) << 2
+}
+
+// Fields returns the fields supported by the layout.
+func (l Layout) Fields() FieldMask {
+	m := FieldIsProxy
+	for _, f := range []struct {
+		column uint8
+		fields FieldMask
+	}{
+		{l.Country, FieldCountryShort | FieldCountryLong},
+		{l.Region, FieldRegion},
+		{l.City, FieldCity},
+		{l.Isp, FieldIsp},
+		{l.ProxyType, FieldProxyType},
+		{l.Domain, FieldDomain},
+		{l.UsageType, FieldUsageType},
+		{l.Asn, FieldAsn},
+		{l.As, FieldAs},
+		{l.LastSeen, FieldLastSeen},
+		{l.Threat, FieldThreat},
+		{l.Provider, FieldProvider},
+	} {
+		if f.column != 0 {
+			m |= f.fields
+		}
+	}
+	return m
+}
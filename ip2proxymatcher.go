@@ -0,0 +1,133 @@
+package ip2proxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// The Matcher struct checks IP addresses against conditions on their proxy record, for use by
+// WAF rule engines. The conditions are written as space separated field=value1,value2 terms,
+// e.g. "proxyType=TOR,VPN threat=SPAM". All terms must hold; a term holds when the field is equal
+// to one of its values, ignoring case. Terms written field!=value1,value2 hold when it is equal to none.
+// Threat and usage type values also match a single part of combined values like "SPAM/BOTNET".
+// Without any term every proxy matches.
+type Matcher struct {
+	resolver Resolver
+	terms    []matchTerm
+}
+
+type matchTerm struct {
+	field  string
+	values map[string]bool
+	negate bool
+}
+
+const msgInvalidMatchTerm string = "Invalid match term."
+const msgUnknownField string = "Unknown field."
+
+// NewMatcher initializes with the resolver used for the lookups and the match conditions.
+func NewMatcher(resolver Resolver, conditions string) (*Matcher, error) {
+	var m = &Matcher{}
+	m.resolver = resolver
+
+	for _, term := range strings.Fields(conditions) {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, errors.New(msgInvalidMatchTerm)
+		}
+		field := strings.ToLower(kv[0])
+		negate := strings.HasSuffix(field, "!")
+		field = strings.TrimSuffix(field, "!")
+		if _, ok := recordField(IP2ProxyRecord{}, field); !ok {
+			return nil, errors.New(msgUnknownField)
+		}
+
+		t := matchTerm{field: field, values: make(map[string]bool), negate: negate}
+		for _, v := range strings.Split(kv[1], ",") {
+			t.values[strings.ToUpper(v)] = true
+		}
+		m.terms = append(m.terms, t)
+	}
+	return m, nil
+}
+
+// Match looks up the IP address and checks its proxy record against the conditions.
+func (m *Matcher) Match(ipAddress string) (bool, error) {
+	rec, err := m.resolver.GetAll(ipAddress)
+	if err != nil {
+		return false, err
+	}
+	return m.MatchRecord(rec), nil
+}
+
+// MatchRecord checks the proxy record against the conditions.
+func (m *Matcher) MatchRecord(rec IP2ProxyRecord) bool {
+	if len(m.terms) == 0 {
+		return rec.IsProxy > 0
+	}
+
+	for _, t := range m.terms {
+		if !t.match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t matchTerm) match(rec IP2ProxyRecord) bool {
+	return t.equal(rec) != t.negate
+}
+
+// whether the field is equal to one of the values
+func (t matchTerm) equal(rec IP2ProxyRecord) bool {
+	v, _ := recordField(rec, t.field)
+	v = strings.ToUpper(v)
+	if t.values[v] {
+		return true
+	}
+
+	if t.field == "threat" || t.field == "usagetype" {
+		for _, part := range strings.Split(v, "/") {
+			if t.values[part] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// value of the record field by its lower case name, as named by the web service
+func recordField(rec IP2ProxyRecord, field string) (string, bool) {
+	switch field {
+	case "isproxy":
+		return strconv.Itoa(int(rec.IsProxy)), true
+	case "proxytype":
+		return rec.ProxyType, true
+	case "countrycode":
+		return rec.CountryShort, true
+	case "countryname":
+		return rec.CountryLong, true
+	case "regionname":
+		return rec.Region, true
+	case "cityname":
+		return rec.City, true
+	case "isp":
+		return rec.Isp, true
+	case "domain":
+		return rec.Domain, true
+	case "usagetype":
+		return rec.UsageType, true
+	case "asn":
+		return rec.Asn, true
+	case "as":
+		return rec.As, true
+	case "lastseen":
+		return rec.LastSeen, true
+	case "threat":
+		return rec.Threat, true
+	case "provider":
+		return rec.Provider, true
+	}
+	return "", false
+}
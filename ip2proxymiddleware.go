@@ -0,0 +1,441 @@
+package ip2proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Resolver interface is implemented by the lookup sources which return proxy records,
+// such as DB, CachedDB and ReloadableDB.
+type Resolver interface {
+	GetAll(ipAddress string) (IP2ProxyRecord, error)
+}
+
+// The Decision type is the outcome of a Policy for a proxy record.
+type Decision int
+
+const (
+	// DecisionNone leaves the decision to the next policy.
+	DecisionNone Decision = iota
+	// DecisionAllow lets the request through.
+	DecisionAllow
+	// DecisionDeny blocks the request.
+	DecisionDeny
+	// DecisionChallenge asks the client to prove it is legitimate, e.g. with a CAPTCHA, before letting the request through.
+	DecisionChallenge
+)
+
+// String returns none, allow, deny or challenge.
+func (d Decision) String() string {
+	switch d {
+	case DecisionAllow:
+		return "allow"
+	case DecisionDeny:
+		return "deny"
+	case DecisionChallenge:
+		return "challenge"
+	}
+	return "none"
+}
+
+// The Policy type decides what to do with a request based on the proxy record of its client IP address.
+type Policy func(rec IP2ProxyRecord) Decision
+
+// Chain combines the policies; the first policy returning a decision other than DecisionNone wins.
+func Chain(policies ...Policy) Policy {
+	return func(rec IP2ProxyRecord) Decision {
+		for _, p := range policies {
+			if d := p(rec); d != DecisionNone {
+				return d
+			}
+		}
+		return DecisionNone
+	}
+}
+
+// BlockProxyTypes denies records whose proxy type is one of the given types, e.g. "TOR" or "VPN".
+func BlockProxyTypes(types ...string) Policy {
+	return matchProxyTypes(types, DecisionDeny)
+}
+
+// AllowProxyTypes allows records whose proxy type is one of the given types, e.g. "RES".
+func AllowProxyTypes(types ...string) Policy {
+	return matchProxyTypes(types, DecisionAllow)
+}
+
+// BlockProxies denies every record flagged as a proxy, including data center and search engine ranges.
+func BlockProxies() Policy {
+	return func(rec IP2ProxyRecord) Decision {
+		if rec.IsProxy > 0 {
+			return DecisionDeny
+		}
+		return DecisionNone
+	}
+}
+
+// BlockThreats denies records reporting one of the threats, e.g. ThreatSpam|ThreatBotnet.
+func BlockThreats(threats ThreatSet) Policy {
+	return func(rec IP2ProxyRecord) Decision {
+		if rec.Threats().Any(threats) {
+			return DecisionDeny
+		}
+		return DecisionNone
+	}
+}
+
+func matchProxyTypes(types []string, d Decision) Policy {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return func(rec IP2ProxyRecord) Decision {
+		if set[rec.ProxyType] {
+			return d
+		}
+		return DecisionNone
+	}
+}
+
+type contextKey int
+
+const recordContextKey contextKey = 0
+const decisionContextKey contextKey = 1
+
+// NewContext returns a copy of the context carrying the proxy record.
+func NewContext(ctx context.Context, rec IP2ProxyRecord) context.Context {
+	return context.WithValue(ctx, recordContextKey, rec)
+}
+
+// RecordFromContext returns the proxy record attached by the middleware.
+func RecordFromContext(ctx context.Context) (IP2ProxyRecord, bool) {
+	rec, ok := ctx.Value(recordContextKey).(IP2ProxyRecord)
+	return rec, ok
+}
+
+// DecisionFromContext returns the decision made by the middleware. In shadow mode a request may
+// carry DecisionDeny without having been blocked.
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionContextKey).(Decision)
+	return d, ok
+}
+
+// The DenyHandler type writes the response for blocked requests.
+type DenyHandler func(w http.ResponseWriter, r *http.Request, rec IP2ProxyRecord)
+
+// DenyWithStatus responds to blocked requests with the status code and its status text.
+func DenyWithStatus(code int) DenyHandler {
+	return func(w http.ResponseWriter, r *http.Request, rec IP2ProxyRecord) {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// DenyWithJSON responds to blocked requests with the status code and the JSON encoded body.
+func DenyWithJSON(code int, body interface{}) DenyHandler {
+	data, err := json.Marshal(body)
+	return func(w http.ResponseWriter, r *http.Request, rec IP2ProxyRecord) {
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write(data)
+	}
+}
+
+// DenyWithRedirect redirects blocked requests, e.g. to a CAPTCHA page. The original request URI
+// is appended to the URL as the query parameter named by param, unless param is empty.
+func DenyWithRedirect(target string, param string) DenyHandler {
+	return func(w http.ResponseWriter, r *http.Request, rec IP2ProxyRecord) {
+		u := target
+		if param != "" {
+			sep := "?"
+			if strings.Contains(u, "?") {
+				sep = "&"
+			}
+			u += sep + url.QueryEscape(param) + "=" + url.QueryEscape(r.URL.RequestURI())
+		}
+		http.Redirect(w, r, u, http.StatusSeeOther)
+	}
+}
+
+// The AuditEvent struct describes a denied or challenged lookup passed to the audit callback.
+// Request is nil for frameworks not based on net/http.
+type AuditEvent struct {
+	ClientIP string
+	Record   IP2ProxyRecord
+	Decision Decision
+	Shadow   bool
+	Request  *http.Request
+}
+
+// The AuditFunc type is the callback invoked for every denied or challenged lookup, including those let
+// through in shadow mode.
+type AuditFunc func(event AuditEvent)
+
+// The Middleware struct looks up the client IP address of HTTP requests, attaches the proxy
+// record to the request context and enforces a Policy. Requests are allowed when no policy
+// decides and when the lookup fails.
+type Middleware struct {
+	resolver  Resolver
+	policy    Policy
+	extractor *ClientIPExtractor
+	decisions *decisionCache
+	deny      DenyHandler
+	challenge DenyHandler
+	audit     AuditFunc
+	shadow    bool
+	redact    Redactor // applied to the client IP addresses of the audit events
+	telemetry Telemetry
+	hooks     []Hooks
+	shadows   []*ShadowPolicy
+}
+
+// NewMiddleware initializes with the resolver used for the lookups and the policy to enforce.
+// A nil policy only attaches the records.
+func NewMiddleware(resolver Resolver, policy Policy) *Middleware {
+	var m = &Middleware{}
+	m.resolver = resolver
+	m.policy = policy
+	return m
+}
+
+// WithPolicy returns a copy of the middleware enforcing another policy, for per-route policies.
+func (m *Middleware) WithPolicy(policy Policy) *Middleware {
+	c := *m
+	c.policy = policy
+	if m.decisions != nil {
+		// decisions of the other policy must not be shared
+		c.decisions = newDecisionCache(m.decisions.ttl, m.decisions.maxEntries)
+		c.decisions.negativeTTL = m.decisions.negativeTTL
+	}
+	return &c
+}
+
+// SetClientIPExtractor sets the extractor used to resolve the client IP address behind reverse proxies.
+// Without an extractor the peer address of the connection is used.
+func (m *Middleware) SetClientIPExtractor(extractor *ClientIPExtractor) *Middleware {
+	m.extractor = extractor
+	return m
+}
+
+// SetDenyHandler sets the handler writing the response for blocked requests; 403 Forbidden by default.
+func (m *Middleware) SetDenyHandler(deny DenyHandler) *Middleware {
+	m.deny = deny
+	return m
+}
+
+// SetChallengeHandler sets the handler writing the response for challenged requests, e.g. DenyWithRedirect to
+// a CAPTCHA page. Without a handler challenged requests are let through with the decision in the request context.
+func (m *Middleware) SetChallengeHandler(challenge DenyHandler) *Middleware {
+	m.challenge = challenge
+	return m
+}
+
+// SetAuditFunc sets the callback invoked for every denied or challenged lookup.
+func (m *Middleware) SetAuditFunc(audit AuditFunc) *Middleware {
+	m.audit = audit
+	return m
+}
+
+// SetShadowMode sets whether denied requests are let through, only tagged with the decision in
+// the request context, e.g. to evaluate a policy before enforcing it.
+func (m *Middleware) SetShadowMode(shadow bool) *Middleware {
+	m.shadow = shadow
+	return m
+}
+
+// EnableDecisionCache caches the records and decisions per matched IP range for the TTL, so requests
+// from anywhere in a range already seen skip the lookup. At most maxEntries ranges are kept, zero for no limit.
+// It only takes effect with resolvers reporting matched ranges, i.e. DB, CachedDB and ReloadableDB. The decisions
+// cached are dropped when a ReloadableDB swaps its DB.
+func (m *Middleware) EnableDecisionCache(ttl time.Duration, maxEntries int) *Middleware {
+	m.decisions = newDecisionCache(ttl, maxEntries)
+	return m
+}
+
+// SetDecisionCacheNegativeTTL sets the TTL of the cached decisions for the ranges not flagged as proxies, usually
+// longer than the TTL of EnableDecisionCache so that newly flagged ranges are still picked up quickly.
+// It must be called after EnableDecisionCache.
+func (m *Middleware) SetDecisionCacheNegativeTTL(ttl time.Duration) *Middleware {
+	if m.decisions != nil {
+		m.decisions.negativeTTL = ttl
+	}
+	return m
+}
+
+// DecisionCacheStats returns the counters of the decision cache.
+func (m *Middleware) DecisionCacheStats() DecisionCacheStats {
+	if m.decisions == nil {
+		return DecisionCacheStats{}
+	}
+	return m.decisions.stats()
+}
+
+// IsCached reports whether the decision for the IP address is in the decision cache, without counting
+// a hit or a miss, e.g. to log whether a lookup about to be made will be answered by the cache.
+func (m *Middleware) IsCached(ipAddress string) bool {
+	if m.decisions == nil {
+		return false
+	}
+	ipType, ipNum := ipToNum(ipAddress)
+	return ipType != 0 && m.decisions.has(resolverGeneration(m.resolver), ipType, ipNum)
+}
+
+// Lookup returns the proxy record and the policy decision for the IP address.
+// The decision is never DecisionNone.
+func (m *Middleware) Lookup(ipAddress string) (IP2ProxyRecord, Decision, error) {
+	rr, ok := m.resolver.(rangeResolver)
+	if m.decisions == nil || !ok {
+		rec, err := m.resolver.GetAll(ipAddress)
+		if err != nil {
+			return rec, DecisionAllow, err
+		}
+		return rec, m.decide(rec), nil
+	}
+
+	generation := resolverGeneration(m.resolver)
+	ipType, ipNum := ipToNum(ipAddress)
+	if rec, d, found := m.decisions.get(generation, ipType, ipNum); found {
+		return rec, d, nil
+	}
+
+	rec, r, err := rr.getAllRange(ipAddress)
+	if err != nil {
+		return rec, DecisionAllow, err
+	}
+
+	d := m.decide(rec)
+	if r.ipType != 0 {
+		m.decisions.set(generation, r, rec, d)
+	}
+	return rec, d, nil
+}
+
+// apply the policy
+func (m *Middleware) decide(rec IP2ProxyRecord) Decision {
+	d := DecisionNone
+	if m.policy != nil {
+		d = m.policy(rec)
+	}
+	if d == DecisionNone {
+		d = DecisionAllow
+	}
+	return d
+}
+
+// ClientIP returns the client IP address of the request.
+func (m *Middleware) ClientIP(r *http.Request) string {
+	return m.ClientIPFromHeader(remoteIP(r.RemoteAddr), r.Header)
+}
+
+// ClientIPFromHeader returns the client IP address given the IP address of the peer and the request headers.
+func (m *Middleware) ClientIPFromHeader(peerIP string, header http.Header) string {
+	if m.extractor == nil {
+		return peerIP
+	}
+	return m.extractor.FromHeader(peerIP, header)
+}
+
+// Check returns the proxy record and the policy decision for the client of the request.
+func (m *Middleware) Check(r *http.Request) (IP2ProxyRecord, Decision, error) {
+	return m.Lookup(m.ClientIP(r))
+}
+
+// Evaluate looks up the IP address, applies the policy and invokes the audit callback for denied and challenged
+// lookups. It returns whether the request must be blocked, which is never the case in shadow mode; challenged
+// requests are not blocked, the caller challenges them.
+// The request is only passed to the audit callback and may be nil.
+func (m *Middleware) Evaluate(ipAddress string, r *http.Request) (IP2ProxyRecord, Decision, bool, error) {
+	if m.telemetry != nil {
+		ctx := context.Background()
+		if r != nil {
+			ctx = r.Context()
+		}
+		_, end := m.telemetry.StartSpan(ctx, SpanEvaluate)
+		rec, d, block, err := m.evaluate(ipAddress, r)
+		if err == nil {
+			m.telemetry.Count(MetricDecisions, 1, Attr{"decision", d.String()}, Attr{"shadow", strconv.FormatBool(m.shadow)})
+		}
+		end(err)
+		return rec, d, block, err
+	}
+	return m.evaluate(ipAddress, r)
+}
+
+// evaluation without telemetry
+func (m *Middleware) evaluate(ipAddress string, r *http.Request) (IP2ProxyRecord, Decision, bool, error) {
+	var started time.Time
+	if m.hooks != nil {
+		started = queryStart(m.hooks, ipAddress)
+	}
+	rec, d, err := m.Lookup(ipAddress)
+	if m.hooks != nil {
+		queryEnd(m.hooks, ipAddress, rec, err, started)
+	}
+	if err != nil {
+		return rec, d, false, err
+	}
+
+	if m.hooks != nil {
+		event := AuditEvent{ClientIP: m.redact.apply(ipAddress), Record: rec, Decision: d, Shadow: m.shadow, Request: r}
+		for _, h := range m.hooks {
+			if h.OnDecision != nil {
+				h.OnDecision(event)
+			}
+		}
+	}
+
+	if m.shadows != nil {
+		clientIP := m.redact.apply(ipAddress)
+		for _, s := range m.shadows {
+			s.Observe(clientIP, rec, d)
+		}
+	}
+
+	if (d == DecisionDeny || d == DecisionChallenge) && m.audit != nil {
+		m.audit(AuditEvent{ClientIP: m.redact.apply(ipAddress), Record: rec, Decision: d, Shadow: m.shadow, Request: r})
+	}
+	return rec, d, d == DecisionDeny && !m.shadow, nil
+}
+
+// Enforce evaluates the request and writes the deny response if it must be blocked.
+// Otherwise it returns the request carrying the record and the decision in its context and true.
+func (m *Middleware) Enforce(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	rec, d, block, err := m.Evaluate(m.ClientIP(r), r)
+	if err != nil {
+		return r, true
+	}
+
+	if block {
+		deny := m.deny
+		if deny == nil {
+			deny = DenyWithStatus(http.StatusForbidden)
+		}
+		deny(w, r, rec)
+		return r, false
+	}
+
+	if d == DecisionChallenge && m.challenge != nil && !m.shadow {
+		m.challenge(w, r, rec)
+		return r, false
+	}
+
+	ctx := NewContext(r.Context(), rec)
+	ctx = context.WithValue(ctx, decisionContextKey, d)
+	return r.WithContext(ctx), true
+}
+
+// Handler wraps the next handler; blocked requests are answered by the deny handler.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r, ok := m.Enforce(w, r); ok {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
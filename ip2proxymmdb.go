@@ -0,0 +1,372 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"lukechampine.com/uint128"
+	"strconv"
+	"time"
+)
+
+// MaxMind DB data types
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbUint16  = 5
+	mmdbUint32  = 6
+	mmdbMap     = 7
+	mmdbUint64  = 9
+	mmdbArray   = 11
+)
+
+const mmdbMetadataMarker = "\xab\xcd\xefMaxMind.com"
+
+const msgTooManyNodes string = "Too many nodes for the MaxMind DB search tree."
+
+// builder of the MaxMind DB search tree; a record is a node index if positive,
+// the negated data index minus 1 if negative and empty if 0 (the root is never a child)
+type mmdbTree struct {
+	nodes [][2]int32
+}
+
+// ExportMMDB converts the IP ranges accepted by the filter, or all of them if filter is nil, into the
+// MaxMind DB format for tools reading maxminddb files, such as the nginx geoip2 module. The file is an
+// IPv6 tree with the IPv4 ranges in ::/96, aliased from ::ffff:0:0/96 and 2002::/16. Every record is a
+// map of is_proxy and the fields supported by the BIN file, named like the columns of the other exports.
+func (d *DB) ExportMMDB(out io.Writer, filter func(r IPRange) bool) error {
+	var t = &mmdbTree{}
+	t.nodes = make([][2]int32, 1, 1024)
+
+	records := make(map[IP2ProxyRecord]int32)
+	var order []IP2ProxyRecord
+
+	insert := func(r IPRange) error {
+		if filter != nil && !filter(r) {
+			return nil
+		}
+		id, ok := records[r.Record]
+		if !ok {
+			id = int32(len(order))
+			records[r.Record] = id
+			order = append(order, r.Record)
+		}
+
+		offset := 0
+		if r.ipType == 4 {
+			offset = 96
+		}
+		for _, b := range rangeToCIDRs(r.ipType, r.ipFrom, r.ipTo) {
+			if err := t.insert(b.ipNum, offset+b.bits, -(id + 1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// IPv4 ranges last as they replace whatever the IPv6 data has in ::/96
+	if err := d.scanRows(6, 0, func(index uint32, r IPRange) error { return insert(r) }); err != nil {
+		return err
+	}
+	if err := d.scanRows(4, 0, func(index uint32, r IPRange) error { return insert(r) }); err != nil {
+		return err
+	}
+	if d.meta.ipV4DatabaseCount > 0 {
+		v4 := t.node(uint128.Zero, 96)
+		mapped := uint128.From64(0xffff).Lsh(32)
+		if err := t.insert(mapped, 96, v4); err != nil {
+			return err
+		}
+		if err := t.insert(uint128.From64(0x2002).Lsh(112), 16, v4); err != nil {
+			return err
+		}
+	}
+	t.compact()
+
+	data, dataOffsets := d.encodeMMDBData(order)
+
+	nodeCount := uint32(len(t.nodes))
+	recordSize := 24
+	maxValue := uint64(nodeCount) + 16 + uint64(len(data))
+	if maxValue >= 1<<32 {
+		return errors.New(msgTooManyNodes)
+	} else if maxValue >= 1<<28 {
+		recordSize = 32
+	} else if maxValue >= 1<<24 {
+		recordSize = 28
+	}
+
+	w := bufio.NewWriter(out)
+	node := make([]byte, recordSize/4)
+	for _, n := range t.nodes {
+		var v [2]uint32
+		for i, rec := range n {
+			switch {
+			case rec > 0:
+				v[i] = uint32(rec)
+			case rec < 0:
+				v[i] = nodeCount + 16 + dataOffsets[-rec-1]
+			default:
+				v[i] = nodeCount
+			}
+		}
+		putMMDBNode(node, recordSize, v[0], v[1])
+		if _, err := w.Write(node); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write(make([]byte, 16)); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(mmdbMetadataMarker); err != nil {
+		return err
+	}
+	if _, err := w.Write(d.encodeMMDBMetadata(nodeCount, recordSize)); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// set the record of the prefix, pushing down the records it splits
+func (t *mmdbTree) insert(ipNum uint128.Uint128, bits int, value int32) error {
+	if bits == 0 {
+		// the root itself cannot hold data
+		if err := t.insert(uint128.Zero, 1, value); err != nil {
+			return err
+		}
+		return t.insert(uint128.From64(1).Lsh(127), 1, value)
+	}
+
+	n := int32(0)
+	for i := 0; i < bits; i++ {
+		b := ipNum.Rsh(uint(127-i)).Lo & 1
+		if i == bits-1 {
+			t.nodes[n][b] = value
+			return nil
+		}
+
+		child := t.nodes[n][b]
+		if child <= 0 {
+			if len(t.nodes) >= 1<<31-1 {
+				return errors.New(msgTooManyNodes)
+			}
+			t.nodes = append(t.nodes, [2]int32{child, child})
+			child = int32(len(t.nodes) - 1)
+			t.nodes[n][b] = child
+		}
+		n = child
+	}
+	return nil
+}
+
+// the node at the prefix, created if needed
+func (t *mmdbTree) node(ipNum uint128.Uint128, bits int) int32 {
+	n := int32(0)
+	for i := 0; i < bits; i++ {
+		b := ipNum.Rsh(uint(127-i)).Lo & 1
+		child := t.nodes[n][b]
+		if child <= 0 {
+			t.nodes = append(t.nodes, [2]int32{child, child})
+			child = int32(len(t.nodes) - 1)
+			t.nodes[n][b] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// drop the nodes no longer reachable from the root and renumber the others
+func (t *mmdbTree) compact() {
+	index := make([]int32, len(t.nodes))
+	for i := range index {
+		index[i] = -1
+	}
+
+	queue := []int32{0}
+	index[0] = 0
+	next := int32(1)
+	for i := 0; i < len(queue); i++ {
+		for _, rec := range t.nodes[queue[i]] {
+			if rec > 0 && index[rec] < 0 {
+				index[rec] = next
+				next++
+				queue = append(queue, rec)
+			}
+		}
+	}
+
+	nodes := make([][2]int32, len(queue))
+	for _, old := range queue {
+		n := t.nodes[old]
+		for i, rec := range n {
+			if rec > 0 {
+				n[i] = index[rec]
+			}
+		}
+		nodes[index[old]] = n
+	}
+	t.nodes = nodes
+}
+
+func putMMDBNode(b []byte, recordSize int, left uint32, right uint32) {
+	switch recordSize {
+	case 24:
+		b[0], b[1], b[2] = byte(left>>16), byte(left>>8), byte(left)
+		b[3], b[4], b[5] = byte(right>>16), byte(right>>8), byte(right)
+	case 28:
+		b[0], b[1], b[2] = byte(left>>16), byte(left>>8), byte(left)
+		b[3] = byte(left>>24)<<4 | byte(right>>24)&0x0f
+		b[4], b[5], b[6] = byte(right>>16), byte(right>>8), byte(right)
+	default:
+		binary.BigEndian.PutUint32(b, left)
+		binary.BigEndian.PutUint32(b[4:], right)
+	}
+}
+
+// encoder of the data section, writing repeated strings as pointers
+type mmdbEncoder struct {
+	buf     []byte
+	strings map[string]uint32
+}
+
+func (e *mmdbEncoder) control(typ int, size int) {
+	var ctrl byte
+	var ext []byte
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+	} else {
+		ctrl = byte(typ) << 5
+	}
+
+	switch {
+	case size < 29:
+		e.buf = append(e.buf, ctrl|byte(size))
+		e.buf = append(e.buf, ext...)
+	case size < 285:
+		e.buf = append(e.buf, ctrl|29)
+		e.buf = append(e.buf, ext...)
+		e.buf = append(e.buf, byte(size-29))
+	case size < 65821:
+		e.buf = append(e.buf, ctrl|30)
+		e.buf = append(e.buf, ext...)
+		e.buf = append(e.buf, byte((size-285)>>8), byte(size-285))
+	default:
+		e.buf = append(e.buf, ctrl|31)
+		e.buf = append(e.buf, ext...)
+		e.buf = append(e.buf, byte((size-65821)>>16), byte((size-65821)>>8), byte(size-65821))
+	}
+}
+
+func (e *mmdbEncoder) pointer(p uint32) {
+	switch {
+	case p < 1<<11:
+		e.buf = append(e.buf, mmdbPointer<<5|byte(p>>8), byte(p))
+	case p < 1<<19+1<<11:
+		p -= 1 << 11
+		e.buf = append(e.buf, mmdbPointer<<5|1<<3|byte(p>>16), byte(p>>8), byte(p))
+	case p < 1<<27+1<<19+1<<11:
+		p -= 1<<19 + 1<<11
+		e.buf = append(e.buf, mmdbPointer<<5|2<<3|byte(p>>24), byte(p>>16), byte(p>>8), byte(p))
+	default:
+		e.buf = append(e.buf, mmdbPointer<<5|3<<3, byte(p>>24), byte(p>>16), byte(p>>8), byte(p))
+	}
+}
+
+func (e *mmdbEncoder) string(s string) {
+	if p, ok := e.strings[s]; ok && len(s) > 2 {
+		e.pointer(p)
+		return
+	}
+	if e.strings != nil {
+		e.strings[s] = uint32(len(e.buf))
+	}
+	e.control(mmdbString, len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *mmdbEncoder) uint(typ int, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	n := 0
+	for n < 8 && b[n] == 0 {
+		n++
+	}
+	e.control(typ, 8-n)
+	e.buf = append(e.buf, b[n:]...)
+}
+
+// encode the distinct records; returns the data section and the offsets of the records
+func (d *DB) encodeMMDBData(records []IP2ProxyRecord) ([]byte, []uint32) {
+	var e = &mmdbEncoder{}
+	e.strings = make(map[string]uint32)
+	fields := d.exportFields()
+	offsets := make([]uint32, len(records))
+
+	for i := range records {
+		rec := &records[i]
+		offsets[i] = uint32(len(e.buf))
+
+		var numbers = make([]uint64, len(fields))
+		var valid = make([]bool, len(fields))
+		size := 1
+		for j, f := range fields {
+			if !f.numeric {
+				valid[j] = true
+			} else if n, err := strconv.ParseUint(f.value(rec), 10, 32); err == nil {
+				numbers[j] = n
+				valid[j] = true
+			}
+			if valid[j] {
+				size++
+			}
+		}
+
+		e.control(mmdbMap, size)
+		e.string("is_proxy")
+		e.uint(mmdbUint16, uint64(uint8(rec.IsProxy)))
+		for j, f := range fields {
+			if !valid[j] {
+				continue
+			}
+			e.string(f.name)
+			if f.numeric {
+				e.uint(mmdbUint32, numbers[j])
+			} else {
+				e.string(f.value(rec))
+			}
+		}
+	}
+	return e.buf, offsets
+}
+
+func (d *DB) encodeMMDBMetadata(nodeCount uint32, recordSize int) []byte {
+	var e = &mmdbEncoder{}
+
+	e.control(mmdbMap, 9)
+	e.string("binary_format_major_version")
+	e.uint(mmdbUint16, 2)
+	e.string("binary_format_minor_version")
+	e.uint(mmdbUint16, 0)
+	e.string("build_epoch")
+	e.uint(mmdbUint64, uint64(time.Now().Unix()))
+	e.string("database_type")
+	e.string("IP2Proxy-PX" + d.PackageVersion())
+	e.string("description")
+	e.control(mmdbMap, 1)
+	e.string("en")
+	e.string("IP2Proxy PX" + d.PackageVersion() + " " + d.DatabaseVersion())
+	e.string("ip_version")
+	e.uint(mmdbUint16, 6)
+	e.string("languages")
+	e.control(mmdbArray, 0)
+	e.string("node_count")
+	e.uint(mmdbUint32, uint64(nodeCount))
+	e.string("record_size")
+	e.uint(mmdbUint16, uint64(recordSize))
+	return e.buf
+}
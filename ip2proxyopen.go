@@ -0,0 +1,79 @@
+package ip2proxy
+
+import "os"
+
+// The FileAdvice type tells the kernel how the BIN file opened by OpenDBWithOptions will be read, so that it
+// can size the read-ahead and the page cache used accordingly. It is only applied on Linux.
+type FileAdvice int
+
+const (
+	// AdviseNormal leaves the read-ahead of the kernel as it is, the default.
+	AdviseNormal FileAdvice = iota
+	// AdviseRandom disables the read-ahead, the lookups reading a few hundred bytes at random offsets, so that
+	// a huge BIN file does not fill the page cache with rows never looked up.
+	AdviseRandom
+	// AdviseWillNeed starts reading the whole file into the page cache, for the lookups to be fast right away.
+	AdviseWillNeed
+)
+
+// The OpenOptions struct sets how OpenDBWithOptions opens the BIN file, e.g. for hosts where the page cache is
+// better kept for memory-hungry workloads.
+type OpenOptions struct {
+	Advice FileAdvice
+	// Direct reads the file with O_DIRECT, bypassing the page cache: every lookup then reads the disk, a few
+	// aligned blocks at a time. It is only supported on Linux, by file systems supporting O_DIRECT.
+	Direct bool
+}
+
+// OpenDBWithOptions opens the BIN file like OpenDB, with the options. The file is always opened read-only.
+func OpenDBWithOptions(dbPath string, opts OpenOptions) (*DB, error) {
+	f, err := openFileWithOptions(dbPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return OpenDBWithReader(f)
+}
+
+// open the file with the options, the reader keeping them for Clone
+func openFileWithOptions(dbPath string, opts OpenOptions) (dbReader, error) {
+	f, err := openFile(dbPath, opts.Direct)
+	if err != nil {
+		return nil, err
+	}
+	return withOptions(f, opts)
+}
+
+// apply the options to the file opened
+func withOptions(f *os.File, opts OpenOptions) (dbReader, error) {
+	if err := fadvise(f, opts.Advice); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if opts.Direct {
+		return newDirectReader(f, opts), nil
+	}
+	return &optionFile{File: f, opts: opts}, nil
+}
+
+// a file opened with options
+type optionFile struct {
+	*os.File
+	opts OpenOptions
+}
+
+func (f *optionFile) clone() (dbReader, error) {
+	return reopenWithOptions(f.File, f.opts)
+}
+
+// open the file again with the options, checking that it was not replaced meanwhile
+func reopenWithOptions(f *os.File, opts OpenOptions) (dbReader, error) {
+	c, err := openFile(f.Name(), opts.Direct)
+	if err != nil {
+		return nil, err
+	}
+	if err = sameFile(f, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return withOptions(c, opts)
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package ip2proxy
+
+import (
+	"os"
+	"syscall"
+)
+
+// open the file read-only, with O_DIRECT if direct
+func openFile(dbPath string, direct bool) (*os.File, error) {
+	flag := os.O_RDONLY
+	if direct {
+		flag |= syscall.O_DIRECT
+	}
+	return os.OpenFile(dbPath, flag, 0)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package ip2proxy
+
+import (
+	"errors"
+	"os"
+)
+
+const msgDirectUnsupported string = "O_DIRECT is only supported on Linux."
+
+// open the file read-only, O_DIRECT being unsupported
+func openFile(dbPath string, direct bool) (*os.File, error) {
+	if direct {
+		return nil, errors.New(msgDirectUnsupported)
+	}
+	return os.Open(dbPath)
+}
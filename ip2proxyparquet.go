@@ -0,0 +1,415 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// Parquet physical types, converted types and other enums of the format specification
+const (
+	parquetInt32          int32 = 1
+	parquetInt64          int32 = 2
+	parquetByteArray      int32 = 6
+	parquetFixedByteArray int32 = 7
+
+	parquetRequired int32 = 0
+	parquetOptional int32 = 1
+
+	parquetUTF8 int32 = 0
+	parquetInt8 int32 = 15
+
+	parquetPlain int32 = 0
+	parquetRLE   int32 = 3
+	parquetGzip  int32 = 2
+)
+
+// rows per row group
+const parquetRowGroupSize = 131072
+
+// a column of the Parquet file; value appends the PLAIN encoded value of the range, or returns false for null
+type parquetColumn struct {
+	name       string
+	ptype      int32
+	typeLength int32
+	converted  int32
+	optional   bool
+	value      func(buf []byte, r *IPRange) ([]byte, bool)
+
+	// row group being built
+	data    []byte
+	defined []bool
+	nulls   bool
+}
+
+// ExportParquet writes the IP ranges accepted by the filter, or all of them if filter is nil, in the
+// Parquet format with GZIP compressed columns. Every range is a row with the inclusive bounds both as
+// text and as 16-byte binaries (IPv4-mapped for IPv4) which sort like the addresses, followed by the
+// fields supported by the BIN file. ASN and last seen are integers, null when unknown.
+func (d *DB) ExportParquet(out io.Writer, filter func(r IPRange) bool) error {
+	columns := d.parquetColumns()
+	w := &countingWriter{w: bufio.NewWriter(out)}
+
+	if _, err := w.Write([]byte("PAR1")); err != nil {
+		return err
+	}
+
+	var rowGroups [][]byte
+	var rows int64
+	var groupRows int64
+	var totalRows int64
+
+	flush := func() error {
+		if groupRows == 0 {
+			return nil
+		}
+		rg, err := writeParquetRowGroup(w, columns, groupRows)
+		if err != nil {
+			return err
+		}
+		rowGroups = append(rowGroups, rg)
+		totalRows += groupRows
+		groupRows = 0
+		return nil
+	}
+
+	err := d.Scan(func(r IPRange) error {
+		if filter != nil && !filter(r) {
+			return nil
+		}
+		for _, c := range columns {
+			var ok bool
+			c.data, ok = c.value(c.data, &r)
+			if c.optional {
+				c.defined = append(c.defined, ok)
+			}
+		}
+		rows++
+		groupRows++
+		if groupRows == parquetRowGroupSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = flush(); err != nil {
+		return err
+	}
+
+	footer := parquetFileMetaData(columns, totalRows, rowGroups)
+	if _, err = w.Write(footer); err != nil {
+		return err
+	}
+	var tail [8]byte
+	binary.LittleEndian.PutUint32(tail[:], uint32(len(footer)))
+	copy(tail[4:], "PAR1")
+	if _, err = w.Write(tail[:]); err != nil {
+		return err
+	}
+	return w.w.(*bufio.Writer).Flush()
+}
+
+// columns of the ranges and of the fields supported by the BIN file
+func (d *DB) parquetColumns() []*parquetColumn {
+	columns := []*parquetColumn{
+		{name: "ip_version", ptype: parquetInt32, converted: -1, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			return appendUint32LE(buf, r.ipType), true
+		}},
+		{name: "ip_from", ptype: parquetByteArray, converted: parquetUTF8, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			return appendParquetString(buf, r.IPFrom.String()), true
+		}},
+		{name: "ip_to", ptype: parquetByteArray, converted: parquetUTF8, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			return appendParquetString(buf, r.IPTo.String()), true
+		}},
+		{name: "ip_from_bin", ptype: parquetFixedByteArray, typeLength: 16, converted: -1, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			return append(buf, r.IPFrom.To16()...), true
+		}},
+		{name: "ip_to_bin", ptype: parquetFixedByteArray, typeLength: 16, converted: -1, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			return append(buf, r.IPTo.To16()...), true
+		}},
+		{name: "is_proxy", ptype: parquetInt32, converted: parquetInt8, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			return appendUint32LE(buf, uint32(int32(r.Record.IsProxy))), true
+		}},
+	}
+
+	for _, f := range d.exportFields() {
+		field := f.value
+		if !f.numeric {
+			columns = append(columns, &parquetColumn{name: f.name, ptype: parquetByteArray, converted: parquetUTF8, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+				return appendParquetString(buf, field(&r.Record)), true
+			}})
+			continue
+		}
+
+		columns = append(columns, &parquetColumn{name: f.name, ptype: parquetInt64, converted: -1, optional: true, value: func(buf []byte, r *IPRange) ([]byte, bool) {
+			n, err := strconv.ParseInt(field(&r.Record), 10, 64)
+			if err != nil {
+				return buf, false
+			}
+			return appendUint64LE(buf, uint64(n)), true
+		}})
+	}
+	return columns
+}
+
+// write a column chunk of a single data page per column; returns the encoded RowGroup struct
+func writeParquetRowGroup(w *countingWriter, columns []*parquetColumn, rows int64) ([]byte, error) {
+	var chunks [][]byte
+	var totalSize int64
+
+	for _, c := range columns {
+		page := c.data
+		if c.optional {
+			page = append(encodeParquetLevels(c.defined), c.data...)
+		}
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(page); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		t := &thriftWriter{}
+		t.i32(1, 0) // DATA_PAGE
+		t.i32(2, int32(len(page)))
+		t.i32(3, int32(compressed.Len()))
+		t.structBegin(5)
+		t.i32(1, int32(rows))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.structEnd()
+		t.stop()
+
+		offset := w.n
+		if _, err := w.Write(t.buf); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(compressed.Bytes()); err != nil {
+			return nil, err
+		}
+		uncompressedSize := int64(len(t.buf) + len(page))
+		compressedSize := int64(len(t.buf) + compressed.Len())
+		totalSize += uncompressedSize
+
+		// ColumnChunk
+		cc := &thriftWriter{}
+		cc.i64(2, offset)
+		cc.structBegin(3)
+		cc.i32(1, c.ptype)
+		cc.listBegin(2, thriftI32, 2)
+		cc.listI32(parquetPlain)
+		cc.listI32(parquetRLE)
+		cc.listBegin(3, thriftBinary, 1)
+		cc.listString(c.name)
+		cc.i32(4, parquetGzip)
+		cc.i64(5, rows)
+		cc.i64(6, uncompressedSize)
+		cc.i64(7, compressedSize)
+		cc.i64(9, offset)
+		cc.structEnd()
+		cc.stop()
+		chunks = append(chunks, cc.buf)
+
+		c.data = c.data[:0]
+		c.defined = c.defined[:0]
+	}
+
+	// RowGroup
+	rg := &thriftWriter{}
+	rg.listBegin(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		rg.buf = append(rg.buf, chunk...)
+	}
+	rg.i64(2, totalSize)
+	rg.i64(3, rows)
+	rg.stop()
+	return rg.buf, nil
+}
+
+// encode the FileMetaData struct of the footer
+func parquetFileMetaData(columns []*parquetColumn, rows int64, rowGroups [][]byte) []byte {
+	t := &thriftWriter{}
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(columns)+1)
+	t.listStructBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(columns)))
+	t.listStructEnd()
+	for _, c := range columns {
+		t.listStructBegin()
+		t.i32(1, c.ptype)
+		if c.typeLength > 0 {
+			t.i32(2, c.typeLength)
+		}
+		if c.optional {
+			t.i32(3, parquetOptional)
+		} else {
+			t.i32(3, parquetRequired)
+		}
+		t.binary(4, c.name)
+		if c.converted >= 0 {
+			t.i32(6, c.converted)
+		}
+		t.listStructEnd()
+	}
+
+	t.i64(3, rows)
+
+	t.listBegin(4, thriftStruct, len(rowGroups))
+	for _, rg := range rowGroups {
+		t.buf = append(t.buf, rg...)
+	}
+
+	t.binary(6, "ip2proxy-go version "+moduleVersion)
+	t.stop()
+	return t.buf
+}
+
+// definition levels as RLE runs of bit width 1, prefixed by their length
+func encodeParquetLevels(defined []bool) []byte {
+	buf := make([]byte, 4, 16)
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		buf = appendUvarint(buf, uint64(j-i)<<1)
+		if defined[i] {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)-4))
+	return buf
+}
+
+func appendParquetString(buf []byte, s string) []byte {
+	buf = appendUint32LE(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func appendUint32LE(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64LE(buf []byte, v uint64) []byte {
+	return appendUint32LE(appendUint32LE(buf, uint32(v)), uint32(v>>32))
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// minimal Thrift compact protocol encoder for the Parquet metadata
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+	stack  []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = appendUvarint(t.buf, uint64(uint16((id<<1)^(id>>15))))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = appendUvarint(t.buf, uint64(uint32((v<<1)^(v>>31))))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = appendUvarint(t.buf, uint64((v<<1)^(v>>63)))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.buf = appendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.listStructBegin()
+}
+
+func (t *thriftWriter) structEnd() {
+	t.listStructEnd()
+}
+
+// begin a struct element of a list
+func (t *thriftWriter) listStructBegin() {
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) listStructEnd() {
+	t.stop()
+	t.lastID = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.buf = appendUvarint(t.buf, uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.buf = appendUvarint(t.buf, uint64(uint32((v<<1)^(v>>31))))
+}
+
+func (t *thriftWriter) listString(s string) {
+	t.buf = appendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+// writer keeping track of the offset
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+package ip2proxy
+
+// the proxy types hiding the client: public, web, VPN, Tor, residential, consumer privacy and enterprise private networks
+var anonymizerTypes = []string{"VPN", "TOR", "PUB", "WEB", "RES", "CPN", "EPN"}
+
+// BlockAnonymizers denies the proxy types hiding the client, i.e. VPN, TOR, PUB, WEB, RES, CPN and EPN, while data
+// center ranges and search engine robots are left to the next policy.
+func BlockAnonymizers() Policy {
+	return matchProxyTypes(anonymizerTypes, DecisionDeny)
+}
+
+// BlockAnonymizersExceptRES denies the proxy types hiding the client like BlockAnonymizers, except residential
+// proxies, whose addresses are shared with regular users.
+func BlockAnonymizersExceptRES() Policy {
+	var types []string
+	for _, t := range anonymizerTypes {
+		if t != "RES" {
+			types = append(types, t)
+		}
+	}
+	return matchProxyTypes(types, DecisionDeny)
+}
+
+// ChallengeDCH challenges the data center ranges, DCH.
+func ChallengeDCH() Policy {
+	return matchProxyTypes([]string{"DCH"}, DecisionChallenge)
+}
+
+// InCountries applies the policy to the records of the countries only, e.g. InCountries(BlockAnonymizers(), "RU", "CN").
+// The country codes are normalized by NormalizeCountryCode.
+func InCountries(policy Policy, codes ...string) Policy {
+	set := countrySet(codes)
+	return func(rec IP2ProxyRecord) Decision {
+		if code, ok := NormalizeCountryCode(rec.CountryShort); ok && set[code] {
+			return policy(rec)
+		}
+		return DecisionNone
+	}
+}
+
+// ExceptCountries applies the policy to the records of the other countries, including those without a country.
+func ExceptCountries(policy Policy, codes ...string) Policy {
+	set := countrySet(codes)
+	return func(rec IP2ProxyRecord) Decision {
+		if code, ok := NormalizeCountryCode(rec.CountryShort); ok && set[code] {
+			return DecisionNone
+		}
+		return policy(rec)
+	}
+}
+
+func countrySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		c, _ = NormalizeCountryCode(c)
+		set[c] = true
+	}
+	return set
+}
+
+// FilterPolicy returns the decision for the records selected by the filter, e.g.
+// FilterPolicy(filter, DecisionDeny) with the filter "proxy_type in (VPN, TOR) && threat != -".
+func FilterPolicy(filter *Filter, d Decision) Policy {
+	return func(rec IP2ProxyRecord) Decision {
+		if filter.Match(rec) {
+			return d
+		}
+		return DecisionNone
+	}
+}
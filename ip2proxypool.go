@@ -0,0 +1,65 @@
+package ip2proxy
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// a record with the buffer holding its strings
+type pooledRecord struct {
+	rec   IP2ProxyRecord // first, so that a pointer to the record is a pointer to the pooledRecord
+	arena []byte
+}
+
+// arenas grown past this size by long strings are not kept in the pool
+const maxPooledArena = 4096
+
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		var p = &pooledRecord{}
+		p.arena = make([]byte, 0, 512)
+		return p
+	},
+}
+
+// the bytes as a string, copied into the arena unless nil; the string points into the arena, which is only
+// appended to until the record is released, a reallocation leaving the earlier strings in the previous array
+func arenaString(arena *[]byte, b []byte) string {
+	if arena == nil {
+		return string(b)
+	}
+	start := len(*arena)
+	*arena = append(*arena, b...)
+	return convertBytesToString((*arena)[start:len(*arena):len(*arena)])
+}
+
+// AcquireRecord returns an empty record from the pool, to be given back with ReleaseRecord.
+func AcquireRecord() *IP2ProxyRecord {
+	return &recordPool.Get().(*pooledRecord).rec
+}
+
+// ReleaseRecord gives back to the pool a record returned by AcquireRecord or GetAllPooled. The record and its
+// strings must not be used afterwards, and it must not be released twice. Records from anywhere else, e.g.
+// the address of a record returned by GetAll, must never be released.
+func ReleaseRecord(x *IP2ProxyRecord) {
+	p := (*pooledRecord)(unsafe.Pointer(x))
+	p.rec = IP2ProxyRecord{}
+	if cap(p.arena) > maxPooledArena {
+		return
+	}
+	p.arena = p.arena[:0]
+	recordPool.Put(p)
+}
+
+// GetAllPooled will return all proxy fields based on the queried IP address like GetAll, in a record from the
+// pool, for the pipelines processing millions of records and discarding them right away. The strings of the
+// record are held in a buffer of the record instead of being allocated one by one, so they are only valid
+// until the record is given back with ReleaseRecord, even if assigned to other variables or passed to the
+// hooks; strings.Clone copies those to keep. The record is returned with the error too, and must be released
+// in any case.
+func (d *DB) GetAllPooled(ipAddress string) (*IP2ProxyRecord, error) {
+	p := recordPool.Get().(*pooledRecord)
+	var err error
+	p.rec, _, err = d.queryRangeInto(ipAddress, all, &p.arena)
+	return &p.rec, err
+}
@@ -0,0 +1,14 @@
+package ip2proxy
+
+import "strings"
+
+// FindRangesByProvider scans the BIN file for the ranges attributed to the proxy provider, e.g. a VPN service,
+// matched without regard to case, in ascending order, the IPv4 ranges first. Comparing the ranges of monthly
+// releases shows how the footprint of the provider changes. It requires the provider field (PX11) and reads
+// the whole file.
+func (d *DB) FindRangesByProvider(name string) ([]IPRange, error) {
+	name = strings.TrimSpace(name)
+	return d.findRanges(FieldProvider, func(rec *IP2ProxyRecord) bool {
+		return strings.EqualFold(rec.Provider, name)
+	})
+}
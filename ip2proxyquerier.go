@@ -0,0 +1,127 @@
+package ip2proxy
+
+// The QuerierStats struct holds the counters of a Querier. Hits are the lookups answered by the last match.
+type QuerierStats struct {
+	Lookups uint64
+	Hits    uint64
+	Errors  uint64
+}
+
+// the last match of a Querier, for an IP version
+type querierMatch struct {
+	r       ipRange
+	rec     IP2ProxyRecord
+	inArena bool // the strings of rec are in the arena
+}
+
+// The Querier struct queries a DB with state of its own: the buffer holding the strings of Lookup, the last
+// matched range of each IP version and counters. It is not safe for concurrent use; every goroutine gets its
+// own from DB.NewQuerier instead, the DB being safe for concurrent use, so that the state is reused without
+// locks. The addresses within the last matched range, e.g. consecutive addresses of the same client or
+// subnet, are answered without reading the BIN file.
+type Querier struct {
+	db    *DB
+	arena []byte
+	rec   IP2ProxyRecord // returned by Lookup
+	last  [2]querierMatch
+	stats QuerierStats
+}
+
+// NewQuerier returns a Querier of the DB, to be used by a single goroutine at a time.
+func (d *DB) NewQuerier() *Querier {
+	var q = &Querier{}
+	q.db = d
+	q.arena = make([]byte, 0, 512)
+	return q
+}
+
+// GetAll will return all proxy fields based on the queried IP address, like DB.GetAll.
+func (q *Querier) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	if m := q.match(ipAddress); m != nil && !m.inArena {
+		return q.hit(ipAddress, m.rec), nil
+	}
+	return q.miss(ipAddress, nil)
+}
+
+// Lookup will return all proxy fields based on the queried IP address like GetAll, the record and its strings
+// being held by the Querier instead of being allocated, like with GetAllPooled. They are only valid until its
+// next lookup; strings.Clone copies those to keep.
+func (q *Querier) Lookup(ipAddress string) (*IP2ProxyRecord, error) {
+	if m := q.match(ipAddress); m != nil {
+		q.rec = q.hit(ipAddress, m.rec)
+		return &q.rec, nil
+	}
+
+	// the strings of the last matches in the arena are overwritten
+	for i := range q.last {
+		if q.last[i].inArena {
+			q.last[i] = querierMatch{}
+		}
+	}
+	if cap(q.arena) > maxPooledArena {
+		q.arena = make([]byte, 0, 512)
+	}
+	q.arena = q.arena[:0]
+	var err error
+	q.rec, err = q.miss(ipAddress, &q.arena)
+	return &q.rec, err
+}
+
+// Stats returns the counters.
+func (q *Querier) Stats() QuerierStats {
+	return q.stats
+}
+
+// Reset forgets the last matches, e.g. after the DB was closed and another one opened, and zeroes the counters.
+func (q *Querier) Reset() {
+	q.last = [2]querierMatch{}
+	q.stats = QuerierStats{}
+}
+
+// the last match containing the IP address, if any
+func (q *Querier) match(ipAddress string) *querierMatch {
+	if q.db.isClosed() {
+		return nil
+	}
+	ipType, ipNum := ipToNum(ipAddress)
+	if ipType == 0 {
+		return nil
+	}
+	m := &q.last[querierSlot(ipType)]
+	if !m.r.contains(ipType, ipNum) {
+		return nil
+	}
+	return m
+}
+
+// count a lookup answered by the last match, invoking the hooks like the other lookups
+func (q *Querier) hit(ipAddress string, rec IP2ProxyRecord) IP2ProxyRecord {
+	q.stats.Lookups++
+	q.stats.Hits++
+	if hooks := q.db.hooks; hooks != nil {
+		queryEnd(hooks, ipAddress, rec, nil, queryStart(hooks, ipAddress))
+	}
+	return rec
+}
+
+// look up the IP address in the DB and remember the match, the strings copied into the arena unless nil
+func (q *Querier) miss(ipAddress string, arena *[]byte) (IP2ProxyRecord, error) {
+	q.stats.Lookups++
+	rec, r, err := q.db.queryRangeInto(ipAddress, all, arena)
+	if err != nil {
+		q.stats.Errors++
+		return rec, err
+	}
+	if r.ipType != 0 {
+		q.last[querierSlot(r.ipType)] = querierMatch{r: r, rec: rec, inArena: arena != nil}
+	}
+	return rec, nil
+}
+
+// slot of the last match of the IP version
+func querierSlot(ipType uint32) int {
+	if ipType == 6 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,21 @@
+package ip2proxy
+
+// LookupRange will return the range of the BIN file containing the queried IP address, with its proxy fields,
+// e.g. to compare the boundaries with the ip_from and ip_to columns of the CSV files. The range is empty with the
+// message in its record when nothing matches, e.g. for invalid addresses.
+//
+// The ranges are matched as follows, identically by all the lookups of the package. A row of a BIN file holds the
+// IP From of its range, the range ending before the IP From of the next row: the row matches the IP numbers
+// from its IP From included to the next IP From excluded. IPTo is that next IP From minus one, the inclusive ip_to
+// of the CSV files. The next IP From of the last row is the maximum IP number, 255.255.255.255 or
+// ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff, which the last range includes. The IPv4-mapped, 6to4 and Teredo IPv6
+// addresses are looked up in the IPv4 ranges, by their IPv4 address, so their range is an IPv4 range.
+func (d *DB) LookupRange(ipAddress string) (IPRange, error) {
+	rec, r, err := d.queryRange(ipAddress, all)
+	if err != nil || r.ipType == 0 {
+		return IPRange{Record: rec}, err
+	}
+
+	last := r.last()
+	return IPRange{IPFrom: numToIP(r.ipType, r.ipFrom), IPTo: numToIP(r.ipType, last), Record: rec, ipType: r.ipType, ipFrom: r.ipFrom, ipTo: last}, nil
+}
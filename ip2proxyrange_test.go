@@ -0,0 +1,107 @@
+package ip2proxy
+
+import (
+	"testing"
+
+	"lukechampine.com/uint128"
+)
+
+// ipFrom and ipTo-1 are in the range, ipTo in the next one, the maximum addresses in the last range whether it is
+// a proxy range or not
+func TestRangeBoundaries(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges [][3]string
+		checks []struct{ ip, proxyType, from, to string }
+	}{
+		{
+			name: "proxy ranges at the maximum addresses",
+			ranges: [][3]string{
+				{"1.2.3.0", "1.2.3.255", "VPN"},
+				{"255.255.255.0", "255.255.255.255", "TOR"},
+				{"2001:db8::", "2001:db8::ffff", "VPN"},
+				{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "TOR"},
+			},
+			checks: []struct{ ip, proxyType, from, to string }{
+				{"1.2.2.255", "-", "0.0.0.0", "1.2.2.255"},
+				{"1.2.3.0", "VPN", "1.2.3.0", "1.2.3.255"},
+				{"1.2.3.255", "VPN", "1.2.3.0", "1.2.3.255"},
+				{"1.2.4.0", "-", "1.2.4.0", "255.255.254.255"},
+				{"255.255.254.255", "-", "1.2.4.0", "255.255.254.255"},
+				{"255.255.255.0", "TOR", "255.255.255.0", "255.255.255.255"},
+				{"255.255.255.254", "TOR", "255.255.255.0", "255.255.255.255"},
+				{"255.255.255.255", "TOR", "255.255.255.0", "255.255.255.255"},
+				{"2001:db8::", "VPN", "2001:db8::", "2001:db8::ffff"},
+				{"2001:db8::ffff", "VPN", "2001:db8::", "2001:db8::ffff"},
+				{"2001:db8::1:0", "-", "2001:db8::1:0", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:feff"},
+				{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "TOR", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+				{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", "TOR", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+				{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "TOR", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+				{"::ffff:255.255.255.255", "TOR", "255.255.255.0", "255.255.255.255"},
+			},
+		},
+		{
+			name: "no proxy range at the maximum addresses",
+			ranges: [][3]string{
+				{"0.0.0.0", "0.0.0.0", "VPN"},
+				{"0.0.0.1", "0.0.0.1", "TOR"},
+				{"::", "::", "VPN"},
+			},
+			checks: []struct{ ip, proxyType, from, to string }{
+				{"0.0.0.0", "VPN", "0.0.0.0", "0.0.0.0"},
+				{"0.0.0.1", "TOR", "0.0.0.1", "0.0.0.1"},
+				{"0.0.0.2", "-", "0.0.0.2", "255.255.255.255"},
+				{"255.255.255.255", "-", "0.0.0.2", "255.255.255.255"},
+				{"::", "VPN", "::", "::"},
+				{"::1", "-", "::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+				{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "-", "::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		db := openTestBIN(t, newTestWriter(t, 2, tt.ranges...))
+		for _, c := range tt.checks {
+			got, err := db.GetProxyType(c.ip)
+			if err != nil || got != c.proxyType {
+				t.Errorf("%s, %s: %q (%v) instead of %q", tt.name, c.ip, got, err, c.proxyType)
+			}
+
+			r, err := db.LookupRange(c.ip)
+			if err != nil {
+				t.Errorf("%s, %s: %v", tt.name, c.ip, err)
+				continue
+			}
+			if r.IPFrom.String() != c.from || r.IPTo.String() != c.to || r.Record.ProxyType != c.proxyType {
+				t.Errorf("%s, %s: %s-%s %q instead of %s-%s %q", tt.name, c.ip, r.IPFrom, r.IPTo, r.Record.ProxyType, c.from, c.to, c.proxyType)
+			}
+		}
+	}
+}
+
+// the range matched contains its first and last addresses only, the maximum addresses included at the end
+func TestRangeContains(t *testing.T) {
+	max4, max6 := maxIPV4Range, maxIPV6Range
+	tests := []struct {
+		r        ipRange
+		ipType   uint32
+		ipNum    uint128.Uint128
+		contains bool
+	}{
+		{ipRange{4, uint128.From64(256), uint128.From64(512)}, 4, uint128.From64(255), false},
+		{ipRange{4, uint128.From64(256), uint128.From64(512)}, 4, uint128.From64(256), true},
+		{ipRange{4, uint128.From64(256), uint128.From64(512)}, 4, uint128.From64(511), true},
+		{ipRange{4, uint128.From64(256), uint128.From64(512)}, 4, uint128.From64(512), false},
+		{ipRange{4, uint128.From64(256), uint128.From64(512)}, 6, uint128.From64(256), false},
+		{ipRange{4, uint128.From64(256), max4}, 4, max4.Sub64(1), true},
+		{ipRange{4, uint128.From64(256), max4}, 4, max4, true},
+		{ipRange{6, uint128.From64(256), max6}, 6, max6.Sub64(1), true},
+		{ipRange{6, uint128.From64(256), max6}, 6, max6, true},
+		{ipRange{6, uint128.From64(256), max6.Sub64(1)}, 6, max6.Sub64(1), false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.contains(tt.ipType, tt.ipNum); got != tt.contains {
+			t.Errorf("%+v contains IPv%d %s: %v", tt.r, tt.ipType, tt.ipNum, got)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package ip2proxy
+
+// SetReadAhead sets the number of bytes of rows the binary search reads at once, e.g. 4096 or 65536, so that
+// it reads the remaining rows in a single call once they fit, instead of one call per step. On high-latency
+// storage like network volumes, this trades bandwidth for fewer reads. It has no effect on the BIN files in
+// memory and is disabled with 0, the default. It must be called before any lookup.
+func (d *DB) SetReadAhead(size uint32) *DB {
+	if d.data == nil {
+		d.readAhead = size
+	}
+	return d
+}
@@ -0,0 +1,194 @@
+package ip2proxy
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// The FieldChange struct describes a field which differs between two proxy records.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// the string fields of the records in declaration order
+var recordFields = []struct {
+	name string
+	get  func(r *IP2ProxyRecord) string
+}{
+	{"CountryShort", func(r *IP2ProxyRecord) string { return r.CountryShort }},
+	{"CountryLong", func(r *IP2ProxyRecord) string { return r.CountryLong }},
+	{"Region", func(r *IP2ProxyRecord) string { return r.Region }},
+	{"City", func(r *IP2ProxyRecord) string { return r.City }},
+	{"Isp", func(r *IP2ProxyRecord) string { return r.Isp }},
+	{"ProxyType", func(r *IP2ProxyRecord) string { return r.ProxyType }},
+	{"Domain", func(r *IP2ProxyRecord) string { return r.Domain }},
+	{"UsageType", func(r *IP2ProxyRecord) string { return r.UsageType }},
+	{"Asn", func(r *IP2ProxyRecord) string { return r.Asn }},
+	{"As", func(r *IP2ProxyRecord) string { return r.As }},
+	{"LastSeen", func(r *IP2ProxyRecord) string { return r.LastSeen }},
+	{"Threat", func(r *IP2ProxyRecord) string { return r.Threat }},
+	{"Provider", func(r *IP2ProxyRecord) string { return r.Provider }},
+}
+
+// sentinel messages are treated as empty values
+func fieldValue(v string) string {
+	switch v {
+	case msgNotSupported, msgInvalidIP, msgMissingFile, msgIPV6Unsupported:
+		return ""
+	}
+	return v
+}
+
+// Equal checks whether both records hold the same data. Fields not supported by the database
+// or carrying another sentinel message compare equal to empty fields, so records from different
+// database types can be compared.
+func (r IP2ProxyRecord) Equal(other IP2ProxyRecord) bool {
+	if r.IsProxy != other.IsProxy {
+		return false
+	}
+	for _, f := range recordFields {
+		if fieldValue(f.get(&r)) != fieldValue(f.get(&other)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a 64-bit FNV-1a hash of the record. Records which are Equal have the same hash.
+func (r IP2ProxyRecord) Hash() uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 0, 256)
+	buf = strconv.AppendInt(buf, int64(r.IsProxy), 10)
+	for _, f := range recordFields {
+		// the separator cannot occur in the fields
+		buf = append(buf, 0)
+		buf = append(buf, fieldValue(f.get(&r))...)
+	}
+	_, _ = h.Write(buf)
+	return h.Sum64()
+}
+
+// Diff returns the fields which differ from the other record, with the values of this record as Old
+// and those of the other record as New. Sentinel messages are reported as empty values; the result
+// is empty if the records are Equal.
+func (r IP2ProxyRecord) Diff(other IP2ProxyRecord) []FieldChange {
+	var changes []FieldChange
+	if r.IsProxy != other.IsProxy {
+		changes = append(changes, FieldChange{Field: "IsProxy", Old: strconv.Itoa(int(r.IsProxy)), New: strconv.Itoa(int(other.IsProxy))})
+	}
+	for _, f := range recordFields {
+		o, n := fieldValue(f.get(&r)), fieldValue(f.get(&other))
+		if o != n {
+			changes = append(changes, FieldChange{Field: f.name, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// The ValidationError struct lists the inconsistencies found in a record.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid proxy record: " + strings.Join(e.Problems, "; ") + "."
+}
+
+// Validate checks the record for impossible combinations of fields, such as a proxy without proxy type,
+// to catch corrupt BIN files and decoding bugs early. Records of failed lookups are valid. It returns nil
+// or a *ValidationError.
+func (r IP2ProxyRecord) Validate() error {
+	var problems []string
+	if r.IsProxy == -1 {
+		for _, f := range recordFields {
+			if f.get(&r) != r.CountryShort {
+				problems = append(problems, f.name+" must hold the message of the failed lookup")
+			}
+		}
+		return validationError(problems)
+	}
+
+	supported := func(v string) bool {
+		return v != msgNotSupported
+	}
+
+	switch {
+	case r.IsProxy < 0 || r.IsProxy > 2:
+		problems = append(problems, "IsProxy must be 0, 1 or 2")
+	case supported(r.ProxyType):
+		dataCenter := r.ProxyType == "DCH" || r.ProxyType == "SES"
+		if r.IsProxy == 0 && r.ProxyType != "-" && r.ProxyType != "" {
+			problems = append(problems, "ProxyType is set but IsProxy is 0")
+		}
+		if r.IsProxy != 0 && r.ProxyType == "-" {
+			problems = append(problems, "IsProxy is set but ProxyType is not")
+		}
+		if r.IsProxy == 1 && dataCenter {
+			problems = append(problems, "IsProxy must be 2 for ProxyType "+r.ProxyType)
+		}
+		if r.IsProxy == 2 && !dataCenter && r.ProxyType != "-" && r.ProxyType != "" {
+			problems = append(problems, "IsProxy must be 1 for ProxyType "+r.ProxyType)
+		}
+	}
+
+	if supported(r.CountryShort) != supported(r.CountryLong) {
+		problems = append(problems, "CountryShort and CountryLong must both be supported")
+	} else if supported(r.CountryShort) {
+		if (r.CountryShort == "-") != (r.CountryLong == "-") {
+			problems = append(problems, "CountryShort and CountryLong must both be set")
+		}
+		if r.CountryShort != "-" && len(r.CountryShort) != 2 {
+			problems = append(problems, "CountryShort must be 2 characters")
+		}
+	}
+
+	for _, f := range []struct {
+		name  string
+		value string
+	}{
+		{"Asn", r.Asn},
+		{"LastSeen", r.LastSeen},
+	} {
+		if supported(f.value) && f.value != "-" && f.value != "" {
+			if _, err := strconv.ParseUint(f.value, 10, 32); err != nil {
+				problems = append(problems, f.name+" must be a number")
+			}
+		}
+	}
+	return validationError(problems)
+}
+
+// ValidateLayout validates the record like Validate and also checks that exactly the fields of the layout are supported,
+// e.g. that no threat is set for a database type without the threat column.
+func (r IP2ProxyRecord) ValidateLayout(l Layout) error {
+	err := r.Validate()
+	if r.IsProxy == -1 {
+		return err
+	}
+
+	var problems []string
+	if err != nil {
+		problems = err.(*ValidationError).Problems
+	}
+
+	columns := []uint8{l.Country, l.Country, l.Region, l.City, l.Isp, l.ProxyType, l.Domain, l.UsageType, l.Asn, l.As, l.LastSeen, l.Threat, l.Provider}
+	for i, f := range recordFields {
+		v := f.get(&r)
+		if columns[i] == 0 && v != msgNotSupported {
+			problems = append(problems, f.name+" is set but not in the layout of PX"+strconv.Itoa(int(l.DatabaseType)))
+		} else if columns[i] != 0 && v == msgNotSupported {
+			problems = append(problems, f.name+" is missing from the layout of PX"+strconv.Itoa(int(l.DatabaseType)))
+		}
+	}
+	return validationError(problems)
+}
+
+func validationError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
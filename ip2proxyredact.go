@@ -0,0 +1,76 @@
+package ip2proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+// The Redactor type rewrites the queried IP addresses which the package puts in traces, errors and audit
+// events, e.g. to truncate or pseudonymize them for data minimization. The lookups are not affected.
+type Redactor func(ipAddress string) string
+
+// returned by the redactors for the strings which are not IP addresses, which may hold anything
+const redactedInvalid = "-"
+
+// RedactTruncate keeps the first ipv4Bits of the IPv4 addresses and ipv6Bits of the IPv6 addresses,
+// zeroing the others, e.g. 24 and 48 to keep the network only: 192.0.2.10 becomes 192.0.2.0. With bit
+// counts out of range, every address is redacted to "-".
+func RedactTruncate(ipv4Bits int, ipv6Bits int) Redactor {
+	v4 := net.CIDRMask(ipv4Bits, 32)
+	v6 := net.CIDRMask(ipv6Bits, 128)
+	return func(ipAddress string) string {
+		ip := net.ParseIP(ipAddress)
+		if ip == nil || v4 == nil || v6 == nil {
+			return redactedInvalid
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(v4).String()
+		}
+		return ip.Mask(v6).String()
+	}
+}
+
+// RedactHash replaces the IP addresses by the first 16 bytes of their HMAC-SHA256 with the key, in hex.
+// The same address always gives the same pseudonym for a key, so that requests can be correlated without
+// the address; the key must be kept secret, the IPv4 addresses being few enough to be hashed exhaustively.
+func RedactHash(key []byte) Redactor {
+	key = append([]byte(nil), key...)
+	return func(ipAddress string) string {
+		ip := net.ParseIP(ipAddress)
+		if ip == nil {
+			return redactedInvalid
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(ip.To16())
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+}
+
+// apply the redactor, if any
+func (r Redactor) apply(ipAddress string) string {
+	if r == nil || ipAddress == "" {
+		return ipAddress
+	}
+	return r(ipAddress)
+}
+
+// SetRedactor sets the redactor applied to the IP addresses of the traces. The IP number of the query
+// is then left out, the IP ranges of the steps being those of the BIN file.
+func (d *DB) SetRedactor(redact Redactor) *DB {
+	d.redact = redact
+	return d
+}
+
+// SetRedactor sets the redactor applied to the client IP addresses of the audit events.
+func (m *Middleware) SetRedactor(redact Redactor) *Middleware {
+	m.redact = redact
+	return m
+}
+
+// SetRedactor sets the redactor applied to the IP addresses of the WSError errors.
+func (w *WS) SetRedactor(redact Redactor) *WS {
+	w.redact = redact
+	return w
+}
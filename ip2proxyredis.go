@@ -0,0 +1,186 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The RedisCache struct is a Cache backed by a Redis server, letting a fleet of
+// processes share lookup results. It speaks the Redis protocol directly and keeps
+// a small pool of idle connections.
+type RedisCache struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+const redisMaxIdle = 8
+
+// NewRedisCache initializes with the address (host:port) of the Redis server, the password
+// (empty if not required) and the database number to select.
+func NewRedisCache(addr string, password string, db int) *RedisCache {
+	var c = &RedisCache{}
+	c.addr = addr
+	c.password = password
+	c.db = db
+	c.timeout = 5 * time.Second
+	c.idle = make(chan *redisConn, redisMaxIdle)
+	return c
+}
+
+// Get returns the cached value for the key.
+func (c *RedisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	return reply, true, nil
+}
+
+// Set stores the value for the key. The TTL is rounded up to the millisecond, the precision of Redis.
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	var err error
+	if ttl > 0 {
+		_, err = c.do("SET", key, string(value), "PX", strconv.FormatInt(int64((ttl+time.Millisecond-1)/time.Millisecond), 10))
+	} else {
+		_, err = c.do("SET", key, string(value))
+	}
+	return err
+}
+
+// Close closes the idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case rc := <-c.idle:
+			_ = rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get an idle connection or dial a new one
+func (c *RedisCache) getConn() (*redisConn, error) {
+	select {
+	case rc := <-c.idle:
+		return rc, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if c.password != "" {
+		if _, err = rc.do(c.timeout, "AUTH", c.password); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err = rc.do(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// run a command on a pooled connection
+func (c *RedisCache) do(args ...string) ([]byte, error) {
+	rc, err := c.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := rc.do(c.timeout, args...)
+	if err != nil {
+		var rerr redisError
+		if !errors.As(err, &rerr) {
+			// the connection state is unknown after I/O errors
+			_ = rc.conn.Close()
+			return nil, err
+		}
+	}
+
+	select {
+	case c.idle <- rc:
+	default:
+		_ = rc.conn.Close()
+	}
+	return reply, err
+}
+
+// error reply from the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// send a command and read the reply; nil reply for nil bulk strings
+func (rc *redisConn) do(timeout time.Duration, args ...string) ([]byte, error) {
+	_ = rc.conn.SetDeadline(time.Now().Add(timeout))
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := rc.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("redis: invalid reply")
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(rc.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, errors.New("redis: unexpected reply " + line)
+}
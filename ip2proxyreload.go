@@ -0,0 +1,230 @@
+package ip2proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// The Flusher interface is implemented by caches which can drop all of their entries.
+type Flusher interface {
+	Flush() error
+}
+
+// The ReloadableDB struct wraps a DB which can be replaced by a newer BIN file while
+// lookups are in progress. Every swap increments the generation and invalidates the attached caches.
+type ReloadableDB struct {
+	mu         sync.RWMutex
+	db         *DB
+	generation uint64
+	caches     []Cache
+	telemetry  Telemetry // set on the DBs swapped in
+	hooks      []Hooks   // added to the DBs swapped in
+	churn      *churnAlert
+	canary     *canary
+	open       *OpenOptions // of the files opened by Reload
+}
+
+// OpenReloadableDB takes the path to the IP2Proxy BIN database file and opens it as the first generation.
+func OpenReloadableDB(dbPath string) (*ReloadableDB, error) {
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReloadableDB(db), nil
+}
+
+// NewReloadableDB wraps an already opened DB.
+func NewReloadableDB(db *DB) *ReloadableDB {
+	var r = &ReloadableDB{}
+	r.db = db
+	r.generation = 1
+	return r
+}
+
+// SetOpenOptions makes Reload open the BIN files with the options, see OpenDBWithOptions. It must be called
+// before any reload.
+func (r *ReloadableDB) SetOpenOptions(opts OpenOptions) *ReloadableDB {
+	r.open = &opts
+	return r
+}
+
+// open the BIN file with the options of SetOpenOptions, if any
+func (r *ReloadableDB) openFile(dbPath string) (*DB, error) {
+	if r.open != nil {
+		return OpenDBWithOptions(dbPath, *r.open)
+	}
+	return OpenDB(dbPath)
+}
+
+// Reload opens the BIN file at the given path and swaps it in. The current DB is kept if the new file is invalid.
+func (r *ReloadableDB) Reload(dbPath string) error {
+	db, err := r.openFile(dbPath)
+	if err != nil {
+		return err
+	}
+
+	return r.Swap(db)
+}
+
+// ReloadVerified opens the BIN file at the given path and swaps it in if its signature is valid.
+func (r *ReloadableDB) ReloadVerified(dbPath string, sigPath string, keys KeyProvider) error {
+	db, err := OpenDBVerified(dbPath, sigPath, keys)
+	if err != nil {
+		return err
+	}
+
+	return r.Swap(db)
+}
+
+// Swap replaces the current DB with the given one and closes the previous DB once no lookup is using it.
+// Attached caches implementing Flusher are flushed; cache keys of the other caches are tagged with the generation.
+// With SetCanary, the DB is only swapped in once the canary period is over.
+func (r *ReloadableDB) Swap(db *DB) error {
+	if r.startCanary(db) {
+		return nil
+	}
+	return r.swap(db)
+}
+
+func (r *ReloadableDB) swap(db *DB) error {
+	r.mu.Lock()
+	old := r.db
+	r.db = db
+	r.generation++
+	caches := r.caches
+	churn := r.churn
+	if r.telemetry != nil {
+		db.SetTelemetry(r.telemetry)
+		r.telemetry.Count(MetricReloads, 1)
+	}
+	for _, h := range r.hooks {
+		db.AddHooks(h)
+	}
+	r.mu.Unlock()
+
+	var err error
+	for _, c := range caches {
+		if f, ok := c.(Flusher); ok {
+			if ferr := f.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	}
+
+	if old != nil && churn != nil {
+		go churn.check(old, db)
+	} else if old != nil {
+		if cerr := old.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Generation returns a counter incremented on every swap, for use in the keys of external caches.
+func (r *ReloadableDB) Generation() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generation
+}
+
+// AttachCache registers a cache to be invalidated whenever a new BIN file is swapped in.
+func (r *ReloadableDB) AttachCache(cache Cache) {
+	r.mu.Lock()
+	r.caches = append(r.caches, cache)
+	r.mu.Unlock()
+}
+
+// Cached attaches the cache and returns a CachedDB which always reads from the current DB. As with NewCachedDB,
+// the records not flagged as proxies are cached for the TTL unless CachedDB.SetNegativeTTL is called.
+func (r *ReloadableDB) Cached(cache Cache, ttl time.Duration) *CachedDB {
+	r.AttachCache(cache)
+
+	var c = &CachedDB{}
+	c.reload = r
+	c.cache = cache
+	c.ttl = ttl
+	c.negTTL = ttl
+	return c
+}
+
+// acquire the current DB and its generation; release must be called once the lookup is done
+func (r *ReloadableDB) acquire() (db *DB, generation uint64, release func()) {
+	r.mu.RLock()
+	return r.db, r.generation, r.mu.RUnlock
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+func (r *ReloadableDB) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	db, _, release := r.acquire()
+	x, err := db.GetAll(ipAddress)
+	release()
+	r.compareCandidate(ipAddress, x, err, all)
+	return x, err
+}
+
+// lookup returning the matched range too
+func (r *ReloadableDB) getAllRange(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	db, _, release := r.acquire()
+	x, rg, err := db.queryRange(ipAddress, all)
+	release()
+	r.compareCandidate(ipAddress, x, err, all)
+	return x, rg, err
+}
+
+// GetAllExtra will return all proxy fields and the extra columns from the current DB, see DB.GetAllExtra.
+func (r *ReloadableDB) GetAllExtra(ipAddress string) (IP2ProxyRecord, ExtraFields, error) {
+	db, _, release := r.acquire()
+	defer release()
+	return db.GetAllExtra(ipAddress)
+}
+
+// ExtraColumns returns the names of the extra columns of the current DB, see DB.ExtraColumns.
+func (r *ReloadableDB) ExtraColumns() []string {
+	db, _, release := r.acquire()
+	defer release()
+	return db.ExtraColumns()
+}
+
+// IsProxy checks whether the queried IP address was a proxy.
+func (r *ReloadableDB) IsProxy(ipAddress string) (int8, error) {
+	db, _, release := r.acquire()
+	x, err := db.query(ipAddress, isProxy)
+	release()
+	r.compareCandidate(ipAddress, x, err, isProxy)
+	return x.IsProxy, err
+}
+
+// DatabaseVersion returns the database version of the current DB.
+func (r *ReloadableDB) DatabaseVersion() string {
+	db, _, release := r.acquire()
+	defer release()
+	return db.DatabaseVersion()
+}
+
+// PackageVersion returns the database type of the current DB.
+func (r *ReloadableDB) PackageVersion() string {
+	db, _, release := r.acquire()
+	defer release()
+	return db.PackageVersion()
+}
+
+// VerifyKnownAnswers looks up the known answers in the current DB, see DB.VerifyKnownAnswers.
+func (r *ReloadableDB) VerifyKnownAnswers(answers []KnownAnswer) ([]AnswerMismatch, int, error) {
+	db, _, release := r.acquire()
+	defer release()
+	return db.VerifyKnownAnswers(answers)
+}
+
+// Close closes the current DB, and the DB under canary evaluation if any.
+func (r *ReloadableDB) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c := r.canary; c != nil && c.candidate != nil {
+		c.timer.Stop()
+		c.candidate.Close()
+		c.candidate = nil
+	}
+	return r.db.Close()
+}
@@ -0,0 +1,150 @@
+package ip2proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"lukechampine.com/uint128"
+	"net"
+)
+
+// The IPRange struct is a range of IP addresses sharing the same proxy record.
+type IPRange struct {
+	IPFrom net.IP
+	IPTo   net.IP // inclusive
+	Record IP2ProxyRecord
+
+	ipType uint32
+	ipFrom uint128.Uint128
+	ipTo   uint128.Uint128 // inclusive
+}
+
+// IsIPv6 checks whether the range belongs to the IPv6 data.
+func (r IPRange) IsIPv6() bool {
+	return r.ipType == 6
+}
+
+// number of rows read at once while scanning
+const scanBatchRows uint32 = 1024
+
+// Scan calls fn for every IP range in the BIN file, first the IPv4 ranges and then the IPv6 ranges,
+// in ascending order. Scanning stops at the first error returned by fn.
+func (d *DB) Scan(fn func(r IPRange) error) error {
+	if err := d.scanRows(4, 0, func(index uint32, r IPRange) error { return fn(r) }); err != nil {
+		return err
+	}
+	return d.scanRows(6, 0, func(index uint32, r IPRange) error { return fn(r) })
+}
+
+// The ScanCheckpoint struct records the progress of a scan, to resume it after an interruption.
+// It is only valid for the BIN file it was taken from.
+type ScanCheckpoint struct {
+	PackageVersion  string `json:"packageVersion"`
+	DatabaseVersion string `json:"databaseVersion"`
+	IPv6            bool   `json:"ipv6"`
+	Row             uint32 `json:"row"` // index of the next row to scan
+}
+
+const msgCheckpointMismatch string = "Scan checkpoint does not belong to this IP2Proxy BIN file."
+
+// ScanFrom scans like Scan starting at the checkpoint; the zero checkpoint starts from the beginning.
+// fn receives every range with the checkpoint following it, which can be saved once the range
+// has been processed so that a resumed scan continues with the next range.
+func (d *DB) ScanFrom(cp ScanCheckpoint, fn func(r IPRange, next ScanCheckpoint) error) error {
+	if cp != (ScanCheckpoint{}) && (cp.PackageVersion != d.PackageVersion() || cp.DatabaseVersion != d.DatabaseVersion()) {
+		return errors.New(msgCheckpointMismatch)
+	}
+
+	next := ScanCheckpoint{PackageVersion: d.PackageVersion(), DatabaseVersion: d.DatabaseVersion()}
+	if !cp.IPv6 {
+		err := d.scanRows(4, cp.Row, func(index uint32, r IPRange) error {
+			next.Row = index + 1
+			return fn(r, next)
+		})
+		if err != nil {
+			return err
+		}
+		cp.Row = 0
+	}
+
+	next.IPv6 = true
+	return d.scanRows(6, cp.Row, func(index uint32, r IPRange) error {
+		next.Row = index + 1
+		return fn(r, next)
+	})
+}
+
+// scan the rows of the IP version from the row index on, reading them in batches
+func (d *DB) scanRows(ipType uint32, start uint32, fn func(index uint32, r IPRange) error) error {
+	var baseAddr uint32
+	var count uint32
+	var colSize uint32
+	var firstCol uint32 = 4
+	var maxIP uint128.Uint128
+
+	if ipType == 4 {
+		baseAddr = d.meta.ipV4DatabaseAddr
+		count = d.meta.ipV4DatabaseCount
+		colSize = d.meta.ipV4ColumnSize
+		maxIP = maxIPV4Range
+	} else {
+		baseAddr = d.meta.ipV6DatabaseAddr
+		count = d.meta.ipV6DatabaseCount
+		colSize = d.meta.ipV6ColumnSize
+		firstCol = 16
+		maxIP = maxIPV6Range
+	}
+
+	readFrom := func(row []byte) uint128.Uint128 {
+		if ipType == 4 {
+			return uint128.From64(uint64(d.readUint32Row(row, 0)))
+		}
+		return d.readUint128Row(row, 0)
+	}
+
+	for i := start; i < count; i += scanBatchRows {
+		n := count - i
+		if n > scanBatchRows {
+			n = scanBatchRows
+		}
+
+		// the IP From of the row following the batch ends the last range
+		data, err := d.readRow(baseAddr+i*colSize, n*colSize+firstCol)
+		if err != nil {
+			return err
+		}
+
+		for j := uint32(0); j < n; j++ {
+			row := data[j*colSize:]
+			ipFrom := readFrom(row)
+			ipTo := readFrom(row[colSize:])
+			if ipTo.Cmp(maxIP) < 0 {
+				ipTo = ipTo.Sub64(1)
+			}
+
+			rec, err := d.readRecord(row[firstCol:colSize], all)
+			if err != nil {
+				return err
+			}
+
+			r := IPRange{IPFrom: numToIP(ipType, ipFrom), IPTo: numToIP(ipType, ipTo), Record: rec, ipType: ipType, ipFrom: ipFrom, ipTo: ipTo}
+			if err = fn(i+j, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IP address of the IP number
+func numToIP(ipType uint32, ipNum uint128.Uint128) net.IP {
+	if ipType == 4 {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(ipNum.Lo))
+		return ip
+	}
+
+	ip := make(net.IP, 16)
+	binary.BigEndian.PutUint64(ip, ipNum.Hi)
+	binary.BigEndian.PutUint64(ip[8:], ipNum.Lo)
+	return ip
+}
@@ -0,0 +1,124 @@
+package ip2proxy
+
+import (
+	"math"
+	"strconv"
+)
+
+// The Scorer struct combines the proxy type, threats, last seen and usage type of a record into a risk score
+// between 0 and 100. The proxy type weight decays with the days since the proxy was last seen, the threat
+// weights add up and the usage type weight, the highest of combined codes, adds to both. The weights are
+// set before the scorer is used and may be negative, e.g. to lower the score of mobile networks.
+type Scorer struct {
+	proxyTypes map[string]float64
+	threats    map[ThreatSet]float64
+	usageTypes map[UsageType]float64
+	halfLife   float64
+}
+
+// NewScorer initializes with the default model, in which a recently seen Tor exit node scores 90 and
+// a residential proxy 40, plus 20 to 35 for each threat.
+func NewScorer() *Scorer {
+	var s = &Scorer{}
+	s.proxyTypes = map[string]float64{
+		"TOR": 90,
+		"PUB": 80,
+		"VPN": 60,
+		"WEB": 60,
+		"DCH": 50,
+		"RES": 40,
+		"CPN": 40,
+		"EPN": 30,
+		"SES": 0,
+	}
+	s.threats = map[ThreatSet]float64{
+		ThreatSpam:    20,
+		ThreatScanner: 25,
+		ThreatBotnet:  35,
+		ThreatBogon:   30,
+		ThreatUnknown: 10,
+	}
+	s.usageTypes = map[UsageType]float64{
+		UsageTypeDataCenter: 10,
+		UsageTypeMobileISP:  -10,
+	}
+	s.halfLife = 30
+	return s
+}
+
+// SetProxyTypeWeight sets the weight of the proxy type, e.g. "VPN"; 0 ignores it.
+func (s *Scorer) SetProxyTypeWeight(proxyType string, weight float64) *Scorer {
+	s.proxyTypes[proxyType] = weight
+	return s
+}
+
+// SetThreatWeight sets the weight of each of the threats, e.g. ThreatSpam|ThreatBotnet.
+func (s *Scorer) SetThreatWeight(threats ThreatSet, weight float64) *Scorer {
+	for t := ThreatSpam; t <= ThreatUnknown; t <<= 1 {
+		if threats.Has(t) {
+			s.threats[t] = weight
+		}
+	}
+	return s
+}
+
+// SetUsageTypeWeight sets the weight of the usage type, e.g. UsageTypeDataCenter.
+func (s *Scorer) SetUsageTypeWeight(usageType UsageType, weight float64) *Scorer {
+	s.usageTypes[usageType] = weight
+	return s
+}
+
+// SetLastSeenHalfLife sets the number of days after which the proxy type weight is halved; 0 disables the decay.
+func (s *Scorer) SetLastSeenHalfLife(days int) *Scorer {
+	s.halfLife = float64(days)
+	return s
+}
+
+// Score returns the risk score of the record, between 0 and 100.
+func (s *Scorer) Score(rec IP2ProxyRecord) float64 {
+	var score float64
+	if rec.IsProxy > 0 {
+		score = s.proxyTypes[rec.ProxyType] * s.recency(rec.LastSeen)
+	}
+
+	threats := rec.Threats()
+	for t := ThreatSpam; t <= ThreatUnknown; t <<= 1 {
+		if threats.Has(t) {
+			score += s.threats[t]
+		}
+	}
+
+	var usage float64
+	for i, code := range UsageType(rec.UsageType).Codes() {
+		if w := s.usageTypes[code]; i == 0 || w > usage {
+			usage = w
+		}
+	}
+	score += usage
+
+	return math.Max(0, math.Min(100, score))
+}
+
+// the decay factor of the days since the proxy was last seen, 1 when unknown
+func (s *Scorer) recency(lastSeen string) float64 {
+	days, err := strconv.Atoi(lastSeen)
+	if err != nil || days <= 0 || s.halfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(days) / s.halfLife)
+}
+
+// ScorePolicy allows the records scoring below allowBelow and denies those scoring denyFrom or more; the
+// decision of the scores in between, e.g. to challenge the client, is left to the next policy.
+func ScorePolicy(s *Scorer, allowBelow float64, denyFrom float64) Policy {
+	return func(rec IP2ProxyRecord) Decision {
+		score := s.Score(rec)
+		if score >= denyFrom {
+			return DecisionDeny
+		}
+		if score < allowBelow {
+			return DecisionAllow
+		}
+		return DecisionNone
+	}
+}
@@ -0,0 +1,189 @@
+package ip2proxy
+
+import (
+	"lukechampine.com/uint128"
+	"sync"
+	"sync/atomic"
+)
+
+// The SequentialStats struct holds the counters of a SequentialDB.
+// Hits are lookups matched by the last row or its neighbours, Misses those needing a binary search.
+type SequentialStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// The SequentialDB struct wraps a DB for IP addresses queried in roughly ascending order, e.g. from
+// sorted log files. It remembers the last matched row and tries it and the following rows before
+// falling back to the binary search, saving most of the reads. It is safe for concurrent use, though
+// interleaved unrelated lookups defeat it.
+type SequentialDB struct {
+	// accessed atomically, kept first for 64-bit alignment
+	hits   uint64
+	misses uint64
+
+	db     *DB
+	probes uint32
+
+	mu   sync.Mutex
+	last [2]uint32 // row number + 1 of the last match, for IPv4 and IPv6
+}
+
+// number of rows tried from the last match by default
+const sequentialProbes uint32 = 4
+
+// NewSequentialDB wraps an already opened DB.
+func NewSequentialDB(db *DB) *SequentialDB {
+	var s = &SequentialDB{}
+	s.db = db
+	s.probes = sequentialProbes
+	return s
+}
+
+// SetProbes sets how many rows are tried from the last match before the binary search, 4 by default.
+func (s *SequentialDB) SetProbes(probes uint32) *SequentialDB {
+	s.probes = probes
+	return s
+}
+
+// Stats returns the counters.
+func (s *SequentialDB) Stats() SequentialStats {
+	return SequentialStats{
+		Hits:   atomic.LoadUint64(&s.hits),
+		Misses: atomic.LoadUint64(&s.misses),
+	}
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+func (s *SequentialDB) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	rec, _, err := s.getAllRange(ipAddress)
+	return rec, err
+}
+
+// lookup returning the matched range too
+func (s *SequentialDB) getAllRange(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	d := s.db
+	// the hooks and telemetry of the DB, for the lookups answered by the probes too
+	if d.telemetry == nil && d.hooks == nil {
+		return s.search(ipAddress)
+	}
+	if d.hooks != nil {
+		started := queryStart(d.hooks, ipAddress)
+		x, r, err := s.measuredSearch(ipAddress)
+		queryEnd(d.hooks, ipAddress, x, err, started)
+		return x, r, err
+	}
+	return s.measuredSearch(ipAddress)
+}
+
+// sequential lookup with the telemetry of the DB if set
+func (s *SequentialDB) measuredSearch(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	d := s.db
+	if d.telemetry == nil {
+		return s.search(ipAddress)
+	}
+	started, end := startLookup(d.telemetry, "bin")
+	x, r, err := s.search(ipAddress)
+	recordLookup(d.telemetry, "bin", started, x.IsProxy, err)
+	end(err)
+	return x, r, err
+}
+
+// sequential lookup without telemetry nor hooks
+func (s *SequentialDB) search(ipAddress string) (IP2ProxyRecord, ipRange, error) {
+	d := s.db
+	if d.isClosed() || !d.metaOK {
+		return d.search(ipAddress, all, nil)
+	}
+
+	ipType, ipNo, ipIndex := d.checkIP(ipAddress)
+	if ipType == 0 || (ipType == 6 && d.meta.ipV6DatabaseCount == 0) {
+		return d.search(ipAddress, all, nil)
+	}
+	if d.bloom != nil && !d.bloom.mayContain(ipType, ipNo) {
+		return d.bloom.record, ipRange{}, nil
+	}
+
+	slot := 0
+	if ipType == 6 {
+		slot = 1
+	}
+	s.mu.Lock()
+	last := s.last[slot]
+	s.mu.Unlock()
+
+	var row []byte
+	var ipFrom, ipTo uint128.Uint128
+	var rowNum uint32
+	var err error
+	if last > 0 {
+		row, ipFrom, ipTo, rowNum, err = d.probeRows(ipType, ipNo, last-1, s.probes)
+		if err != nil {
+			return loadMessage(msgNotSupported), ipRange{}, err
+		}
+	}
+
+	if row != nil {
+		atomic.AddUint64(&s.hits, 1)
+	} else {
+		atomic.AddUint64(&s.misses, 1)
+		row, ipFrom, ipTo, rowNum, err = d.searchRowNumber(ipType, ipNo, ipIndex, nil)
+		if err != nil || row == nil {
+			return loadMessage(msgNotSupported), ipRange{}, err
+		}
+	}
+
+	s.mu.Lock()
+	s.last[slot] = rowNum + 1
+	s.mu.Unlock()
+
+	rec, err := d.readRecord(row, all)
+	if err != nil {
+		return rec, ipRange{}, err
+	}
+	return rec, ipRange{ipType: ipType, ipFrom: ipFrom, ipTo: ipTo}, nil
+}
+
+// try the rows from the given row number; nil row if none matches
+func (d *DB) probeRows(ipType uint32, ipNo uint128.Uint128, from uint32, probes uint32) (row []byte, ipFrom uint128.Uint128, ipTo uint128.Uint128, rowNum uint32, err error) {
+	var firstCol uint32 = 4 // 4 bytes for ip from
+	baseAddr := d.meta.ipV4DatabaseAddr
+	count := d.meta.ipV4DatabaseCount
+	colSize := d.meta.ipV4ColumnSize
+	maxIP := maxIPV4Range
+	if ipType == 6 {
+		firstCol = 16 // 16 bytes for ip from
+		baseAddr = d.meta.ipV6DatabaseAddr
+		count = d.meta.ipV6DatabaseCount
+		colSize = d.meta.ipV6ColumnSize
+		maxIP = maxIPV6Range
+	}
+
+	if ipNo.Cmp(maxIP) >= 0 {
+		ipNo = ipNo.Sub(uint128.From64(1))
+	}
+
+	for n := from; n < from+probes && n < count; n++ {
+		fullRow, err := d.readRow(baseAddr+n*colSize, colSize+firstCol)
+		if err != nil {
+			return nil, ipFrom, ipTo, 0, err
+		}
+
+		if ipType == 4 {
+			ipFrom = uint128.From64(uint64(d.readUint32Row(fullRow, 0)))
+			ipTo = uint128.From64(uint64(d.readUint32Row(fullRow, colSize)))
+		} else {
+			ipFrom = d.readUint128Row(fullRow, 0)
+			ipTo = d.readUint128Row(fullRow, colSize)
+		}
+
+		if ipNo.Cmp(ipFrom) < 0 {
+			// addresses going backwards
+			break
+		}
+		if ipNo.Cmp(ipTo) < 0 {
+			return fullRow[firstCol:colSize], ipFrom, ipTo, n, nil
+		}
+	}
+	return nil, ipFrom, ipTo, 0, nil
+}
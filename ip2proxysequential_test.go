@@ -0,0 +1,80 @@
+package ip2proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// the lookups in ascending order are matched by the rows following the last match
+func TestSequentialDB(t *testing.T) {
+	db := openTestBIN(t, newTestWriter(t, 2, [3]string{"192.0.2.0", "192.0.2.127", "VPN"}, [3]string{"192.0.2.128", "192.0.2.255", "TOR"}))
+	s := NewSequentialDB(db)
+	for _, c := range [][2]string{{"192.0.2.1", "VPN"}, {"192.0.2.2", "VPN"}, {"192.0.2.200", "TOR"}, {"192.0.2.3", "VPN"}} {
+		rec, err := s.GetAll(c[0])
+		if err != nil || rec.ProxyType != c[1] {
+			t.Errorf("%s: %+v (%v) instead of %s", c[0], rec, err, c[1])
+		}
+	}
+	if stats := s.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("%+v instead of 2 hits and 2 misses", stats)
+	}
+}
+
+// the lookups of SequentialDB invoke the hooks and the telemetry of the DB once each
+func TestSequentialDBHooks(t *testing.T) {
+	var starts, ends int
+	hooks := Hooks{
+		OnQueryStart: func(ipAddress string) { starts++ },
+		OnQueryEnd:   func(ipAddress string, rec IP2ProxyRecord, err error, elapsed time.Duration) { ends++ },
+	}
+	telemetry := &countingTelemetry{}
+	db := openTestBIN(t, newTestWriter(t, 2, testVPNRange)).AddHooks(hooks).SetTelemetry(telemetry)
+
+	s := NewSequentialDB(db)
+	ips := []string{"192.0.2.1", "192.0.2.2", "198.51.100.1", "not an address"}
+	for _, ip := range ips {
+		if _, err := s.GetAll(ip); err != nil {
+			t.Fatalf("%s: %v", ip, err)
+		}
+	}
+	n := len(ips)
+	if starts != n || ends != n || telemetry.lookups != int64(n) || telemetry.spans != n {
+		t.Errorf("%d starts, %d ends, %d lookups and %d spans instead of %d each", starts, ends, telemetry.lookups, telemetry.spans, n)
+	}
+}
+
+// the addresses ruled out by the bloom filter skip the probes and the binary search
+func TestSequentialDBBloomFilter(t *testing.T) {
+	db := openTestBIN(t, newTestWriter(t, 2, testVPNRange))
+	if err := db.EnableBloomFilter(0.01); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSequentialDB(db)
+	rec, err := s.GetAll("198.51.100.1")
+	if err != nil || rec.IsProxy != 0 {
+		t.Fatalf("%+v (%v) instead of a non-proxy", rec, err)
+	}
+	if bloom := db.BloomStats(); bloom.Skipped != 1 {
+		t.Errorf("bloom filter %+v instead of 1 skipped lookup", bloom)
+	}
+	if stats := s.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("%+v instead of no probe", stats)
+	}
+}
+
+// the lookups of a closed DB fail with ErrClosed, the BIN file being held in memory
+func TestSequentialDBClosed(t *testing.T) {
+	db := openTestBIN(t, newTestWriter(t, 2, testVPNRange))
+	s := NewSequentialDB(db)
+	if _, err := s.GetAll("192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	for _, ip := range []string{"192.0.2.2", "198.51.100.1"} {
+		if _, err := s.GetAll(ip); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: %v instead of ErrClosed", ip, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ip2proxy
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// The ShadowPolicy struct evaluates a candidate policy against the live lookups of a Middleware without enforcing
+// it, counting the decisions it would take and sampling the addresses where it disagrees with the enforced policy,
+// e.g. to check the would-block rate of a stricter policy before switching to it.
+type ShadowPolicy struct {
+	name        string
+	policy      Policy
+	maxExamples int
+
+	mu       sync.Mutex
+	stats    ShadowStats
+	disagree uint64 // disagreements seen by the reservoir sampling
+}
+
+// The ShadowStats struct holds the counters of a ShadowPolicy. Examples are a uniform sample of the
+// disagreements, with the client IP addresses redacted like the audit events of the middleware.
+type ShadowStats struct {
+	Name           string
+	Lookups        uint64
+	WouldDeny      uint64
+	WouldChallenge uint64
+	NewlyDenied    uint64 // denied by the candidate, not by the enforced policy
+	NewlyAllowed   uint64 // denied by the enforced policy, not by the candidate
+	Disagreements  uint64 // lookups with different decisions
+	Examples       []ShadowExample
+}
+
+// The ShadowExample struct is a lookup where the candidate and the enforced policy disagree.
+type ShadowExample struct {
+	ClientIP string
+	Record   IP2ProxyRecord
+	Shadow   Decision
+	Enforced Decision
+}
+
+// WouldBlockRate returns the share of the lookups the candidate policy would deny.
+func (s ShadowStats) WouldBlockRate() float64 {
+	if s.Lookups == 0 {
+		return 0
+	}
+	return float64(s.WouldDeny) / float64(s.Lookups)
+}
+
+// NewShadowPolicy initializes with the name reported in the stats, the candidate policy and the number of
+// disagreements kept as examples.
+func NewShadowPolicy(name string, policy Policy, maxExamples int) *ShadowPolicy {
+	var s = &ShadowPolicy{}
+	s.name = name
+	s.policy = policy
+	s.maxExamples = maxExamples
+	s.stats.Name = name
+	return s
+}
+
+// Observe applies the candidate policy to the record of a lookup and compares its decision with the enforced one.
+// The middleware calls it for the shadow policies added with AddShadowPolicy; it is exported for the frameworks
+// not based on Middleware.
+func (s *ShadowPolicy) Observe(clientIP string, rec IP2ProxyRecord, enforced Decision) {
+	d := DecisionNone
+	if s.policy != nil {
+		d = s.policy(rec)
+	}
+	if d == DecisionNone {
+		d = DecisionAllow
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Lookups++
+	switch d {
+	case DecisionDeny:
+		s.stats.WouldDeny++
+	case DecisionChallenge:
+		s.stats.WouldChallenge++
+	}
+	if d == enforced {
+		return
+	}
+
+	s.stats.Disagreements++
+	if d == DecisionDeny {
+		s.stats.NewlyDenied++
+	} else if enforced == DecisionDeny {
+		s.stats.NewlyAllowed++
+	}
+
+	example := ShadowExample{ClientIP: clientIP, Record: rec, Shadow: d, Enforced: enforced}
+	s.disagree++
+	if len(s.stats.Examples) < s.maxExamples {
+		s.stats.Examples = append(s.stats.Examples, example)
+	} else if i := rand.Int63n(int64(s.disagree)); i < int64(s.maxExamples) {
+		s.stats.Examples[i] = example
+	}
+}
+
+// Stats returns a copy of the counters and examples.
+func (s *ShadowPolicy) Stats() ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Examples = append([]ShadowExample(nil), s.stats.Examples...)
+	return st
+}
+
+// Reset clears the counters and examples, e.g. after a change of the enforced policy.
+func (s *ShadowPolicy) Reset() {
+	s.mu.Lock()
+	s.stats = ShadowStats{Name: s.name}
+	s.disagree = 0
+	s.mu.Unlock()
+}
+
+// AddShadowPolicy evaluates the candidate policy on every successful lookup of the middleware, without enforcing it.
+// The decision cache only holds the decisions of the enforced policy, the candidate policy is applied every time.
+func (m *Middleware) AddShadowPolicy(s *ShadowPolicy) *Middleware {
+	m.shadows = append(m.shadows, s)
+	return m
+}
@@ -0,0 +1,194 @@
+package ip2proxy
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The SIEMEvent struct is a lookup result or a decision rendered by FormatCEF and FormatLEEF.
+// Decision is DecisionNone for plain lookups; Request is optional, e.g. the path of the HTTP request.
+type SIEMEvent struct {
+	Time     time.Time
+	ClientIP string
+	Record   IP2ProxyRecord
+	Decision Decision
+	Request  string
+}
+
+const siemVendor = "IP2Location"
+const siemProduct = "IP2Proxy"
+
+const msgInvalidSIEMFormat string = "Invalid SIEM format."
+
+// the event class, name and severity from 0 to 10
+func (e SIEMEvent) class() (id string, name string, severity int) {
+	switch e.Decision {
+	case DecisionDeny:
+		return "deny", "Proxy denied", 7
+	case DecisionChallenge:
+		return "challenge", "Proxy challenged", 5
+	}
+	id = "lookup"
+	if e.Decision == DecisionAllow {
+		id = "allow"
+	}
+	if e.Record.IsProxy > 0 {
+		return id, "Proxy detected", 3
+	}
+	return id, "No proxy detected", 0
+}
+
+// the fields of the record worth reporting, "-" and the sentinel messages left out
+func siemValue(s string) string {
+	if s == "-" || s == msgNotSupported || s == msgInvalidIP || s == msgIPV6Unsupported || s == msgMissingFile {
+		return ""
+	}
+	return s
+}
+
+// extension keys and values, empty values left out
+type siemFields []string
+
+func (f *siemFields) add(key string, value string) {
+	if value != "" {
+		*f = append(*f, key, value)
+	}
+}
+
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+// FormatCEF renders the event as an ArcSight Common Event Format line, without line feed, e.g. for Splunk.
+// The proxy type, country, usage type, threat and provider are in the custom string fields cs1 to cs5, labelled,
+// and IsProxy in cn1.
+func FormatCEF(e SIEMEvent) string {
+	id, name, severity := e.class()
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	for _, h := range []string{siemVendor, siemProduct, ModuleVersion(), id, name} {
+		b.WriteString(cefHeaderEscaper.Replace(h))
+		b.WriteByte('|')
+	}
+	b.WriteString(strconv.Itoa(severity))
+	b.WriteByte('|')
+
+	var f siemFields
+	if !e.Time.IsZero() {
+		f.add("rt", strconv.FormatInt(e.Time.UnixMilli(), 10))
+	}
+	f.add("src", e.ClientIP)
+	if e.Decision != DecisionNone {
+		f.add("act", e.Decision.String())
+	}
+	f.add("request", e.Request)
+	f.add("cn1", strconv.Itoa(int(e.Record.IsProxy)))
+	f.add("cn1Label", "isProxy")
+	for i, cs := range [][2]string{
+		{"proxyType", e.Record.ProxyType},
+		{"countryCode", e.Record.CountryShort},
+		{"usageType", e.Record.UsageType},
+		{"threat", e.Record.Threat},
+		{"provider", e.Record.Provider},
+	} {
+		if v := siemValue(cs[1]); v != "" {
+			n := strconv.Itoa(i + 1)
+			f.add("cs"+n, v)
+			f.add("cs"+n+"Label", cs[0])
+		}
+	}
+	for i := 0; i < len(f); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f[i])
+		b.WriteByte('=')
+		b.WriteString(cefValueEscaper.Replace(f[i+1]))
+	}
+	return b.String()
+}
+
+var leefHeaderEscaper = strings.NewReplacer(`|`, `\|`, "\t", " ", "\n", " ", "\r", " ")
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// FormatLEEF renders the event as an IBM QRadar Log Event Extended Format 1.0 line, without line feed, the
+// attributes being separated by tabs.
+func FormatLEEF(e SIEMEvent) string {
+	id, _, severity := e.class()
+	var b strings.Builder
+	b.WriteString("LEEF:1.0|")
+	for _, h := range []string{siemVendor, siemProduct, ModuleVersion(), id} {
+		b.WriteString(leefHeaderEscaper.Replace(h))
+		b.WriteByte('|')
+	}
+
+	var f siemFields
+	if !e.Time.IsZero() {
+		f.add("devTime", strconv.FormatInt(e.Time.UnixMilli(), 10))
+	}
+	f.add("src", e.ClientIP)
+	f.add("sev", strconv.Itoa(severity))
+	if e.Decision != DecisionNone {
+		f.add("action", e.Decision.String())
+	}
+	f.add("url", e.Request)
+	f.add("isProxy", strconv.Itoa(int(e.Record.IsProxy)))
+	f.add("proxyType", siemValue(e.Record.ProxyType))
+	f.add("countryCode", siemValue(e.Record.CountryShort))
+	f.add("usageType", siemValue(e.Record.UsageType))
+	f.add("threat", siemValue(e.Record.Threat))
+	f.add("provider", siemValue(e.Record.Provider))
+	for i := 0; i < len(f); i += 2 {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(f[i])
+		b.WriteByte('=')
+		b.WriteString(leefValueEscaper.Replace(f[i+1]))
+	}
+	return b.String()
+}
+
+// The SIEMEncoder struct writes events as CEF or LEEF lines, e.g. to a file watched by the SIEM forwarder or to
+// a syslog connection. It is safe for concurrent use.
+type SIEMEncoder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format func(e SIEMEvent) string
+}
+
+// NewSIEMEncoder initializes with the writer and the format, cef or leef.
+func NewSIEMEncoder(w io.Writer, format string) (*SIEMEncoder, error) {
+	var s = &SIEMEncoder{}
+	s.w = w
+	switch strings.ToLower(format) {
+	case "cef":
+		s.format = FormatCEF
+	case "leef":
+		s.format = FormatLEEF
+	default:
+		return nil, errors.New(msgInvalidSIEMFormat)
+	}
+	return s, nil
+}
+
+// Encode writes the event as a line.
+func (s *SIEMEncoder) Encode(e SIEMEvent) error {
+	line := s.format(e) + "\n"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.w, line)
+	return err
+}
+
+// Audit writes the audit event of a Middleware, for SetAuditFunc; the write errors are dropped.
+func (s *SIEMEncoder) Audit(event AuditEvent) {
+	e := SIEMEvent{Time: time.Now(), ClientIP: event.ClientIP, Record: event.Record, Decision: event.Decision}
+	if event.Request != nil {
+		e.Request = event.Request.URL.Path
+	}
+	_ = s.Encode(e)
+}
@@ -0,0 +1,182 @@
+package ip2proxy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+)
+
+// The KeyProvider interface supplies the public keys trusted to sign IP2Proxy BIN files.
+// Implementations may load keys from disk, a secrets manager or a certificate store.
+type KeyProvider interface {
+	PublicKeys() ([]crypto.PublicKey, error)
+}
+
+// The StaticKeys type is a KeyProvider holding a fixed set of public keys.
+type StaticKeys []crypto.PublicKey
+
+// PublicKeys returns the static keys.
+func (k StaticKeys) PublicKeys() ([]crypto.PublicKey, error) {
+	return k, nil
+}
+
+// The PEMKeyFile struct is a KeyProvider reading PEM encoded public keys and X.509
+// certificates from a file each time the keys are needed, so rotated keys are picked up.
+// When Roots is set, certificates must chain to one of the roots to be trusted.
+type PEMKeyFile struct {
+	Path  string
+	Roots *x509.CertPool
+}
+
+// PublicKeys returns the keys found in the PEM file.
+func (k PEMKeyFile) PublicKeys() ([]crypto.PublicKey, error) {
+	data, err := os.ReadFile(k.Path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePEMKeys(data, k.Roots)
+}
+
+const msgInvalidSignature string = "Invalid IP2Proxy BIN file signature."
+const msgNoPublicKey string = "No public key available to verify the IP2Proxy BIN file signature."
+const msgUnsupportedKey string = "Unsupported key type."
+
+// parse PEM blocks into public keys
+func parsePEMKeys(data []byte, roots *x509.CertPool) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			if roots != nil {
+				if _, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+					return nil, err
+				}
+			}
+			keys = append(keys, cert.PublicKey)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New(msgNoPublicKey)
+	}
+	return keys, nil
+}
+
+// compute the SHA-256 digest which is the signed content
+func digestDatabase(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignDatabase signs the BIN file content read from r, e.g. a file produced by the Writer.
+// The signature is computed over the SHA-256 digest of the content. Ed25519, ECDSA and RSA signers are supported.
+func SignDatabase(r io.Reader, signer crypto.Signer) ([]byte, error) {
+	digest, err := digestDatabase(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch signer.Public().(type) {
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, digest, crypto.Hash(0))
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return signer.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	return nil, errors.New(msgUnsupportedKey)
+}
+
+// VerifyDatabase checks the signature of the BIN file content read from r against the keys
+// supplied by the key provider. It returns nil if any of the keys verifies the signature.
+func VerifyDatabase(r io.Reader, sig []byte, keys KeyProvider) error {
+	pubKeys, err := keys.PublicKeys()
+	if err != nil {
+		return err
+	}
+	if len(pubKeys) == 0 {
+		return errors.New(msgNoPublicKey)
+	}
+
+	digest, err := digestDatabase(r)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range pubKeys {
+		if verifyDigest(key, digest, sig) {
+			return nil
+		}
+	}
+	return errors.New(msgInvalidSignature)
+}
+
+// verify the digest signature with a single key
+func verifyDigest(key crypto.PublicKey, digest []byte, sig []byte) bool {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, digest, sig)
+	case *ecdsa.PublicKey:
+		var esig struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) != 0 {
+			return false
+		}
+		return ecdsa.Verify(k, digest, esig.R, esig.S)
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil {
+			return true
+		}
+		return rsa.VerifyPSS(k, crypto.SHA256, digest, sig, nil) == nil
+	}
+	return false
+}
+
+// OpenDBVerified takes the path to the IP2Proxy BIN database file and the path to its detached signature.
+// The BIN file is only opened if the signature is valid for one of the keys from the key provider.
+// The file is read into memory once, the bytes verified being those queried whatever happens to the file
+// afterwards, like with OpenDBFromBytes.
+func OpenDBVerified(dbPath string, sigPath string, keys KeyProvider) (*DB, error) {
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = VerifyDatabase(bytes.NewReader(data), sig, keys); err != nil {
+		return nil, err
+	}
+
+	return OpenDBFromBytes(data)
+}
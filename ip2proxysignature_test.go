@@ -0,0 +1,61 @@
+package ip2proxy
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSignedBIN(t *testing.T, proxyType string, priv ed25519.PrivateKey) (bin []byte, sig []byte) {
+	t.Helper()
+	bin = writeTestBIN(t, newTestWriter(t, 2, [3]string{"192.0.2.0", "192.0.2.255", proxyType}))
+	sig, err := SignDatabase(bytes.NewReader(bin), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bin, sig
+}
+
+// the content verified is the content queried, even if the file is replaced in place after the verification
+func TestOpenDBVerified(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := StaticKeys{pub}
+	dir := t.TempDir()
+	dbPath, sigPath := filepath.Join(dir, "db.bin"), filepath.Join(dir, "db.sig")
+
+	bin, sig := writeSignedBIN(t, "VPN", priv)
+	if err := os.WriteFile(dbPath, bin, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sigPath, sig, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDBVerified(dbPath, sigPath, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	other, _ := writeSignedBIN(t, "TOR", priv)
+	f, err := os.OpenFile(dbPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(other, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, err := db.GetProxyType("192.0.2.1"); err != nil || got != "VPN" {
+		t.Errorf("%q (%v) instead of the verified VPN", got, err)
+	}
+
+	if _, err := OpenDBVerified(dbPath, sigPath, keys); err == nil {
+		t.Error("file not matching the signature opened")
+	}
+}
@@ -0,0 +1,90 @@
+package ip2proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// The LatencyBreach struct is a window of lookups whose 99th percentile latency exceeded the budget of
+// a LatencyGuard.
+type LatencyBreach struct {
+	Budget  time.Duration
+	P99     time.Duration
+	Lookups uint64
+	Start   time.Time
+	Window  time.Duration // time covered, at least the window of the guard
+}
+
+// The LatencyGuard struct records the latency of the lookups over consecutive windows and calls a function when
+// the 99th percentile of a window exceeds the budget, a guardrail against storage regressions, e.g. a BIN file
+// on a disk slowed down by its neighbours: the function can alert, or switch to a DB opened from memory with
+// OpenDBFromBytes through ReloadableDB.Swap. It is fed by the hooks returned by Hooks, added to a DB,
+// ReloadableDB or Middleware.
+type LatencyGuard struct {
+	budget     time.Duration
+	window     time.Duration
+	minLookups uint64
+	onBreach   func(LatencyBreach)
+
+	mu      sync.Mutex
+	start   time.Time
+	lookups uint64
+	latency [statsLatencyBuckets]uint64
+}
+
+// NewLatencyGuard initializes with the p99 budget, the duration of the windows, e.g. a minute, and the
+// function called for the windows over budget. The function is called in its own goroutine, once per window
+// over budget, and the windows of fewer than 100 lookups are not checked, see SetMinLookups. The percentile is
+// estimated within 25%, like those of StatsWindow.
+func NewLatencyGuard(budget time.Duration, window time.Duration, onBreach func(LatencyBreach)) *LatencyGuard {
+	var g = &LatencyGuard{}
+	g.budget = budget
+	g.window = window
+	g.minLookups = 100
+	g.onBreach = onBreach
+	g.start = time.Now()
+	return g
+}
+
+// SetMinLookups sets how many lookups a window needs to be checked, for the p99 of a few lookups not to
+// raise false alarms. It must be called before any lookup.
+func (g *LatencyGuard) SetMinLookups(n uint64) *LatencyGuard {
+	g.minLookups = n
+	return g
+}
+
+// Hooks returns the hooks recording the latency of the lookups.
+func (g *LatencyGuard) Hooks() Hooks {
+	return Hooks{OnQueryEnd: func(ipAddress string, rec IP2ProxyRecord, err error, elapsed time.Duration) {
+		g.Record(elapsed)
+	}}
+}
+
+// Record records the latency of a lookup, for the lookups not made through hooks. The window is checked by the
+// first lookup recorded after its end.
+func (g *LatencyGuard) Record(elapsed time.Duration) {
+	now := time.Now()
+	i := latencyBucket(elapsed)
+
+	g.mu.Lock()
+	var b LatencyBreach
+	if covered := now.Sub(g.start); covered >= g.window {
+		if g.lookups >= g.minLookups && g.lookups > 0 {
+			b.P99 = latencyPercentile(&g.latency, g.lookups, 0.99)
+			b.Lookups = g.lookups
+			b.Start = g.start
+			b.Window = covered
+		}
+		g.start = now
+		g.lookups = 0
+		g.latency = [statsLatencyBuckets]uint64{}
+	}
+	g.lookups++
+	g.latency[i]++
+	g.mu.Unlock()
+
+	if b.P99 > g.budget {
+		b.Budget = g.budget
+		go g.onBreach(b)
+	}
+}
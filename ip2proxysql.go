@@ -0,0 +1,214 @@
+package ip2proxy
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"lukechampine.com/uint128"
+)
+
+// SQLiteDriverName is the name of the database/sql driver used by ExportSQLite and OpenSQLite.
+// A SQLite driver must be imported by the program, e.g. github.com/mattn/go-sqlite3 ("sqlite3")
+// or modernc.org/sqlite ("sqlite").
+var SQLiteDriverName = "sqlite3"
+
+// The SQL tables hold one row per IP range with the inclusive bounds ip_from and ip_to.
+// IPv4 bounds are integers; IPv6 bounds are 16-byte big-endian blobs, which sort like the addresses.
+// Fields not supported by the BIN file are NULL.
+const sqlSchema = `
+CREATE TABLE %s (
+	ip_from %s NOT NULL PRIMARY KEY,
+	ip_to %s NOT NULL,
+	is_proxy INTEGER NOT NULL,
+	proxy_type TEXT,
+	country_code TEXT,
+	country_name TEXT,
+	region_name TEXT,
+	city_name TEXT,
+	isp TEXT,
+	domain TEXT,
+	usage_type TEXT,
+	asn TEXT,
+	as_name TEXT,
+	last_seen TEXT,
+	threat TEXT,
+	provider TEXT
+);
+CREATE UNIQUE INDEX %s_ip_to ON %s (ip_to);`
+
+const sqlColumns = "ip_from, ip_to, is_proxy, proxy_type, country_code, country_name, region_name, city_name, isp, domain, usage_type, asn, as_name, last_seen, threat, provider"
+
+// SQLTableIPv4 and SQLTableIPv6 are the names of the tables holding the IPv4 and IPv6 ranges.
+const (
+	SQLTableIPv4 = "ip2proxy_ipv4"
+	SQLTableIPv6 = "ip2proxy_ipv6"
+)
+
+const msgTableExists string = "IP2Proxy tables already exist."
+
+// ExportSQLite writes the IP ranges and their proxy records to a new SQLite database file.
+func (d *DB) ExportSQLite(dbPath string) error {
+	conn, err := sql.Open(SQLiteDriverName, dbPath)
+	if err != nil {
+		return err
+	}
+
+	if err = d.ExportSQL(conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	return conn.Close()
+}
+
+// ExportSQL creates the IP2Proxy tables in the SQL database and fills them in a single transaction.
+// The statements use SQLite syntax.
+func (d *DB) ExportSQL(conn *sql.DB) error {
+	var n int
+	err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN (?, ?)", SQLTableIPv4, SQLTableIPv6).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errors.New(msgTableExists)
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = d.exportSQL(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) exportSQL(tx *sql.Tx) error {
+	for _, t := range []struct {
+		ipType uint32
+		table  string
+		column string
+	}{{4, SQLTableIPv4, "INTEGER"}, {6, SQLTableIPv6, "BLOB"}} {
+		if _, err := tx.Exec(fmt.Sprintf(sqlSchema, t.table, t.column, t.column, t.table, t.table)); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare("INSERT INTO " + t.table + " (" + sqlColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+
+		err = d.scanRows(t.ipType, 0, func(index uint32, r IPRange) error {
+			rec := r.Record
+			_, err := stmt.Exec(sqlIPNum(t.ipType, r.ipFrom), sqlIPNum(t.ipType, r.ipTo), rec.IsProxy,
+				sqlString(rec.ProxyType), sqlString(rec.CountryShort), sqlString(rec.CountryLong),
+				sqlString(rec.Region), sqlString(rec.City), sqlString(rec.Isp), sqlString(rec.Domain),
+				sqlString(rec.UsageType), sqlString(rec.Asn), sqlString(rec.As), sqlString(rec.LastSeen),
+				sqlString(rec.Threat), sqlString(rec.Provider))
+			return err
+		})
+		_ = stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SQL value of an IP number
+func sqlIPNum(ipType uint32, ipNum uint128.Uint128) interface{} {
+	if ipType == 4 {
+		return int64(ipNum.Lo)
+	}
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, ipNum.Hi)
+	binary.BigEndian.PutUint64(b[8:], ipNum.Lo)
+	return b
+}
+
+// NULL for fields not supported by the BIN file
+func sqlString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != msgNotSupported}
+}
+
+// The SQLResolver struct looks up IP addresses in the tables written by ExportSQL.
+type SQLResolver struct {
+	conn *sql.DB
+}
+
+// OpenSQLite opens a SQLite database file written by ExportSQLite.
+func OpenSQLite(dbPath string) (*SQLResolver, error) {
+	conn, err := sql.Open(SQLiteDriverName, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewSQLResolver(conn), nil
+}
+
+// NewSQLResolver initializes with a SQL database holding the tables written by ExportSQL.
+func NewSQLResolver(conn *sql.DB) *SQLResolver {
+	var s = &SQLResolver{}
+	s.conn = conn
+	return s
+}
+
+// GetAll will return all proxy fields based on the queried IP address.
+func (s *SQLResolver) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	x := loadMessage(msgNotSupported)
+
+	ipType, ipNum := ipToNum(ipAddress)
+	if ipType == 0 {
+		return loadMessage(msgInvalidIP), nil
+	}
+
+	table := SQLTableIPv4
+	if ipType == 6 {
+		table = SQLTableIPv6
+	}
+	num := sqlIPNum(ipType, ipNum)
+
+	var fields [13]sql.NullString
+	var ipFrom interface{}
+	row := s.conn.QueryRow("SELECT ip_from, is_proxy, proxy_type, country_code, country_name, region_name, city_name, isp, domain, usage_type, asn, as_name, last_seen, threat, provider FROM "+table+" WHERE ip_to >= ? ORDER BY ip_to LIMIT 1", num)
+	dest := []interface{}{&ipFrom, &x.IsProxy}
+	for i := range fields {
+		dest = append(dest, &fields[i])
+	}
+	if err := row.Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return loadMessage(msgNotSupported), nil
+		}
+		return loadMessage(msgNotSupported), err
+	}
+
+	if !sqlLessOrEqual(ipFrom, num) {
+		return loadMessage(msgNotSupported), nil
+	}
+
+	for i, p := range []*string{&x.ProxyType, &x.CountryShort, &x.CountryLong, &x.Region, &x.City, &x.Isp, &x.Domain,
+		&x.UsageType, &x.Asn, &x.As, &x.LastSeen, &x.Threat, &x.Provider} {
+		if fields[i].Valid {
+			*p = fields[i].String
+		}
+	}
+	return x, nil
+}
+
+// Close closes the SQL database.
+func (s *SQLResolver) Close() error {
+	return s.conn.Close()
+}
+
+// compare SQL values of IP numbers
+func sqlLessOrEqual(a interface{}, b interface{}) bool {
+	switch v := a.(type) {
+	case int64:
+		return v <= b.(int64)
+	case []byte:
+		return len(v) == 16 && bytes.Compare(v, b.([]byte)) <= 0
+	}
+	return false
+}
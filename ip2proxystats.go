@@ -0,0 +1,155 @@
+package ip2proxy
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// The QueryStats struct holds the aggregates of the lookups of a StatsWindow.
+type QueryStats struct {
+	Window        time.Duration // time covered, shorter than the window until it has elapsed once
+	Lookups       uint64
+	Errors        uint64
+	Proxies       uint64  // lookups of IP addresses flagged as proxies
+	PerMinute     float64 // lookup rate
+	ProxyRatio    float64 // share of the successful lookups flagged as proxies
+	P50, P90, P99 time.Duration
+}
+
+// number of latency buckets: 4 per power of two of the nanoseconds
+const statsLatencyBuckets = 64 * 4
+
+// lookups of one minute
+type statsBucket struct {
+	minute  int64 // since the Unix epoch
+	lookups uint64
+	errors  uint64
+	proxies uint64
+	latency [statsLatencyBuckets]uint64
+}
+
+// The StatsWindow struct aggregates the lookups of the last minutes, e.g. of the last 5 minutes with
+// NewStatsWindow(5), for the lookup rate, the latency percentiles and the share of proxies. It is fed by
+// the hooks returned by Hooks, added to a DB, ReloadableDB or Middleware.
+type StatsWindow struct {
+	mu      sync.Mutex
+	buckets []statsBucket
+	started time.Time
+}
+
+// NewStatsWindow initializes with the number of minutes aggregated, at least 1.
+func NewStatsWindow(minutes int) *StatsWindow {
+	if minutes < 1 {
+		minutes = 1
+	}
+	var w = &StatsWindow{}
+	w.buckets = make([]statsBucket, minutes+1) // the current minute is partial
+	w.started = time.Now()
+	return w
+}
+
+// Hooks returns the hooks recording the lookups in the window.
+func (w *StatsWindow) Hooks() Hooks {
+	return Hooks{OnQueryEnd: func(ipAddress string, rec IP2ProxyRecord, err error, elapsed time.Duration) {
+		w.Record(rec, err, elapsed)
+	}}
+}
+
+// Record records a lookup, for the lookups not made through hooks.
+func (w *StatsWindow) Record(rec IP2ProxyRecord, err error, elapsed time.Duration) {
+	minute := time.Now().Unix() / 60
+	i := latencyBucket(elapsed)
+
+	w.mu.Lock()
+	b := &w.buckets[minute%int64(len(w.buckets))]
+	if b.minute != minute {
+		*b = statsBucket{minute: minute}
+	}
+	b.lookups++
+	if err != nil {
+		b.errors++
+	} else if rec.IsProxy > 0 {
+		b.proxies++
+	}
+	b.latency[i]++
+	w.mu.Unlock()
+}
+
+// Stats returns the aggregates of the window.
+func (w *StatsWindow) Stats() QueryStats {
+	now := time.Now()
+	minute := now.Unix() / 60
+	oldest := minute - int64(len(w.buckets)) + 1
+
+	var s QueryStats
+	var latency [statsLatencyBuckets]uint64
+	w.mu.Lock()
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.minute < oldest || b.minute > minute {
+			continue
+		}
+		s.Lookups += b.lookups
+		s.Errors += b.errors
+		s.Proxies += b.proxies
+		for j, n := range b.latency {
+			latency[j] += n
+		}
+	}
+	w.mu.Unlock()
+
+	from := time.Unix(oldest*60, 0)
+	if w.started.After(from) {
+		from = w.started
+	}
+	s.Window = now.Sub(from)
+	if s.Window > 0 {
+		s.PerMinute = float64(s.Lookups) / s.Window.Minutes()
+	}
+	if ok := s.Lookups - s.Errors; ok > 0 {
+		s.ProxyRatio = float64(s.Proxies) / float64(ok)
+	}
+	s.P50 = latencyPercentile(&latency, s.Lookups, 0.50)
+	s.P90 = latencyPercentile(&latency, s.Lookups, 0.90)
+	s.P99 = latencyPercentile(&latency, s.Lookups, 0.99)
+	return s
+}
+
+// bucket of the duration, within 25% of its value
+func latencyBucket(d time.Duration) int {
+	ns := uint64(d)
+	if d < 0 {
+		ns = 0
+	}
+	if ns < 4 {
+		return int(ns)
+	}
+	e := bits.Len64(ns) - 1
+	return e<<2 | int(ns>>(e-2)&3)
+}
+
+// middle of the values of the bucket
+func latencyValue(i int) time.Duration {
+	if i < 4 {
+		return time.Duration(i)
+	}
+	e, sub := uint(i>>2), uint64(i&3)
+	low := (4 + sub) << (e - 2)
+	high := (5 + sub) << (e - 2)
+	return time.Duration(low + (high-low)/2)
+}
+
+func latencyPercentile(latency *[statsLatencyBuckets]uint64, total uint64, p float64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(p*float64(total-1)) + 1
+	var seen uint64
+	for i, n := range latency {
+		if seen += n; seen >= rank {
+			return latencyValue(i)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,256 @@
+package ip2proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The SyslogForwarder struct sends detection events to a syslog server as RFC 5424 messages, over UDP, TCP or
+// TLS, the TCP and TLS messages being framed by octet counting as per RFC 5425. The events are queued and sent in
+// the background so that the lookups never wait for the server; the events over the rate limit, those arriving
+// while the queue is full and those the server cannot be reached for are dropped and counted.
+type SyslogForwarder struct {
+	dropped uint64 // accessed atomically, kept first for 64-bit alignment
+
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	hostname  string
+	appName   string
+	facility  int
+	format    func(e SIEMEvent) string
+
+	mu     sync.Mutex // of the rate limit
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	closeMu sync.RWMutex
+	closed  bool
+	queue   chan SIEMEvent
+	done    chan struct{}
+	conn    net.Conn
+}
+
+// queued events before dropping
+const syslogQueueSize = 1024
+
+// timeout of the connections and writes
+const syslogTimeout = 5 * time.Second
+
+// local0
+const syslogDefaultFacility = 16
+
+const msgInvalidSyslogNetwork string = "Invalid syslog network, must be udp, tcp or tls."
+
+// NewSyslogForwarder initializes with the network, udp, tcp or tls, and the host:port of the syslog server; the
+// TLS configuration is only used with tls and may be nil. The connection is made with the first event, and made
+// again after errors. The events are formatted as CEF by default, see SetFormat, with the local0 facility and a
+// rate limit of 100 events per second.
+func NewSyslogForwarder(network string, addr string, tlsConfig *tls.Config) (*SyslogForwarder, error) {
+	if network != "udp" && network != "tcp" && network != "tls" {
+		return nil, errors.New(msgInvalidSyslogNetwork)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+
+	var s = &SyslogForwarder{}
+	s.network = network
+	s.addr = addr
+	s.tlsConfig = tlsConfig
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+	s.appName = "ip2proxy"
+	s.facility = syslogDefaultFacility
+	s.format = FormatCEF
+	s.SetRateLimit(100, 100)
+	s.queue = make(chan SIEMEvent, syslogQueueSize)
+	s.done = make(chan struct{})
+	go s.run()
+	return s, nil
+}
+
+// SetRateLimit sets how many events per second are sent, with bursts of up to burst events; zero for no limit.
+// It must be called before any event.
+func (s *SyslogForwarder) SetRateLimit(perSecond float64, burst int) *SyslogForwarder {
+	s.rate = perSecond
+	s.burst = math.Max(float64(burst), 1)
+	s.tokens = s.burst
+	return s
+}
+
+// SetFormat sets the format of the messages, cef or leef. It must be called before any event.
+func (s *SyslogForwarder) SetFormat(format string) (*SyslogForwarder, error) {
+	switch format {
+	case "cef":
+		s.format = FormatCEF
+	case "leef":
+		s.format = FormatLEEF
+	default:
+		return s, errors.New(msgInvalidSIEMFormat)
+	}
+	return s, nil
+}
+
+// SetFacility sets the syslog facility, from 0 to 23, e.g. 4 for security messages or 16 to 23 for local0 to local7.
+// It must be called before any event.
+func (s *SyslogForwarder) SetFacility(facility int) *SyslogForwarder {
+	if facility >= 0 && facility <= 23 {
+		s.facility = facility
+	}
+	return s
+}
+
+// SetAppName sets the APP-NAME of the messages, ip2proxy by default. It must be called before any event.
+func (s *SyslogForwarder) SetAppName(name string) *SyslogForwarder {
+	s.appName = name
+	return s
+}
+
+// Forward queues the event unless over the rate limit or the queue is full, and returns whether it was queued.
+func (s *SyslogForwarder) Forward(e SIEMEvent) bool {
+	if !s.allow(time.Now()) {
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+	select {
+	case s.queue <- e:
+		return true
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+}
+
+// Hooks returns the hooks forwarding the decisions of a Middleware for the clients detected as proxies,
+// for Middleware.AddHooks.
+func (s *SyslogForwarder) Hooks() Hooks {
+	return Hooks{
+		OnDecision: func(event AuditEvent) {
+			if event.Record.IsProxy <= 0 {
+				return
+			}
+			e := SIEMEvent{ClientIP: event.ClientIP, Record: event.Record, Decision: event.Decision}
+			if event.Request != nil {
+				e.Request = event.Request.URL.Path
+			}
+			s.Forward(e)
+		},
+	}
+}
+
+// Dropped returns the number of events dropped so far.
+func (s *SyslogForwarder) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close sends the queued events and closes the connection. The events forwarded afterwards are dropped.
+func (s *SyslogForwarder) Close() error {
+	s.closeMu.Lock()
+	if s.closed {
+		s.closeMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.closeMu.Unlock()
+	<-s.done
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// token bucket of the rate limit
+func (s *SyslogForwarder) allow(now time.Time) bool {
+	if s.rate <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.last.IsZero() {
+		s.tokens = math.Min(s.burst, s.tokens+now.Sub(s.last).Seconds()*s.rate)
+	}
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// send the queued events, connecting again once after an error
+func (s *SyslogForwarder) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		msg := s.message(e)
+		if err := s.send(msg); err != nil {
+			if s.conn != nil {
+				s.conn.Close()
+				s.conn = nil
+			}
+			if err = s.send(msg); err != nil {
+				atomic.AddUint64(&s.dropped, 1)
+			}
+		}
+	}
+}
+
+func (s *SyslogForwarder) send(msg []byte) error {
+	if s.conn == nil {
+		var err error
+		dialer := &net.Dialer{Timeout: syslogTimeout}
+		if s.network == "tls" {
+			s.conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+		} else {
+			s.conn, err = dialer.Dial(s.network, s.addr)
+		}
+		if err != nil {
+			s.conn = nil
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// the RFC 5424 message, framed for TCP and TLS
+func (s *SyslogForwarder) message(e SIEMEvent) []byte {
+	id, _, _ := e.class()
+	severity := 6 // informational
+	switch e.Decision {
+	case DecisionDeny:
+		severity = 4 // warning
+	case DecisionChallenge:
+		severity = 5 // notice
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s", s.facility*8+severity,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.appName, os.Getpid(), id, s.format(e))
+	if s.network == "udp" {
+		return []byte(msg)
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
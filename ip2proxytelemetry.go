@@ -0,0 +1,108 @@
+package ip2proxy
+
+import (
+	"context"
+	"time"
+)
+
+// The Telemetry interface receives the metrics and spans of DB, ReloadableDB, WS and Middleware, so that
+// the package stays free of observability dependencies. The contrib/prometheus and contrib/otel modules
+// provide adapters. The implementations must be safe for concurrent use.
+type Telemetry interface {
+	// Count adds delta to the counter.
+	Count(name string, delta int64, attrs ...Attr)
+	// Observe records a value of the histogram.
+	Observe(name string, value float64, attrs ...Attr)
+	// StartSpan starts a span as a child of the span of ctx; end is called with the error of the operation.
+	StartSpan(ctx context.Context, name string, attrs ...Attr) (spanCtx context.Context, end func(err error))
+}
+
+// The Attr struct is an attribute of a metric or a span, a label for Prometheus.
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// The metrics and their attributes, always given in this order.
+const (
+	// MetricLookups counts the lookups by source (bin or webservice) and outcome (proxy, not_proxy,
+	// error, or unknown when the record has no answer, as for the lookups of fields other than IsProxy).
+	MetricLookups = "ip2proxy_lookups_total"
+	// MetricLookupDuration observes the duration of the lookups in seconds, by source.
+	MetricLookupDuration = "ip2proxy_lookup_duration_seconds"
+	// MetricDecisions counts the policy decisions of the middleware by decision (allow or deny) and
+	// shadow (true or false).
+	MetricDecisions = "ip2proxy_decisions_total"
+	// MetricReloads counts the BIN files swapped in by ReloadableDB, without attribute.
+	MetricReloads = "ip2proxy_reloads_total"
+)
+
+// The spans and their attributes.
+const (
+	// SpanLookup is a lookup, with the source attribute. The lookups of DB and WS have no context, their
+	// spans are roots.
+	SpanLookup = "ip2proxy.lookup"
+	// SpanEvaluate is a policy evaluation of the middleware, a child of the span of the request.
+	SpanEvaluate = "ip2proxy.evaluate"
+)
+
+// SetTelemetry sets the telemetry of the lookups. It must be called before any lookup.
+func (d *DB) SetTelemetry(t Telemetry) *DB {
+	d.telemetry = t
+	return d
+}
+
+// SetTelemetry sets the telemetry of the reloads and of the lookups, the BIN files swapped in included.
+// It must be called before any lookup.
+func (r *ReloadableDB) SetTelemetry(t Telemetry) *ReloadableDB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.telemetry = t
+	r.db.SetTelemetry(t)
+	return r
+}
+
+// SetTelemetry sets the telemetry of the web service lookups.
+func (w *WS) SetTelemetry(t Telemetry) *WS {
+	w.telemetry = t
+	return w
+}
+
+// SetTelemetry sets the telemetry of the policy evaluations. The lookups are measured by the telemetry of the resolver.
+func (m *Middleware) SetTelemetry(t Telemetry) *Middleware {
+	m.telemetry = t
+	return m
+}
+
+// start the span of a lookup
+func startLookup(t Telemetry, source string) (time.Time, func(err error)) {
+	_, end := t.StartSpan(context.Background(), SpanLookup, Attr{"source", source})
+	return time.Now(), end
+}
+
+// record the outcome and the duration of a lookup
+func recordLookup(t Telemetry, source string, started time.Time, isProxy int8, err error) {
+	outcome := "error"
+	switch {
+	case err != nil:
+	case isProxy > 0:
+		outcome = "proxy"
+	case isProxy == 0:
+		outcome = "not_proxy"
+	default:
+		outcome = "unknown"
+	}
+	t.Count(MetricLookups, 1, Attr{"source", source}, Attr{"outcome", outcome})
+	t.Observe(MetricLookupDuration, time.Since(started).Seconds(), Attr{"source", source})
+}
+
+// the outcome of a web service lookup as an IsProxy value
+func wsIsProxy(res IP2ProxyResult) int8 {
+	switch res.IsProxy {
+	case "YES":
+		return 1
+	case "NO":
+		return 0
+	}
+	return -1
+}
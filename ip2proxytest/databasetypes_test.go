@@ -0,0 +1,309 @@
+package ip2proxytest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// the sentinel messages of the lookups
+const (
+	messageNotSupported  = "NOT SUPPORTED"
+	messageInvalidIP     = "INVALID IP ADDRESS"
+	messageIPv6Missing   = "IPV6 ADDRESS MISSING IN IPV4 BIN"
+	messageNotApplicable = "-"
+)
+
+// a field of the records with its sample value
+type typeField struct {
+	name   string
+	mask   ip2proxy.FieldMask
+	column func(l ip2proxy.Layout) uint8
+	value  func(x *ip2proxy.IP2ProxyRecord) *string
+	get    func(db *ip2proxy.DB, ipAddress string) (string, error)
+	sample string
+}
+
+var typeFields = []typeField{
+	{"CountryShort", ip2proxy.FieldCountryShort, func(l ip2proxy.Layout) uint8 { return l.Country },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.CountryShort }, (*ip2proxy.DB).GetCountryShort, "US"},
+	{"CountryLong", ip2proxy.FieldCountryLong, func(l ip2proxy.Layout) uint8 { return l.Country },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.CountryLong }, (*ip2proxy.DB).GetCountryLong, "United States of America"},
+	{"Region", ip2proxy.FieldRegion, func(l ip2proxy.Layout) uint8 { return l.Region },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.Region }, (*ip2proxy.DB).GetRegion, "California"},
+	{"City", ip2proxy.FieldCity, func(l ip2proxy.Layout) uint8 { return l.City },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.City }, (*ip2proxy.DB).GetCity, "Los Angeles"},
+	{"Isp", ip2proxy.FieldIsp, func(l ip2proxy.Layout) uint8 { return l.Isp },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.Isp }, (*ip2proxy.DB).GetIsp, "Example Hosting"},
+	{"ProxyType", ip2proxy.FieldProxyType, func(l ip2proxy.Layout) uint8 { return l.ProxyType },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.ProxyType }, (*ip2proxy.DB).GetProxyType, "VPN"},
+	{"Domain", ip2proxy.FieldDomain, func(l ip2proxy.Layout) uint8 { return l.Domain },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.Domain }, (*ip2proxy.DB).GetDomain, "example.com"},
+	{"UsageType", ip2proxy.FieldUsageType, func(l ip2proxy.Layout) uint8 { return l.UsageType },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.UsageType }, (*ip2proxy.DB).GetUsageType, "DCH"},
+	{"Asn", ip2proxy.FieldAsn, func(l ip2proxy.Layout) uint8 { return l.Asn },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.Asn }, (*ip2proxy.DB).GetAsn, "64500"},
+	{"As", ip2proxy.FieldAs, func(l ip2proxy.Layout) uint8 { return l.As },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.As }, (*ip2proxy.DB).GetAs, "EXAMPLE-AS"},
+	{"LastSeen", ip2proxy.FieldLastSeen, func(l ip2proxy.Layout) uint8 { return l.LastSeen },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.LastSeen }, (*ip2proxy.DB).GetLastSeen, "7"},
+	{"Threat", ip2proxy.FieldThreat, func(l ip2proxy.Layout) uint8 { return l.Threat },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.Threat }, (*ip2proxy.DB).GetThreat, "SPAM"},
+	{"Provider", ip2proxy.FieldProvider, func(l ip2proxy.Layout) uint8 { return l.Provider },
+		func(x *ip2proxy.IP2ProxyRecord) *string { return &x.Provider }, (*ip2proxy.DB).GetProvider, "ExampleVPN"},
+}
+
+// the columns of the fields of each database type, in the order of typeFields, as documented by IP2Location
+// rather than taken from the position tables of the package
+var typeColumns = [][13]uint8{
+	1:  {2, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	2:  {3, 3, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0},
+	3:  {3, 3, 4, 5, 0, 2, 0, 0, 0, 0, 0, 0, 0},
+	4:  {3, 3, 4, 5, 6, 2, 0, 0, 0, 0, 0, 0, 0},
+	5:  {3, 3, 4, 5, 6, 2, 7, 0, 0, 0, 0, 0, 0},
+	6:  {3, 3, 4, 5, 6, 2, 7, 8, 0, 0, 0, 0, 0},
+	7:  {3, 3, 4, 5, 6, 2, 7, 8, 9, 10, 0, 0, 0},
+	8:  {3, 3, 4, 5, 6, 2, 7, 8, 9, 10, 11, 0, 0},
+	9:  {3, 3, 4, 5, 6, 2, 7, 8, 9, 10, 11, 12, 0},
+	10: {3, 3, 4, 5, 6, 2, 7, 8, 9, 10, 11, 12, 0},
+	11: {3, 3, 4, 5, 6, 2, 7, 8, 9, 10, 11, 12, 13},
+	12: {3, 3, 4, 5, 6, 2, 7, 8, 9, 10, 11, 12, 13},
+}
+
+// PX12 adds the fraud score in column 14 to the columns of PX11. The package reads it with the layout of PX11,
+// the latest database type it knows, the fraud score being read as a registered column.
+const (
+	typeLatestKnown   uint8 = 11
+	typeFraudScore          = "FraudScore"
+	typeFraudScoreCol uint8 = 14
+	typeFraudSample         = "99"
+)
+
+var errFraudScoreColumn = ip2proxy.RegisterColumn(ip2proxy.Column{
+	Name:      typeFraudScore,
+	Positions: []uint8{12: typeFraudScoreCol},
+	Type:      ip2proxy.ColumnString,
+})
+
+// the addresses of the synthetic BIN files: a proxy range of each IP version and addresses outside of it
+const (
+	typeProxyFrom   = "198.51.100.0"
+	typeProxyTo     = "198.51.100.255"
+	typeProxyIP     = "198.51.100.7"
+	typeProxyLastIP = "198.51.100.255"
+	typeOtherIP     = "198.51.101.0"
+	typeProxyFrom6  = "2001:db8::"
+	typeProxyTo6    = "2001:db8::ffff"
+	typeProxyIP6    = "2001:db8::7"
+	typeOtherIP6    = "2001:db8::1:0"
+)
+
+// TestDatabaseTypes builds a small synthetic BIN file of every database type, PX1 to PX12, and checks the
+// lookups of the package against the documented layouts: the columns of the fields, the fields returned,
+// read alone or all together, and the sentinel messages of the unsupported fields, of the addresses outside
+// of any proxy range, of invalid addresses and of IPv6 addresses in IPv4 files.
+func TestDatabaseTypes(t *testing.T) {
+	if errFraudScoreColumn != nil {
+		t.Fatal(errFraudScoreColumn)
+	}
+	for dbt := uint8(1); int(dbt) < len(typeColumns); dbt++ {
+		dbt := dbt
+		t.Run(fmt.Sprintf("PX%d", dbt), func(t *testing.T) {
+			for _, p := range checkDatabaseType(dbt) {
+				t.Error(p)
+			}
+		})
+	}
+}
+
+// build the BIN file of the database type, with IPv6 ranges or not
+func buildTypeDB(dbt uint8, ipv6 bool) (*ip2proxy.DB, error) {
+	var rec ip2proxy.IP2ProxyRecord
+	for _, f := range typeFields {
+		*f.value(&rec) = f.sample
+	}
+	ranges := []Range{{From: typeProxyFrom, To: typeProxyTo, Record: rec}}
+	if ipv6 {
+		ranges = append(ranges, Range{From: typeProxyFrom6, To: typeProxyTo6, Record: rec})
+	}
+	if dbt <= typeLatestKnown {
+		return OpenWrittenDB(dbt, ranges...)
+	}
+
+	// the Writer only writes the known types, the PX11 file gets the fraud score column
+	bin, err := writeBIN(typeLatestKnown, ranges...)
+	if err != nil {
+		return nil, err
+	}
+	return ip2proxy.OpenDBFromBytes(addFraudScore(bin))
+}
+
+// add the fraud score column of PX12 to a PX11 BIN file, the sample for the proxy rows and "-" for the others:
+// the rows grow by 4 bytes, moving the IPv6 rows and the strings, and the two strings are appended
+func addFraudScore(bin []byte) []byte {
+	columns := uint32(bin[1])
+	v4Count := binary.LittleEndian.Uint32(bin[5:])
+	v4Addr := binary.LittleEndian.Uint32(bin[9:]) - 1
+	v6Count := binary.LittleEndian.Uint32(bin[13:])
+	v6Addr := binary.LittleEndian.Uint32(bin[17:]) - 1
+
+	type section struct {
+		addr, rows, firstCol uint32
+	}
+	sections := []section{{v4Addr, v4Count + 1, 4}} // extra row holding the last IP To
+	moved := (v4Count + 1) << 2
+	if v6Count > 0 {
+		sections = append(sections, section{v6Addr, v6Count + 1, 16})
+		moved += (v6Count + 1) << 2
+	}
+
+	str := func(offset uint32) string {
+		return string(bin[offset+1 : offset+1+uint32(bin[offset])])
+	}
+	scoreAddr := uint32(len(bin)) + moved
+	dashAddr := scoreAddr + 1 + uint32(len(typeFraudSample))
+
+	out := append([]byte(nil), bin[:v4Addr]...)
+	end := v4Addr
+	for _, sec := range sections {
+		size := sec.firstCol + (columns-1)<<2
+		for i := uint32(0); i < sec.rows; i++ {
+			row := make([]byte, size+4)
+			copy(row, bin[sec.addr+i*size:sec.addr+(i+1)*size])
+			for c := sec.firstCol; c < size; c += 4 {
+				binary.LittleEndian.PutUint32(row[c:], binary.LittleEndian.Uint32(row[c:])+moved)
+			}
+			binary.LittleEndian.PutUint32(row[size:], scoreAddr)
+			if str(binary.LittleEndian.Uint32(bin[sec.addr+i*size+sec.firstCol:])) == messageNotApplicable {
+				binary.LittleEndian.PutUint32(row[size:], dashAddr)
+			}
+			out = append(out, row...)
+		}
+		end = sec.addr + sec.rows*size
+	}
+	out = append(out, bin[end:]...)
+	out = append(append(out, uint8(len(typeFraudSample))), typeFraudSample...)
+	out = append(append(out, uint8(len(messageNotApplicable))), messageNotApplicable...)
+
+	out[0] = 12
+	out[1] = uint8(columns + 1)
+	if v6Count > 0 {
+		binary.LittleEndian.PutUint32(out[17:], v6Addr+1+(v4Count+1)<<2)
+	}
+	binary.LittleEndian.PutUint32(out[31:], uint32(len(out)))
+	return out
+}
+
+func checkDatabaseType(dbt uint8) []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	known := dbt
+	if known > typeLatestKnown {
+		known = typeLatestKnown
+	}
+	layout, err := ip2proxy.DatabaseLayout(known)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var supported ip2proxy.FieldMask = ip2proxy.FieldIsProxy
+	for i, f := range typeFields {
+		if got := f.column(layout); got != typeColumns[dbt][i] {
+			report("%s in column %d instead of %d", f.name, got, typeColumns[dbt][i])
+		}
+		if typeColumns[dbt][i] > 0 {
+			supported |= f.mask
+		}
+	}
+
+	db, err := buildTypeDB(dbt, true)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	defer db.Close()
+	if got := db.Fields(); got != supported {
+		report("fields %s instead of %s", got, supported)
+	}
+
+	check := func(ipAddress string, isProxy int8, value func(f typeField) string) {
+		rec, err := db.GetAll(ipAddress)
+		if err != nil {
+			report("%s: %v", ipAddress, err)
+			return
+		}
+		if rec.IsProxy != isProxy {
+			report("%s: IsProxy %d instead of %d", ipAddress, rec.IsProxy, isProxy)
+		}
+		for _, f := range typeFields {
+			want := value(f)
+			if got := *f.value(&rec); got != want {
+				report("%s: %s %q instead of %q", ipAddress, f.name, got, want)
+			}
+			if got, err := f.get(db, ipAddress); err != nil || got != want {
+				report("%s: Get%s %q (%v) instead of %q", ipAddress, f.name, got, err, want)
+			}
+		}
+		if dbt <= typeLatestKnown {
+			return
+		}
+
+		want := typeFraudSample
+		if isProxy == 0 {
+			want = messageNotApplicable
+		}
+		_, extra, err := db.GetAllExtra(ipAddress)
+		if err != nil {
+			report("%s: %v", ipAddress, err)
+		} else if isProxy == -1 && extra != nil {
+			report("%s: extra fields %v instead of none", ipAddress, extra)
+		} else if isProxy != -1 && extra[typeFraudScore] != want {
+			report("%s: %s %q instead of %q", ipAddress, typeFraudScore, extra[typeFraudScore], want)
+		}
+	}
+	proxy := func(f typeField) string {
+		if !supported.Has(f.mask) {
+			return messageNotSupported
+		}
+		return f.sample
+	}
+	other := func(f typeField) string {
+		if !supported.Has(f.mask) {
+			return messageNotSupported
+		}
+		return messageNotApplicable
+	}
+	message := func(msg string) func(f typeField) string {
+		return func(f typeField) string { return msg }
+	}
+
+	// IsProxy is 1 for VPN and for the types without proxy type, as the country is set
+	check(typeProxyIP, 1, proxy)
+	check(typeProxyFrom, 1, proxy)
+	check(typeProxyLastIP, 1, proxy)
+	check(typeOtherIP, 0, other)
+	check(typeProxyIP6, 1, proxy)
+	check(typeOtherIP6, 0, other)
+	check("not an address", -1, message(messageInvalidIP))
+
+	db.SetUnsupportedFields(ip2proxy.UnsupportedAsEmpty)
+	check(typeProxyIP, 1, func(f typeField) string {
+		if !supported.Has(f.mask) {
+			return ""
+		}
+		return f.sample
+	})
+
+	db4, err := buildTypeDB(dbt, false)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	defer db4.Close()
+	db = db4
+	check(typeProxyIP, 1, proxy)
+	check(typeProxyIP6, -1, message(messageIPv6Missing))
+	return problems
+}
@@ -0,0 +1,40 @@
+package ip2proxytest
+
+import (
+	"github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/internal/sampledb"
+)
+
+// The addresses of the sample BIN file of OpenSampleDB, one per proxy type of the IPv4 ranges.
+const (
+	SampleVPN = "192.0.2.1"
+	SampleTOR = "192.0.2.65"
+	SampleDCH = "192.0.2.129"
+	SamplePUB = "198.51.100.1"
+	SampleWEB = "198.51.100.129"
+	SampleSES = "203.0.113.1"
+	SampleRES = "203.0.113.33"
+	SampleCPN = "203.0.113.65"
+	SampleEPN = "203.0.113.97"
+	// SampleVPN6 is in an IPv6 VPN range
+	SampleVPN6 = "2001:db8::1"
+	// SampleNotProxy is outside of the proxy ranges
+	SampleNotProxy = "192.0.2.200"
+)
+
+// OpenSampleDB opens the sample PX11 BIN file embedded in the module, a few ranges of the documentation address
+// blocks with every proxy type, for the tests and examples to run without downloading a database.
+func OpenSampleDB() (*ip2proxy.DB, error) {
+	return sampledb.Open()
+}
+
+// SampleBytes returns the sample BIN file of OpenSampleDB, e.g. for OpenDBFromBytes. The slice is shared and must
+// not be modified.
+func SampleBytes() ([]byte, error) {
+	return sampledb.Bytes()
+}
+
+// SampleKnownAnswers returns the known answers of the sample BIN file of OpenSampleDB.
+func SampleKnownAnswers() ([]ip2proxy.KnownAnswer, error) {
+	return sampledb.KnownAnswers()
+}
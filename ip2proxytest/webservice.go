@@ -0,0 +1,264 @@
+// Package ip2proxytest provides a stub of the IP2Proxy Web Service, so that applications can test
+// their web service code paths offline:
+//
+//	srv := ip2proxytest.NewWebServiceServer()
+//	defer srv.Close()
+//	srv.SetResult("1.2.3.4", ip2proxy.IP2ProxyResult{IsProxy: "YES", ProxyType: "VPN", CountryCode: "US"})
+//	srv.SetHTTPStatus("5.6.7.8", http.StatusServiceUnavailable)
+//	ws, err := srv.OpenWS("PX11")
+//
+// OpenSampleDB opens a small sample BIN file embedded in the module:
+//
+//	db, err := ip2proxytest.OpenSampleDB()
+//	rec, err := db.GetAll(ip2proxytest.SampleTOR)
+//
+// OpenWrittenDB writes one of the database type and ranges given:
+//
+//	db, err := ip2proxytest.OpenWrittenDB(2, ip2proxytest.Range{From: "192.0.2.0", To: "192.0.2.255", Record: rec})
+package ip2proxytest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// APIKey is the API key of the web services opened with WebServiceServer.OpenWS.
+const APIKey = "TESTKEY000"
+
+// The responses of the stub in the error scenarios, as those of api.ip2proxy.com.
+const (
+	ResponseInvalidAccount     = "INVALID ACCOUNT"
+	ResponseInvalidPackage     = "INVALID PACKAGE"
+	ResponseInvalidIP          = "INVALID IP ADDRESS"
+	ResponseInsufficientCredit = "INSUFFICIENT CREDIT"
+)
+
+// The WebServiceServer struct is an HTTP server answering like api.ip2proxy.com. The addresses without
+// fixture are returned as not proxies. The setters may be called while requests are served.
+type WebServiceServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	results    map[string]ip2proxy.IP2ProxyResult
+	statuses   map[string]int // HTTP error status by IP address
+	apiKey     string         // empty to accept every key
+	maxPackage int
+	credit     int // negative for unlimited
+	requests   int
+}
+
+// NewWebServiceServer starts a stub web service accepting every API key and package, with unlimited credit.
+// It must be closed with Close.
+func NewWebServiceServer() *WebServiceServer {
+	var s = &WebServiceServer{}
+	s.results = make(map[string]ip2proxy.IP2ProxyResult)
+	s.statuses = make(map[string]int)
+	s.maxPackage = 12
+	s.credit = -1
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// OpenWS opens a web service with the package sending its requests to the stub.
+func (s *WebServiceServer) OpenWS(apiPackage string) (*ip2proxy.WS, error) {
+	ws, err := ip2proxy.OpenWS(APIKey, apiPackage, false)
+	if err != nil {
+		return nil, err
+	}
+	return ws.SetBaseURL(s.URL), nil
+}
+
+// SetResult sets the result of the IP address. Response defaults to OK and IP to the address; the fields
+// which the requested package does not return are left out. A Response other than OK is returned alone,
+// e.g. to emulate an error message of the web service.
+func (s *WebServiceServer) SetResult(ipAddress string, res ip2proxy.IP2ProxyResult) *WebServiceServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[normalizeIP(ipAddress)] = res
+	return s
+}
+
+// SetHTTPStatus makes the lookups of the IP address fail with the HTTP status, 0 to remove the failure.
+func (s *WebServiceServer) SetHTTPStatus(ipAddress string, status int) *WebServiceServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.statuses, normalizeIP(ipAddress))
+	} else {
+		s.statuses[normalizeIP(ipAddress)] = status
+	}
+	return s
+}
+
+// SetAPIKey restricts the stub to the API key, the others being answered with ResponseInvalidAccount.
+func (s *WebServiceServer) SetAPIKey(apiKey string) *WebServiceServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKey = apiKey
+	return s
+}
+
+// SetMaxPackage sets the highest package of the subscription, e.g. PX4; the lookups with higher packages
+// are answered with ResponseInvalidPackage.
+func (s *WebServiceServer) SetMaxPackage(apiPackage string) *WebServiceServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPackage = packageNumber(apiPackage)
+	return s
+}
+
+// SetCredit sets the credit balance, negative for unlimited. Every successful lookup uses a credit; once
+// none is left, the lookups are answered with ResponseInsufficientCredit.
+func (s *WebServiceServer) SetCredit(credit int) *WebServiceServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credit = credit
+	return s
+}
+
+// Credit returns the credit balance, negative when unlimited.
+func (s *WebServiceServer) Credit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.credit
+}
+
+// Requests returns the number of requests served, credit checks included, e.g. to test caching.
+func (s *WebServiceServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *WebServiceServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	q := r.URL.Query()
+	if s.apiKey != "" && q.Get("key") != s.apiKey {
+		writeResponse(w, map[string]string{"response": ResponseInvalidAccount})
+		return
+	}
+	if q.Get("check") == "true" {
+		credit := "UNLIMITED"
+		if s.credit >= 0 {
+			credit = strconv.Itoa(s.credit)
+		}
+		writeResponse(w, map[string]string{"response": credit})
+		return
+	}
+
+	ip := normalizeIP(q.Get("ip"))
+	if status, ok := s.statuses[ip]; ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	n := packageNumber(q.Get("package"))
+	switch {
+	case n == 0 || n > s.maxPackage:
+		writeResponse(w, map[string]string{"response": ResponseInvalidPackage})
+		return
+	case net.ParseIP(ip) == nil:
+		writeResponse(w, map[string]string{"response": ResponseInvalidIP})
+		return
+	case s.credit == 0:
+		writeResponse(w, map[string]string{"response": ResponseInsufficientCredit})
+		return
+	}
+
+	res, ok := s.results[ip]
+	if !ok {
+		res = notProxy()
+	}
+	if res.Response != "" && res.Response != "OK" {
+		writeResponse(w, map[string]string{"response": res.Response})
+		return
+	}
+	if s.credit > 0 {
+		s.credit--
+	}
+	fields, _ := ip2proxy.PackageFields("PX" + strconv.Itoa(n))
+	writeResponse(w, packageResult(ip, res, fields))
+}
+
+// the result of the addresses without fixture
+func notProxy() ip2proxy.IP2ProxyResult {
+	return ip2proxy.IP2ProxyResult{
+		CountryCode: "-",
+		CountryName: "-",
+		RegionName:  "-",
+		CityName:    "-",
+		ISP:         "-",
+		Domain:      "-",
+		UsageType:   "-",
+		ASN:         "-",
+		AS:          "-",
+		LastSeen:    "-",
+		ProxyType:   "-",
+		Threat:      "-",
+		IsProxy:     "NO",
+		Provider:    "-",
+	}
+}
+
+// the members of the result returned by a package with the fields
+func packageResult(ip string, res ip2proxy.IP2ProxyResult, fields ip2proxy.FieldMask) map[string]string {
+	if res.IP == "" {
+		res.IP = ip
+	}
+	m := map[string]string{"response": "OK", "ip": res.IP, "isProxy": res.IsProxy}
+	for _, f := range []struct {
+		field ip2proxy.FieldMask
+		name  string
+		value string
+	}{
+		{ip2proxy.FieldCountryShort, "countryCode", res.CountryCode},
+		{ip2proxy.FieldCountryLong, "countryName", res.CountryName},
+		{ip2proxy.FieldRegion, "regionName", res.RegionName},
+		{ip2proxy.FieldCity, "cityName", res.CityName},
+		{ip2proxy.FieldIsp, "isp", res.ISP},
+		{ip2proxy.FieldDomain, "domain", res.Domain},
+		{ip2proxy.FieldUsageType, "usageType", res.UsageType},
+		{ip2proxy.FieldAsn, "asn", res.ASN},
+		{ip2proxy.FieldAs, "as", res.AS},
+		{ip2proxy.FieldLastSeen, "lastSeen", res.LastSeen},
+		{ip2proxy.FieldProxyType, "proxyType", res.ProxyType},
+		{ip2proxy.FieldThreat, "threat", res.Threat},
+		{ip2proxy.FieldProvider, "provider", res.Provider},
+	} {
+		if fields.Has(f.field) {
+			m[f.name] = f.value
+		}
+	}
+	return m
+}
+
+func writeResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// number of the package, 0 if invalid
+func packageNumber(apiPackage string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(apiPackage), "PX"))
+	if err != nil || n < 1 || n > 12 || !strings.HasPrefix(strings.ToUpper(apiPackage), "PX") {
+		return 0
+	}
+	return n
+}
+
+// the fixtures are keyed by the canonical form of the addresses
+func normalizeIP(ipAddress string) string {
+	if ip := net.ParseIP(ipAddress); ip != nil {
+		return ip.String()
+	}
+	return ipAddress
+}
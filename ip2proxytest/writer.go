@@ -0,0 +1,44 @@
+package ip2proxytest
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ip2location/ip2proxy-go/v4"
+)
+
+// The Range struct is a range of the BIN files of OpenWrittenDB with its proxy record.
+type Range struct {
+	From   string
+	To     string
+	Record ip2proxy.IP2ProxyRecord
+}
+
+// OpenWrittenDB writes a BIN file of the database type dated 2024-01-15 with the ranges and opens it from memory,
+// for the tests of the database types other than PX11 and of the records not in the sample BIN file.
+func OpenWrittenDB(databaseType uint8, ranges ...Range) (*ip2proxy.DB, error) {
+	bin, err := writeBIN(databaseType, ranges...)
+	if err != nil {
+		return nil, err
+	}
+	return ip2proxy.OpenDBFromBytes(bin)
+}
+
+// the BIN file of OpenWrittenDB
+func writeBIN(databaseType uint8, ranges ...Range) ([]byte, error) {
+	w, err := ip2proxy.NewWriter(databaseType, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranges {
+		if err := w.AddRange(r.From, r.To, r.Record); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
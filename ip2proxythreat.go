@@ -0,0 +1,87 @@
+package ip2proxy
+
+import "strings"
+
+// The ThreatSet type is the set of threats of a record, parsed from values like "SPAM/BOTNET".
+type ThreatSet uint8
+
+// The threats reported by the Threat column.
+const (
+	ThreatSpam ThreatSet = 1 << iota
+	ThreatScanner
+	ThreatBotnet
+	ThreatBogon
+	// ThreatUnknown is set for the values this version of the package does not know.
+	ThreatUnknown
+)
+
+var threatNames = []struct {
+	threat ThreatSet
+	name   string
+}{
+	{ThreatSpam, "SPAM"},
+	{ThreatScanner, "SCANNER"},
+	{ThreatBotnet, "BOTNET"},
+	{ThreatBogon, "BOGON"},
+}
+
+// ParseThreat returns the set of threats of the Threat column value; empty for "-", "" and the sentinel messages.
+func ParseThreat(threat string) ThreatSet {
+	threat = strings.TrimSpace(threat)
+	if threat == "" || threat == "-" || threat == msgNotSupported || threat == msgInvalidIP || threat == msgMissingFile ||
+		threat == msgIPV6Unsupported {
+		return 0
+	}
+
+	var s ThreatSet
+	for _, part := range strings.Split(threat, "/") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		known := false
+		for _, t := range threatNames {
+			if t.name == part {
+				s |= t.threat
+				known = true
+				break
+			}
+		}
+		if !known {
+			s |= ThreatUnknown
+		}
+	}
+	return s
+}
+
+// Has checks whether the set contains all the given threats.
+func (s ThreatSet) Has(threats ThreatSet) bool {
+	return s&threats == threats
+}
+
+// Any checks whether the set contains one of the given threats.
+func (s ThreatSet) Any(threats ThreatSet) bool {
+	return s&threats != 0
+}
+
+// String returns the threats joined with a slash like the Threat column, e.g. SPAM/BOTNET; "-" for the empty set.
+func (s ThreatSet) String() string {
+	if s == 0 {
+		return "-"
+	}
+	var names []string
+	for _, t := range threatNames {
+		if s&t.threat != 0 {
+			names = append(names, t.name)
+		}
+	}
+	if s&ThreatUnknown != 0 {
+		names = append(names, "UNKNOWN")
+	}
+	return strings.Join(names, "/")
+}
+
+// Threats returns the set of threats of the record.
+func (r IP2ProxyRecord) Threats() ThreatSet {
+	return ParseThreat(r.Threat)
+}
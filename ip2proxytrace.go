@@ -0,0 +1,72 @@
+package ip2proxy
+
+// The QueryTrace struct records how a query was resolved, to diagnose why an IP address
+// matched a row or did not match any.
+type QueryTrace struct {
+	IPAddress string
+	IPType    int    // 4 or 6 after remapping IPv4-mapped, 6to4 and Teredo addresses; 0 if invalid
+	IPNumber  string // decimal IP number searched for, empty with a redactor
+	Indexed   bool
+
+	// offset of the index entry and the row bounds it gave; the whole table if not indexed
+	IndexOffset uint32
+	Low         uint32
+	High        uint32
+
+	Steps   []TraceStep
+	Matched bool
+	Record  IP2ProxyRecord
+}
+
+// The TraceStep struct is a step of the binary search, comparing the IP number with the range of the middle row.
+type TraceStep struct {
+	Low       uint32
+	Mid       uint32
+	High      uint32
+	RowOffset uint32
+	IPFrom    string
+	IPTo      string // exclusive, the IP From of the next row
+}
+
+// Trace queries the IP address like GetAll and records the binary search trail.
+func (d *DB) Trace(ipAddress string) (QueryTrace, error) {
+	var t QueryTrace
+	t.IPAddress = d.redact.apply(ipAddress)
+	t.Record = loadMessage(msgNotSupported)
+
+	if !d.metaOK {
+		t.Record = loadMessage(msgMissingFile)
+		return t, nil
+	}
+
+	ipType, ipNo, ipIndex := d.checkIP(ipAddress)
+	t.IPType = int(ipType)
+	if ipType == 0 {
+		t.Record = loadMessage(msgInvalidIP)
+		return t, nil
+	}
+	if d.redact == nil {
+		t.IPNumber = ipNo.String()
+	}
+
+	if ipType == 6 && d.meta.ipV6DatabaseCount == 0 {
+		t.Record = loadMessage(msgIPV6Unsupported)
+		return t, nil
+	}
+
+	t.Indexed = ipIndex > 0
+	if ipType == 4 {
+		t.High = d.meta.ipV4DatabaseCount
+	} else {
+		t.High = d.meta.ipV6DatabaseCount
+	}
+
+	row, _, _, err := d.searchRow(ipType, ipNo, ipIndex, &t)
+	if err != nil || row == nil {
+		return t, err
+	}
+
+	t.Matched = true
+	t.Record, err = d.readRecord(row, all)
+	return t, err
+}
@@ -0,0 +1,82 @@
+package ip2proxy
+
+import "strings"
+
+// The UsageType type is the usage type code of the records, e.g. UsageType(rec.UsageType).Description().
+// Some ranges combine several codes separated by a slash, e.g. ISP/MOB.
+type UsageType string
+
+// The usage types, see https://www.ip2location.com/database/ip2proxy for their definitions.
+const (
+	UsageTypeCommercial   UsageType = "COM"
+	UsageTypeOrganization UsageType = "ORG"
+	UsageTypeGovernment   UsageType = "GOV"
+	UsageTypeMilitary     UsageType = "MIL"
+	UsageTypeEducation    UsageType = "EDU"
+	UsageTypeLibrary      UsageType = "LIB"
+	UsageTypeCDN          UsageType = "CDN"
+	UsageTypeFixedISP     UsageType = "ISP"
+	UsageTypeMobileISP    UsageType = "MOB"
+	UsageTypeDataCenter   UsageType = "DCH"
+	UsageTypeSearchEngine UsageType = "SES"
+	UsageTypeReserved     UsageType = "RSV"
+)
+
+var usageTypeDescriptions = map[UsageType]string{
+	UsageTypeCommercial:   "Commercial",
+	UsageTypeOrganization: "Organization",
+	UsageTypeGovernment:   "Government",
+	UsageTypeMilitary:     "Military",
+	UsageTypeEducation:    "University/College/School",
+	UsageTypeLibrary:      "Library",
+	UsageTypeCDN:          "Content Delivery Network",
+	UsageTypeFixedISP:     "Fixed Line ISP",
+	UsageTypeMobileISP:    "Mobile ISP",
+	UsageTypeDataCenter:   "Data Center/Web Hosting/Transit",
+	UsageTypeSearchEngine: "Search Engine Spider",
+	UsageTypeReserved:     "Reserved",
+}
+
+// Description returns the human-readable description of the usage type, those of combined codes joined
+// with " / "; empty for unknown codes, "-" and the sentinel messages.
+func (u UsageType) Description() string {
+	if d, ok := usageTypeDescriptions[u]; ok {
+		return d
+	}
+	codes := u.Codes()
+	if len(codes) < 2 {
+		return ""
+	}
+	descriptions := make([]string, len(codes))
+	for i, c := range codes {
+		d, ok := usageTypeDescriptions[c]
+		if !ok {
+			return ""
+		}
+		descriptions[i] = d
+	}
+	return strings.Join(descriptions, " / ")
+}
+
+// Codes returns the codes of a combined usage type, e.g. ISP and MOB for ISP/MOB.
+func (u UsageType) Codes() []UsageType {
+	if u == "" {
+		return nil
+	}
+	parts := strings.Split(string(u), "/")
+	codes := make([]UsageType, len(parts))
+	for i, p := range parts {
+		codes[i] = UsageType(p)
+	}
+	return codes
+}
+
+// Is checks whether the usage type is the code or a combination including it.
+func (u UsageType) Is(code UsageType) bool {
+	for _, c := range u.Codes() {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
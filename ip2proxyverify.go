@@ -0,0 +1,110 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The KnownAnswer struct is an expected lookup result used to validate a BIN file.
+// Tier is the product tier the answer applies to, e.g. "PX2", or "*" for every tier.
+// Expect maps field names, as used by filter expressions, to the expected values.
+type KnownAnswer struct {
+	Tier   string
+	IP     string
+	Expect map[string]string
+	Line   int
+}
+
+// The AnswerMismatch struct describes a field not matching its known answer.
+type AnswerMismatch struct {
+	Answer   KnownAnswer
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (m AnswerMismatch) String() string {
+	return "line " + strconv.Itoa(m.Answer.Line) + ": " + m.Answer.IP + " " + m.Field + " is " + strconv.Quote(m.Actual) + ", expected " + strconv.Quote(m.Expected)
+}
+
+const msgInvalidAnswer string = "Invalid known answer"
+
+// ParseKnownAnswers reads known answers, one per line as the tier, the IP address and
+// field=value pairs separated by spaces, e.g.
+//
+//	PX2  192.0.2.1  proxy_type=VPN
+//	*    127.0.0.1  is_proxy=0 proxy_type=-
+//
+// Values containing spaces are quoted. Empty lines and lines starting with # are ignored.
+func ParseKnownAnswers(in io.Reader) ([]KnownAnswer, error) {
+	var answers []KnownAnswer
+	s := bufio.NewScanner(in)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		tokens := tokenizeFilter(text)
+		if len(tokens) < 2 {
+			return nil, errors.New(msgInvalidAnswer + " on line " + strconv.Itoa(line) + ".")
+		}
+
+		a := KnownAnswer{Tier: strings.ToUpper(tokens[0].text), IP: tokens[1].text, Expect: make(map[string]string), Line: line}
+		rest := tokens[2:]
+		for len(rest) > 0 {
+			if len(rest) < 3 || rest[1].text != "=" || rest[1].quoted {
+				return nil, errors.New(msgInvalidAnswer + " on line " + strconv.Itoa(line) + ".")
+			}
+			if _, ok := filterField(rest[0].text); !ok {
+				return nil, errors.New(msgInvalidAnswer + " on line " + strconv.Itoa(line) + ": unknown field " + rest[0].text + ".")
+			}
+			a.Expect[rest[0].text] = rest[2].text
+			rest = rest[3:]
+		}
+		answers = append(answers, a)
+	}
+	return answers, s.Err()
+}
+
+// VerifyKnownAnswers looks up the known answers applying to the tier of the BIN file and returns
+// the fields not matching, along with the number of answers checked.
+func (d *DB) VerifyKnownAnswers(answers []KnownAnswer) ([]AnswerMismatch, int, error) {
+	tier := "PX" + d.PackageVersion()
+
+	var mismatches []AnswerMismatch
+	checked := 0
+	for _, a := range answers {
+		if a.Tier != "*" && a.Tier != tier {
+			continue
+		}
+		checked++
+
+		rec, err := d.GetAll(a.IP)
+		if err != nil {
+			return mismatches, checked, err
+		}
+
+		names := make([]string, 0, len(a.Expect))
+		for name := range a.Expect {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			expected := a.Expect[name]
+			field, _ := filterField(name)
+			actual, _ := recordField(rec, field)
+			if actual != expected {
+				mismatches = append(mismatches, AnswerMismatch{Answer: a, Field: name, Expected: expected, Actual: actual})
+			}
+		}
+	}
+	return mismatches, checked, nil
+}
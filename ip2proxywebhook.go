@@ -0,0 +1,277 @@
+package ip2proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The WebhookRule struct selects the lookups a WebhookDispatcher posts events for: the records selected by the
+// filter, every proxy if nil, for the requests whose path starts with PathPrefix, e.g. the filter
+// "threat contains BOTNET" with the path prefix /login. Name identifies the rule in the events.
+type WebhookRule struct {
+	Name       string
+	Filter     *Filter
+	PathPrefix string
+}
+
+// The WebhookDispatcher struct posts JSON events to an HTTP endpoint for the lookups matching its rules, in the
+// background, retrying the failed deliveries with exponential backoff. With a secret, the events are signed:
+// the X-IP2Proxy-Signature header is sha256= followed by the hex HMAC-SHA256 of the X-IP2Proxy-Timestamp header,
+// a dot and the body, see VerifyWebhookSignature. The events arriving while the queue is full are dropped.
+type WebhookDispatcher struct {
+	dropped uint64 // accessed atomically, kept first for 64-bit alignment
+	failed  uint64
+
+	endpoint string
+	secret   []byte
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	rules    []WebhookRule
+	path     func(r *http.Request) string
+
+	closeMu sync.RWMutex
+	closed  bool
+	queue   chan []byte
+	wg      sync.WaitGroup
+}
+
+// JSON event posted to the endpoint
+type webhookEvent struct {
+	Rule     string        `json:"rule"`
+	Time     string        `json:"time"`
+	IP       string        `json:"ip"`
+	Path     string        `json:"path,omitempty"`
+	Decision string        `json:"decision,omitempty"`
+	Record   webhookRecord `json:"record"`
+}
+
+type webhookRecord struct {
+	IsProxy     int8   `json:"isProxy"`
+	ProxyType   string `json:"proxyType"`
+	CountryCode string `json:"countryCode"`
+	CountryName string `json:"countryName"`
+	RegionName  string `json:"regionName"`
+	CityName    string `json:"cityName"`
+	ISP         string `json:"isp"`
+	Domain      string `json:"domain"`
+	UsageType   string `json:"usageType"`
+	ASN         string `json:"asn"`
+	AS          string `json:"as"`
+	LastSeen    string `json:"lastSeen"`
+	Threat      string `json:"threat"`
+	Provider    string `json:"provider"`
+}
+
+// queued events before dropping, and goroutines posting them
+const webhookQueueSize = 1024
+const webhookWorkers = 4
+
+const msgInvalidWebhookURL string = "Invalid webhook URL."
+
+// NewWebhookDispatcher initializes with the http:// or https:// URL of the endpoint and the secret of the
+// signatures, nil not to sign the events. The deliveries are attempted 3 times, 1 second apart then 2.
+func NewWebhookDispatcher(endpoint string, secret []byte) (*WebhookDispatcher, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New(msgInvalidWebhookURL)
+	}
+
+	var d = &WebhookDispatcher{}
+	d.endpoint = endpoint
+	d.secret = secret
+	d.client = &http.Client{Timeout: 10 * time.Second}
+	d.attempts = 3
+	d.backoff = time.Second
+	d.path = func(r *http.Request) string { return r.URL.Path }
+	d.queue = make(chan []byte, webhookQueueSize)
+	for i := 0; i < webhookWorkers; i++ {
+		d.wg.Add(1)
+		go d.run()
+	}
+	return d, nil
+}
+
+// AddRule adds a rule; an event is posted for every rule matching a lookup. It must be called before any lookup.
+func (d *WebhookDispatcher) AddRule(rule WebhookRule) *WebhookDispatcher {
+	d.rules = append(d.rules, rule)
+	return d
+}
+
+// SetRetries sets how many times a delivery is attempted and the wait before the first retry, doubled for every
+// following one. The deliveries answered by 2xx, or by 4xx other than 429, are not retried. It must be called
+// before any lookup.
+func (d *WebhookDispatcher) SetRetries(attempts int, backoff time.Duration) *WebhookDispatcher {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d.attempts = attempts
+	d.backoff = backoff
+	return d
+}
+
+// SetTimeout sets the timeout of the deliveries; 10 seconds by default. It must be called before any lookup.
+func (d *WebhookDispatcher) SetTimeout(timeout time.Duration) *WebhookDispatcher {
+	d.client.Timeout = timeout
+	return d
+}
+
+// SetRequestPath sets how the path matched against the path prefixes of the rules is taken from the requests,
+// e.g. from X-Forwarded-Uri behind a forward authentication proxy; the path of the URL by default. It must be
+// called before any lookup.
+func (d *WebhookDispatcher) SetRequestPath(path func(r *http.Request) string) *WebhookDispatcher {
+	d.path = path
+	return d
+}
+
+// Hooks returns the hooks posting the events for the decisions of a Middleware, for Middleware.AddHooks.
+func (d *WebhookDispatcher) Hooks() Hooks {
+	return Hooks{
+		OnDecision: func(event AuditEvent) {
+			path := ""
+			if event.Request != nil {
+				path = d.path(event.Request)
+			}
+			d.Dispatch(event.ClientIP, path, event.Record, event.Decision)
+		},
+	}
+}
+
+// Dispatch queues an event for every rule matching the lookup and returns the number queued. The path is empty
+// outside of HTTP requests, matching the rules without path prefix only; the decision may be DecisionNone.
+func (d *WebhookDispatcher) Dispatch(ipAddress string, path string, rec IP2ProxyRecord, decision Decision) int {
+	n := 0
+	for _, rule := range d.rules {
+		if !rule.match(path, rec) {
+			continue
+		}
+		e := webhookEvent{Rule: rule.Name, Time: time.Now().UTC().Format(time.RFC3339Nano), IP: ipAddress, Path: path}
+		if decision != DecisionNone {
+			e.Decision = decision.String()
+		}
+		e.Record = webhookRecord{rec.IsProxy, rec.ProxyType, rec.CountryShort, rec.CountryLong, rec.Region, rec.City,
+			rec.Isp, rec.Domain, rec.UsageType, rec.Asn, rec.As, rec.LastSeen, rec.Threat, rec.Provider}
+		body, err := json.Marshal(e)
+		if err == nil && d.enqueue(body) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r WebhookRule) match(path string, rec IP2ProxyRecord) bool {
+	if r.PathPrefix != "" && !strings.HasPrefix(path, r.PathPrefix) {
+		return false
+	}
+	if r.Filter == nil {
+		return rec.IsProxy > 0
+	}
+	return r.Filter.Match(rec)
+}
+
+func (d *WebhookDispatcher) enqueue(body []byte) bool {
+	d.closeMu.RLock()
+	defer d.closeMu.RUnlock()
+	if !d.closed {
+		select {
+		case d.queue <- body:
+			return true
+		default:
+		}
+	}
+	atomic.AddUint64(&d.dropped, 1)
+	return false
+}
+
+// Dropped returns the number of events dropped because the queue was full.
+func (d *WebhookDispatcher) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Failed returns the number of events not delivered after all the attempts.
+func (d *WebhookDispatcher) Failed() uint64 {
+	return atomic.LoadUint64(&d.failed)
+}
+
+// Close delivers the queued events, retries included, and stops the dispatcher. The events dispatched
+// afterwards are dropped.
+func (d *WebhookDispatcher) Close() error {
+	d.closeMu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.closeMu.Unlock()
+	d.wg.Wait()
+	return nil
+}
+
+func (d *WebhookDispatcher) run() {
+	defer d.wg.Done()
+	for body := range d.queue {
+		wait := d.backoff
+		for attempt := 1; ; attempt++ {
+			retry, err := d.post(body)
+			if err == nil {
+				break
+			}
+			if !retry || attempt >= d.attempts {
+				atomic.AddUint64(&d.failed, 1)
+				break
+			}
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+}
+
+// post the event, returning whether a failure is worth retrying
+func (d *WebhookDispatcher) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, d.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "IP2Proxy/"+ModuleVersion())
+	if d.secret != nil {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-IP2Proxy-Timestamp", ts)
+		req.Header.Set("X-IP2Proxy-Signature", webhookSignature(d.secret, ts, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, errors.New(resp.Status)
+}
+
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the X-IP2Proxy-Signature header of an event received from a WebhookDispatcher,
+// given its X-IP2Proxy-Timestamp header and body. The receivers should also reject the timestamps too far in the
+// past, against replays.
+func VerifyWebhookSignature(secret []byte, timestamp string, signature string, body []byte) bool {
+	return hmac.Equal([]byte(webhookSignature(secret, timestamp, body)), []byte(signature))
+}
@@ -4,16 +4,20 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // The IP2ProxyResult struct stores all of the available
 // proxy info found in the IP2Proxy Web Service.
 type IP2ProxyResult struct {
 	Response    string `json:"response"`
+	IP          string `json:"ip"`
 	CountryCode string `json:"countryCode"`
 	CountryName string `json:"countryName"`
 	RegionName  string `json:"regionName"`
@@ -41,6 +45,13 @@ type WS struct {
 	apiKey     string
 	apiPackage string
 	useSSL     bool
+	downgrade  bool
+	baseURL    string   // scheme included, empty for api.ip2proxy.com
+	redact     Redactor // applied to the IP addresses of the errors
+	telemetry  Telemetry
+
+	mu        sync.Mutex
+	effective string // package the lookups succeeded with after a downgrade, empty before
 }
 
 var regexAPIKey = regexp.MustCompile(`^[\dA-Z]{10}$`)
@@ -49,6 +60,54 @@ var regexAPIPackage = regexp.MustCompile(`^PX\d+$`)
 const baseURL = "api.ip2proxy.com/"
 const msgInvalidAPIKey = "Invalid API key."
 const msgInvalidAPIPackage = "Invalid package name."
+const msgFieldNotInPackage = "Field not returned by the web service package."
+
+// ErrFieldNotInPackage is matched by the FieldNotInPackageError errors, using errors.Is.
+var ErrFieldNotInPackage = errors.New(msgFieldNotInPackage)
+
+// The WSError struct is the error of LookUp when the web service answers without a valid result:
+// a response other than OK, or the result of another IP address than the queried one.
+type WSError struct {
+	IPAddress  string
+	Response   string
+	ReturnedIP string
+}
+
+func (e *WSError) Error() string {
+	if e.Response != "OK" {
+		return "Web service error for " + e.IPAddress + ": " + e.Response + "."
+	}
+	return "Web service returned the result of " + e.ReturnedIP + " for " + e.IPAddress + "."
+}
+
+// check the response of the lookup of the IP address
+func validateResult(ipAddress string, res IP2ProxyResult) error {
+	if res.Response != "OK" {
+		return &WSError{IPAddress: ipAddress, Response: res.Response}
+	}
+	// the IP address is only checked when returned
+	if res.IP != "" {
+		if ip := net.ParseIP(res.IP); ip == nil || !ip.Equal(net.ParseIP(ipAddress)) {
+			return &WSError{IPAddress: ipAddress, Response: res.Response, ReturnedIP: res.IP}
+		}
+	}
+	return nil
+}
+
+// The FieldNotInPackageError struct is the error of WS.Require, listing the fields the package does not return.
+type FieldNotInPackageError struct {
+	Package string
+	Fields  FieldMask
+}
+
+func (e *FieldNotInPackageError) Error() string {
+	return "Fields " + e.Fields.String() + " not returned by the web service package " + e.Package + "."
+}
+
+// Is matches ErrFieldNotInPackage.
+func (e *FieldNotInPackageError) Is(target error) bool {
+	return target == ErrFieldNotInPackage
+}
 
 // OpenWS initializes with the web service API key, API package and whether to use SSL
 func OpenWS(apikey string, apipackage string, usessl bool) (*WS, error) {
@@ -78,22 +137,145 @@ func (w *WS) checkParams() error {
 	return nil
 }
 
-// LookUp will return all proxy fields based on the queried IP address.
-func (w *WS) LookUp(ipAddress string) (IP2ProxyResult, error) {
-	var res IP2ProxyResult
-	err := w.checkParams()
+// PackageFields returns the fields the web service package (PX1 to PX12) returns, those of the BIN
+// database type of the same number. PX12 returns the fields of PX11 and more, which IP2ProxyResult does not hold.
+func PackageFields(apiPackage string) (FieldMask, error) {
+	if !regexAPIPackage.MatchString(apiPackage) {
+		return 0, errors.New(msgInvalidAPIPackage)
+	}
+	n, err := strconv.Atoi(apiPackage[2:])
+	if err != nil || n < 1 || n > 12 {
+		return 0, errors.New(msgInvalidAPIPackage)
+	}
+	if n == 12 {
+		n = 11
+	}
+
+	l, err := DatabaseLayout(uint8(n))
+	if err != nil {
+		return 0, err
+	}
+	return l.Fields(), nil
+}
+
+// Fields returns the fields returned by the package of the web service, the others being left empty.
+func (w *WS) Fields() FieldMask {
+	m, _ := PackageFields(w.Package())
+	return m
+}
+
+// SetPackageDowngrade sets whether the lookups rejected because of the package, e.g. after a subscription
+// change, are retried with the lower packages down to PX1. The package which succeeded is kept for the next
+// lookups and returned by Package.
+func (w *WS) SetPackageDowngrade(downgrade bool) *WS {
+	w.downgrade = downgrade
+	return w
+}
+
+// Package returns the package of the lookups, lower than the configured package after a downgrade.
+func (w *WS) Package() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.effective != "" {
+		return w.effective
+	}
+	return w.apiPackage
+}
+
+// SetBaseURL sends the requests to another server than api.ip2proxy.com, e.g. a stub of the
+// ip2proxytest package or a forwarding proxy. The URL includes the scheme, which replaces the SSL setting.
+func (w *WS) SetBaseURL(baseURL string) *WS {
+	if baseURL != "" && !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	w.baseURL = baseURL
+	return w
+}
+
+// URL of the web service
+func (w *WS) endpoint() string {
+	if w.baseURL != "" {
+		return w.baseURL
+	}
+	if w.useSSL {
+		return "https://" + baseURL
+	}
+	return "http://" + baseURL
+}
+
+// the web service rejected the package
+func packageRejected(res IP2ProxyResult) bool {
+	return strings.Contains(strings.ToUpper(res.Response), "PACKAGE")
+}
+
+// the package of the next lower tier, false below PX1
+func lowerPackage(apiPackage string) (string, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(apiPackage, "PX"))
+	if err != nil || n <= 1 {
+		return "", false
+	}
+	return "PX" + strconv.Itoa(n-1), true
+}
+
+// Require checks that the package of the web service returns the given fields, e.g. at startup so that
+// code does not silently read empty fields. The error is a *FieldNotInPackageError.
+func (w *WS) Require(fields FieldMask) error {
+	if missing := fields &^ w.Fields(); missing != 0 {
+		return &FieldNotInPackageError{Package: w.apiPackage, Fields: missing}
+	}
+	return nil
+}
+
+// LookUp will return all proxy fields based on the queried IP address. A *WSError is returned, along with the
+// result, when the web service answers with an error message or with the result of another IP address.
+func (w *WS) LookUp(ipAddress string) (res IP2ProxyResult, err error) {
+	err = w.checkParams()
 
 	if err != nil {
 		return res, err
 	}
 
-	protocol := "https"
+	if w.telemetry != nil {
+		started, end := startLookup(w.telemetry, "webservice")
+		defer func() {
+			recordLookup(w.telemetry, "webservice", started, wsIsProxy(res), err)
+			end(err)
+		}()
+	}
+
+	apiPackage := w.Package()
+	for {
+		res, err = w.lookUp(ipAddress, apiPackage)
+		if err != nil || !w.downgrade || !packageRejected(res) {
+			break
+		}
+		lower, ok := lowerPackage(apiPackage)
+		if !ok {
+			break
+		}
+		apiPackage = lower
+	}
 
-	if !w.useSSL {
-		protocol = "http"
+	if err != nil {
+		return res, err
+	}
+	if !packageRejected(res) && apiPackage != w.Package() {
+		w.mu.Lock()
+		w.effective = apiPackage
+		w.mu.Unlock()
 	}
+	err = validateResult(ipAddress, res)
+	if wsErr, ok := err.(*WSError); ok && w.redact != nil {
+		wsErr.IPAddress = w.redact.apply(wsErr.IPAddress)
+		wsErr.ReturnedIP = w.redact.apply(wsErr.ReturnedIP)
+	}
+	return res, err
+}
 
-	myUrl := protocol + "://" + baseURL + "?key=" + w.apiKey + "&package=" + w.apiPackage + "&ip=" + url.QueryEscape(ipAddress)
+// query the web service with the package
+func (w *WS) lookUp(ipAddress string, apiPackage string) (IP2ProxyResult, error) {
+	var res IP2ProxyResult
+	myUrl := w.endpoint() + "?key=" + w.apiKey + "&package=" + apiPackage + "&ip=" + url.QueryEscape(ipAddress)
 
 	resp, err := http.Get(myUrl)
 
@@ -131,13 +313,7 @@ func (w *WS) GetCredit() (IP2ProxyCreditResult, error) {
 		return res, err
 	}
 
-	protocol := "https"
-
-	if !w.useSSL {
-		protocol = "http"
-	}
-
-	myUrl := protocol + "://" + baseURL + "?key=" + w.apiKey + "&check=true"
+	myUrl := w.endpoint() + "?key=" + w.apiKey + "&check=true"
 
 	resp, err := http.Get(myUrl)
 
@@ -165,3 +341,55 @@ func (w *WS) GetCredit() (IP2ProxyCreditResult, error) {
 
 	return res, errors.New("Error HTTP " + strconv.Itoa(int(resp.StatusCode)))
 }
+
+// the web service lookups, of WS and CachedWS
+type wsLookUp interface {
+	LookUp(ipAddress string) (IP2ProxyResult, error)
+}
+
+type wsResolver struct {
+	ws wsLookUp
+}
+
+// WSResolver adapts a WS or a CachedWS to the Resolver interface, e.g. for SetIPv6Fallback. The fields the
+// package does not return are set to "NOT SUPPORTED".
+func WSResolver(ws wsLookUp) Resolver {
+	return wsResolver{ws: ws}
+}
+
+// GetAll will return all proxy fields based on the queried IP address, looked up with the web service.
+func (r wsResolver) GetAll(ipAddress string) (IP2ProxyRecord, error) {
+	res, err := r.ws.LookUp(ipAddress)
+	if err != nil {
+		return loadMessage(msgNotSupported), err
+	}
+
+	x := loadMessage(msgNotSupported)
+	for _, f := range []struct {
+		value string
+		dst   *string
+	}{
+		{res.CountryCode, &x.CountryShort},
+		{res.CountryName, &x.CountryLong},
+		{res.RegionName, &x.Region},
+		{res.CityName, &x.City},
+		{res.ISP, &x.Isp},
+		{res.ProxyType, &x.ProxyType},
+		{res.Domain, &x.Domain},
+		{res.UsageType, &x.UsageType},
+		{res.ASN, &x.Asn},
+		{res.AS, &x.As},
+		{res.LastSeen, &x.LastSeen},
+		{res.Threat, &x.Threat},
+		{res.Provider, &x.Provider},
+	} {
+		if f.value != "" {
+			*f.dst = f.value
+		}
+	}
+	x.IsProxy = wsIsProxy(res)
+	if x.IsProxy == 1 && (x.ProxyType == "DCH" || x.ProxyType == "SES") {
+		x.IsProxy = 2
+	}
+	return x, nil
+}
@@ -0,0 +1,376 @@
+package ip2proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"lukechampine.com/uint128"
+	"os"
+	"sort"
+	"time"
+)
+
+// The Writer struct is used to build an IP2Proxy BIN file from
+// arbitrary IP ranges and their proxy records.
+type Writer struct {
+	databaseType  uint8
+	databaseYear  uint8
+	databaseMonth uint8
+	databaseDay   uint8
+	v4Ranges      []writerRange
+	v6Ranges      []writerRange
+	noV4Index     bool
+	noV6Index     bool
+}
+
+// an inclusive range of IP numbers with its record
+type writerRange struct {
+	ipFrom uint128.Uint128
+	ipTo   uint128.Uint128
+	rec    IP2ProxyRecord
+}
+
+const headerSize uint32 = 64
+const indexSize uint32 = 65536 << 3 // 65536 entries of 4 bytes each for low and high row
+
+const msgInvalidDatabaseType string = "Invalid IP2Proxy database type."
+const msgInvalidDate string = "Invalid database date."
+const msgInvalidRange string = "Invalid IP range."
+const msgOverlappingRange string = "Overlapping IP range."
+const msgInvalidCountryCode string = "Country code must not exceed 2 characters."
+const msgStringTooLong string = "String field must not exceed 255 bytes."
+
+// NewWriter initializes with the database type (1 to 11 respectively for PX1 to PX11)
+// and the publish date to be embedded in the BIN header.
+func NewWriter(databaseType uint8, date time.Time) (*Writer, error) {
+	if databaseType < 1 || int(databaseType) >= len(countryPosition) {
+		return nil, errors.New(msgInvalidDatabaseType)
+	}
+
+	if date.Year() < 2000 || date.Year() > 2099 {
+		return nil, errors.New(msgInvalidDate)
+	}
+
+	var w = &Writer{}
+	w.databaseType = databaseType
+	w.databaseYear = uint8(date.Year() - 2000)
+	w.databaseMonth = uint8(date.Month())
+	w.databaseDay = uint8(date.Day())
+
+	return w, nil
+}
+
+// AddRange adds the proxy record for the IP addresses from ipFrom to ipTo inclusive.
+// Both addresses must be of the same IP version. Addresses not covered by any range
+// will be written as not being a proxy.
+func (w *Writer) AddRange(ipFrom string, ipTo string, record IP2ProxyRecord) error {
+	fromType, fromNum := parseIP(ipFrom)
+	toType, toNum := parseIP(ipTo)
+
+	if fromType == 0 || fromType != toType || fromNum.Cmp(toNum) > 0 {
+		return errors.New(msgInvalidRange)
+	}
+
+	if len(record.CountryShort) > 2 {
+		return errors.New(msgInvalidCountryCode)
+	}
+
+	r := writerRange{ipFrom: fromNum, ipTo: toNum, rec: record}
+
+	if fromType == 4 {
+		w.v4Ranges = append(w.v4Ranges, r)
+	} else {
+		w.v6Ranges = append(w.v6Ranges, r)
+	}
+	return nil
+}
+
+// SetIndexes sets whether the IPv4 and IPv6 indexes are written, both being by default. The BIN files of some
+// tiers have no IPv6 index, which a file written without one reproduces, e.g. to test DB.BuildIPv6Index.
+// It must be called before WriteTo or WriteFile.
+func (w *Writer) SetIndexes(ipv4 bool, ipv6 bool) *Writer {
+	w.noV4Index = !ipv4
+	w.noV6Index = !ipv6
+	return w
+}
+
+// WriteFile writes the BIN file to the given path.
+func (w *Writer) WriteFile(dbPath string) error {
+	f, err := os.Create(dbPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.WriteTo(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteTo writes the BIN file to out. The IPv6 section is only written when IPv6 ranges were added.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	v4Rows, err := fillRanges(w.v4Ranges, maxIPV4Range)
+	if err != nil {
+		return 0, err
+	}
+
+	var v6Rows []writerRange
+	if len(w.v6Ranges) > 0 {
+		if v6Rows, err = fillRanges(w.v6Ranges, uint128.Max); err != nil {
+			return 0, err
+		}
+	}
+
+	dbt := w.databaseType
+	column := writerColumns(dbt)
+	v4ColSize := uint32(column) << 2
+	v6ColSize := 16 + (uint32(column-1) << 2)
+
+	// layout (1-based addresses as used by the reader)
+	v4IndexAddr := uint32(0)
+	v6IndexAddr := uint32(0)
+	v4DataAddr := headerSize + 1
+	var v4Index, v6Index []byte
+	if !w.noV4Index {
+		v4IndexAddr = v4DataAddr
+		v4DataAddr += indexSize
+		v4Index = buildIndex(len(v4Rows), func(i int) uint128.Uint128 { return v4Rows[i].ipFrom }, 16, maxIPV4Range)
+	}
+	if len(v6Rows) > 0 && !w.noV6Index {
+		v6IndexAddr = v4DataAddr
+		v4DataAddr += indexSize
+		v6Index = buildIndex(len(v6Rows), func(i int) uint128.Uint128 { return v6Rows[i].ipFrom }, 112, uint128.Max)
+	}
+	v6DataAddr := v4DataAddr + uint32(len(v4Rows)+1)*v4ColSize // extra row holds the last IP To
+	strAddr := v6DataAddr
+	if len(v6Rows) > 0 {
+		strAddr += uint32(len(v6Rows)+1) * v6ColSize
+	}
+
+	// string table, offsets are 0-based as used by readStr
+	var strs bytes.Buffer
+	strPos := make(map[string]uint32)
+	addStr := func(parts ...string) (uint32, error) {
+		key := ""
+		for _, p := range parts {
+			key += p + "\x00"
+		}
+		if pos, ok := strPos[key]; ok {
+			return pos, nil
+		}
+		pos := strAddr - 1 + uint32(strs.Len())
+		for i, p := range parts {
+			if len(p) > 255 {
+				return 0, errors.New(msgStringTooLong)
+			}
+			strs.WriteByte(uint8(len(p)))
+			strs.WriteString(p)
+			if i == 0 && len(parts) > 1 {
+				// country code is padded so that the country name always starts 3 bytes later
+				for j := len(p); j < 2; j++ {
+					strs.WriteByte(0)
+				}
+			}
+		}
+		strPos[key] = pos
+		return pos, nil
+	}
+
+	v4Data, err := w.encodeRows(v4Rows, 4, v4ColSize, addStr)
+	if err != nil {
+		return 0, err
+	}
+	v6Data, err := w.encodeRows(v6Rows, 16, v6ColSize, addStr)
+	if err != nil {
+		return 0, err
+	}
+
+	fileSize := strAddr - 1 + uint32(strs.Len())
+
+	header := make([]byte, headerSize)
+	header[0] = dbt
+	header[1] = column
+	header[2] = w.databaseYear
+	header[3] = w.databaseMonth
+	header[4] = w.databaseDay
+	binary.LittleEndian.PutUint32(header[5:], uint32(len(v4Rows)))
+	binary.LittleEndian.PutUint32(header[9:], v4DataAddr)
+	binary.LittleEndian.PutUint32(header[13:], uint32(len(v6Rows)))
+	if len(v6Rows) > 0 {
+		binary.LittleEndian.PutUint32(header[17:], v6DataAddr)
+	}
+	binary.LittleEndian.PutUint32(header[21:], v4IndexAddr)
+	binary.LittleEndian.PutUint32(header[25:], v6IndexAddr)
+	header[29] = 2 // product code for IP2Proxy
+	binary.LittleEndian.PutUint32(header[31:], fileSize)
+
+	bw := bufio.NewWriter(out)
+	var n int64
+	for _, chunk := range [][]byte{
+		header,
+		v4Index,
+		v6Index,
+		v4Data,
+		v6Data,
+		strs.Bytes(),
+	} {
+		m, err := bw.Write(chunk)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// encode the rows including the extra row holding the IP To of the last row
+func (w *Writer) encodeRows(rows []writerRange, firstCol uint32, colSize uint32, addStr func(...string) (uint32, error)) ([]byte, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	dbt := w.databaseType
+	data := make([]byte, uint32(len(rows)+1)*colSize)
+
+	for i := 0; i <= len(rows); i++ {
+		row := data[uint32(i)*colSize : uint32(i+1)*colSize]
+
+		var ipFrom uint128.Uint128
+		var rec *IP2ProxyRecord
+		if i < len(rows) {
+			ipFrom = rows[i].ipFrom
+			rec = &rows[i].rec
+		} else {
+			ipFrom = rows[i-1].ipTo
+			rec = &rows[i-1].rec
+		}
+
+		if firstCol == 4 {
+			binary.LittleEndian.PutUint32(row, uint32(ipFrom.Lo))
+		} else {
+			ipFrom.PutBytes(row)
+		}
+
+		if countryPosition[dbt] != 0 {
+			pos, err := addStr(rec.CountryShort, rec.CountryLong)
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint32(row[firstCol+(uint32(countryPosition[dbt]-2)<<2):], pos)
+		}
+
+		for _, f := range []struct {
+			position *[12]uint8
+			value    string
+		}{
+			{&regionPosition, rec.Region},
+			{&cityPosition, rec.City},
+			{&ispPosition, rec.Isp},
+			{&proxyTypePosition, rec.ProxyType},
+			{&domainPosition, rec.Domain},
+			{&usageTypePosition, rec.UsageType},
+			{&asnPosition, rec.Asn},
+			{&asPosition, rec.As},
+			{&lastSeenPosition, rec.LastSeen},
+			{&threatPosition, rec.Threat},
+			{&providerPosition, rec.Provider},
+		} {
+			if f.position[dbt] == 0 {
+				continue
+			}
+			pos, err := addStr(f.value)
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint32(row[firstCol+(uint32(f.position[dbt]-2)<<2):], pos)
+		}
+	}
+	return data, nil
+}
+
+// number of columns (including IP From) for the database type
+func writerColumns(dbt uint8) uint8 {
+	column := uint8(1)
+	for _, position := range []*[12]uint8{
+		&countryPosition, &regionPosition, &cityPosition, &ispPosition,
+		&proxyTypePosition, &domainPosition, &usageTypePosition, &asnPosition,
+		&asPosition, &lastSeenPosition, &threatPosition, &providerPosition,
+	} {
+		if position[dbt] > column {
+			column = position[dbt]
+		}
+	}
+	return column
+}
+
+// sort the ranges and fill the gaps with non-proxy rows so that the rows cover the whole address space
+func fillRanges(ranges []writerRange, maxIP uint128.Uint128) ([]writerRange, error) {
+	sorted := make([]writerRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ipFrom.Cmp(sorted[j].ipFrom) < 0
+	})
+
+	notProxy := loadMessage("-")
+	rows := make([]writerRange, 0, 2*len(sorted)+1)
+	next := uint128.Zero
+	done := false
+
+	for _, r := range sorted {
+		if done || r.ipFrom.Cmp(next) < 0 {
+			return nil, errors.New(msgOverlappingRange)
+		}
+		if r.ipTo.Cmp(maxIP) > 0 {
+			return nil, errors.New(msgInvalidRange)
+		}
+		if r.ipFrom.Cmp(next) > 0 {
+			rows = append(rows, writerRange{ipFrom: next, ipTo: r.ipFrom.Sub64(1), rec: notProxy})
+		}
+		rows = append(rows, r)
+		if r.ipTo.Equals(maxIP) {
+			done = true
+		} else {
+			next = r.ipTo.Add64(1)
+		}
+	}
+
+	if !done {
+		rows = append(rows, writerRange{ipFrom: next, ipTo: maxIP, rec: notProxy})
+	}
+	return rows, nil
+}
+
+// build the index of low and high rows for each of the 65536 leading 16-bit prefixes, given the number
+// of rows and their IP From in ascending order
+func buildIndex(n int, ipFrom func(i int) uint128.Uint128, shift uint, maxIP uint128.Uint128) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	// the reader maps the last IP to the one before
+	lastIP := maxIP.Sub64(1)
+	rowOf := func(ipNum uint128.Uint128) uint32 {
+		if ipNum.Cmp(lastIP) > 0 {
+			ipNum = lastIP
+		}
+		i := sort.Search(n, func(i int) bool {
+			return ipFrom(i).Cmp(ipNum) > 0
+		})
+		return uint32(i - 1)
+	}
+
+	index := make([]byte, indexSize)
+	for p := uint64(0); p < 65536; p++ {
+		start := uint128.From64(p).Lsh(shift)
+		end := uint128.From64(p + 1).Lsh(shift).SubWrap64(1)
+		if p == 65535 {
+			end = maxIP
+		}
+		binary.LittleEndian.PutUint32(index[p<<3:], rowOf(start))
+		binary.LittleEndian.PutUint32(index[(p<<3)+4:], rowOf(end))
+	}
+	return index
+}
@@ -0,0 +1,77 @@
+package ip2proxy
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// the VPN range of the BIN files of most tests
+var testVPNRange = [3]string{"192.0.2.0", "192.0.2.255", "VPN"}
+
+// the proxy record of the ranges of newTestWriter
+func testRecord(proxyType string) IP2ProxyRecord {
+	return IP2ProxyRecord{ProxyType: proxyType, CountryShort: "US", CountryLong: "United States of America"}
+}
+
+// the Writer of the BIN files of the tests, of the database type dated 2024-01-15, with the ranges given as
+// from, to and proxy type
+func newTestWriter(t testing.TB, databaseType uint8, ranges ...[3]string) *Writer {
+	t.Helper()
+	w, err := NewWriter(databaseType, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range ranges {
+		if err := w.AddRange(r[0], r[1], testRecord(r[2])); err != nil {
+			t.Fatalf("%s-%s: %v", r[0], r[1], err)
+		}
+	}
+	return w
+}
+
+// the BIN file written by the Writer
+func writeTestBIN(t testing.TB, w *Writer) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// the BIN file written by the Writer opened from memory, closed at the end of the test
+func openTestBIN(t testing.TB, w *Writer) *DB {
+	t.Helper()
+	db, err := OpenDBFromBytes(writeTestBIN(t, w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// the Writer parses the addresses as the lookups do, an IPv4-mapped range being written to the IPv4 data
+func TestWriterAddresses(t *testing.T) {
+	w := newTestWriter(t, 2)
+	rec := testRecord("VPN")
+	if err := w.AddRange("::ffff:192.0.2.0", "::ffff:192.0.2.255", rec); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][2]string{
+		{"fe80::1%eth0", "fe80::2"},
+		{"fe80::1", "fe80::2%eth0"},
+		{"192.0.2.0", "2001:db8::"},
+	} {
+		if err := w.AddRange(r[0], r[1], rec); err == nil {
+			t.Errorf("%s - %s added", r[0], r[1])
+		}
+	}
+
+	db := openTestBIN(t, w)
+	for _, ip := range []string{"192.0.2.0", "192.0.2.255", "::ffff:192.0.2.1"} {
+		if got, err := db.GetProxyType(ip); err != nil || got != "VPN" {
+			t.Errorf("%s: %q (%v) instead of VPN", ip, got, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ip2proxy
+
+import (
+	"net/netip"
+	"strconv"
+
+	v4 "github.com/ip2location/ip2proxy-go/v4"
+)
+
+// Wrap returns a DB querying a database opened with version 4, which remains usable.
+func Wrap(db *v4.DB) *DB {
+	d, _ := newDB(db, options{}) // cannot fail without options
+	return d
+}
+
+// V4 returns the underlying version 4 database. With WithAutoReload, it is the database opened first, closed
+// once replaced by a newer file.
+func (d *DB) V4() *v4.DB {
+	return d.db
+}
+
+const notSupported = "NOT SUPPORTED"
+
+// FromV4 converts a record returned by version 4 for the IP address. The sentinel messages of failed
+// lookups are returned as errors.
+func FromV4(addr netip.Addr, rec v4.IP2ProxyRecord) (Record, error) {
+	switch rec.CountryShort {
+	case "INVALID IP ADDRESS":
+		return Record{}, ErrInvalidAddress
+	case "IPV6 ADDRESS MISSING IN IPV4 BIN":
+		return Record{}, ErrIPv6NotSupported
+	case "MISSING FILE":
+		return Record{}, ErrNotOpened
+	}
+
+	var r Record
+	r.Addr = addr
+	r.IsProxy = ProxyStatus(rec.IsProxy)
+	for _, f := range []struct {
+		field Field
+		value string
+		dst   *string
+	}{
+		{FieldCountry, rec.CountryShort, &r.CountryCode},
+		{FieldCountry, rec.CountryLong, &r.CountryName},
+		{FieldRegion, rec.Region, &r.Region},
+		{FieldCity, rec.City, &r.City},
+		{FieldISP, rec.Isp, &r.ISP},
+		{FieldProxyType, rec.ProxyType, (*string)(&r.ProxyType)},
+		{FieldDomain, rec.Domain, &r.Domain},
+		{FieldUsageType, rec.UsageType, (*string)(&r.UsageType)},
+		{FieldASN, rec.Asn, nil},
+		{FieldAS, rec.As, &r.AS},
+		{FieldLastSeen, rec.LastSeen, nil},
+		{FieldThreat, rec.Threat, &r.Threat},
+		{FieldProvider, rec.Provider, &r.Provider},
+	} {
+		if f.value == notSupported {
+			continue
+		}
+		r.Fields |= f.field
+		if f.dst != nil && f.value != "-" {
+			*f.dst = f.value
+		}
+	}
+
+	if n, err := strconv.ParseUint(rec.Asn, 10, 32); err == nil {
+		r.ASN = uint32(n)
+	}
+	if n, err := strconv.Atoi(rec.LastSeen); err == nil {
+		r.LastSeen = n
+	}
+	return r, nil
+}
+
+// V4 converts the record to a version 4 record; fields not supported by the database are set to "NOT SUPPORTED"
+// and values not applicable to the address to "-".
+func (r Record) V4() v4.IP2ProxyRecord {
+	var rec v4.IP2ProxyRecord
+	rec.IsProxy = int8(r.IsProxy)
+	asn := "-"
+	if r.ASN != 0 {
+		asn = strconv.FormatUint(uint64(r.ASN), 10)
+	}
+	lastSeen := "-"
+	if r.LastSeen != 0 {
+		lastSeen = strconv.Itoa(r.LastSeen)
+	}
+	for _, f := range []struct {
+		field Field
+		value string
+		dst   *string
+	}{
+		{FieldCountry, r.CountryCode, &rec.CountryShort},
+		{FieldCountry, r.CountryName, &rec.CountryLong},
+		{FieldRegion, r.Region, &rec.Region},
+		{FieldCity, r.City, &rec.City},
+		{FieldISP, r.ISP, &rec.Isp},
+		{FieldProxyType, string(r.ProxyType), &rec.ProxyType},
+		{FieldDomain, r.Domain, &rec.Domain},
+		{FieldUsageType, string(r.UsageType), &rec.UsageType},
+		{FieldASN, asn, &rec.Asn},
+		{FieldAS, r.AS, &rec.As},
+		{FieldLastSeen, lastSeen, &rec.LastSeen},
+		{FieldThreat, r.Threat, &rec.Threat},
+		{FieldProvider, r.Provider, &rec.Provider},
+	} {
+		switch {
+		case !r.Has(f.field):
+			*f.dst = notSupported
+		case f.value == "":
+			*f.dst = "-"
+		default:
+			*f.dst = f.value
+		}
+	}
+	return rec
+}
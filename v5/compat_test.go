@@ -0,0 +1,140 @@
+package ip2proxy
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	v4 "github.com/ip2location/ip2proxy-go/v4"
+	"github.com/ip2location/ip2proxy-go/v4/ip2proxytest"
+)
+
+var sampleAddresses = []string{
+	ip2proxytest.SampleVPN, ip2proxytest.SampleTOR, ip2proxytest.SampleDCH, ip2proxytest.SamplePUB,
+	ip2proxytest.SampleWEB, ip2proxytest.SampleSES, ip2proxytest.SampleRES, ip2proxytest.SampleCPN,
+	ip2proxytest.SampleEPN, ip2proxytest.SampleVPN6, ip2proxytest.SampleNotProxy,
+	"::ffff:" + ip2proxytest.SampleTOR, "255.255.255.255", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+}
+
+func openSample(t *testing.T) *v4.DB {
+	t.Helper()
+	db, err := ip2proxytest.OpenSampleDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// a database of the type with an IPv4 VPN range only
+func openWritten(t *testing.T, databaseType uint8) *v4.DB {
+	t.Helper()
+	rec := v4.IP2ProxyRecord{CountryShort: "US", CountryLong: "United States of America", ProxyType: "VPN"}
+	db, err := ip2proxytest.OpenWrittenDB(databaseType, ip2proxytest.Range{From: "192.0.2.0", To: "192.0.2.255", Record: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// the records of version 5 are those of version 4 converted, and convert back to them
+func TestCompatRecords(t *testing.T) {
+	db4 := openSample(t)
+	bin, err := ip2proxytest.SampleBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := OpenBytes(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+
+	for name, db := range map[string]*DB{"Wrap": Wrap(db4), "OpenBytes": opened} {
+		for _, ip := range sampleAddresses {
+			addr := netip.MustParseAddr(ip)
+			rec4, err := db4.GetAll(ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := FromV4(addr, rec4)
+			if err != nil {
+				t.Fatalf("%s: %v", ip, err)
+			}
+
+			got, err := db.Lookup(context.Background(), addr)
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, ip, err)
+			}
+			if got.Addr != addr || got.IsProxy != ProxyStatus(rec4.IsProxy) || got.ProxyType != want.ProxyType ||
+				got.CountryCode != want.CountryCode || got.ASN != want.ASN || got.Fields != want.Fields {
+				t.Errorf("%s, %s: %+v instead of %+v", name, ip, got, want)
+			}
+			if back := got.V4(); back != rec4 {
+				t.Errorf("%s, %s: converted back to %+v instead of %+v", name, ip, back, rec4)
+			}
+		}
+	}
+	if got := Wrap(db4).V4(); got != db4 {
+		t.Error("V4 does not return the wrapped database")
+	}
+}
+
+func TestCompatErrors(t *testing.T) {
+	db := Wrap(openSample(t))
+	ctx := context.Background()
+	if _, err := db.LookupString(ctx, "not an address"); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("invalid address: %v", err)
+	}
+	if _, err := db.Lookup(ctx, netip.Addr{}); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("zero address: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := db.LookupString(canceled, ip2proxytest.SampleVPN); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: %v", err)
+	}
+
+	ipv4Only := Wrap(openWritten(t, 2))
+	if _, err := ipv4Only.LookupString(ctx, ip2proxytest.SampleVPN6); !errors.Is(err, ErrIPv6NotSupported) {
+		t.Errorf("IPv6 address in IPv4 database: %v", err)
+	}
+
+	for _, msg := range []struct {
+		countryShort string
+		err          error
+	}{
+		{"INVALID IP ADDRESS", ErrInvalidAddress},
+		{"IPV6 ADDRESS MISSING IN IPV4 BIN", ErrIPv6NotSupported},
+		{"MISSING FILE", ErrNotOpened},
+	} {
+		if _, err := FromV4(netip.Addr{}, v4.IP2ProxyRecord{CountryShort: msg.countryShort}); !errors.Is(err, msg.err) {
+			t.Errorf("%s: %v instead of %v", msg.countryShort, err, msg.err)
+		}
+	}
+}
+
+// the fields not supported by the database type are not in Fields, and "NOT SUPPORTED" again in version 4
+func TestCompatUnsupportedFields(t *testing.T) {
+	db4 := openWritten(t, 1)
+	rec4, err := db4.GetAll("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := Wrap(db4).LookupString(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Fields != FieldCountry || !rec.Has(FieldCountry) || rec.Has(FieldProxyType) {
+		t.Errorf("fields %b instead of country only", rec.Fields)
+	}
+	if rec.CountryCode != "US" || rec.ProxyType != ProxyTypeNone {
+		t.Errorf("%q %q instead of US and no proxy type", rec.CountryCode, rec.ProxyType)
+	}
+	if back := rec.V4(); back != rec4 || back.ProxyType != notSupported {
+		t.Errorf("converted back to %+v instead of %+v", back, rec4)
+	}
+}
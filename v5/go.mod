@@ -0,0 +1,9 @@
+module github.com/ip2location/ip2proxy-go/v5
+
+go 1.18
+
+require github.com/ip2location/ip2proxy-go/v4 v4.1.0
+
+require lukechampine.com/uint128 v1.2.0 // indirect
+
+replace github.com/ip2location/ip2proxy-go/v4 => ../
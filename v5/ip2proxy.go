@@ -0,0 +1,256 @@
+// Package ip2proxy is the version 5 API to query the IP2Proxy BIN databases for VPN anonymizers,
+// open proxies, web proxies, Tor exits, data centers, search engine robots and residential proxies.
+//
+// Compared to version 4 it takes net/netip addresses and a context, reports failures as errors
+// instead of sentinel messages in the record fields, and decodes the fields into typed values.
+// It is built on top of version 4, which stays maintained; Wrap, DB.V4, FromV4 and Record.V4
+// convert between both so that code can be migrated incrementally.
+package ip2proxy
+
+import (
+	"context"
+	"errors"
+	"net/http/cookiejar"
+	"net/netip"
+	"time"
+
+	v4 "github.com/ip2location/ip2proxy-go/v4"
+)
+
+// Errors returned by the lookups.
+var (
+	// ErrInvalidAddress is returned for addresses which are not valid IPv4 or IPv6 addresses.
+	ErrInvalidAddress = errors.New("ip2proxy: invalid IP address")
+	// ErrIPv6NotSupported is returned for IPv6 addresses looked up in an IPv4-only database.
+	ErrIPv6NotSupported = errors.New("ip2proxy: IPv6 address missing in IPv4 database")
+	// ErrNotOpened is returned when the database metadata could not be read.
+	ErrNotOpened = errors.New("ip2proxy: database not opened")
+)
+
+// The DB struct is the main object used to query the IP2Proxy BIN file.
+type DB struct {
+	db       *v4.DB
+	src      source // db, or the ReloadableDB of WithAutoReload
+	resolver v4.Resolver
+	stop     context.CancelFunc
+	suffixes cookiejar.PublicSuffixList // for Record.RegistrableDomain
+}
+
+// the database looked up, either a v4.DB or a v4.ReloadableDB
+type source interface {
+	v4.Resolver
+	GetAllExtra(ipAddress string) (v4.IP2ProxyRecord, v4.ExtraFields, error)
+	ExtraColumns() []string
+	DatabaseVersion() string
+	Close() error
+}
+
+// interval between the checks of the file of WithAutoReload
+const autoReloadInterval = 10 * time.Second
+
+// The Option type configures how a database is opened.
+type Option func(o *options)
+
+type options struct {
+	zeroCopy    bool
+	ipv6Index   bool
+	readAhead   uint32
+	cache       v4.Cache
+	cacheTTL    time.Duration
+	negativeTTL time.Duration
+	reloadPath  string
+	onReload    func(v4.ReloadEvent)
+	suffixes    cookiejar.PublicSuffixList
+}
+
+// WithZeroCopy lets the strings of the records opened by OpenBytes point into the slice instead of being copied.
+// The slice must then never be modified while any record is in use.
+func WithZeroCopy() Option {
+	return func(o *options) {
+		o.zeroCopy = true
+	}
+}
+
+// WithIPv6Index builds an IPv6 index in memory at open for the BIN files without one, see v4.DB.BuildIPv6Index.
+func WithIPv6Index() Option {
+	return func(o *options) {
+		o.ipv6Index = true
+	}
+}
+
+// WithReadAhead lets the binary search of the files opened by Open read up to size bytes of rows at once,
+// see v4.DB.SetReadAhead.
+func WithReadAhead(size uint32) Option {
+	return func(o *options) {
+		o.readAhead = size
+	}
+}
+
+// WithCache caches the lookups in the cache for the TTL.
+func WithCache(cache v4.Cache, ttl time.Duration) Option {
+	return func(o *options) {
+		o.cache = cache
+		o.cacheTTL = ttl
+	}
+}
+
+// WithNegativeCacheTTL caches the lookups of the addresses not flagged as proxies for another TTL than the
+// one of WithCache, usually longer.
+func WithNegativeCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithAutoReload watches the BIN file at the path, usually the one opened or a symbolic link to it, and swaps
+// it in once changed, see v4.ReloadableDB.WatchFile. The lookups in progress complete on the previous file.
+func WithAutoReload(path string) Option {
+	return func(o *options) {
+		o.reloadPath = path
+	}
+}
+
+// WithReloadHandler calls the function after every automatic reload of WithAutoReload, successful or not.
+func WithReloadHandler(onReload func(v4.ReloadEvent)) Option {
+	return func(o *options) {
+		o.onReload = onReload
+	}
+}
+
+// WithPublicSuffixList sets the RegistrableDomain of the records, by the public suffix list, usually
+// publicsuffix.List of golang.org/x/net/publicsuffix, see v4.RegistrableDomain.
+func WithPublicSuffixList(list cookiejar.PublicSuffixList) Option {
+	return func(o *options) {
+		o.suffixes = list
+	}
+}
+
+// Open takes the path to the IP2Proxy BIN database file.
+func Open(path string, opts ...Option) (*DB, error) {
+	db, err := v4.OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return newDB(db, applyOptions(opts))
+}
+
+// OpenBytes takes the content of an IP2Proxy BIN database file already in memory. The slice is not copied
+// and must not be modified while the DB is in use.
+func OpenBytes(b []byte, opts ...Option) (*DB, error) {
+	o := applyOptions(opts)
+	open := v4.OpenDBFromBytes
+	if o.zeroCopy {
+		open = v4.OpenDBFromBytesZeroCopy
+	}
+	db, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	return newDB(db, o)
+}
+
+func applyOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func newDB(db *v4.DB, o options) (*DB, error) {
+	if o.ipv6Index {
+		if err := db.BuildIPv6Index(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	db.SetReadAhead(o.readAhead)
+
+	var d = &DB{}
+	d.db = db
+	d.src = db
+	d.suffixes = o.suffixes
+	var reload *v4.ReloadableDB
+	if o.reloadPath != "" {
+		reload = v4.NewReloadableDB(db)
+		d.src = reload
+	}
+	d.resolver = d.src
+	if o.cache != nil {
+		var cached *v4.CachedDB
+		if reload != nil {
+			cached = reload.Cached(o.cache, o.cacheTTL) // flushed on reload
+		} else {
+			cached = v4.NewCachedDB(db, o.cache, o.cacheTTL)
+		}
+		if o.negativeTTL > 0 {
+			cached.SetNegativeTTL(o.negativeTTL)
+		}
+		d.resolver = cached
+	}
+
+	if reload != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		d.stop = cancel
+		go reload.WatchFile(ctx, o.reloadPath, autoReloadInterval, o.onReload)
+	}
+	return d, nil
+}
+
+// Lookup returns the proxy record of the IP address.
+func (d *DB) Lookup(ctx context.Context, addr netip.Addr) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	if !addr.IsValid() {
+		return Record{}, ErrInvalidAddress
+	}
+
+	if len(d.src.ExtraColumns()) > 0 {
+		rec, extra, err := d.src.GetAllExtra(addr.String())
+		if err != nil {
+			return Record{}, err
+		}
+		r, err := d.fromV4(addr, rec)
+		r.ExtraFields = extra
+		return r, err
+	}
+
+	rec, err := d.resolver.GetAll(addr.String())
+	if err != nil {
+		return Record{}, err
+	}
+	return d.fromV4(addr, rec)
+}
+
+// convert with the registrable domain of WithPublicSuffixList
+func (d *DB) fromV4(addr netip.Addr, rec v4.IP2ProxyRecord) (Record, error) {
+	r, err := FromV4(addr, rec)
+	if err == nil && d.suffixes != nil {
+		r.RegistrableDomain = v4.RegistrableDomain(r.Domain, d.suffixes)
+	}
+	return r, err
+}
+
+// LookupString parses the IP address and returns its proxy record.
+func (d *DB) LookupString(ctx context.Context, ipAddress string) (Record, error) {
+	addr, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return Record{}, ErrInvalidAddress
+	}
+	return d.Lookup(ctx, addr)
+}
+
+// DatabaseVersion returns the version of the database, e.g. "2024.1.15".
+func (d *DB) DatabaseVersion() string {
+	return d.src.DatabaseVersion()
+}
+
+// Close closes the BIN file, and stops watching it with WithAutoReload.
+func (d *DB) Close() error {
+	if d.stop != nil {
+		d.stop()
+	}
+	return d.src.Close()
+}
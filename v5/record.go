@@ -0,0 +1,101 @@
+package ip2proxy
+
+import (
+	"net/netip"
+
+	v4 "github.com/ip2location/ip2proxy-go/v4"
+)
+
+// The ProxyStatus type tells whether an IP address is a proxy.
+type ProxyStatus int8
+
+const (
+	// NotProxy is an IP address not known as a proxy.
+	NotProxy ProxyStatus = 0
+	// Proxy is an anonymizing proxy of any type but DCH and SES.
+	Proxy ProxyStatus = 1
+	// DataCenter is a data center, web hosting (DCH) or search engine robot (SES) address.
+	DataCenter ProxyStatus = 2
+)
+
+// The ProxyType type is the type of a proxy, as found in the BIN files.
+type ProxyType string
+
+// The proxy types, see https://www.ip2location.com/database/ip2proxy for their definitions.
+const (
+	ProxyTypeNone        ProxyType = ""
+	ProxyTypeVPN         ProxyType = "VPN"
+	ProxyTypeTOR         ProxyType = "TOR"
+	ProxyTypeDataCenter  ProxyType = "DCH"
+	ProxyTypePublic      ProxyType = "PUB"
+	ProxyTypeWeb         ProxyType = "WEB"
+	ProxyTypeSearch      ProxyType = "SES"
+	ProxyTypeResidential ProxyType = "RES"
+	ProxyTypeConsumer    ProxyType = "CPN"
+	ProxyTypeEnterprise  ProxyType = "EPN"
+)
+
+// The UsageType type is the usage type of an IP address, e.g. COM or ISP/MOB, with its Description.
+type UsageType = v4.UsageType
+
+// The Field type is a set of record fields.
+type Field uint32
+
+// The record fields, which may be combined.
+const (
+	FieldCountry Field = 1 << iota
+	FieldRegion
+	FieldCity
+	FieldISP
+	FieldProxyType
+	FieldDomain
+	FieldUsageType
+	FieldASN
+	FieldAS
+	FieldLastSeen
+	FieldThreat
+	FieldProvider
+)
+
+// The Record struct holds the proxy data of an IP address. Values not applicable to the address,
+// written as "-" in the BIN files, are empty or zero; Fields tells which fields the database supports.
+type Record struct {
+	Addr        netip.Addr
+	IsProxy     ProxyStatus
+	ProxyType   ProxyType
+	CountryCode string
+	CountryName string
+	Region      string
+	City        string
+	ISP         string
+	Domain      string
+	UsageType   UsageType
+	ASN         uint32
+	AS          string
+	LastSeen    int // days since the proxy was last seen
+	Threat      string
+	Provider    string
+	Fields      Field
+
+	// RegistrableDomain is the registrable domain of Domain (eTLD+1), set with WithPublicSuffixList.
+	RegistrableDomain string
+
+	// ExtraFields holds the columns registered with v4.RegisterColumn which the database has, nil without any.
+	// The lookups of databases with such columns bypass the cache of WithCache.
+	ExtraFields map[string]string
+}
+
+// Country returns the ISO 3166 metadata of the country of the record; false without known country code.
+func (r Record) Country() (v4.CountryInfo, bool) {
+	return v4.LookupCountry(r.CountryCode)
+}
+
+// Threats returns the set of threats of the record, e.g. Threats().Has(v4.ThreatSpam).
+func (r Record) Threats() v4.ThreatSet {
+	return v4.ParseThreat(r.Threat)
+}
+
+// Has checks whether the database supports all the given fields.
+func (r Record) Has(fields Field) bool {
+	return r.Fields&fields == fields
+}